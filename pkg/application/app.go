@@ -3,95 +3,394 @@ package application
 import (
 	"context"
 	"fmt"
+	"net"
 	"net/http"
+	"sync"
 	"sync/atomic"
 	"time"
 
+	"google.golang.org/grpc"
+
 	"github.com/jcsw/go-api-learn/pkg/application/handlers"
+	"github.com/jcsw/go-api-learn/pkg/application/router"
+	"github.com/jcsw/go-api-learn/pkg/application/rpc"
 	"github.com/jcsw/go-api-learn/pkg/service"
 
 	"github.com/jcsw/go-api-learn/pkg/infra/cache"
 	"github.com/jcsw/go-api-learn/pkg/infra/cache/cachestore"
 	"github.com/jcsw/go-api-learn/pkg/infra/database"
 	"github.com/jcsw/go-api-learn/pkg/infra/database/repository"
+	"github.com/jcsw/go-api-learn/pkg/infra/events"
+	"github.com/jcsw/go-api-learn/pkg/infra/jobs"
 	"github.com/jcsw/go-api-learn/pkg/infra/logger"
+	"github.com/jcsw/go-api-learn/pkg/infra/metrics"
 	"github.com/jcsw/go-api-learn/pkg/infra/properties"
-)
-
-type key int
-
-const (
-	requestIDKey key = 0
+	"github.com/jcsw/go-api-learn/pkg/infra/webhook"
 )
 
 var healthy int32
 
+// initializeMongo the mongodb client is shared by the customers, the webhooks and the jobs
+var initializeMongo sync.Once
+
 // App define the app
 type App struct {
-	server    *http.Server
-	startDate time.Time
+	server     *http.Server
+	grpcServer *grpc.Server
+	startDate  time.Time
+	purgeJob   *service.CustomerPurgeJob
+	relay      *service.OutboxRelay
+	dispatcher *service.WebhookDispatcher
+	jobPool    *jobs.Pool
+	stopJobs   context.CancelFunc
 }
 
 // Initialize initialize the all components to app
 func (app *App) Initialize(env string) {
 	app.startDate = time.Now()
 
-	logger.Info("Initialize server by env [%s]", env)
+	logger.Info("Initialize server", logger.String("env", env))
 
 	properties.LoadProperties(env)
-	cache.InitializeLocalCache()
-	database.InitializeMongoClient()
+	if err := logger.Configure(properties.AppProperties.Log.Level, properties.AppProperties.Log.Format); err != nil {
+		logger.Fatal("Could not configure the logger", logger.Err(err))
+	}
 
-	router := http.NewServeMux()
-	router.HandleFunc("/health", health)
+	appRouter := router.New()
+	appRouter.HandleFunc("GET", "/health", health)
 
-	router.HandleFunc("/monitor", handlers.MonitorHandler)
+	appRouter.HandleFunc("GET", "/monitor", handlers.MonitorHandler)
+	appRouter.Handle("GET", "/metrics", metrics.Handler())
 
-	customerRepository := repository.Repository{MongoClient: database.RetrieveMongoClient()}
-	customerCacheStore := cachestore.CacheStore{}
+	customerRepository := createCustomerRepository()
+	customerCacheStore := createCustomerCacheStore()
+
+	stream := properties.AppProperties.Stream
+	customerStream := events.NewHub(stream.BufferSize, stream.MaxSubscribers)
 
-	customerAggregate := service.CustomerAggregate{Repository: &customerRepository, CacheStore: &customerCacheStore}
+	customerAggregate := service.CustomerAggregate{Repository: customerRepository, CacheStore: customerCacheStore, Notifier: customerStream}
 
-	customerHandler := handlers.CustomerHandler{CAggregate: &customerAggregate}
+	registerCustomerLookupMetrics(&customerAggregate)
+	registerCustomerStreamMetrics(customerStream)
 
-	router.HandleFunc("/customer", customerHandler.Register)
+	customerImport := properties.AppProperties.Import
+	customerImporter := service.CustomerImporter{Aggregate: &customerAggregate, BatchSize: customerImport.BatchSize, MaxSyncRows: customerImport.MaxSyncRows}
+
+	app.jobPool = createJobPool()
+
+	customerHandler := handlers.CustomerHandler{CAggregate: &customerAggregate, Importer: &customerImporter, Jobs: app.jobPool, Stream: customerStream, Heartbeat: stream.Heartbeat * time.Second}
+	customerHandler.RegisterRoutes(appRouter)
+	customerHandler.RegisterJobs()
+
+	app.grpcServer = rpc.NewServer(&rpc.CustomerServer{CAggregate: &customerAggregate, Stream: customerStream}, properties.AppProperties.Admin.Token)
+
+	if app.jobPool != nil {
+		jobHandler := handlers.JobHandler{Pool: app.jobPool}
+		jobHandler.RegisterRoutes(appRouter)
+	}
+
+	purge := properties.AppProperties.Purge
+	app.purgeJob = service.NewCustomerPurgeJob(&customerAggregate, purge.Retention*time.Hour, purge.Interval*time.Minute)
+
+	publisher := createEventPublisher(appRouter)
+	if webhookPublisher, ok := publisher.(*service.WebhookPublisher); ok {
+		app.dispatcher = createWebhookDispatcher(webhookPublisher.Repository)
+		registerWebhookDispatcherMetrics(app.dispatcher)
+	}
 
+	outbox := properties.AppProperties.Outbox
+	app.relay = &service.OutboxRelay{
+		Outbox:      customerRepository,
+		Publisher:   publisher,
+		Interval:    outbox.Interval * time.Millisecond,
+		BatchSize:   outbox.BatchSize,
+		MaxAttempts: outbox.MaxAttempts,
+		Backoff:     outbox.Backoff * time.Millisecond,
+	}
+	registerOutboxRelayMetrics(app.relay)
+
+	adminHandler := handlers.AdminHandler{PurgeJob: app.purgeJob, Token: properties.AppProperties.Admin.Token}
+	adminHandler.RegisterRoutes(appRouter)
+
+	// the write timeout is applied by route, the server one would close the streams and cut the imports,
+	// the headers must arrive fast but an import file may take a while to upload
 	app.server = &http.Server{
-		Addr:         fmt.Sprintf(":%d", properties.AppProperties.ServerPort),
-		Handler:      tracing()(logging()(router)),
-		ReadTimeout:  1 * time.Second,
-		WriteTimeout: 2 * time.Second,
-		IdleTimeout:  5 * time.Second,
+		Addr:              fmt.Sprintf(":%d", properties.AppProperties.ServerPort),
+		Handler:           tracing(properties.AppProperties.Admin.Token)(logging()(measuring(appRouter)(timeout(appRouter, 2*time.Second, handlers.CustomerStreamPath, handlers.CustomerImportPath, handlers.CustomerExportPath)(appRouter)))),
+		ReadHeaderTimeout: 1 * time.Second,
+		ReadTimeout:       60 * time.Second,
+		IdleTimeout:       5 * time.Second,
 	}
+
+	// the streams and the watches only end when their subscription is closed, Shutdown would wait for them otherwise
+	app.server.RegisterOnShutdown(customerStream.Close)
 }
 
 // Start initializes the application
 func (app *App) Start() {
-	logger.Info("Server is ready to handle requests at port %d, elapsed time to start was %v", properties.AppProperties.ServerPort, time.Since(app.startDate))
+	logger.Info("Server is ready to handle requests",
+		logger.Int("port", properties.AppProperties.ServerPort),
+		logger.Duration("elapsedTime", time.Since(app.startDate)))
+
+	jobsCtx, stopJobs := context.WithCancel(context.Background())
+	app.stopJobs = stopJobs
+	go app.purgeJob.Run(jobsCtx)
+	go app.relay.Run(jobsCtx)
+	if app.dispatcher != nil {
+		go app.dispatcher.Run(jobsCtx)
+	}
+	if app.jobPool != nil {
+		app.jobPool.Start(jobsCtx)
+	}
+
+	go app.serveGRPC()
 
 	atomic.StoreInt32(&healthy, 1)
 	if err := app.server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
-		logger.Fatal("Could not listen on port [%s]\n%v", properties.AppProperties.ServerPort, err)
+		logger.Fatal("Could not listen on port", logger.Int("port", properties.AppProperties.ServerPort), logger.Err(err))
 	}
 }
 
-// Stop stop the application
+// Stop stop the application, the servers first so the requests in progress finish before the jobs and the
+// storage clients they use are stopped
 func (app *App) Stop() {
 	logger.Info("Server is shutting down...")
 
 	atomic.StoreInt32(&healthy, 0)
 
-	database.CloseMongoClient()
-
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
 	app.server.SetKeepAlivesEnabled(false)
 	if err := app.server.Shutdown(ctx); err != nil {
-		logger.Fatal("Could not gracefully shutdown the server\n%v", err)
+		logger.Error("Could not gracefully shutdown the server, closing the remaining connections", logger.Err(err))
+		app.server.Close()
+	}
+
+	app.stopGRPC(5 * time.Second)
+
+	// the running jobs are given the drain timeout to finish, the ones cut off run again when their lease expires
+	if app.jobPool != nil {
+		drainCtx, cancelDrain := context.WithTimeout(context.Background(), properties.AppProperties.Jobs.DrainTimeout*time.Second)
+		app.jobPool.Stop(drainCtx)
+		cancelDrain()
+	}
+
+	if app.stopJobs != nil {
+		app.stopJobs()
+	}
+
+	database.CloseMongoClient()
+	database.CloseCassandraSession()
+	cache.CloseRedisPool()
+}
+
+// serveGRPC serve the CustomerService on the gRPC port until the server is stopped
+func (app *App) serveGRPC() {
+
+	listener, err := net.Listen("tcp", fmt.Sprintf(":%d", properties.AppProperties.GRPCPort))
+	if err != nil {
+		logger.Fatal("Could not listen on port", logger.Int("port", properties.AppProperties.GRPCPort), logger.Err(err))
+	}
+
+	logger.Info("gRPC server is ready to handle requests", logger.Int("port", properties.AppProperties.GRPCPort))
+	if err := app.grpcServer.Serve(listener); err != nil && err != grpc.ErrServerStopped {
+		logger.Fatal("Could not serve gRPC", logger.Int("port", properties.AppProperties.GRPCPort), logger.Err(err))
 	}
 }
 
+// stopGRPC wait the calls in progress to finish, the ones still running after the timeout, like the watches
+// that run until the client cancels, are cut off
+func (app *App) stopGRPC(timeout time.Duration) {
+
+	stopped := make(chan struct{})
+	go func() {
+		app.grpcServer.GracefulStop()
+		close(stopped)
+	}()
+
+	select {
+	case <-stopped:
+	case <-time.After(timeout):
+		app.grpcServer.Stop()
+	}
+}
+
+func createCustomerRepository() repository.CustomerRepository {
+
+	if properties.AppProperties.Storage.Backend == properties.StorageCassandra {
+		database.InitializeCassandraSession()
+		database.RegisterCassandraSessionMetrics()
+
+		customerRepository := repository.CassandraRepository{Session: database.RetrieveCassandraSession()}
+		if err := customerRepository.CreateSchema(context.Background()); err != nil {
+			logger.Error("Could not create the cassandra schema", logger.Err(err))
+		}
+
+		return &repository.InstrumentedRepository{Repository: &customerRepository, Backend: properties.StorageCassandra}
+	}
+
+	// the customers are written in the same transaction as their audit and their events, a standalone mongodb
+	// has no transactions and the changes would be lost
+	if properties.AppProperties.MongoDB.ReplicaSet == "" {
+		logger.Fatal("The mongodb storage requires a replica set, set mongodb.replicaSet")
+	}
+
+	initializeMongoClient()
+
+	customerRepository := repository.Repository{MongoClient: database.RetrieveMongoClient()}
+	if err := database.EnsureMongoIndexes(context.Background(), customerRepository.MongoClient, &customerRepository); err != nil {
+		logger.Error("Could not create the mongodb indexes", logger.Err(err))
+	}
+
+	return &repository.InstrumentedRepository{Repository: &customerRepository, Backend: properties.StorageMongoDB}
+}
+
+func createCustomerCacheStore() cachestore.CustomerCacheStore {
+
+	switch properties.AppProperties.Cache.Backend {
+	case properties.CacheRedis:
+		cache.InitializeRedisPool()
+		cache.RegisterRedisMetrics()
+		return &cachestore.RedisCacheStore{}
+	case properties.CacheTwoTier:
+		cache.InitializeLocalCache()
+		cache.RegisterLocalCacheMetrics()
+		cache.InitializeRedisPool()
+		cache.RegisterRedisMetrics()
+		return cachestore.NewTwoTierCacheStore(cache.DefaultLocalCache())
+	default:
+		cache.InitializeLocalCache()
+		cache.RegisterLocalCacheMetrics()
+		return &cachestore.CacheStore{}
+	}
+}
+
+func registerCustomerLookupMetrics(customerAggregate *service.CustomerAggregate) {
+	metrics.Register(
+		metrics.CounterFunc("customer_lookup_database_calls_total", "Number of lookups by name that queried the database.", func() float64 {
+			return float64(customerAggregate.LookupStats().DatabaseCalls)
+		}),
+		metrics.CounterFunc("customer_lookup_saved_calls_total", "Number of lookups by name answered without querying the database.", func() float64 {
+			return float64(customerAggregate.LookupStats().SavedCalls)
+		}))
+}
+
+func registerCustomerStreamMetrics(customerStream *events.Hub) {
+	metrics.Register(
+		metrics.GaugeFunc("customer_stream_subscribers", "Number of clients streaming the customer changes.", func() float64 {
+			return float64(customerStream.Subscribers())
+		}))
+}
+
+// createEventPublisher create the publisher of the outbox, the webhook publisher also registers the routes of "/webhooks"
+func createEventPublisher(appRouter *router.Router) events.EventPublisher {
+
+	switch publisher := properties.AppProperties.Outbox.Publisher; publisher {
+	case "", properties.PublisherLog:
+		return &events.LogPublisher{}
+	case properties.PublisherWebhook:
+		webhookRepository := createWebhookRepository()
+
+		webhookHandler := handlers.WebhookHandler{
+			WAggregate: &service.WebhookAggregate{Repository: webhookRepository},
+			Token:      properties.AppProperties.Admin.Token,
+		}
+		webhookHandler.RegisterRoutes(appRouter)
+
+		return &service.WebhookPublisher{Repository: webhookRepository}
+	default:
+		logger.Fatal("Unknown event publisher", logger.String("publisher", publisher))
+		return nil
+	}
+}
+
+// createWebhookRepository create the repository of the webhooks, it's always in mongodb
+func createWebhookRepository() repository.WebhookRepository {
+
+	initializeMongoClient()
+
+	webhookRepository := repository.MongoWebhookRepository{MongoClient: database.RetrieveMongoClient()}
+	if err := database.EnsureMongoIndexes(context.Background(), webhookRepository.MongoClient, &webhookRepository); err != nil {
+		logger.Error("Could not create the mongodb indexes", logger.Err(err))
+	}
+
+	return &repository.InstrumentedWebhookRepository{Repository: &webhookRepository, Backend: properties.StorageMongoDB}
+}
+
+// createJobPool create the pool of workers running the jobs, they're stored in mongodb so there is none when the
+// customers are stored in another backend, the imports are then all done during the request
+func createJobPool() *jobs.Pool {
+
+	if properties.AppProperties.Storage.Backend == properties.StorageCassandra {
+		return nil
+	}
+
+	initializeMongoClient()
+
+	jobRepository := repository.MongoJobRepository{MongoClient: database.RetrieveMongoClient()}
+	if err := database.EnsureMongoIndexes(context.Background(), jobRepository.MongoClient, &jobRepository); err != nil {
+		logger.Error("Could not create the mongodb indexes", logger.Err(err))
+	}
+
+	jobsProperties := properties.AppProperties.Jobs
+	return &jobs.Pool{
+		Repository:    &repository.InstrumentedJobRepository{Repository: &jobRepository, Backend: properties.StorageMongoDB},
+		Workers:       jobsProperties.Workers,
+		PollInterval:  jobsProperties.PollInterval * time.Millisecond,
+		MaxAttempts:   jobsProperties.MaxAttempts,
+		LeaseDuration: jobsProperties.LeaseDuration * time.Second,
+	}
+}
+
+func initializeMongoClient() {
+	initializeMongo.Do(func() {
+		database.InitializeMongoClient()
+		database.RegisterMongoClientMetrics()
+	})
+}
+
+func createWebhookDispatcher(webhookRepository repository.WebhookRepository) *service.WebhookDispatcher {
+
+	webhookProperties := properties.AppProperties.Webhook
+	return &service.WebhookDispatcher{
+		Repository:  webhookRepository,
+		Sender:      &webhook.Sender{Client: &http.Client{Timeout: webhookProperties.Timeout * time.Millisecond}},
+		Interval:    webhookProperties.Interval * time.Millisecond,
+		BatchSize:   webhookProperties.BatchSize,
+		MaxAttempts: webhookProperties.MaxAttempts,
+		Backoff:     webhookProperties.Backoff * time.Millisecond,
+		Workers:     webhookProperties.Workers,
+		Lease:       2 * webhookProperties.Timeout * time.Millisecond,
+	}
+}
+
+func registerWebhookDispatcherMetrics(dispatcher *service.WebhookDispatcher) {
+	metrics.Register(
+		metrics.CounterFunc("webhook_deliveries_delivered_total", "Number of events delivered to the webhooks.", func() float64 {
+			return float64(dispatcher.Stats().Delivered)
+		}),
+		metrics.CounterFunc("webhook_deliveries_retried_total", "Number of failed deliveries to the webhooks that will be retried.", func() float64 {
+			return float64(dispatcher.Stats().Retried)
+		}),
+		metrics.CounterFunc("webhook_deliveries_failed_total", "Number of deliveries to the webhooks that failed every attempt.", func() float64 {
+			return float64(dispatcher.Stats().Failed)
+		}))
+}
+
+func registerOutboxRelayMetrics(relay *service.OutboxRelay) {
+	metrics.Register(
+		metrics.CounterFunc("outbox_events_published_total", "Number of customer events published.", func() float64 {
+			return float64(relay.Stats().Published)
+		}),
+		metrics.CounterFunc("outbox_events_retried_total", "Number of failed publications of customer events that will be retried.", func() float64 {
+			return float64(relay.Stats().Retried)
+		}),
+		metrics.CounterFunc("outbox_events_dead_lettered_total", "Number of customer events moved to the dead letter store.", func() float64 {
+			return float64(relay.Stats().DeadLettered)
+		}))
+}
+
 func health(w http.ResponseWriter, r *http.Request) {
 	if atomic.LoadInt32(&healthy) == 1 {
 		w.WriteHeader(http.StatusNoContent)
@@ -105,23 +404,83 @@ func logging() func(http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			start := time.Now()
 			next.ServeHTTP(w, r)
-			requestID, ok := r.Context().Value(requestIDKey).(string)
-			if !ok {
-				requestID = "unknown"
+			logger.FromContext(r.Context()).Info("Request handled",
+				logger.String("method", r.Method),
+				logger.String("path", r.URL.Path),
+				logger.String("remoteAddr", r.RemoteAddr),
+				logger.Duration("elapsedTime", time.Since(start)))
+		})
+	}
+}
+
+// statusRecorder keep the status code written by the handler
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (recorder *statusRecorder) WriteHeader(status int) {
+	recorder.status = status
+	recorder.ResponseWriter.WriteHeader(status)
+}
+
+// Flush send the buffered response to the client, the streams flush every event
+func (recorder *statusRecorder) Flush() {
+	if flusher, ok := recorder.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+func measuring(appRouter *router.Router) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			start := time.Now()
+			recorder := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+			next.ServeHTTP(recorder, r)
+
+			route := appRouter.Pattern(r)
+			if route == "" {
+				route = "unmatched"
 			}
-			logger.Info("requestID=%s, method=%s path=%s remoteAddr=%s elapsedTime=%v",
-				requestID, r.Method, r.URL.Path, r.RemoteAddr, time.Since(start))
+			metrics.ObserveHTTPRequest(route, r.Method, recorder.status, time.Since(start))
 		})
 	}
 }
-func tracing() func(http.Handler) http.Handler {
+
+// timeout answer 503 when the route takes longer than the timeout to respond, except the long running routes,
+// like the streams that respond until the client disconnects
+func timeout(appRouter *router.Router, timeout time.Duration, longRunningRoutes ...string) func(http.Handler) http.Handler {
+
+	exempt := map[string]bool{}
+	for _, route := range longRunningRoutes {
+		exempt[route] = true
+	}
+
+	return func(next http.Handler) http.Handler {
+		limited := http.TimeoutHandler(next, timeout, "Request timed out")
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if exempt[appRouter.Pattern(r)] {
+				next.ServeHTTP(w, r)
+				return
+			}
+			limited.ServeHTTP(w, r)
+		})
+	}
+}
+
+// tracing carry the request id and the actor of the request in its context. The X-Actor header is asserted by the
+// client, it's trusted only from the requests carrying the admin token, the changes of the others are audited as anonymous
+func tracing(adminToken string) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			requestID := r.Header.Get("X-Request-Id")
 			if requestID == "" {
 				requestID = newRequestID()
 			}
-			ctx := context.WithValue(r.Context(), requestIDKey, requestID)
+			ctx := logger.WithRequestID(r.Context(), requestID)
+			if actor := r.Header.Get("X-Actor"); actor != "" && handlers.HasBearerToken(r.Header.Get("Authorization"), adminToken) {
+				ctx = logger.WithActor(ctx, actor)
+			}
 			w.Header().Set("X-Request-Id", requestID)
 			next.ServeHTTP(w, r.WithContext(ctx))
 		})
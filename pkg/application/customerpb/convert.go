@@ -0,0 +1,110 @@
+package customerpb
+
+import (
+	"time"
+
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"github.com/jcsw/go-api-learn/pkg/domain"
+)
+
+// FromDomain create the message of the customer
+func FromDomain(customer *domain.Customer) *Customer {
+
+	message := &Customer{
+		Id:        customer.ID,
+		Name:      customer.Name,
+		City:      customer.City,
+		Email:     customer.Email,
+		Phone:     customer.Phone,
+		Document:  customer.Document,
+		Status:    string(customer.Status),
+		CreatedAt: fromTime(customer.CreatedAt),
+		UpdatedAt: fromTime(customer.UpdatedAt),
+		Version:   customer.Version,
+	}
+
+	for _, address := range customer.Addresses {
+		message.Addresses = append(message.Addresses, &Address{
+			Type:       string(address.Type),
+			Street:     address.Street,
+			Number:     address.Number,
+			Complement: address.Complement,
+			District:   address.District,
+			City:       address.City,
+			State:      address.State,
+			PostalCode: address.PostalCode,
+			Country:    address.Country,
+		})
+	}
+
+	return message
+}
+
+// ToDomain create the customer of the message
+func (message *Customer) ToDomain() *domain.Customer {
+
+	customer := &domain.Customer{
+		ID:        message.GetId(),
+		Name:      message.GetName(),
+		City:      message.GetCity(),
+		Email:     message.GetEmail(),
+		Phone:     message.GetPhone(),
+		Document:  message.GetDocument(),
+		Status:    domain.CustomerStatus(message.GetStatus()),
+		CreatedAt: toTime(message.GetCreatedAt()),
+		UpdatedAt: toTime(message.GetUpdatedAt()),
+		Version:   message.GetVersion(),
+	}
+
+	for _, address := range message.GetAddresses() {
+		customer.Addresses = append(customer.Addresses, domain.Address{
+			Type:       domain.AddressType(address.GetType()),
+			Street:     address.GetStreet(),
+			Number:     address.GetNumber(),
+			Complement: address.GetComplement(),
+			District:   address.GetDistrict(),
+			City:       address.GetCity(),
+			State:      address.GetState(),
+			PostalCode: address.GetPostalCode(),
+			Country:    address.GetCountry(),
+		})
+	}
+
+	return customer
+}
+
+// fromTime the timestamp of the time, nil when it's not set
+func fromTime(t time.Time) *timestamppb.Timestamp {
+	if t.IsZero() {
+		return nil
+	}
+	return timestamppb.New(t)
+}
+
+func toTime(timestamp *timestamppb.Timestamp) time.Time {
+	if timestamp == nil {
+		return time.Time{}
+	}
+	return timestamp.AsTime()
+}
+
+// FromEvent create the message of the customer event
+func FromEvent(event *domain.CustomerEvent) *CustomerEvent {
+
+	message := &CustomerEvent{
+		Id:         event.ID,
+		Type:       string(event.Type),
+		CustomerId: event.CustomerID,
+		Version:    event.Version,
+		OccurredAt: fromTime(event.OccurredAt),
+		Actor:      event.Actor,
+		RequestId:  event.RequestID,
+	}
+
+	if event.Customer != nil {
+		message.Customer = FromDomain(event.Customer)
+	}
+
+	return message
+}
@@ -0,0 +1,274 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+
+package customerpb
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.32.0 or later.
+const _ = grpc.SupportPackageIsVersion7
+
+// CustomerServiceClient is the client API for CustomerService service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type CustomerServiceClient interface {
+	// Create create a new customer, the id, the status, the dates and the version of the request are ignored
+	Create(ctx context.Context, in *CreateCustomerRequest, opts ...grpc.CallOption) (*Customer, error)
+	// Get find the customer by id, NOT_FOUND when it does not exist or is deleted
+	Get(ctx context.Context, in *GetCustomerRequest, opts ...grpc.CallOption) (*Customer, error)
+	// List send every customer matching the request, a page at a time
+	List(ctx context.Context, in *ListCustomersRequest, opts ...grpc.CallOption) (CustomerService_ListClient, error)
+	// Watch send the changes of the customers until the client cancels, from the one after last_event_id when
+	// it's still buffered
+	Watch(ctx context.Context, in *WatchCustomersRequest, opts ...grpc.CallOption) (CustomerService_WatchClient, error)
+}
+
+type customerServiceClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewCustomerServiceClient(cc grpc.ClientConnInterface) CustomerServiceClient {
+	return &customerServiceClient{cc}
+}
+
+func (c *customerServiceClient) Create(ctx context.Context, in *CreateCustomerRequest, opts ...grpc.CallOption) (*Customer, error) {
+	out := new(Customer)
+	err := c.cc.Invoke(ctx, "/customer.v1.CustomerService/Create", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *customerServiceClient) Get(ctx context.Context, in *GetCustomerRequest, opts ...grpc.CallOption) (*Customer, error) {
+	out := new(Customer)
+	err := c.cc.Invoke(ctx, "/customer.v1.CustomerService/Get", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *customerServiceClient) List(ctx context.Context, in *ListCustomersRequest, opts ...grpc.CallOption) (CustomerService_ListClient, error) {
+	stream, err := c.cc.NewStream(ctx, &CustomerService_ServiceDesc.Streams[0], "/customer.v1.CustomerService/List", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &customerServiceListClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type CustomerService_ListClient interface {
+	Recv() (*Customer, error)
+	grpc.ClientStream
+}
+
+type customerServiceListClient struct {
+	grpc.ClientStream
+}
+
+func (x *customerServiceListClient) Recv() (*Customer, error) {
+	m := new(Customer)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *customerServiceClient) Watch(ctx context.Context, in *WatchCustomersRequest, opts ...grpc.CallOption) (CustomerService_WatchClient, error) {
+	stream, err := c.cc.NewStream(ctx, &CustomerService_ServiceDesc.Streams[1], "/customer.v1.CustomerService/Watch", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &customerServiceWatchClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type CustomerService_WatchClient interface {
+	Recv() (*CustomerEvent, error)
+	grpc.ClientStream
+}
+
+type customerServiceWatchClient struct {
+	grpc.ClientStream
+}
+
+func (x *customerServiceWatchClient) Recv() (*CustomerEvent, error) {
+	m := new(CustomerEvent)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// CustomerServiceServer is the server API for CustomerService service.
+// All implementations must embed UnimplementedCustomerServiceServer
+// for forward compatibility
+type CustomerServiceServer interface {
+	// Create create a new customer, the id, the status, the dates and the version of the request are ignored
+	Create(context.Context, *CreateCustomerRequest) (*Customer, error)
+	// Get find the customer by id, NOT_FOUND when it does not exist or is deleted
+	Get(context.Context, *GetCustomerRequest) (*Customer, error)
+	// List send every customer matching the request, a page at a time
+	List(*ListCustomersRequest, CustomerService_ListServer) error
+	// Watch send the changes of the customers until the client cancels, from the one after last_event_id when
+	// it's still buffered
+	Watch(*WatchCustomersRequest, CustomerService_WatchServer) error
+	mustEmbedUnimplementedCustomerServiceServer()
+}
+
+// UnimplementedCustomerServiceServer must be embedded to have forward compatible implementations.
+type UnimplementedCustomerServiceServer struct {
+}
+
+func (UnimplementedCustomerServiceServer) Create(context.Context, *CreateCustomerRequest) (*Customer, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Create not implemented")
+}
+func (UnimplementedCustomerServiceServer) Get(context.Context, *GetCustomerRequest) (*Customer, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Get not implemented")
+}
+func (UnimplementedCustomerServiceServer) List(*ListCustomersRequest, CustomerService_ListServer) error {
+	return status.Errorf(codes.Unimplemented, "method List not implemented")
+}
+func (UnimplementedCustomerServiceServer) Watch(*WatchCustomersRequest, CustomerService_WatchServer) error {
+	return status.Errorf(codes.Unimplemented, "method Watch not implemented")
+}
+func (UnimplementedCustomerServiceServer) mustEmbedUnimplementedCustomerServiceServer() {}
+
+// UnsafeCustomerServiceServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to CustomerServiceServer will
+// result in compilation errors.
+type UnsafeCustomerServiceServer interface {
+	mustEmbedUnimplementedCustomerServiceServer()
+}
+
+func RegisterCustomerServiceServer(s grpc.ServiceRegistrar, srv CustomerServiceServer) {
+	s.RegisterService(&CustomerService_ServiceDesc, srv)
+}
+
+func _CustomerService_Create_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(CreateCustomerRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(CustomerServiceServer).Create(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/customer.v1.CustomerService/Create",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(CustomerServiceServer).Create(ctx, req.(*CreateCustomerRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _CustomerService_Get_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetCustomerRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(CustomerServiceServer).Get(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/customer.v1.CustomerService/Get",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(CustomerServiceServer).Get(ctx, req.(*GetCustomerRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _CustomerService_List_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(ListCustomersRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(CustomerServiceServer).List(m, &customerServiceListServer{stream})
+}
+
+type CustomerService_ListServer interface {
+	Send(*Customer) error
+	grpc.ServerStream
+}
+
+type customerServiceListServer struct {
+	grpc.ServerStream
+}
+
+func (x *customerServiceListServer) Send(m *Customer) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func _CustomerService_Watch_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(WatchCustomersRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(CustomerServiceServer).Watch(m, &customerServiceWatchServer{stream})
+}
+
+type CustomerService_WatchServer interface {
+	Send(*CustomerEvent) error
+	grpc.ServerStream
+}
+
+type customerServiceWatchServer struct {
+	grpc.ServerStream
+}
+
+func (x *customerServiceWatchServer) Send(m *CustomerEvent) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+// CustomerService_ServiceDesc is the grpc.ServiceDesc for CustomerService service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var CustomerService_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "customer.v1.CustomerService",
+	HandlerType: (*CustomerServiceServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "Create",
+			Handler:    _CustomerService_Create_Handler,
+		},
+		{
+			MethodName: "Get",
+			Handler:    _CustomerService_Get_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "List",
+			Handler:       _CustomerService_List_Handler,
+			ServerStreams: true,
+		},
+		{
+			StreamName:    "Watch",
+			Handler:       _CustomerService_Watch_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "customer_service.proto",
+}
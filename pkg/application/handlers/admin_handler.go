@@ -0,0 +1,27 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/jcsw/go-api-learn/pkg/application/router"
+	"github.com/jcsw/go-api-learn/pkg/service"
+)
+
+// AdminHandler handler to "/admin", every route requires the admin token
+type AdminHandler struct {
+	PurgeJob *service.CustomerPurgeJob
+	Token    string
+}
+
+const customerPurgePath = "/admin/customer/purge"
+
+// RegisterRoutes register the routes of "/admin/customer/purge"
+func (ah *AdminHandler) RegisterRoutes(adminRouter *router.Router) {
+	adminRouter.HandleFunc("POST", customerPurgePath, ah.purgeCustomers, requireToken(ah.Token))
+}
+
+// purgeCustomers trigger the purge of the deleted customers, it runs in background
+func (ah *AdminHandler) purgeCustomers(w http.ResponseWriter, r *http.Request) {
+	ah.PurgeJob.Trigger()
+	respondWithCode(w, http.StatusAccepted)
+}
@@ -0,0 +1,79 @@
+package handlers_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+
+	"github.com/jcsw/go-api-learn/pkg/application/handlers"
+	"github.com/jcsw/go-api-learn/pkg/application/router"
+	"github.com/jcsw/go-api-learn/pkg/infra/database/repository"
+	"github.com/jcsw/go-api-learn/pkg/service"
+)
+
+func TestAdminHandler(t *testing.T) {
+	assert := assert.New(t)
+
+	tests := []struct {
+		description        string
+		token              string
+		authorization      string
+		expectedStatusCode int
+		expectedBody       string
+	}{
+		{
+			description:        "should return 202 when the token is valid",
+			token:              "admin-token",
+			authorization:      "Bearer admin-token",
+			expectedStatusCode: 202,
+			expectedBody:       `^$`,
+		},
+		{
+			description:        "should return 401 when the token is missing",
+			token:              "admin-token",
+			expectedStatusCode: 401,
+			expectedBody:       `"status":401,.*"code":"unauthorized"`,
+		},
+		{
+			description:        "should return 401 when the token is wrong",
+			token:              "admin-token",
+			authorization:      "Bearer other-token",
+			expectedStatusCode: 401,
+			expectedBody:       `"status":401,.*"code":"unauthorized"`,
+		},
+		{
+			description:        "should return 403 when no token is configured",
+			authorization:      "Bearer ",
+			expectedStatusCode: 403,
+			expectedBody:       `"status":403,.*"code":"forbidden"`,
+		},
+	}
+
+	for _, tc := range tests {
+
+		req, err := http.NewRequest("POST", "/admin/customer/purge", nil)
+		assert.NoError(err)
+
+		if tc.authorization != "" {
+			req.Header.Set("Authorization", tc.authorization)
+		}
+
+		resp := httptest.NewRecorder()
+
+		repositoryMock := &repository.CustomerRepositoryMock{}
+		repositoryMock.On("PurgeCustomers", mock.Anything, mock.Anything).Return(int64(0), nil)
+		purgeJob := service.NewCustomerPurgeJob(&service.CustomerAggregate{Repository: repositoryMock}, 0, 0)
+
+		adminHandler := handlers.AdminHandler{PurgeJob: purgeJob, Token: tc.token}
+
+		adminRouter := router.New()
+		adminHandler.RegisterRoutes(adminRouter)
+		adminRouter.ServeHTTP(resp, req)
+
+		assert.Equal(tc.expectedStatusCode, resp.Code, tc.description)
+		assert.Regexp(tc.expectedBody, resp.Body.String(), tc.description)
+	}
+}
@@ -0,0 +1,218 @@
+package handlers
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"io"
+	"io/ioutil"
+
+	"github.com/vmihailenco/msgpack/v5"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/jcsw/go-api-learn/pkg/application/customerpb"
+	"github.com/jcsw/go-api-learn/pkg/application/problem"
+	"github.com/jcsw/go-api-learn/pkg/domain"
+)
+
+// errUnsupportedPayload Error for a payload a codec can not encode or decode
+var errUnsupportedPayload = errors.New("payload not supported by the codec")
+
+// Codec encode and decode the payloads of the negotiated routes in a media type, the customers, the pages
+// of customers and the problems
+type Codec interface {
+	problem.Encoder
+
+	// ContentType the media type of the payloads, with its parameters
+	ContentType() string
+
+	Encode(w io.Writer, payload interface{}) error
+	Decode(r io.Reader, payload interface{}) error
+}
+
+// JSONCodec the payloads in JSON, the codec of the routes that are not negotiated
+type JSONCodec struct{}
+
+// ContentType application/json
+func (JSONCodec) ContentType() string { return "application/json; charset=UTF-8" }
+
+// ProblemMediaType application/problem+json
+func (JSONCodec) ProblemMediaType() string { return problem.ContentType }
+
+// Encode write the payload in JSON
+func (JSONCodec) Encode(w io.Writer, payload interface{}) error {
+	response, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(response)
+	return err
+}
+
+// Decode read the payload from JSON
+func (JSONCodec) Decode(r io.Reader, payload interface{}) error {
+	return json.NewDecoder(r).Decode(payload)
+}
+
+// EncodeProblem write the problem in JSON
+func (codec JSONCodec) EncodeProblem(w io.Writer, problem *problem.Problem) error {
+	return codec.Encode(w, problem)
+}
+
+// XMLCodec the payloads in XML, the customers and the pages of customers are written with the elements
+// of customer_xml.go, named like the fields in JSON
+type XMLCodec struct{}
+
+// ContentType application/xml
+func (XMLCodec) ContentType() string { return "application/xml; charset=UTF-8" }
+
+// ProblemMediaType application/problem+xml
+func (XMLCodec) ProblemMediaType() string { return "application/problem+xml" }
+
+// Encode write the payload in XML, after the XML declaration
+func (XMLCodec) Encode(w io.Writer, payload interface{}) error {
+
+	switch typed := payload.(type) {
+	case *domain.Customer:
+		payload = newXMLCustomer(typed)
+	case *customerPageResponse:
+		payload = newXMLCustomerPage(typed)
+	}
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	return xml.NewEncoder(w).Encode(payload)
+}
+
+// Decode read the payload from XML
+func (XMLCodec) Decode(r io.Reader, payload interface{}) error {
+
+	customer, ok := payload.(*domain.Customer)
+	if !ok {
+		return xml.NewDecoder(r).Decode(payload)
+	}
+
+	element := &xmlCustomer{}
+	if err := xml.NewDecoder(r).Decode(element); err != nil {
+		return err
+	}
+
+	*customer = *element.toDomain()
+	return nil
+}
+
+// EncodeProblem write the problem in XML (RFC 7807)
+func (codec XMLCodec) EncodeProblem(w io.Writer, problem *problem.Problem) error {
+	return codec.Encode(w, problem)
+}
+
+// MessagePackCodec the payloads in MessagePack, the keys are named like the fields in JSON
+type MessagePackCodec struct{}
+
+// ContentType application/msgpack
+func (MessagePackCodec) ContentType() string { return "application/msgpack" }
+
+// ProblemMediaType application/msgpack, there is no media type for the problems in MessagePack
+func (codec MessagePackCodec) ProblemMediaType() string { return codec.ContentType() }
+
+// Encode write the payload in MessagePack
+func (MessagePackCodec) Encode(w io.Writer, payload interface{}) error {
+	encoder := msgpack.NewEncoder(w)
+	encoder.SetCustomStructTag("json")
+	return encoder.Encode(payload)
+}
+
+// Decode read the payload from MessagePack
+func (MessagePackCodec) Decode(r io.Reader, payload interface{}) error {
+	decoder := msgpack.NewDecoder(r)
+	decoder.SetCustomStructTag("json")
+	return decoder.Decode(payload)
+}
+
+// EncodeProblem write the problem in MessagePack
+func (codec MessagePackCodec) EncodeProblem(w io.Writer, problem *problem.Problem) error {
+	return codec.Encode(w, problem)
+}
+
+// ProtobufCodec the payloads in Protobuf, with the messages of customerpb
+type ProtobufCodec struct{}
+
+// ContentType application/x-protobuf
+func (ProtobufCodec) ContentType() string { return "application/x-protobuf" }
+
+// ProblemMediaType application/x-protobuf, the problem is a customer.v1.Problem
+func (codec ProtobufCodec) ProblemMediaType() string { return codec.ContentType() }
+
+// Encode write the customer or the page of customers in Protobuf
+func (ProtobufCodec) Encode(w io.Writer, payload interface{}) error {
+
+	var message proto.Message
+	switch payload := payload.(type) {
+	case *domain.Customer:
+		message = customerpb.FromDomain(payload)
+	case *customerPageResponse:
+		page := &customerpb.CustomerPage{Next: payload.Next}
+		for _, customer := range payload.Data {
+			page.Data = append(page.Data, customerpb.FromDomain(customer))
+		}
+		message = page
+	case *problem.Problem:
+		message = fromProblem(payload)
+	default:
+		return errUnsupportedPayload
+	}
+
+	response, err := proto.Marshal(message)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(response)
+	return err
+}
+
+// Decode read the customer from Protobuf
+func (ProtobufCodec) Decode(r io.Reader, payload interface{}) error {
+
+	customer, ok := payload.(*domain.Customer)
+	if !ok {
+		return errUnsupportedPayload
+	}
+
+	request, err := ioutil.ReadAll(r)
+	if err != nil {
+		return err
+	}
+
+	message := &customerpb.Customer{}
+	if err := proto.Unmarshal(request, message); err != nil {
+		return err
+	}
+
+	*customer = *message.ToDomain()
+	return nil
+}
+
+// EncodeProblem write the problem in Protobuf
+func (codec ProtobufCodec) EncodeProblem(w io.Writer, problem *problem.Problem) error {
+	return codec.Encode(w, problem)
+}
+
+func fromProblem(problem *problem.Problem) *customerpb.Problem {
+
+	message := &customerpb.Problem{
+		Type:      problem.Type,
+		Title:     problem.Title,
+		Status:    int32(problem.Status),
+		Detail:    problem.Detail,
+		Instance:  problem.Instance,
+		Code:      problem.Code,
+		RequestId: problem.RequestID,
+	}
+
+	for _, param := range problem.InvalidParams {
+		message.InvalidParams = append(message.InvalidParams, &customerpb.InvalidParam{Name: param.Name, Code: param.Code, Reason: param.Reason})
+	}
+
+	return message
+}
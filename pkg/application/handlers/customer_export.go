@@ -0,0 +1,108 @@
+package handlers
+
+import (
+	"io"
+	"net/http"
+
+	"github.com/jcsw/go-api-learn/pkg/application/problem"
+	"github.com/jcsw/go-api-learn/pkg/domain"
+	"github.com/jcsw/go-api-learn/pkg/infra/logger"
+	"github.com/jcsw/go-api-learn/pkg/service"
+)
+
+const (
+	// CustomerExportPath the route of the export of customers, it's exempt from the write timeout
+	CustomerExportPath = "/customer/export"
+
+	// exportChunkSize the customers written between two flushes of the response
+	exportChunkSize = 100
+)
+
+// exportFile the media type and the file name of an export format
+type exportFile struct {
+	contentType string
+	fileName    string
+}
+
+// exportFiles the file of each export format
+var exportFiles = map[string]exportFile{
+	service.ExportCSV:    {contentType: "text/csv; charset=utf-8", fileName: "customers.csv"},
+	service.ExportExcel:  {contentType: "text/csv; charset=utf-8", fileName: "customers.csv"},
+	service.ExportNDJSON: {contentType: "application/x-ndjson", fileName: "customers.ndjson"},
+}
+
+// exportCustomers stream the customers matching the filters of the listing as a file, CSV when no format is informed.
+// The response is flushed every exportChunkSize customers, a failure after the first write can only cut it short
+func (ch *CustomerHandler) exportCustomers(w http.ResponseWriter, r *http.Request) {
+
+	params := r.URL.Query()
+
+	format := params.Get("format")
+	if format == "" {
+		format = service.ExportCSV
+	}
+
+	file, ok := exportFiles[format]
+	if !ok {
+		problem.RespondWithError(w, r, service.ErrUnsupportedExportFormat)
+		return
+	}
+
+	query := service.CustomerQuery{
+		City:  params.Get("city"),
+		Sort:  params.Get("sort"),
+		After: params.Get("after"),
+	}
+
+	// while the encoder is only buffering the headers can still be replaced by a problem
+	body := &bodyWriter{writer: w}
+	encoder, _ := service.NewCustomerEncoder(format, body)
+	flusher, _ := w.(http.Flusher)
+
+	w.Header().Set("Content-Type", file.contentType)
+	w.Header().Set("Content-Disposition", `attachment; filename="`+file.fileName+`"`)
+
+	exported := 0
+	err := ch.CAggregate.ExportCustomers(r.Context(), query, func(customer *domain.Customer) error {
+		if err := encoder.Encode(customer); err != nil {
+			return err
+		}
+
+		exported++
+		if exported%exportChunkSize != 0 {
+			return nil
+		}
+
+		if err := encoder.Flush(); err != nil {
+			return err
+		}
+		if flusher != nil {
+			flusher.Flush()
+		}
+		return nil
+	})
+
+	if err != nil && !body.written {
+		w.Header().Del("Content-Disposition")
+		problem.RespondWithError(w, r, err)
+		return
+	}
+
+	if err != nil {
+		logger.FromContext(r.Context()).Error("export cut short", logger.Int("exported", exported), logger.Err(err))
+		return
+	}
+
+	encoder.Flush()
+}
+
+// bodyWriter report whether anything was written to the response body
+type bodyWriter struct {
+	writer  io.Writer
+	written bool
+}
+
+func (body *bodyWriter) Write(p []byte) (int, error) {
+	body.written = true
+	return body.writer.Write(p)
+}
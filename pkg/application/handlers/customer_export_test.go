@@ -0,0 +1,92 @@
+package handlers_test
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/mongodb/mongo-go-driver/bson/objectid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+
+	"github.com/jcsw/go-api-learn/pkg/application/handlers"
+	"github.com/jcsw/go-api-learn/pkg/application/router"
+	"github.com/jcsw/go-api-learn/pkg/infra/database/repository"
+	"github.com/jcsw/go-api-learn/pkg/service"
+)
+
+func getExport(repositoryMock *repository.CustomerRepositoryMock, url string) *httptest.ResponseRecorder {
+
+	customerHandler := handlers.CustomerHandler{CAggregate: &service.CustomerAggregate{Repository: repositoryMock}}
+
+	customerRouter := router.New()
+	customerHandler.RegisterRoutes(customerRouter)
+
+	req, _ := http.NewRequest("GET", url, nil)
+	response := httptest.NewRecorder()
+	customerRouter.ServeHTTP(response, req)
+	return response
+}
+
+func newExportedCustomers(n int) []*repository.CustomerEntity {
+
+	customersEntity := make([]*repository.CustomerEntity, n)
+	for i := range customersEntity {
+		customersEntity[i] = &repository.CustomerEntity{ID: objectid.New(), Name: fmt.Sprintf("Customer %d", i), City: "Limeira", Status: "active", Version: 1}
+	}
+
+	return customersEntity
+}
+
+func TestShouldExportCustomersInCSVByDefault(t *testing.T) {
+
+	repositoryMock := &repository.CustomerRepositoryMock{}
+	repositoryMock.On("StreamCustomers", mock.Anything, repository.CustomerFilter{City: "Limeira", SortBy: "name"}).Return(newExportedCustomers(250), nil)
+
+	response := getExport(repositoryMock, "/customer/export?city=Limeira&sort=name")
+
+	assert.Equal(t, http.StatusOK, response.Code)
+	assert.Equal(t, "text/csv; charset=utf-8", response.Header().Get("Content-Type"))
+	assert.Equal(t, `attachment; filename="customers.csv"`, response.Header().Get("Content-Disposition"))
+
+	lines := strings.Split(strings.TrimSuffix(response.Body.String(), "\n"), "\n")
+	assert.Len(t, lines, 251)
+	assert.Equal(t, "id,name,city,email,phone,document,status,createdAt,updatedAt,version", lines[0])
+	assert.Regexp(t, `^[0-9a-f]{24},Customer 249,Limeira,,,,active,,,1$`, lines[250])
+	assert.True(t, response.Flushed)
+}
+
+func TestShouldExportCustomersInNDJSON(t *testing.T) {
+
+	repositoryMock := &repository.CustomerRepositoryMock{}
+	repositoryMock.On("StreamCustomers", mock.Anything, mock.Anything).Return(newExportedCustomers(1), nil)
+
+	response := getExport(repositoryMock, "/customer/export?format=ndjson")
+
+	assert.Equal(t, http.StatusOK, response.Code)
+	assert.Equal(t, "application/x-ndjson", response.Header().Get("Content-Type"))
+	assert.Regexp(t, `^{"id":"[0-9a-f]{24}","name":"Customer 0","city":"Limeira",.*}\n$`, response.Body.String())
+}
+
+func TestShouldRespondWithProblemWhenExportFailsBeforeWriting(t *testing.T) {
+
+	repositoryMock := &repository.CustomerRepositoryMock{}
+	repositoryMock.On("StreamCustomers", mock.Anything, mock.Anything).Return(nil, errors.New("connection refused"))
+
+	response := getExport(repositoryMock, "/customer/export?format=excel")
+	assert.Equal(t, http.StatusInternalServerError, response.Code)
+	assert.Equal(t, "application/problem+json", response.Header().Get("Content-Type"))
+	assert.Empty(t, response.Header().Get("Content-Disposition"))
+	assert.Regexp(t, `"code":"customer_export_failed"`, response.Body.String())
+
+	response = getExport(&repository.CustomerRepositoryMock{}, "/customer/export?format=xlsx")
+	assert.Equal(t, http.StatusBadRequest, response.Code)
+	assert.Regexp(t, `"invalidParams":\[{"name":"format"`, response.Body.String())
+
+	response = getExport(&repository.CustomerRepositoryMock{}, "/customer/export?sort=email")
+	assert.Equal(t, http.StatusBadRequest, response.Code)
+	assert.Regexp(t, `"invalidParams":\[{"name":"sort"`, response.Body.String())
+}
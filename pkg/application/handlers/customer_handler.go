@@ -1,36 +1,109 @@
 package handlers
 
 import (
-	"encoding/json"
+	"io/ioutil"
 	"net/http"
+	"net/url"
+	"strconv"
+	"time"
 
+	"github.com/jcsw/go-api-learn/pkg/application/problem"
+	"github.com/jcsw/go-api-learn/pkg/application/router"
 	"github.com/jcsw/go-api-learn/pkg/domain"
+	"github.com/jcsw/go-api-learn/pkg/infra/events"
+	"github.com/jcsw/go-api-learn/pkg/infra/jobs"
 	"github.com/jcsw/go-api-learn/pkg/service"
 )
 
-// CustomerHandler handler to "/customer"
+// errInvalidPayload Error for a request body that could not be decoded
+var errInvalidPayload = domain.NewError(domain.ErrInvalid, "invalid_payload", "Invalid request payload")
+
+// customerPageResponse the envelope of a customer listing
+type customerPageResponse struct {
+	Data []*domain.Customer `json:"data"`
+	Next string             `json:"next,omitempty"`
+}
+
+// customerHistoryResponse the envelope of the history of a customer
+type customerHistoryResponse struct {
+	Data []*domain.CustomerAudit `json:"data"`
+	Next string                  `json:"next,omitempty"`
+}
+
+// CustomerHandler handler to "/customer", the stream of changes is only served when there is a Stream
+// and the import when there is an Importer, it runs the big imports in background when there are Jobs.
+// The routes of a customer and of the listing negotiate the media type with Codecs, DefaultCodecs when empty
 type CustomerHandler struct {
 	CAggregate *service.CustomerAggregate
+	Importer   *service.CustomerImporter
+	Jobs       *jobs.Pool
+	Stream     *events.Hub
+	Heartbeat  time.Duration
+	Codecs     Codecs
 }
 
-// Register function to handle "/customer"
-func (ch *CustomerHandler) Register(w http.ResponseWriter, r *http.Request) {
+const (
+	customerPath        = "/customer"
+	customerByIDPath    = "/customer/{id}"
+	customerRestorePath = "/customer/{id}/restore"
+	customerHistoryPath = "/customer/{id}/history"
 
-	if r.Method == "POST" {
-		ch.addCustomer(w, r)
-		return
+	// maxCustomerBodySize the maximum size in bytes of a customer payload
+	maxCustomerBodySize = 1 << 20
+
+	// mergePatchMediaType the media type of a JSON merge patch (RFC 7396)
+	mergePatchMediaType = "application/merge-patch+json"
+)
+
+// RegisterRoutes register the routes of "/customer", "/customer/export", "/customer/import", "/customer/stream",
+// "/customer/{id}" and "/customer/{id}/restore"
+func (ch *CustomerHandler) RegisterRoutes(customerRouter *router.Router) {
+
+	codecs := ch.Codecs
+	if len(codecs) == 0 {
+		codecs = DefaultCodecs
 	}
+	negotiated := negotiate(codecs)
 
-	if r.Method == "GET" {
-		name := r.URL.Query().Get("name")
-		if name != "" {
-			ch.getCustomer(w, r, name)
-			return
-		}
+	customerRouter.HandleFunc("GET", customerPath, ch.findCustomers, negotiated)
+	customerRouter.HandleFunc("POST", customerPath, ch.addCustomer, negotiated, limitRequestBody(maxCustomerBodySize))
+
+	// the export, the import and the stream are registered before "/customer/{id}" so they're not taken as an id
+	customerRouter.HandleFunc("GET", CustomerExportPath, ch.exportCustomers)
+
+	if ch.Importer != nil {
+		customerRouter.HandleFunc("POST", CustomerImportPath, ch.importCustomers, limitRequestBody(maxImportBodySize))
+	}
 
-		ch.listCustomers(w, r)
+	if ch.Stream != nil {
+		customerRouter.HandleFunc("GET", CustomerStreamPath, ch.streamCustomers)
+	}
+
+	customerRouter.HandleFunc("GET", customerByIDPath, ch.getCustomerByID, negotiated)
+	customerRouter.HandleFunc("PUT", customerByIDPath, ch.updateCustomer, negotiated, limitRequestBody(maxCustomerBodySize))
+	customerRouter.HandleFunc("PATCH", customerByIDPath, ch.patchCustomer, negotiated, limitRequestBody(maxCustomerBodySize))
+	customerRouter.HandleFunc("DELETE", customerByIDPath, ch.deleteCustomer, negotiated)
+	customerRouter.HandleFunc("POST", customerRestorePath, ch.restoreCustomer, negotiated)
+	customerRouter.HandleFunc("GET", customerHistoryPath, ch.customerHistory)
+
+	customerRouter.HandleFunc("GET", "/monitor/customer", ch.LookupStats)
+}
+
+// RegisterJobs register the handler of the jobs importing customers
+func (ch *CustomerHandler) RegisterJobs() {
+	if ch.Importer != nil && ch.Jobs != nil {
+		ch.Jobs.Register(CustomerImportJob, ch.runImportJob)
+	}
+}
+
+func (ch *CustomerHandler) findCustomers(w http.ResponseWriter, r *http.Request) {
+
+	if name := r.URL.Query().Get("name"); name != "" {
+		ch.getCustomer(w, r, name)
 		return
 	}
+
+	ch.listCustomers(w, r)
 }
 
 func (ch *CustomerHandler) addCustomer(w http.ResponseWriter, r *http.Request) {
@@ -39,50 +112,213 @@ func (ch *CustomerHandler) addCustomer(w http.ResponseWriter, r *http.Request) {
 	defer reader.Close()
 
 	var newCustomer domain.Customer
-	if err := json.NewDecoder(reader).Decode(&newCustomer); err != nil {
-		respondWithError(w, http.StatusBadRequest, "Invalid request payload")
+	if !decodePayload(w, r, &newCustomer) {
 		return
 	}
 
-	createdCustomer, err := ch.CAggregate.CreateNewCustomer(&newCustomer)
+	createdCustomer, err := ch.CAggregate.CreateNewCustomer(r.Context(), &newCustomer)
 	if err != nil {
+		problem.RespondWithError(w, r, err)
+		return
+	}
 
-		if err == domain.ErrInvalidCity || err == domain.ErrInvalidName {
-			respondWithError(w, http.StatusBadRequest, err.Error())
+	w.Header().Set("ETag", customerETag(createdCustomer.Version))
+	respondWithPayload(w, r, http.StatusOK, createdCustomer)
+}
+
+func (ch *CustomerHandler) listCustomers(w http.ResponseWriter, r *http.Request) {
+
+	params := r.URL.Query()
+	query := service.CustomerQuery{
+		City:  params.Get("city"),
+		Sort:  params.Get("sort"),
+		After: params.Get("after"),
+	}
+
+	if limit := params.Get("limit"); limit != "" {
+		var err error
+		if query.Limit, err = strconv.Atoi(limit); err != nil {
+			problem.RespondWithError(w, r, service.ErrInvalidLimit)
 			return
 		}
+	}
 
-		respondWithError(w, http.StatusInternalServerError, "could not complete customer registration")
+	page, err := ch.CAggregate.FindCustomers(r.Context(), query)
+	if err != nil {
+		problem.RespondWithError(w, r, err)
 		return
 	}
 
-	respondWithJSON(w, http.StatusOK, createdCustomer)
+	response := &customerPageResponse{Data: page.Customers}
+	if page.Next != "" {
+		params.Set("after", page.Next)
+		response.Next = (&url.URL{Path: customerPath, RawQuery: params.Encode()}).String()
+	}
+
+	respondWithPayload(w, r, http.StatusOK, response)
 }
 
-func (ch *CustomerHandler) listCustomers(w http.ResponseWriter, r *http.Request) {
+func (ch *CustomerHandler) getCustomer(w http.ResponseWriter, r *http.Request, customerName string) {
 
-	customers, err := ch.CAggregate.FindAllCustomers()
+	customer, err := ch.CAggregate.FindCustomerByName(r.Context(), customerName)
 	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, "Error to process request")
+		problem.RespondWithError(w, r, err)
 		return
 	}
 
-	respondWithJSON(w, http.StatusOK, customers)
+	respondWithPayload(w, r, http.StatusOK, customer)
+}
+
+func (ch *CustomerHandler) getCustomerByID(w http.ResponseWriter, r *http.Request) {
+
+	customerID := router.Param(r, "id")
 
+	customer, err := ch.CAggregate.FindCustomerByID(r.Context(), customerID)
+	if err != nil {
+		problem.RespondWithError(w, r, err)
+		return
+	}
+
+	etag := customerETag(customer.Version)
+	w.Header().Set("ETag", etag)
+
+	if !noneMatch(r, etag) {
+		respondWithCode(w, http.StatusNotModified)
+		return
+	}
+
+	respondWithPayload(w, r, http.StatusOK, customer)
 }
 
-func (ch *CustomerHandler) getCustomer(w http.ResponseWriter, r *http.Request, customerName string) {
+func (ch *CustomerHandler) updateCustomer(w http.ResponseWriter, r *http.Request) {
+
+	customerID := router.Param(r, "id")
+
+	version, ok := expectedVersion(w, r)
+	if !ok {
+		return
+	}
+
+	reader := r.Body
+	defer reader.Close()
+
+	var customer domain.Customer
+	if !decodePayload(w, r, &customer) {
+		return
+	}
+
+	updatedCustomer, err := ch.CAggregate.UpdateCustomer(r.Context(), customerID, version, &customer)
+	if err != nil {
+		problem.RespondWithError(w, r, err)
+		return
+	}
+
+	w.Header().Set("ETag", customerETag(updatedCustomer.Version))
+	respondWithPayload(w, r, http.StatusOK, updatedCustomer)
+}
+
+func (ch *CustomerHandler) patchCustomer(w http.ResponseWriter, r *http.Request) {
+
+	customerID := router.Param(r, "id")
+
+	version, ok := expectedVersion(w, r)
+	if !ok {
+		return
+	}
+
+	if contentType := mediaTypeOf(r.Header.Get("Content-Type")); contentType != mergePatchMediaType && contentType != "application/json" {
+		problem.Respond(w, r, problem.New(http.StatusUnsupportedMediaType, "unsupported_media_type", "Content-Type must be "+mergePatchMediaType+" or application/json"))
+		return
+	}
+
+	reader := r.Body
+	defer reader.Close()
 
-	customer, err := ch.CAggregate.FindCustomerByName(customerName)
+	patch, err := ioutil.ReadAll(reader)
 	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, "Error to process request")
+		respondWithBodyError(w, r, err, errInvalidPayload)
 		return
 	}
 
-	if customer == nil {
-		respondWithError(w, http.StatusNotFound, "Customer not found")
+	patchedCustomer, err := ch.CAggregate.PatchCustomer(r.Context(), customerID, version, patch)
+	if err != nil {
+		problem.RespondWithError(w, r, err)
 		return
 	}
 
-	respondWithJSON(w, http.StatusOK, customer)
+	w.Header().Set("ETag", customerETag(patchedCustomer.Version))
+	respondWithPayload(w, r, http.StatusOK, patchedCustomer)
+}
+
+func (ch *CustomerHandler) deleteCustomer(w http.ResponseWriter, r *http.Request) {
+
+	customerID := router.Param(r, "id")
+
+	version, ok := expectedVersion(w, r)
+	if !ok {
+		return
+	}
+
+	deletedVersion, err := ch.CAggregate.DeleteCustomer(r.Context(), customerID, version)
+	if err != nil {
+		problem.RespondWithError(w, r, err)
+		return
+	}
+
+	w.Header().Set("ETag", customerETag(deletedVersion))
+	respondWithCode(w, http.StatusNoContent)
+}
+
+func (ch *CustomerHandler) restoreCustomer(w http.ResponseWriter, r *http.Request) {
+
+	customerID := router.Param(r, "id")
+
+	version, ok := expectedVersion(w, r)
+	if !ok {
+		return
+	}
+
+	restoredCustomer, err := ch.CAggregate.RestoreCustomer(r.Context(), customerID, version)
+	if err != nil {
+		problem.RespondWithError(w, r, err)
+		return
+	}
+
+	w.Header().Set("ETag", customerETag(restoredCustomer.Version))
+	respondWithPayload(w, r, http.StatusOK, restoredCustomer)
+}
+
+func (ch *CustomerHandler) customerHistory(w http.ResponseWriter, r *http.Request) {
+
+	customerID := router.Param(r, "id")
+
+	params := r.URL.Query()
+	query := service.HistoryQuery{After: params.Get("after")}
+
+	if limit := params.Get("limit"); limit != "" {
+		var err error
+		if query.Limit, err = strconv.Atoi(limit); err != nil {
+			problem.RespondWithError(w, r, service.ErrInvalidLimit)
+			return
+		}
+	}
+
+	history, err := ch.CAggregate.FindCustomerHistory(r.Context(), customerID, query)
+	if err != nil {
+		problem.RespondWithError(w, r, err)
+		return
+	}
+
+	response := customerHistoryResponse{Data: history.Changes}
+	if history.Next != "" {
+		params.Set("after", history.Next)
+		response.Next = (&url.URL{Path: r.URL.Path, RawQuery: params.Encode()}).String()
+	}
+
+	respondWithJSON(w, http.StatusOK, response)
+}
+
+// LookupStats function to handle "/monitor/customer"
+func (ch *CustomerHandler) LookupStats(w http.ResponseWriter, r *http.Request) {
+	respondWithJSON(w, http.StatusOK, ch.CAggregate.LookupStats())
 }
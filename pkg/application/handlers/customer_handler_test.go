@@ -6,17 +6,25 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 
 	"github.com/mongodb/mongo-go-driver/bson/objectid"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
 
 	"github.com/jcsw/go-api-learn/pkg/application/handlers"
+	"github.com/jcsw/go-api-learn/pkg/application/router"
 	"github.com/jcsw/go-api-learn/pkg/infra/cache/cachestore"
 	"github.com/jcsw/go-api-learn/pkg/infra/database/repository"
 	"github.com/jcsw/go-api-learn/pkg/service"
 )
 
+var (
+	customerAmandaID        = objectid.New()
+	customerAmandaCreatedAt = time.Date(2018, 10, 7, 12, 30, 0, 0, time.UTC)
+	customerAmandaAuditID   = objectid.New()
+)
+
 func TestPostCustomerHandler(t *testing.T) {
 	assert := assert.New(t)
 
@@ -27,8 +35,10 @@ func TestPostCustomerHandler(t *testing.T) {
 		method                 string
 		url                    string
 		payload                []byte
+		headers                map[string]string
 		expectedStatusCode     int
 		expectedBody           string
+		expectedHeaders        map[string]string
 	}{
 		{
 			description:            "should return error 400 when body is not valid",
@@ -38,7 +48,7 @@ func TestPostCustomerHandler(t *testing.T) {
 			url:                    "/customer",
 			payload:                []byte(`"a=b"`),
 			expectedStatusCode:     400,
-			expectedBody:           `{"error":"Invalid request payload"}`,
+			expectedBody:           `"status":400,"detail":"Invalid request payload".*"code":"invalid_payload"`,
 		},
 		{
 			description:            "should return error 400 when is missing an argument",
@@ -48,7 +58,7 @@ func TestPostCustomerHandler(t *testing.T) {
 			url:                    "/customer",
 			payload:                []byte(`{"name":"Fernanda Lima","country":"Limeira"}`),
 			expectedStatusCode:     400,
-			expectedBody:           `{"error":"Invalid value 'city'"}`,
+			expectedBody:           `"status":400,"detail":"Invalid value 'city'".*"code":"validation_failed","invalidParams":\[{"name":"city","code":"invalid_value","reason":"Invalid value 'city'"}\]`,
 		},
 		{
 			description:            "should return 200 when successful",
@@ -58,7 +68,30 @@ func TestPostCustomerHandler(t *testing.T) {
 			url:                    "/customer",
 			payload:                []byte(`{"name":"Fernanda Lima","city":"Limeira"}`),
 			expectedStatusCode:     200,
-			expectedBody:           `{"id":".*","name":"Fernanda Lima","city":"Limeira"}`,
+			expectedBody:           `{"id":".*","name":"Fernanda Lima","city":"Limeira","status":"active","createdAt":"[^"]+","updatedAt":"[^"]+","version":1}`,
+			expectedHeaders:        map[string]string{"ETag": `"1"`},
+		},
+		{
+			description:            "should return 400 with the violations of the contact and the addresses",
+			customerRepositoryMock: mockCustomerRepositoryDefault(),
+			customerCacheStoreMock: mockCustomerCacheStoreDefault(),
+			method:                 "POST",
+			url:                    "/customer",
+			payload: []byte(`{"name":"Fernanda Lima","city":"Limeira","email":"fernanda","phone":"19 99999-0000",` +
+				`"document":"111.444.777-00","addresses":[{"type":"summer","street":"Rua Boa Morte","city":"Limeira"}]}`),
+			expectedStatusCode: 400,
+			expectedBody: `"invalidParams":\[{"name":"email","code":"invalid_format".*},{"name":"phone","code":"invalid_format".*},` +
+				`{"name":"document","code":"invalid_check_digit".*},{"name":"addresses\[0\].type","code":"invalid_value".*}\]`,
+		},
+		{
+			description:            "should return 409 when customer already exists",
+			customerRepositoryMock: mockCreateCustomerDuplicate(),
+			customerCacheStoreMock: mockCustomerCacheStoreDefault(),
+			method:                 "POST",
+			url:                    "/customer",
+			payload:                []byte(`{"name":"Fernanda Lima","city":"Limeira"}`),
+			expectedStatusCode:     409,
+			expectedBody:           `"status":409,"detail":"Customer already exists".*"code":"customer_already_exists"`,
 		},
 		{
 			description:            "should return 500 when occurs internal error",
@@ -68,7 +101,7 @@ func TestPostCustomerHandler(t *testing.T) {
 			url:                    "/customer",
 			payload:                []byte(`{"name":"Fernanda Lima","city":"Limeira"}`),
 			expectedStatusCode:     500,
-			expectedBody:           `{"error":"could not complete customer registration"}`,
+			expectedBody:           `"status":500,"detail":"could not complete customer registration".*"code":"customer_registration_failed"`,
 		},
 		{
 			description:            "should return 200 when successful",
@@ -77,7 +110,43 @@ func TestPostCustomerHandler(t *testing.T) {
 			method:                 "GET",
 			url:                    "/customer",
 			expectedStatusCode:     200,
-			expectedBody:           `{"id":".*","name":"Amanda","city":"São Paulo"}`,
+			expectedBody:           `{"data":\[{"id":".*","name":"Amanda","city":"São Paulo","status":"active",[^}]+}\]}`,
+		},
+		{
+			description:            "should return 200 with next link when has more customers",
+			customerRepositoryMock: mockFindCustomersWithNextPage(),
+			customerCacheStoreMock: mockCustomerCacheStoreDefault(),
+			method:                 "GET",
+			url:                    "/customer?limit=1&city=S%C3%A3o+Paulo",
+			expectedStatusCode:     200,
+			expectedBody:           `{"data":\[{"id":".*","name":"Amanda","city":"São Paulo","status":"active",[^}]+}\],"next":"/customer\?after=[\w-]+\\u0026city=S%C3%A3o\+Paulo\\u0026limit=1"}`,
+		},
+		{
+			description:            "should return 400 when limit is not valid",
+			customerRepositoryMock: mockCustomerRepositoryDefault(),
+			customerCacheStoreMock: mockCustomerCacheStoreDefault(),
+			method:                 "GET",
+			url:                    "/customer?limit=abc",
+			expectedStatusCode:     400,
+			expectedBody:           `"status":400,"detail":"Invalid value 'limit'".*"invalidParams":\[{"name":"limit"`,
+		},
+		{
+			description:            "should return 400 when sort is not valid",
+			customerRepositoryMock: mockCustomerRepositoryDefault(),
+			customerCacheStoreMock: mockCustomerCacheStoreDefault(),
+			method:                 "GET",
+			url:                    "/customer?sort=age",
+			expectedStatusCode:     400,
+			expectedBody:           `"status":400,"detail":"Invalid value 'sort'".*"invalidParams":\[{"name":"sort"`,
+		},
+		{
+			description:            "should return 400 when cursor is not valid",
+			customerRepositoryMock: mockCustomerRepositoryDefault(),
+			customerCacheStoreMock: mockCustomerCacheStoreDefault(),
+			method:                 "GET",
+			url:                    "/customer?after=invalid",
+			expectedStatusCode:     400,
+			expectedBody:           `"status":400,"detail":"Invalid value 'after'".*"invalidParams":\[{"name":"after"`,
 		},
 		{
 			description:            "should return 500 when occurs internal error",
@@ -86,7 +155,7 @@ func TestPostCustomerHandler(t *testing.T) {
 			method:                 "GET",
 			url:                    "/customer",
 			expectedStatusCode:     500,
-			expectedBody:           `{"error":"Error to process request"}`,
+			expectedBody:           `"status":500,"detail":"could not find customers".*"code":"customer_search_failed"`,
 		},
 		{
 			description:            "should return 200 when successful",
@@ -95,7 +164,7 @@ func TestPostCustomerHandler(t *testing.T) {
 			method:                 "GET",
 			url:                    "/customer?name=Amanda",
 			expectedStatusCode:     200,
-			expectedBody:           `{"id":".*","name":"Amanda","city":"São Paulo"}`,
+			expectedBody:           `{"id":".*","name":"Amanda","city":"São Paulo","status":"active",[^}]+}`,
 		},
 		{
 			description:            "should return 404 when customer not exists",
@@ -104,7 +173,7 @@ func TestPostCustomerHandler(t *testing.T) {
 			method:                 "GET",
 			url:                    "/customer?name=Thiago",
 			expectedStatusCode:     404,
-			expectedBody:           `{"error":"Customer not found"}`,
+			expectedBody:           `"status":404,"detail":"Customer not found".*"code":"customer_not_found"`,
 		},
 		{
 			description:            "should return 500 when occurs internal error",
@@ -113,7 +182,329 @@ func TestPostCustomerHandler(t *testing.T) {
 			method:                 "GET",
 			url:                    "/customer?name=Pedro",
 			expectedStatusCode:     500,
-			expectedBody:           `{"error":"Error to process request"}`,
+			expectedBody:           `"status":500,"detail":"could not find customer".*"code":"customer_search_failed"`,
+		},
+		{
+			description:            "should return 200 when customer exists by id",
+			customerRepositoryMock: mockFindCustomerByIDSuccesfull(),
+			customerCacheStoreMock: mockCustomerCacheStoreDefault(),
+			method:                 "GET",
+			url:                    "/customer/" + customerAmandaID.Hex(),
+			expectedStatusCode:     200,
+			expectedBody: `{"id":"` + customerAmandaID.Hex() + `","name":"Amanda","city":"São Paulo","email":"amanda@example.com","phone":"\+5511987654321",` +
+				`"document":"52998224725","addresses":\[{"type":"home","street":"Rua Augusta","number":"100","city":"São Paulo"}\],` +
+				`"status":"active","createdAt":"2018-10-07T12:30:00Z","updatedAt":"2018-10-07T12:30:00Z","version":2}`,
+			expectedHeaders: map[string]string{"ETag": `"2"`},
+		},
+		{
+			description:            "should return 304 when customer version matches If-None-Match",
+			customerRepositoryMock: mockFindCustomerByIDSuccesfull(),
+			customerCacheStoreMock: mockCustomerCacheStoreDefault(),
+			method:                 "GET",
+			url:                    "/customer/" + customerAmandaID.Hex(),
+			headers:                map[string]string{"If-None-Match": `W/"1", W/"2"`},
+			expectedStatusCode:     304,
+			expectedBody:           `^$`,
+			expectedHeaders:        map[string]string{"ETag": `"2"`},
+		},
+		{
+			description:            "should return 200 when customer version does not match If-None-Match",
+			customerRepositoryMock: mockFindCustomerByIDSuccesfull(),
+			customerCacheStoreMock: mockCustomerCacheStoreDefault(),
+			method:                 "GET",
+			url:                    "/customer/" + customerAmandaID.Hex(),
+			headers:                map[string]string{"If-None-Match": `"1"`},
+			expectedStatusCode:     200,
+			expectedBody:           `"version":2}`,
+			expectedHeaders:        map[string]string{"ETag": `"2"`},
+		},
+		{
+			description:            "should return 404 when customer not exists by id",
+			customerRepositoryMock: mockCustomerRepositoryDefault(),
+			customerCacheStoreMock: mockCustomerCacheStoreDefault(),
+			method:                 "GET",
+			url:                    "/customer/" + objectid.New().Hex(),
+			expectedStatusCode:     404,
+			expectedBody:           `"status":404,"detail":"Customer not found".*"code":"customer_not_found"`,
+		},
+		{
+			description:            "should return 404 when id is not valid",
+			customerRepositoryMock: mockCustomerRepositoryDefault(),
+			customerCacheStoreMock: mockCustomerCacheStoreDefault(),
+			method:                 "GET",
+			url:                    "/customer/invalid",
+			expectedStatusCode:     404,
+			expectedBody:           `"status":404,"detail":"Customer not found".*"code":"customer_not_found"`,
+		},
+		{
+			description:            "should return 200 when update is successful",
+			customerRepositoryMock: mockUpdateCustomerSuccesfull(),
+			customerCacheStoreMock: mockCustomerCacheStoreDefault(),
+			method:                 "PUT",
+			url:                    "/customer/" + customerAmandaID.Hex(),
+			headers:                map[string]string{"If-Match": `"2"`},
+			payload:                []byte(`{"name":"Amanda","city":"Campinas"}`),
+			expectedStatusCode:     200,
+			expectedBody:           `{"id":"` + customerAmandaID.Hex() + `","name":"Amanda","city":"Campinas",.*"createdAt":"2018-10-07T12:30:00Z","updatedAt":"[^"]+","version":3}`,
+			expectedHeaders:        map[string]string{"ETag": `"3"`},
+		},
+		{
+			description:            "should return 200 when update matches any version",
+			customerRepositoryMock: mockUpdateCustomerSuccesfull(),
+			customerCacheStoreMock: mockCustomerCacheStoreDefault(),
+			method:                 "PUT",
+			url:                    "/customer/" + customerAmandaID.Hex(),
+			headers:                map[string]string{"If-Match": `*`},
+			payload:                []byte(`{"name":"Amanda","city":"Campinas"}`),
+			expectedStatusCode:     200,
+			expectedBody:           `"city":"Campinas",.*"version":3}`,
+			expectedHeaders:        map[string]string{"ETag": `"3"`},
+		},
+		{
+			description:            "should return 428 when update has no If-Match",
+			customerRepositoryMock: mockUpdateCustomerSuccesfull(),
+			customerCacheStoreMock: mockCustomerCacheStoreDefault(),
+			method:                 "PUT",
+			url:                    "/customer/" + customerAmandaID.Hex(),
+			payload:                []byte(`{"name":"Amanda","city":"Campinas"}`),
+			expectedStatusCode:     428,
+			expectedBody:           `"status":428,"detail":"If-Match header is required".*"code":"precondition_required"`,
+		},
+		{
+			description:            "should return 412 when update is based on an outdated version",
+			customerRepositoryMock: mockUpdateCustomerSuccesfull(),
+			customerCacheStoreMock: mockCustomerCacheStoreDefault(),
+			method:                 "PUT",
+			url:                    "/customer/" + customerAmandaID.Hex(),
+			headers:                map[string]string{"If-Match": `"1"`},
+			payload:                []byte(`{"name":"Amanda","city":"Campinas"}`),
+			expectedStatusCode:     412,
+			expectedBody:           `"status":412,"detail":"Customer was modified by another request".*"code":"customer_version_mismatch"`,
+		},
+		{
+			description:            "should return 400 when update is missing an argument",
+			customerRepositoryMock: mockCustomerRepositoryDefault(),
+			customerCacheStoreMock: mockCustomerCacheStoreDefault(),
+			method:                 "PUT",
+			url:                    "/customer/" + customerAmandaID.Hex(),
+			headers:                map[string]string{"If-Match": `"2"`},
+			payload:                []byte(`{"name":"Amanda"}`),
+			expectedStatusCode:     400,
+			expectedBody:           `"status":400,"detail":"Invalid value 'city'".*"code":"validation_failed","invalidParams":\[{"name":"city","code":"invalid_value","reason":"Invalid value 'city'"}\]`,
+		},
+		{
+			description:            "should return 404 when update a customer that not exists",
+			customerRepositoryMock: mockCustomerRepositoryDefault(),
+			customerCacheStoreMock: mockCustomerCacheStoreDefault(),
+			method:                 "PUT",
+			url:                    "/customer/" + customerAmandaID.Hex(),
+			headers:                map[string]string{"If-Match": `"2"`},
+			payload:                []byte(`{"name":"Amanda","city":"Campinas"}`),
+			expectedStatusCode:     404,
+			expectedBody:           `"status":404,"detail":"Customer not found".*"code":"customer_not_found"`,
+		},
+		{
+			description:            "should return 200 when patch is successful",
+			customerRepositoryMock: mockUpdateCustomerSuccesfull(),
+			customerCacheStoreMock: mockCustomerCacheStoreDefault(),
+			method:                 "PATCH",
+			url:                    "/customer/" + customerAmandaID.Hex(),
+			headers:                map[string]string{"If-Match": `"2"`, "Content-Type": "application/merge-patch+json"},
+			payload:                []byte(`{"city":"Campinas"}`),
+			expectedStatusCode:     200,
+			expectedBody:           `{"id":"` + customerAmandaID.Hex() + `","name":"Amanda","city":"Campinas",.*"createdAt":"2018-10-07T12:30:00Z","updatedAt":"[^"]+","version":3}`,
+			expectedHeaders:        map[string]string{"ETag": `"3"`},
+		},
+		{
+			description:            "should return 412 when patch If-Match is a weak tag",
+			customerRepositoryMock: mockUpdateCustomerSuccesfull(),
+			customerCacheStoreMock: mockCustomerCacheStoreDefault(),
+			method:                 "PATCH",
+			url:                    "/customer/" + customerAmandaID.Hex(),
+			headers:                map[string]string{"If-Match": `W/"2"`, "Content-Type": "application/merge-patch+json"},
+			payload:                []byte(`{"city":"Campinas"}`),
+			expectedStatusCode:     412,
+			expectedBody:           `"status":412,.*"code":"customer_version_mismatch"`,
+		},
+		{
+			description:            "should return 400 when patch removes a required argument",
+			customerRepositoryMock: mockFindCustomerByIDSuccesfull(),
+			customerCacheStoreMock: mockCustomerCacheStoreDefault(),
+			method:                 "PATCH",
+			url:                    "/customer/" + customerAmandaID.Hex(),
+			headers:                map[string]string{"If-Match": `"2"`, "Content-Type": "application/merge-patch+json"},
+			payload:                []byte(`{"city":null}`),
+			expectedStatusCode:     400,
+			expectedBody:           `"status":400,"detail":"Invalid value 'city'".*"code":"validation_failed","invalidParams":\[{"name":"city","code":"invalid_value","reason":"Invalid value 'city'"}\]`,
+		},
+		{
+			description:            "should return 400 when patch is not valid",
+			customerRepositoryMock: mockFindCustomerByIDSuccesfull(),
+			customerCacheStoreMock: mockCustomerCacheStoreDefault(),
+			method:                 "PATCH",
+			url:                    "/customer/" + customerAmandaID.Hex(),
+			headers:                map[string]string{"If-Match": `"2"`, "Content-Type": "application/merge-patch+json"},
+			payload:                []byte(`["city"]`),
+			expectedStatusCode:     400,
+			expectedBody:           `"status":400,"detail":"Invalid merge patch document".*"code":"invalid_merge_patch"`,
+		},
+		{
+			description:            "should return 415 when patch is not a JSON merge patch",
+			customerRepositoryMock: mockFindCustomerByIDSuccesfull(),
+			customerCacheStoreMock: mockCustomerCacheStoreDefault(),
+			method:                 "PATCH",
+			url:                    "/customer/" + customerAmandaID.Hex(),
+			headers:                map[string]string{"If-Match": `"2"`, "Content-Type": "application/json-patch+json"},
+			payload:                []byte(`[{"op":"replace","path":"/city","value":"Campinas"}]`),
+			expectedStatusCode:     415,
+			expectedBody:           `"status":415,"detail":"Content-Type must be application/merge-patch\+json or application/json".*"code":"unsupported_media_type"`,
+		},
+		{
+			description:            "should return 415 when patch has no Content-Type",
+			customerRepositoryMock: mockFindCustomerByIDSuccesfull(),
+			customerCacheStoreMock: mockCustomerCacheStoreDefault(),
+			method:                 "PATCH",
+			url:                    "/customer/" + customerAmandaID.Hex(),
+			headers:                map[string]string{"If-Match": `"2"`},
+			payload:                []byte(`{"city":"Campinas"}`),
+			expectedStatusCode:     415,
+			expectedBody:           `"status":415,.*"code":"unsupported_media_type"`,
+		},
+		{
+			description:            "should return 204 when delete is successful",
+			customerRepositoryMock: mockDeleteCustomerSuccesfull(),
+			customerCacheStoreMock: mockCustomerCacheStoreDefault(),
+			method:                 "DELETE",
+			url:                    "/customer/" + customerAmandaID.Hex(),
+			headers:                map[string]string{"If-Match": `"2"`},
+			expectedStatusCode:     204,
+			expectedBody:           ``,
+			expectedHeaders:        map[string]string{"ETag": `"3"`},
+		},
+		{
+			description:            "should return 404 when customer by id is deleted",
+			customerRepositoryMock: mockRestoreCustomerSuccesfull(),
+			customerCacheStoreMock: mockCustomerCacheStoreDefault(),
+			method:                 "GET",
+			url:                    "/customer/" + customerAmandaID.Hex(),
+			expectedStatusCode:     404,
+			expectedBody:           `"status":404,"detail":"Customer not found".*"code":"customer_not_found"`,
+		},
+		{
+			description:            "should return 200 when restore is successful",
+			customerRepositoryMock: mockRestoreCustomerSuccesfull(),
+			customerCacheStoreMock: mockCustomerCacheStoreDefault(),
+			method:                 "POST",
+			url:                    "/customer/" + customerAmandaID.Hex() + "/restore",
+			headers:                map[string]string{"If-Match": `"3"`},
+			expectedStatusCode:     200,
+			expectedBody:           `{"id":"` + customerAmandaID.Hex() + `","name":"Amanda",.*"version":4}`,
+			expectedHeaders:        map[string]string{"ETag": `"4"`},
+		},
+		{
+			description:            "should return 409 when restore a customer that is not deleted",
+			customerRepositoryMock: mockFindCustomerByIDSuccesfull(),
+			customerCacheStoreMock: mockCustomerCacheStoreDefault(),
+			method:                 "POST",
+			url:                    "/customer/" + customerAmandaID.Hex() + "/restore",
+			headers:                map[string]string{"If-Match": `"2"`},
+			expectedStatusCode:     409,
+			expectedBody:           `"status":409,"detail":"Customer is not deleted".*"code":"customer_not_deleted"`,
+		},
+		{
+			description:            "should return 428 when restore has no If-Match",
+			customerRepositoryMock: mockRestoreCustomerSuccesfull(),
+			customerCacheStoreMock: mockCustomerCacheStoreDefault(),
+			method:                 "POST",
+			url:                    "/customer/" + customerAmandaID.Hex() + "/restore",
+			expectedStatusCode:     428,
+			expectedBody:           `"status":428,.*"code":"precondition_required"`,
+		},
+		{
+			description:            "should return 200 with the history and the next link when has more changes",
+			customerRepositoryMock: mockFindCustomerHistorySuccesfull(),
+			customerCacheStoreMock: mockCustomerCacheStoreDefault(),
+			method:                 "GET",
+			url:                    "/customer/" + customerAmandaID.Hex() + "/history?limit=1",
+			expectedStatusCode:     200,
+			expectedBody: `{"data":\[{"id":"` + customerAmandaAuditID.Hex() + `","action":"updated","actor":"backoffice","requestId":"1539000000",` +
+				`"timestamp":"2018-10-08T09:00:00Z","version":2,"changes":\[{"field":"city","before":"Santos","after":"São Paulo"}\]}\],` +
+				`"next":"/customer/` + customerAmandaID.Hex() + `/history\?after=` + customerAmandaAuditID.Hex() + `\\u0026limit=1"}`,
+		},
+		{
+			description:            "should return 404 when the customer of the history not exists",
+			customerRepositoryMock: mockCustomerRepositoryDefault(),
+			customerCacheStoreMock: mockCustomerCacheStoreDefault(),
+			method:                 "GET",
+			url:                    "/customer/" + customerAmandaID.Hex() + "/history",
+			expectedStatusCode:     404,
+			expectedBody:           `"status":404,"detail":"Customer not found".*"code":"customer_not_found"`,
+		},
+		{
+			description:            "should return 400 when the history limit is not a number",
+			customerRepositoryMock: mockCustomerRepositoryDefault(),
+			customerCacheStoreMock: mockCustomerCacheStoreDefault(),
+			method:                 "GET",
+			url:                    "/customer/" + customerAmandaID.Hex() + "/history?limit=ten",
+			expectedStatusCode:     400,
+			expectedBody:           `"status":400,.*"invalidParams":\[{"name":"limit","code":"invalid_value"`,
+		},
+		{
+			description:            "should return 428 when delete has no If-Match",
+			customerRepositoryMock: mockDeleteCustomerSuccesfull(),
+			customerCacheStoreMock: mockCustomerCacheStoreDefault(),
+			method:                 "DELETE",
+			url:                    "/customer/" + customerAmandaID.Hex(),
+			expectedStatusCode:     428,
+			expectedBody:           `"status":428,.*"code":"precondition_required"`,
+		},
+		{
+			description:            "should return 412 when delete is based on an outdated version",
+			customerRepositoryMock: mockDeleteCustomerSuccesfull(),
+			customerCacheStoreMock: mockCustomerCacheStoreDefault(),
+			method:                 "DELETE",
+			url:                    "/customer/" + customerAmandaID.Hex(),
+			headers:                map[string]string{"If-Match": `"1"`},
+			expectedStatusCode:     412,
+			expectedBody:           `"status":412,.*"code":"customer_version_mismatch"`,
+		},
+		{
+			description:            "should return 404 when delete a customer that not exists",
+			customerRepositoryMock: mockCustomerRepositoryDefault(),
+			customerCacheStoreMock: mockCustomerCacheStoreDefault(),
+			method:                 "DELETE",
+			url:                    "/customer/" + customerAmandaID.Hex(),
+			headers:                map[string]string{"If-Match": `"2"`},
+			expectedStatusCode:     404,
+			expectedBody:           `"status":404,"detail":"Customer not found".*"code":"customer_not_found"`,
+		},
+		{
+			description:            "should return 500 when delete occurs internal error",
+			customerRepositoryMock: mockDeleteCustomerError(),
+			customerCacheStoreMock: mockCustomerCacheStoreDefault(),
+			method:                 "DELETE",
+			url:                    "/customer/" + customerAmandaID.Hex(),
+			headers:                map[string]string{"If-Match": `"2"`},
+			expectedStatusCode:     500,
+			expectedBody:           `"status":500,"detail":"could not delete customer".*"code":"customer_delete_failed"`,
+		},
+		{
+			description:            "should return 405 when method is not supported by customer",
+			customerRepositoryMock: mockCustomerRepositoryDefault(),
+			customerCacheStoreMock: mockCustomerCacheStoreDefault(),
+			method:                 "DELETE",
+			url:                    "/customer",
+			expectedStatusCode:     405,
+			expectedBody:           `"status":405,"detail":"Method not allowed".*"code":"method_not_allowed"`,
+		},
+		{
+			description:            "should return 405 when method is not supported by customer id",
+			customerRepositoryMock: mockCustomerRepositoryDefault(),
+			customerCacheStoreMock: mockCustomerCacheStoreDefault(),
+			method:                 "POST",
+			url:                    "/customer/" + customerAmandaID.Hex(),
+			expectedStatusCode:     405,
+			expectedBody:           `"status":405,"detail":"Method not allowed".*"code":"method_not_allowed"`,
 		},
 	}
 
@@ -122,68 +513,174 @@ func TestPostCustomerHandler(t *testing.T) {
 		req, err := http.NewRequest(tc.method, tc.url, bytes.NewBuffer(tc.payload))
 		assert.NoError(err)
 
+		for name, value := range tc.headers {
+			req.Header.Set(name, value)
+		}
+
 		resp := httptest.NewRecorder()
 
 		aggregate := service.CustomerAggregate{Repository: tc.customerRepositoryMock, CacheStore: tc.customerCacheStoreMock}
 
 		customerHandler := handlers.CustomerHandler{CAggregate: &aggregate}
 
-		customerHandler.Register(resp, req)
+		customerRouter := router.New()
+		customerHandler.RegisterRoutes(customerRouter)
+		customerRouter.ServeHTTP(resp, req)
 
 		assert.Equal(tc.expectedStatusCode, resp.Code, tc.description)
 		assert.Regexp(tc.expectedBody, string(resp.Body.Bytes()), tc.description)
+
+		for name, value := range tc.expectedHeaders {
+			assert.Equal(value, resp.Header().Get(name), tc.description)
+		}
 	}
 }
 
 func mockCustomerCacheStoreDefault() *cachestore.CustomerCacheStoreMock {
 	cacheStoreMock := &cachestore.CustomerCacheStoreMock{}
-	cacheStoreMock.On("RetriveCustomerEntity", mock.Anything).Return(nil)
-	cacheStoreMock.On("PersistCustomerEntity", mock.Anything)
+	cacheStoreMock.On("RetriveCustomerEntity", mock.Anything, mock.Anything).Return(nil)
+	cacheStoreMock.On("PersistCustomerEntity", mock.Anything, mock.Anything)
+	cacheStoreMock.On("RemoveCustomerEntity", mock.Anything, mock.Anything)
 	return cacheStoreMock
 }
 
 func mockCustomerRepositoryDefault() *repository.CustomerRepositoryMock {
 	repositoryMock := &repository.CustomerRepositoryMock{}
-	repositoryMock.On("InsertCustomer", mock.Anything).Return(nil)
-	repositoryMock.On("FindAllCustomers").Return([]*repository.CustomerEntity{}, nil)
-	repositoryMock.On("FindCustomerByName", mock.Anything).Return(nil, nil)
+	repositoryMock.On("InsertCustomer", mock.Anything, mock.Anything, mock.Anything).Return(nil)
+	repositoryMock.On("FindCustomers", mock.Anything, mock.Anything).Return([]*repository.CustomerEntity{}, nil)
+	repositoryMock.On("FindCustomerByName", mock.Anything, mock.Anything).Return(nil, nil)
+	repositoryMock.On("FindCustomerByID", mock.Anything, mock.Anything).Return(nil, nil)
+	repositoryMock.On("UpdateCustomer", mock.Anything, mock.Anything, mock.Anything).Return(false, nil)
+	repositoryMock.On("FindCustomerAudit", mock.Anything, mock.Anything, mock.Anything).Return([]*repository.CustomerAuditEntity{}, nil)
 	return repositoryMock
 }
 
 func mockCreateCustomerSuccesfull() *repository.CustomerRepositoryMock {
 	repositoryMock := &repository.CustomerRepositoryMock{}
-	repositoryMock.On("InsertCustomer", mock.Anything).Return(nil)
+	repositoryMock.On("InsertCustomer", mock.Anything, mock.Anything, mock.Anything).Return(nil)
+	return repositoryMock
+}
+
+func mockCreateCustomerDuplicate() *repository.CustomerRepositoryMock {
+	repositoryMock := &repository.CustomerRepositoryMock{}
+	repositoryMock.On("InsertCustomer", mock.Anything, mock.Anything, mock.Anything).Return(repository.ErrDuplicateCustomer)
 	return repositoryMock
 }
 
 func mockCreateCustomerError() *repository.CustomerRepositoryMock {
 	repositoryMock := &repository.CustomerRepositoryMock{}
-	repositoryMock.On("InsertCustomer", mock.Anything).Return(errors.New("mock error"))
+	repositoryMock.On("InsertCustomer", mock.Anything, mock.Anything, mock.Anything).Return(errors.New("mock error"))
 	return repositoryMock
 }
 
 func mockFindCustomersSuccesfull() *repository.CustomerRepositoryMock {
 	repositoryMock := &repository.CustomerRepositoryMock{}
 	customerAmanda := &repository.CustomerEntity{ID: objectid.New(), Name: "Amanda", City: "São Paulo"}
-	repositoryMock.On("FindAllCustomers").Return([]*repository.CustomerEntity{customerAmanda}, nil)
+	repositoryMock.On("FindCustomers", mock.Anything, mock.Anything).Return([]*repository.CustomerEntity{customerAmanda}, nil)
+	return repositoryMock
+}
+
+func mockFindCustomersWithNextPage() *repository.CustomerRepositoryMock {
+	repositoryMock := &repository.CustomerRepositoryMock{}
+	customerAmanda := &repository.CustomerEntity{ID: objectid.New(), Name: "Amanda", City: "São Paulo"}
+	customerMarcos := &repository.CustomerEntity{ID: objectid.New(), Name: "Marcos", City: "São Paulo"}
+	repositoryMock.On("FindCustomers", mock.Anything, repository.CustomerFilter{City: "São Paulo", SortBy: "_id", Limit: 2}).
+		Return([]*repository.CustomerEntity{customerAmanda, customerMarcos}, nil)
 	return repositoryMock
 }
 
 func mockFindCustomersError() *repository.CustomerRepositoryMock {
 	repositoryMock := &repository.CustomerRepositoryMock{}
-	repositoryMock.On("FindAllCustomers").Return(nil, errors.New("mock error"))
+	repositoryMock.On("FindCustomers", mock.Anything, mock.Anything).Return(nil, errors.New("mock error"))
 	return repositoryMock
 }
 
 func mockFindCustomerSuccesfull() *repository.CustomerRepositoryMock {
 	repositoryMock := &repository.CustomerRepositoryMock{}
 	customerAmanda := &repository.CustomerEntity{ID: objectid.New(), Name: "Amanda", City: "São Paulo"}
-	repositoryMock.On("FindCustomerByName", "Amanda").Return(customerAmanda, nil)
+	repositoryMock.On("FindCustomerByName", mock.Anything, "Amanda").Return(customerAmanda, nil)
 	return repositoryMock
 }
 
 func mockFindCustomerError() *repository.CustomerRepositoryMock {
 	repositoryMock := &repository.CustomerRepositoryMock{}
-	repositoryMock.On("FindCustomerByName", "Pedro").Return(nil, errors.New("mock error"))
+	repositoryMock.On("FindCustomerByName", mock.Anything, "Pedro").Return(nil, errors.New("mock error"))
+	return repositoryMock
+}
+
+func mockFindCustomerByIDSuccesfull() *repository.CustomerRepositoryMock {
+	repositoryMock := &repository.CustomerRepositoryMock{}
+	customerAmanda := &repository.CustomerEntity{
+		ID:        customerAmandaID,
+		Name:      "Amanda",
+		City:      "São Paulo",
+		Email:     "amanda@example.com",
+		Phone:     "+5511987654321",
+		Document:  "52998224725",
+		Addresses: []repository.AddressEntity{{Type: "home", Street: "Rua Augusta", Number: "100", City: "São Paulo"}},
+		Status:    "active",
+		CreatedAt: customerAmandaCreatedAt,
+		UpdatedAt: customerAmandaCreatedAt,
+		Version:   2,
+	}
+	repositoryMock.On("FindCustomerByID", mock.Anything, customerAmandaID).Return(customerAmanda, nil)
+	return repositoryMock
+}
+
+func mockUpdateCustomerSuccesfull() *repository.CustomerRepositoryMock {
+	repositoryMock := mockFindCustomerByIDSuccesfull()
+	repositoryMock.On("UpdateCustomer", mock.Anything, mock.Anything, mock.Anything).Return(true, nil)
+	return repositoryMock
+}
+
+func mockDeleteCustomerSuccesfull() *repository.CustomerRepositoryMock {
+	repositoryMock := mockFindCustomerByIDSuccesfull()
+	repositoryMock.On("UpdateCustomer", mock.Anything, mock.MatchedBy(func(customerEntity *repository.CustomerEntity) bool {
+		return customerEntity.IsDeleted()
+	}), mock.Anything).Return(true, nil)
+	return repositoryMock
+}
+
+func mockDeleteCustomerError() *repository.CustomerRepositoryMock {
+	repositoryMock := mockFindCustomerByIDSuccesfull()
+	repositoryMock.On("UpdateCustomer", mock.Anything, mock.Anything, mock.Anything).Return(false, errors.New("mock error"))
+	return repositoryMock
+}
+
+func mockRestoreCustomerSuccesfull() *repository.CustomerRepositoryMock {
+	repositoryMock := &repository.CustomerRepositoryMock{}
+	customerAmanda := &repository.CustomerEntity{
+		ID:        customerAmandaID,
+		Name:      "Amanda",
+		City:      "São Paulo",
+		Status:    "active",
+		CreatedAt: customerAmandaCreatedAt,
+		UpdatedAt: customerAmandaCreatedAt,
+		DeletedAt: customerAmandaCreatedAt,
+		Version:   3,
+	}
+	repositoryMock.On("FindCustomerByID", mock.Anything, customerAmandaID).Return(customerAmanda, nil)
+	repositoryMock.On("UpdateCustomer", mock.Anything, mock.MatchedBy(func(customerEntity *repository.CustomerEntity) bool {
+		return !customerEntity.IsDeleted()
+	}), mock.Anything).Return(true, nil)
+	return repositoryMock
+}
+
+func mockFindCustomerHistorySuccesfull() *repository.CustomerRepositoryMock {
+	repositoryMock := &repository.CustomerRepositoryMock{}
+	audits := []*repository.CustomerAuditEntity{
+		{
+			ID:         customerAmandaAuditID,
+			CustomerID: customerAmandaID,
+			Action:     "updated",
+			Actor:      "backoffice",
+			RequestID:  "1539000000",
+			Timestamp:  time.Date(2018, 10, 8, 9, 0, 0, 0, time.UTC),
+			Version:    2,
+			Changes:    []repository.AuditChangeEntity{{Field: "city", Before: `"Santos"`, After: `"São Paulo"`}},
+		},
+		{ID: objectid.New(), CustomerID: customerAmandaID, Action: "created", Actor: "backoffice", Version: 1},
+	}
+	repositoryMock.On("FindCustomerAudit", mock.Anything, customerAmandaID, repository.AuditFilter{Limit: 2}).Return(audits, nil)
 	return repositoryMock
 }
@@ -0,0 +1,232 @@
+package handlers
+
+import (
+	"context"
+	"mime"
+	"net/http"
+
+	"github.com/jcsw/go-api-learn/pkg/application/problem"
+	"github.com/jcsw/go-api-learn/pkg/domain"
+	"github.com/jcsw/go-api-learn/pkg/infra/jobs"
+	"github.com/jcsw/go-api-learn/pkg/service"
+)
+
+const (
+	// CustomerImportPath the route of the import of customers, it's exempt from the write timeout
+	CustomerImportPath = "/customer/import"
+
+	// CustomerImportJob the kind of the jobs importing customers in background
+	CustomerImportJob = "customer.import"
+
+	// maxImportBodySize the maximum size in bytes of an import file, a file imported in background is read whole
+	// before its rows are stored with its job
+	maxImportBodySize = 8 << 20
+)
+
+// importFormats the import format of each media type accepted
+var importFormats = map[string]string{
+	"text/csv":             service.ImportCSV,
+	"application/x-ndjson": service.ImportNDJSON,
+	"application/ndjson":   service.ImportNDJSON,
+}
+
+// importReportResponse the result of an import with the result of each row
+type importReportResponse struct {
+	Total    int                  `json:"total"`
+	Imported int                  `json:"imported"`
+	Failed   int                  `json:"failed"`
+	Rows     []*importRowResponse `json:"rows"`
+}
+
+// importRowResponse the result of a row, the id of the customer created or the problem that rejected it
+type importRowResponse struct {
+	Line   int              `json:"line"`
+	Status string           `json:"status"`
+	ID     string           `json:"id,omitempty"`
+	Error  *problem.Problem `json:"error,omitempty"`
+}
+
+// importJobPayload the payload of an import job, its rows are stored apart in the parts of the job, a batch each
+type importJobPayload struct {
+	Total int `json:"total"`
+}
+
+// importJobCounters the counters of an import job, recorded with each batch so a job queued again resumes them
+type importJobCounters struct {
+	Done     int `json:"done"`
+	Imported int `json:"imported"`
+	Failed   int `json:"failed"`
+}
+
+// importJobResponse the result of an import job, the result of each row is in the results of the job
+type importJobResponse struct {
+	Total    int    `json:"total"`
+	Imported int    `json:"imported"`
+	Failed   int    `json:"failed"`
+	Results  string `json:"results"`
+}
+
+// importJobRow a row of an import in the parts of its job, Invalid is set when it could not be read
+type importJobRow struct {
+	Line     int              `json:"line"`
+	Customer *domain.Customer `json:"customer,omitempty"`
+	Invalid  bool             `json:"invalid,omitempty"`
+}
+
+// importCustomers create the customers of a CSV or NDJSON file. A small file is imported during the request and
+// answered with the report, a bigger one is imported in background and answered with the job following it.
+// Without jobs every file is imported during the request, a batch at a time as it's read
+func (ch *CustomerHandler) importCustomers(w http.ResponseWriter, r *http.Request) {
+
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	format, ok := importFormats[mediaType]
+	if !ok {
+		problem.Respond(w, r, problem.New(http.StatusUnsupportedMediaType, "unsupported_media_type", "Content-Type must be text/csv or application/x-ndjson"))
+		return
+	}
+
+	reader := r.Body
+	defer reader.Close()
+
+	rowReader, err := service.NewImportRowReader(format, reader)
+	if err != nil {
+		respondWithBodyError(w, r, err, err)
+		return
+	}
+
+	if ch.Jobs == nil {
+		report, err := ch.Importer.ImportFrom(r.Context(), rowReader)
+		if err != nil {
+			respondWithBodyError(w, r, err, err)
+			return
+		}
+		respondWithJSON(w, http.StatusOK, makeImportReportResponse(report))
+		return
+	}
+
+	// the rows are read up to one past the limit, only a file imported in background is read whole
+	rows, err := rowReader.ReadN(ch.Importer.SyncLimit() + 1)
+	if err != nil {
+		respondWithBodyError(w, r, err, err)
+		return
+	}
+
+	if ch.Importer.IsAsync(rows) {
+		rest, err := rowReader.ReadN(-1)
+		if err != nil {
+			respondWithBodyError(w, r, err, err)
+			return
+		}
+		ch.startImportJob(w, r, append(rows, rest...))
+		return
+	}
+
+	report := ch.Importer.Import(r.Context(), rows)
+	respondWithJSON(w, http.StatusOK, makeImportReportResponse(report))
+}
+
+// startImportJob enqueue the import of the rows, a batch in each part of the job, and answer with the job following it
+func (ch *CustomerHandler) startImportJob(w http.ResponseWriter, r *http.Request, rows []*service.ImportRow) {
+
+	batchSize := ch.Importer.BatchLimit()
+
+	parts := make([]interface{}, 0, (len(rows)+batchSize-1)/batchSize)
+	for start := 0; start < len(rows); start += batchSize {
+		end := start + batchSize
+		if end > len(rows) {
+			end = len(rows)
+		}
+
+		batch := make([]*importJobRow, 0, end-start)
+		for _, row := range rows[start:end] {
+			batch = append(batch, &importJobRow{Line: row.Line, Customer: row.Customer, Invalid: row.Err != nil})
+		}
+		parts = append(parts, batch)
+	}
+
+	job, err := ch.Jobs.Enqueue(r.Context(), CustomerImportJob, &importJobPayload{Total: len(rows)}, parts...)
+	if err != nil {
+		problem.RespondWithError(w, r, domain.WrapError(domain.ErrUnexpected, "customer_import_failed", "could not start the import", err))
+		return
+	}
+
+	w.Header().Set("Location", jobPath+"/"+job.ID)
+	respondWithJSON(w, http.StatusAccepted, job)
+}
+
+// runImportJob import the rows of the job a part at a time, the result of each row is the result of its part and
+// the result of the job has only the counters. A job queued again resumes from the first part not imported, with
+// the counters of its earlier attempts, so the rows already imported are not reported as already existing customers
+func (ch *CustomerHandler) runImportJob(ctx context.Context, task *jobs.Task) (interface{}, error) {
+
+	payload := importJobPayload{}
+	if err := task.Decode(&payload); err != nil {
+		return nil, err
+	}
+
+	counters := importJobCounters{}
+	if _, err := task.Counters(&counters); err != nil {
+		return nil, err
+	}
+
+	for ctx.Err() == nil {
+		batch := []*importJobRow{}
+		next, err := task.NextPart(ctx, &batch)
+		if err != nil {
+			return nil, err
+		}
+
+		if !next {
+			break
+		}
+
+		rows := make([]*service.ImportRow, 0, len(batch))
+		for _, row := range batch {
+			importRow := &service.ImportRow{Line: row.Line, Customer: row.Customer}
+			if row.Invalid {
+				importRow.Err = service.ErrInvalidImportRow
+			}
+			rows = append(rows, importRow)
+		}
+
+		report := ch.Importer.Import(ctx, rows)
+		counters.Done += report.Total
+		counters.Imported += report.Imported
+		counters.Failed += report.Failed
+
+		task.CompletePart(counters.Done, payload.Total, makeImportRowResponses(report.Rows), counters)
+	}
+
+	response := &importJobResponse{
+		Total:    payload.Total,
+		Imported: counters.Imported,
+		Failed:   counters.Failed,
+		Results:  jobPath + "/" + task.ID + "/results",
+	}
+
+	return response, ctx.Err()
+}
+
+func makeImportReportResponse(report *service.ImportReport) *importReportResponse {
+
+	return &importReportResponse{
+		Total:    report.Total,
+		Imported: report.Imported,
+		Failed:   report.Failed,
+		Rows:     makeImportRowResponses(report.Rows),
+	}
+}
+
+func makeImportRowResponses(rows []*service.ImportRow) []*importRowResponse {
+
+	responses := make([]*importRowResponse, len(rows), len(rows))
+	for i, row := range rows {
+		responses[i] = &importRowResponse{Line: row.Line, Status: "imported", ID: row.ID}
+		if row.Err != nil {
+			responses[i].Status = "failed"
+			responses[i].Error = problem.FromError(row.Err)
+		}
+	}
+
+	return responses
+}
@@ -0,0 +1,194 @@
+package handlers_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mongodb/mongo-go-driver/bson/objectid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+
+	"github.com/jcsw/go-api-learn/pkg/application/handlers"
+	"github.com/jcsw/go-api-learn/pkg/application/router"
+	"github.com/jcsw/go-api-learn/pkg/infra/database/repository"
+	"github.com/jcsw/go-api-learn/pkg/infra/jobs"
+	"github.com/jcsw/go-api-learn/pkg/service"
+)
+
+func newImportRouter(repositoryMock *repository.CustomerRepositoryMock, maxSyncRows int, pool *jobs.Pool) *router.Router {
+
+	customerAggregate := &service.CustomerAggregate{Repository: repositoryMock}
+	customerHandler := handlers.CustomerHandler{
+		CAggregate: customerAggregate,
+		Importer:   &service.CustomerImporter{Aggregate: customerAggregate, MaxSyncRows: maxSyncRows},
+		Jobs:       pool,
+	}
+
+	customerRouter := router.New()
+	customerHandler.RegisterRoutes(customerRouter)
+	customerHandler.RegisterJobs()
+	return customerRouter
+}
+
+func postImport(customerRouter *router.Router, contentType string, file string) *httptest.ResponseRecorder {
+
+	req, _ := http.NewRequest("POST", "/customer/import", strings.NewReader(file))
+	req.Header.Set("Content-Type", contentType)
+
+	response := httptest.NewRecorder()
+	customerRouter.ServeHTTP(response, req)
+	return response
+}
+
+func TestShouldImportCustomersAndReportEachRow(t *testing.T) {
+
+	repositoryMock := &repository.CustomerRepositoryMock{}
+	repositoryMock.On("InsertCustomers", mock.Anything, mock.Anything, mock.Anything).Return([]error{nil, repository.ErrDuplicateCustomer}, nil)
+
+	file := "name,city\nFernanda Lima,Limeira\nAmanda,\nMaria,Campinas\n"
+	response := postImport(newImportRouter(repositoryMock, 0, nil), "text/csv; charset=utf-8", file)
+
+	assert.Equal(t, http.StatusOK, response.Code)
+	assert.Regexp(t, `^{"total":3,"imported":1,"failed":2,"rows":\[`+
+		`{"line":2,"status":"imported","id":"[0-9a-f]{24}"},`+
+		`{"line":3,"status":"failed","error":{.*"code":"validation_failed","invalidParams":\[{"name":"city".*}\]}},`+
+		`{"line":4,"status":"failed","error":{.*"status":409.*"code":"customer_already_exists"}}\]}$`, response.Body.String())
+}
+
+func TestShouldImportNDJSON(t *testing.T) {
+
+	repositoryMock := &repository.CustomerRepositoryMock{}
+	repositoryMock.On("InsertCustomers", mock.Anything, mock.Anything, mock.Anything).Return(nil, nil)
+
+	file := `{"name":"Fernanda Lima","city":"Limeira"}` + "\n" + `{"name":"Amanda","city":"Santos"}` + "\n"
+	response := postImport(newImportRouter(repositoryMock, 0, nil), "application/x-ndjson", file)
+
+	assert.Equal(t, http.StatusOK, response.Code)
+	assert.Regexp(t, `^{"total":2,"imported":2,"failed":0,`, response.Body.String())
+}
+
+func TestShouldRejectImportWithUnsupportedContentTypeOrInvalidFile(t *testing.T) {
+
+	customerRouter := newImportRouter(&repository.CustomerRepositoryMock{}, 0, nil)
+
+	response := postImport(customerRouter, "application/json", `[{"name":"Fernanda Lima"}]`)
+	assert.Equal(t, http.StatusUnsupportedMediaType, response.Code)
+	assert.Regexp(t, `"code":"unsupported_media_type"`, response.Body.String())
+
+	response = postImport(customerRouter, "text/csv", "name,age\nFernanda Lima,30\n")
+	assert.Equal(t, http.StatusBadRequest, response.Code)
+	assert.Regexp(t, `"code":"invalid_import_header"`, response.Body.String())
+}
+
+func TestShouldRejectImportLargerThanTheLimit(t *testing.T) {
+
+	repositoryMock := &repository.CustomerRepositoryMock{}
+	repositoryMock.On("InsertCustomers", mock.Anything, mock.Anything, mock.Anything).Return(nil, nil)
+
+	file := "name,city\nFernanda Lima," + strings.Repeat("a", 9<<20) + "\n"
+	response := postImport(newImportRouter(repositoryMock, 0, nil), "text/csv", file)
+
+	assert.Equal(t, http.StatusRequestEntityTooLarge, response.Code)
+	assert.Regexp(t, `"status":413,.*"code":"request_too_large"`, response.Body.String())
+}
+
+func TestShouldImportInBackgroundByAJob(t *testing.T) {
+
+	repositoryMock := &repository.CustomerRepositoryMock{}
+	repositoryMock.On("InsertCustomers", mock.Anything, mock.Anything, mock.Anything).Return(nil, nil)
+
+	var enqueued *repository.JobEntity
+	var parts []*repository.JobPartEntity
+	jobRepositoryMock := &repository.JobRepositoryMock{}
+	jobRepositoryMock.On("InsertJob", mock.Anything, mock.Anything, mock.Anything).Return(nil).Run(func(args mock.Arguments) {
+		enqueued = args.Get(1).(*repository.JobEntity)
+		enqueued.ID = objectid.New()
+		parts = args.Get(2).([]*repository.JobPartEntity)
+	})
+
+	pool := &jobs.Pool{Repository: jobRepositoryMock, Workers: 1}
+	customerRouter := newImportRouter(repositoryMock, 1, pool)
+	response := postImport(customerRouter, "text/csv", "name,city\nFernanda Lima,Limeira\nAmanda,Santos\n")
+
+	assert.Equal(t, http.StatusAccepted, response.Code)
+	assert.Equal(t, "/jobs/"+enqueued.ID.Hex(), response.Header().Get("Location"))
+	assert.Regexp(t, `"kind":"customer.import","state":"queued"`, response.Body.String())
+	assert.Equal(t, `{"total":2}`, enqueued.Payload)
+	if assert.Len(t, parts, 1) {
+		assert.Regexp(t, `^\[{"line":2,"customer":{.*"name":"Fernanda Lima".*},{"line":3,`, parts[0].Input)
+	}
+	repositoryMock.AssertNotCalled(t, "InsertCustomers", mock.Anything, mock.Anything, mock.Anything)
+
+	finished := make(chan *repository.JobEntity, 1)
+	jobRepositoryMock.On("RequeueExpiredJobs", mock.Anything, mock.Anything, mock.Anything).Return(int64(0), nil)
+	jobRepositoryMock.On("ClaimJob", mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(enqueued, nil).Once()
+	jobRepositoryMock.On("ClaimJob", mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(nil, nil)
+	jobRepositoryMock.On("FindJobParts", mock.Anything, enqueued.ID, int64(0), int64(1)).Return(parts, nil)
+	jobRepositoryMock.On("FindJobParts", mock.Anything, enqueued.ID, int64(1), int64(1)).Return([]*repository.JobPartEntity{}, nil)
+	jobRepositoryMock.On("UpdateJobProgress", mock.Anything, enqueued, parts[0], mock.Anything).Return(false, nil)
+	jobRepositoryMock.On("FinishJob", mock.Anything, mock.Anything).Return(nil).Run(func(args mock.Arguments) {
+		finished <- args.Get(1).(*repository.JobEntity)
+	})
+
+	pool.Start(context.Background())
+	defer pool.Stop(context.Background())
+
+	select {
+	case job := <-finished:
+		assert.Equal(t, repository.JobSucceeded, job.State)
+		assert.Equal(t, `{"total":2,"imported":2,"failed":0,"results":"/jobs/`+enqueued.ID.Hex()+`/results"}`, job.Result)
+		assert.Regexp(t, `^\[{"line":2,"status":"imported","id":"[0-9a-f]{24}"},{"line":3,"status":"imported",`, parts[0].Result)
+	case <-time.After(time.Second):
+		t.Fatal("import job did not finish")
+	}
+}
+
+func TestShouldResumeTheImportJobFromTheFirstPartNotImported(t *testing.T) {
+
+	repositoryMock := &repository.CustomerRepositoryMock{}
+	repositoryMock.On("InsertCustomers", mock.Anything, mock.Anything, mock.Anything).Return(nil, nil)
+
+	requeued := &repository.JobEntity{ID: objectid.New(), Kind: handlers.CustomerImportJob, State: repository.JobRunning,
+		Payload: `{"total":2}`, Offset: 1, Counters: `{"done":1,"imported":1,"failed":0}`}
+	second := &repository.JobPartEntity{ID: objectid.New(), JobID: requeued.ID, Seq: 1,
+		Input: `[{"line":3,"customer":{"name":"Amanda","city":"Santos"}}]`}
+
+	finished := make(chan *repository.JobEntity, 1)
+	jobRepositoryMock := &repository.JobRepositoryMock{}
+	jobRepositoryMock.On("RequeueExpiredJobs", mock.Anything, mock.Anything, mock.Anything).Return(int64(0), nil)
+	jobRepositoryMock.On("ClaimJob", mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(requeued, nil).Once()
+	jobRepositoryMock.On("ClaimJob", mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(nil, nil)
+	jobRepositoryMock.On("FindJobParts", mock.Anything, requeued.ID, int64(1), int64(1)).Return([]*repository.JobPartEntity{second}, nil)
+	jobRepositoryMock.On("FindJobParts", mock.Anything, requeued.ID, int64(2), int64(1)).Return([]*repository.JobPartEntity{}, nil)
+	jobRepositoryMock.On("UpdateJobProgress", mock.Anything, requeued, second, mock.Anything).Return(false, nil)
+	jobRepositoryMock.On("FinishJob", mock.Anything, mock.Anything).Return(nil).Run(func(args mock.Arguments) {
+		finished <- args.Get(1).(*repository.JobEntity)
+	})
+
+	pool := &jobs.Pool{Repository: jobRepositoryMock, Workers: 1}
+	newImportRouter(repositoryMock, 1, pool)
+
+	pool.Start(context.Background())
+	defer pool.Stop(context.Background())
+
+	select {
+	case job := <-finished:
+		assert.Equal(t, repository.JobSucceeded, job.State)
+		assert.Equal(t, `{"total":2,"imported":2,"failed":0,"results":"/jobs/`+requeued.ID.Hex()+`/results"}`, job.Result)
+		assert.Equal(t, int64(2), job.Done)
+		assert.Equal(t, int64(2), job.Offset)
+		assert.Equal(t, `{"done":2,"imported":2,"failed":0}`, job.Counters)
+	case <-time.After(time.Second):
+		t.Fatal("import job did not finish")
+	}
+
+	inserted := repositoryMock.Calls[0].Arguments.Get(1).([]*repository.CustomerEntity)
+	if assert.Len(t, inserted, 1) {
+		assert.Equal(t, "Amanda", inserted[0].Name)
+		assert.Equal(t, `[{"line":3,"status":"imported","id":"`+inserted[0].ID.Hex()+`"}]`, second.Result)
+	}
+}
@@ -0,0 +1,77 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/jcsw/go-api-learn/pkg/application/problem"
+	"github.com/jcsw/go-api-learn/pkg/infra/events"
+)
+
+const (
+	// CustomerStreamPath the route of the stream of customer changes, it's exempt from the write timeout
+	CustomerStreamPath = "/customer/stream"
+
+	// defaultStreamHeartbeat the interval of the comments that keep an idle stream open through the proxies
+	defaultStreamHeartbeat = 15 * time.Second
+
+	// streamRetryAfter the seconds a client waits before subscribing again when the stream is full
+	streamRetryAfter = "5"
+)
+
+// streamCustomers send the customer events as Server-Sent Events until the client disconnects or the hub is closed
+// by the shutdown of the server.
+// A client that reconnects with the Last-Event-ID header first receives the events it missed, as long as
+// they are still buffered
+func (ch *CustomerHandler) streamCustomers(w http.ResponseWriter, r *http.Request) {
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		problem.Respond(w, r, problem.New(http.StatusInternalServerError, "streaming_unsupported", "Streaming is not supported"))
+		return
+	}
+
+	subscription, err := ch.Stream.Subscribe(r.Header.Get("Last-Event-ID"))
+	if err == events.ErrTooManySubscribers {
+		w.Header().Set("Retry-After", streamRetryAfter)
+		problem.Respond(w, r, problem.New(http.StatusServiceUnavailable, "too_many_subscribers", "Too many subscribers, retry later"))
+		return
+	}
+
+	if err == events.ErrHubClosed {
+		w.Header().Set("Retry-After", streamRetryAfter)
+		problem.Respond(w, r, problem.New(http.StatusServiceUnavailable, "shutting_down", "Server is shutting down, retry later"))
+		return
+	}
+	defer subscription.Close()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	heartbeat := ch.Heartbeat
+	if heartbeat <= 0 {
+		heartbeat = defaultStreamHeartbeat
+	}
+
+	ticker := time.NewTicker(heartbeat)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-ticker.C:
+			fmt.Fprint(w, ": heartbeat\n\n")
+		case event, open := <-subscription.Events():
+			if !open {
+				return
+			}
+			fmt.Fprintf(w, "id: %s\nevent: %s\ndata: %s\n\n", event.ID, event.Type, event.Payload)
+		}
+		flusher.Flush()
+	}
+}
@@ -0,0 +1,133 @@
+package handlers_test
+
+import (
+	"bufio"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/jcsw/go-api-learn/pkg/application/handlers"
+	"github.com/jcsw/go-api-learn/pkg/application/router"
+	"github.com/jcsw/go-api-learn/pkg/infra/events"
+	"github.com/jcsw/go-api-learn/pkg/service"
+)
+
+func newStreamServer(t *testing.T, hub *events.Hub, heartbeat time.Duration) *httptest.Server {
+
+	customerHandler := handlers.CustomerHandler{CAggregate: &service.CustomerAggregate{}, Stream: hub, Heartbeat: heartbeat}
+
+	customerRouter := router.New()
+	customerHandler.RegisterRoutes(customerRouter)
+
+	server := httptest.NewServer(customerRouter)
+	t.Cleanup(server.Close)
+	return server
+}
+
+func openStream(t *testing.T, url string, lastEventID string) (*http.Response, *bufio.Reader) {
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	t.Cleanup(cancel)
+
+	req, err := http.NewRequest("GET", url+"/customer/stream", nil)
+	assert.NoError(t, err)
+
+	if lastEventID != "" {
+		req.Header.Set("Last-Event-ID", lastEventID)
+	}
+
+	resp, err := http.DefaultClient.Do(req.WithContext(ctx))
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	t.Cleanup(func() { resp.Body.Close() })
+
+	return resp, bufio.NewReader(resp.Body)
+}
+
+// readMessage read the lines of the next message of the stream
+func readMessage(t *testing.T, reader *bufio.Reader) string {
+
+	message := []string{}
+	for {
+		line, err := reader.ReadString('\n')
+		if !assert.NoError(t, err) {
+			return strings.Join(message, "\n")
+		}
+
+		line = strings.TrimSuffix(line, "\n")
+		if line == "" {
+			return strings.Join(message, "\n")
+		}
+		message = append(message, line)
+	}
+}
+
+func TestShouldStreamMissedAndLiveCustomerEvents(t *testing.T) {
+
+	hub := events.NewHub(10, 10)
+	hub.Publish(context.Background(), &events.Event{ID: "1", Type: "CustomerCreated", Payload: []byte(`{"id":"1"}`)})
+	hub.Publish(context.Background(), &events.Event{ID: "2", Type: "CustomerUpdated", Payload: []byte(`{"id":"2"}`)})
+
+	server := newStreamServer(t, hub, time.Minute)
+	resp, reader := openStream(t, server.URL, "1")
+
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+	assert.Equal(t, "id: 2\nevent: CustomerUpdated\ndata: {\"id\":\"2\"}", readMessage(t, reader))
+
+	hub.Publish(context.Background(), &events.Event{ID: "3", Type: "CustomerDeleted", Payload: []byte(`{"id":"3"}`)})
+	assert.Equal(t, "id: 3\nevent: CustomerDeleted\ndata: {\"id\":\"3\"}", readMessage(t, reader))
+}
+
+func TestShouldSendHeartbeatsWhileStreamIsIdle(t *testing.T) {
+
+	server := newStreamServer(t, events.NewHub(10, 10), 10*time.Millisecond)
+	_, reader := openStream(t, server.URL, "")
+
+	assert.Equal(t, ": heartbeat", readMessage(t, reader))
+}
+
+func TestShouldEndTheStreamWhenTheServerShutsDown(t *testing.T) {
+
+	hub := events.NewHub(10, 10)
+	server := newStreamServer(t, hub, time.Minute)
+	server.Config.RegisterOnShutdown(hub.Close)
+
+	resp, reader := openStream(t, server.URL, "")
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	assert.NoError(t, server.Config.Shutdown(ctx))
+
+	_, err := reader.ReadString('\n')
+	assert.Error(t, err)
+}
+
+func TestShouldReturn503WhenStreamHasTooManySubscribers(t *testing.T) {
+
+	hub := events.NewHub(10, 1)
+	subscription, err := hub.Subscribe("")
+	assert.NoError(t, err)
+	defer subscription.Close()
+
+	req, err := http.NewRequest("GET", "/customer/stream", nil)
+	assert.NoError(t, err)
+
+	resp := httptest.NewRecorder()
+
+	customerHandler := handlers.CustomerHandler{CAggregate: &service.CustomerAggregate{}, Stream: hub}
+	customerRouter := router.New()
+	customerHandler.RegisterRoutes(customerRouter)
+	customerRouter.ServeHTTP(resp, req)
+
+	assert.Equal(t, http.StatusServiceUnavailable, resp.Code)
+	assert.Equal(t, "5", resp.Header().Get("Retry-After"))
+	assert.Regexp(t, `"status":503,.*"code":"too_many_subscribers"`, resp.Body.String())
+}
@@ -0,0 +1,98 @@
+package handlers
+
+import (
+	"encoding/xml"
+	"time"
+
+	"github.com/jcsw/go-api-learn/pkg/domain"
+)
+
+// xmlCustomer the customer in XML, the elements are named like the fields in JSON
+type xmlCustomer struct {
+	XMLName   xml.Name              `xml:"customer"`
+	ID        string                `xml:"id"`
+	Name      string                `xml:"name"`
+	City      string                `xml:"city"`
+	Email     string                `xml:"email,omitempty"`
+	Phone     string                `xml:"phone,omitempty"`
+	Document  string                `xml:"document,omitempty"`
+	Addresses []xmlAddress          `xml:"addresses>address,omitempty"`
+	Status    domain.CustomerStatus `xml:"status"`
+	CreatedAt time.Time             `xml:"createdAt"`
+	UpdatedAt time.Time             `xml:"updatedAt"`
+	Version   int64                 `xml:"version"`
+}
+
+// xmlAddress the address of the customer in XML, it has the fields of domain.Address
+type xmlAddress struct {
+	Type       domain.AddressType `xml:"type"`
+	Street     string             `xml:"street"`
+	Number     string             `xml:"number,omitempty"`
+	Complement string             `xml:"complement,omitempty"`
+	District   string             `xml:"district,omitempty"`
+	City       string             `xml:"city"`
+	State      string             `xml:"state,omitempty"`
+	PostalCode string             `xml:"postalCode,omitempty"`
+	Country    string             `xml:"country,omitempty"`
+}
+
+// xmlCustomerPage the envelope of a customer listing in XML
+type xmlCustomerPage struct {
+	XMLName xml.Name       `xml:"customers"`
+	Data    []*xmlCustomer `xml:"customer"`
+	Next    string         `xml:"next,omitempty"`
+}
+
+func newXMLCustomer(customer *domain.Customer) *xmlCustomer {
+
+	element := &xmlCustomer{
+		ID:        customer.ID,
+		Name:      customer.Name,
+		City:      customer.City,
+		Email:     customer.Email,
+		Phone:     customer.Phone,
+		Document:  customer.Document,
+		Status:    customer.Status,
+		CreatedAt: customer.CreatedAt,
+		UpdatedAt: customer.UpdatedAt,
+		Version:   customer.Version,
+	}
+
+	for _, address := range customer.Addresses {
+		element.Addresses = append(element.Addresses, xmlAddress(address))
+	}
+
+	return element
+}
+
+func newXMLCustomerPage(page *customerPageResponse) *xmlCustomerPage {
+
+	element := &xmlCustomerPage{Next: page.Next}
+	for _, customer := range page.Data {
+		element.Data = append(element.Data, newXMLCustomer(customer))
+	}
+
+	return element
+}
+
+func (element *xmlCustomer) toDomain() *domain.Customer {
+
+	customer := &domain.Customer{
+		ID:        element.ID,
+		Name:      element.Name,
+		City:      element.City,
+		Email:     element.Email,
+		Phone:     element.Phone,
+		Document:  element.Document,
+		Status:    element.Status,
+		CreatedAt: element.CreatedAt,
+		UpdatedAt: element.UpdatedAt,
+		Version:   element.Version,
+	}
+
+	for _, address := range element.Addresses {
+		customer.Addresses = append(customer.Addresses, domain.Address(address))
+	}
+
+	return customer
+}
@@ -0,0 +1,60 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/jcsw/go-api-learn/pkg/application/problem"
+	"github.com/jcsw/go-api-learn/pkg/service"
+)
+
+// weakPrefix the prefix of a weak entity tag
+const weakPrefix = "W/"
+
+// customerETag the strong entity tag of a version of the customer
+func customerETag(version int64) string {
+	return `"` + strconv.FormatInt(version, 10) + `"`
+}
+
+// expectedVersion read the version a write is based on from If-Match, "*" matches any version.
+// It responds 428 when the header is missing and 412 when it's not a tag of this API, ok is false in both cases
+func expectedVersion(w http.ResponseWriter, r *http.Request) (version int64, ok bool) {
+
+	ifMatch := strings.TrimSpace(r.Header.Get("If-Match"))
+	if ifMatch == "" {
+		problem.Respond(w, r, problem.New(http.StatusPreconditionRequired, "precondition_required", "If-Match header is required"))
+		return 0, false
+	}
+
+	if ifMatch == "*" {
+		return service.AnyVersion, true
+	}
+
+	// If-Match uses the strong comparison, a weak tag never matches
+	version, err := strconv.ParseInt(strings.TrimSuffix(strings.TrimPrefix(ifMatch, `"`), `"`), 10, 64)
+	if err != nil || version < 0 || customerETag(version) != ifMatch {
+		problem.RespondWithError(w, r, service.ErrCustomerVersionMismatch)
+		return 0, false
+	}
+
+	return version, true
+}
+
+// noneMatch report whether If-None-Match does not match the entity tag, it uses the weak comparison
+func noneMatch(r *http.Request, etag string) bool {
+
+	ifNoneMatch := r.Header.Get("If-None-Match")
+	if ifNoneMatch == "" {
+		return true
+	}
+
+	for _, tag := range strings.Split(ifNoneMatch, ",") {
+		tag = strings.TrimSpace(tag)
+		if tag == "*" || strings.TrimPrefix(tag, weakPrefix) == strings.TrimPrefix(etag, weakPrefix) {
+			return false
+		}
+	}
+
+	return true
+}
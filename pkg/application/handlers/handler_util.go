@@ -1,10 +1,23 @@
 package handlers
 
 import (
+	"crypto/subtle"
 	"encoding/json"
+	"errors"
+	"io"
 	"net/http"
+	"strings"
+
+	"github.com/jcsw/go-api-learn/pkg/application/problem"
+	"github.com/jcsw/go-api-learn/pkg/application/router"
 )
 
+// bearerPrefix the scheme of the Authorization header carrying a token
+const bearerPrefix = "Bearer "
+
+// errBodyTooLarge Error for a request body larger than the limit of its route
+var errBodyTooLarge = errors.New("request body too large")
+
 func respondWithCode(w http.ResponseWriter, code int) {
 	w.WriteHeader(code)
 }
@@ -16,6 +29,65 @@ func respondWithJSON(w http.ResponseWriter, code int, payload interface{}) {
 	w.Write(response)
 }
 
-func respondWithError(w http.ResponseWriter, code int, message string) {
-	respondWithJSON(w, code, map[string]string{"error": message})
+// limitRequestBody fail reading the request body with errBodyTooLarge when it's larger than maxBytes
+func limitRequestBody(maxBytes int64) router.Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			r.Body = limitedBody{ReadCloser: http.MaxBytesReader(w, r.Body, maxBytes)}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// limitedBody a body read by http.MaxBytesReader, its error has no type to match until go 1.19
+// so it's replaced by errBodyTooLarge
+type limitedBody struct {
+	io.ReadCloser
+}
+
+func (body limitedBody) Read(p []byte) (int, error) {
+	n, err := body.ReadCloser.Read(p)
+	if err != nil && err.Error() == "http: request body too large" {
+		return n, errBodyTooLarge
+	}
+	return n, err
+}
+
+// respondWithBodyError answer 413 when the request body was larger than the limit of its route,
+// and the problem of err otherwise
+func respondWithBodyError(w http.ResponseWriter, r *http.Request, bodyErr error, err error) {
+
+	if errors.Is(bodyErr, errBodyTooLarge) {
+		problem.Respond(w, r, problem.New(http.StatusRequestEntityTooLarge, "request_too_large", "Request body too large"))
+		return
+	}
+
+	problem.RespondWithError(w, r, err)
+}
+
+// HasBearerToken report whether the Authorization header carries the bearer token, never when the token is empty
+func HasBearerToken(authorization string, token string) bool {
+	return token != "" && strings.HasPrefix(authorization, bearerPrefix) &&
+		subtle.ConstantTimeCompare([]byte(strings.TrimPrefix(authorization, bearerPrefix)), []byte(token)) == 1
+}
+
+// requireToken answer 401 when the request does not carry the bearer token, every request is forbidden when the token is empty
+func requireToken(token string) router.Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+			if token == "" {
+				problem.Respond(w, r, problem.New(http.StatusForbidden, "forbidden", "Route is disabled"))
+				return
+			}
+
+			if !HasBearerToken(r.Header.Get("Authorization"), token) {
+				w.Header().Set("WWW-Authenticate", "Bearer")
+				problem.Respond(w, r, problem.New(http.StatusUnauthorized, "unauthorized", "A valid bearer token is required"))
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
 }
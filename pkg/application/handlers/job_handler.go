@@ -0,0 +1,111 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/jcsw/go-api-learn/pkg/application/problem"
+	"github.com/jcsw/go-api-learn/pkg/application/router"
+	"github.com/jcsw/go-api-learn/pkg/infra/jobs"
+	"github.com/jcsw/go-api-learn/pkg/service"
+)
+
+// JobHandler handler to "/jobs", the status and the cancellation of the jobs run in background
+type JobHandler struct {
+	Pool *jobs.Pool
+}
+
+const (
+	jobPath        = "/jobs"
+	jobByIDPath    = "/jobs/{id}"
+	jobResultsPath = "/jobs/{id}/results"
+)
+
+// jobResultsResponse a page of the results of the parts of a job, Next is the link to the next page
+type jobResultsResponse struct {
+	Data []json.RawMessage `json:"data"`
+	Next string            `json:"next,omitempty"`
+}
+
+// RegisterRoutes register the routes of "/jobs/{id}"
+func (jh *JobHandler) RegisterRoutes(jobRouter *router.Router) {
+	jobRouter.HandleFunc("GET", jobByIDPath, jh.getJobByID)
+	jobRouter.HandleFunc("DELETE", jobByIDPath, jh.cancelJob)
+	jobRouter.HandleFunc("GET", jobResultsPath, jh.getJobResults)
+}
+
+func (jh *JobHandler) getJobByID(w http.ResponseWriter, r *http.Request) {
+
+	job, err := jh.Pool.Find(r.Context(), router.Param(r, "id"))
+	if err != nil {
+		respondWithJobError(w, r, err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, job)
+}
+
+// cancelJob cancel the job and answer with its status, a running job is still running until its handler stops
+func (jh *JobHandler) cancelJob(w http.ResponseWriter, r *http.Request) {
+
+	job, err := jh.Pool.Cancel(r.Context(), router.Param(r, "id"))
+	if err != nil {
+		respondWithJobError(w, r, err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, job)
+}
+
+// getJobResults answer a page of the results of the parts done by the job, "after" is the count of parts skipped
+func (jh *JobHandler) getJobResults(w http.ResponseWriter, r *http.Request) {
+
+	params := r.URL.Query()
+
+	limit := service.DefaultPageLimit
+	if value := params.Get("limit"); value != "" {
+		var err error
+		if limit, err = strconv.Atoi(value); err != nil || limit < 0 || limit > service.MaxPageLimit {
+			problem.RespondWithError(w, r, service.ErrInvalidLimit)
+			return
+		}
+		if limit == 0 {
+			limit = service.DefaultPageLimit
+		}
+	}
+
+	after := int64(0)
+	if value := params.Get("after"); value != "" {
+		var err error
+		if after, err = strconv.ParseInt(value, 10, 64); err != nil || after < 0 {
+			problem.RespondWithError(w, r, service.ErrInvalidCursor)
+			return
+		}
+	}
+
+	results, err := jh.Pool.Results(r.Context(), router.Param(r, "id"), after, int64(limit))
+	if err != nil {
+		respondWithJobError(w, r, err)
+		return
+	}
+
+	response := jobResultsResponse{Data: results}
+	if len(results) == limit {
+		params.Set("after", strconv.FormatInt(after+int64(limit), 10))
+		response.Next = (&url.URL{Path: r.URL.Path, RawQuery: params.Encode()}).String()
+	}
+
+	respondWithJSON(w, http.StatusOK, response)
+}
+
+func respondWithJobError(w http.ResponseWriter, r *http.Request, err error) {
+
+	if err == jobs.ErrJobNotFound {
+		problem.Respond(w, r, problem.New(http.StatusNotFound, "job_not_found", "Job not found"))
+		return
+	}
+
+	problem.RespondWithError(w, r, err)
+}
@@ -0,0 +1,102 @@
+package handlers_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/mongodb/mongo-go-driver/bson/objectid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+
+	"github.com/jcsw/go-api-learn/pkg/application/handlers"
+	"github.com/jcsw/go-api-learn/pkg/application/router"
+	"github.com/jcsw/go-api-learn/pkg/infra/database/repository"
+	"github.com/jcsw/go-api-learn/pkg/infra/jobs"
+)
+
+func serveJobRequest(repositoryMock *repository.JobRepositoryMock, method string, url string) *httptest.ResponseRecorder {
+
+	jobHandler := handlers.JobHandler{Pool: &jobs.Pool{Repository: repositoryMock}}
+
+	jobRouter := router.New()
+	jobHandler.RegisterRoutes(jobRouter)
+
+	req, _ := http.NewRequest(method, url, nil)
+	response := httptest.NewRecorder()
+	jobRouter.ServeHTTP(response, req)
+	return response
+}
+
+func TestShouldGetJobWithItsProgress(t *testing.T) {
+
+	job := &repository.JobEntity{
+		ID:        objectid.New(),
+		Kind:      "customer.import",
+		State:     repository.JobRunning,
+		Done:      500,
+		Total:     2000,
+		Attempts:  1,
+		CreatedAt: time.Date(2018, 10, 8, 12, 0, 0, 0, time.UTC),
+		StartedAt: time.Date(2018, 10, 8, 12, 0, 1, 0, time.UTC),
+	}
+
+	repositoryMock := &repository.JobRepositoryMock{}
+	repositoryMock.On("FindJobByID", mock.Anything, job.ID).Return(job, nil)
+
+	response := serveJobRequest(repositoryMock, "GET", "/jobs/"+job.ID.Hex())
+
+	assert.Equal(t, http.StatusOK, response.Code)
+	assert.Equal(t, `{"id":"`+job.ID.Hex()+`","kind":"customer.import","state":"running","progress":{"done":500,"total":2000},`+
+		`"attempts":1,"createdAt":"2018-10-08T12:00:00Z","startedAt":"2018-10-08T12:00:01Z"}`, response.Body.String())
+}
+
+func TestShouldCancelJob(t *testing.T) {
+
+	job := &repository.JobEntity{ID: objectid.New(), Kind: "customer.import", State: repository.JobCanceled, Result: `{"total":2}`}
+
+	repositoryMock := &repository.JobRepositoryMock{}
+	repositoryMock.On("CancelJob", mock.Anything, job.ID, mock.Anything).Return(job, nil)
+
+	response := serveJobRequest(repositoryMock, "DELETE", "/jobs/"+job.ID.Hex())
+
+	assert.Equal(t, http.StatusOK, response.Code)
+	assert.Regexp(t, `"state":"canceled","progress":{"done":0,"total":0},"result":{"total":2}`, response.Body.String())
+}
+
+func TestShouldNotFindJob(t *testing.T) {
+
+	repositoryMock := &repository.JobRepositoryMock{}
+	repositoryMock.On("FindJobByID", mock.Anything, mock.Anything).Return(nil, nil)
+	repositoryMock.On("CancelJob", mock.Anything, mock.Anything, mock.Anything).Return(nil, nil)
+
+	for _, method := range []string{"GET", "DELETE"} {
+		response := serveJobRequest(repositoryMock, method, "/jobs/5bbb50ab0c3b8a1b5c3c1d2e")
+		assert.Equal(t, http.StatusNotFound, response.Code, method)
+		assert.Regexp(t, `"code":"job_not_found"`, response.Body.String(), method)
+	}
+}
+
+func TestShouldGetTheResultsOfTheJobAPageAtATime(t *testing.T) {
+
+	job := &repository.JobEntity{ID: objectid.New(), Kind: "customer.import", State: repository.JobRunning}
+
+	repositoryMock := &repository.JobRepositoryMock{}
+	repositoryMock.On("FindJobByID", mock.Anything, job.ID).Return(job, nil)
+	repositoryMock.On("FindJobParts", mock.Anything, job.ID, int64(2), int64(2)).Return([]*repository.JobPartEntity{
+		{Seq: 2, Result: `[{"line":4}]`},
+		{Seq: 3, Result: `[{"line":5}]`},
+	}, nil)
+
+	response := serveJobRequest(repositoryMock, "GET", "/jobs/"+job.ID.Hex()+"/results?after=2&limit=2")
+
+	assert.Equal(t, http.StatusOK, response.Code)
+	assert.Equal(t, `{"data":[[{"line":4}],[{"line":5}]],"next":"/jobs/`+job.ID.Hex()+`/results?after=4\u0026limit=2"}`, response.Body.String())
+
+	response = serveJobRequest(repositoryMock, "GET", "/jobs/"+job.ID.Hex()+"/results?after=-1")
+	assert.Equal(t, http.StatusBadRequest, response.Code)
+
+	response = serveJobRequest(repositoryMock, "GET", "/jobs/"+job.ID.Hex()+"/results?limit=x")
+	assert.Equal(t, http.StatusBadRequest, response.Code)
+}
@@ -3,7 +3,9 @@ package handlers
 import (
 	"net/http"
 
+	"github.com/jcsw/go-api-learn/pkg/infra/cache"
 	"github.com/jcsw/go-api-learn/pkg/infra/database"
+	"github.com/jcsw/go-api-learn/pkg/infra/properties"
 )
 
 type monitorComponent struct {
@@ -14,7 +16,15 @@ type monitorComponent struct {
 // MonitorHandler function to handle "/monitor"
 func MonitorHandler(w http.ResponseWriter, r *http.Request) {
 	monitors := []monitorComponent{}
-	monitors = append(monitors, retriveMongoDBStatus())
+	if properties.AppProperties.Storage.Backend == properties.StorageCassandra {
+		monitors = append(monitors, retriveCassandraStatus())
+	} else {
+		monitors = append(monitors, retriveMongoDBStatus())
+	}
+
+	if cacheBackend := properties.AppProperties.Cache.Backend; cacheBackend == properties.CacheRedis || cacheBackend == properties.CacheTwoTier {
+		monitors = append(monitors, retriveRedisStatus())
+	}
 	respondWithJSON(w, http.StatusOK, monitors)
 }
 
@@ -28,3 +38,25 @@ func retriveMongoDBStatus() monitorComponent {
 
 	return mongoDBStatus
 }
+
+func retriveCassandraStatus() monitorComponent {
+	cassandraStatus := monitorComponent{Component: "Cassandra"}
+	if database.IsCassandraSessionAlive() {
+		cassandraStatus.Status = "OK"
+	} else {
+		cassandraStatus.Status = "ERROR"
+	}
+
+	return cassandraStatus
+}
+
+func retriveRedisStatus() monitorComponent {
+	redisStatus := monitorComponent{Component: "Redis"}
+	if cache.IsRedisAlive() {
+		redisStatus.Status = "OK"
+	} else {
+		redisStatus.Status = "ERROR"
+	}
+
+	return redisStatus
+}
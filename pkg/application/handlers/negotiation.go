@@ -0,0 +1,188 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"mime"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/jcsw/go-api-learn/pkg/application/problem"
+	"github.com/jcsw/go-api-learn/pkg/application/router"
+)
+
+// Codecs the codecs of the negotiated routes, the first one answers the clients that accept any media type
+type Codecs []Codec
+
+// DefaultCodecs JSON, XML, MessagePack and Protobuf, JSON is the default
+var DefaultCodecs = Codecs{JSONCodec{}, XMLCodec{}, MessagePackCodec{}, ProtobufCodec{}}
+
+// mediaRange a media range of Accept with its quality
+type mediaRange struct {
+	mediaType string
+	quality   float64
+}
+
+// ForAccept return the codec the client prefers by Accept, the first codec when there is no Accept and nil when
+// no codec is acceptable. On a tie the codec that comes first wins
+func (codecs Codecs) ForAccept(accept string) Codec {
+
+	if strings.TrimSpace(accept) == "" {
+		return codecs[0]
+	}
+
+	ranges := parseAccept(accept)
+
+	var preferred Codec
+	preferredQuality := 0.0
+	for _, codec := range codecs {
+		if quality := acceptQuality(ranges, mediaTypeOf(codec.ContentType())); quality > preferredQuality {
+			preferred, preferredQuality = codec, quality
+		}
+	}
+
+	return preferred
+}
+
+// ForContentType return the codec of the media type of Content-Type, nil when there is none
+func (codecs Codecs) ForContentType(contentType string) Codec {
+
+	mediaType := mediaTypeOf(contentType)
+	for _, codec := range codecs {
+		if mediaTypeOf(codec.ContentType()) == mediaType {
+			return codec
+		}
+	}
+
+	return nil
+}
+
+func (codecs Codecs) mediaTypes() string {
+
+	mediaTypes := make([]string, len(codecs), len(codecs))
+	for i, codec := range codecs {
+		mediaTypes[i] = mediaTypeOf(codec.ContentType())
+	}
+
+	return strings.Join(mediaTypes, ", ")
+}
+
+// parseAccept read the media ranges of Accept, the most specific first, the invalid ones are ignored
+func parseAccept(accept string) []mediaRange {
+
+	ranges := []mediaRange{}
+	for _, value := range strings.Split(accept, ",") {
+		mediaType, params, err := mime.ParseMediaType(value)
+		if err != nil {
+			continue
+		}
+
+		quality := 1.0
+		if q, ok := params["q"]; ok {
+			if quality, err = strconv.ParseFloat(q, 64); err != nil {
+				continue
+			}
+		}
+
+		ranges = append(ranges, mediaRange{mediaType: mediaType, quality: quality})
+	}
+
+	sort.SliceStable(ranges, func(i, j int) bool {
+		return strings.Count(ranges[i].mediaType, "*") < strings.Count(ranges[j].mediaType, "*")
+	})
+
+	return ranges
+}
+
+// acceptQuality the quality of the most specific range matching the media type, zero when none matches
+func acceptQuality(ranges []mediaRange, mediaType string) float64 {
+
+	for _, r := range ranges {
+		if r.mediaType == mediaType || r.mediaType == "*/*" ||
+			(strings.HasSuffix(r.mediaType, "/*") && strings.HasPrefix(mediaType, strings.TrimSuffix(r.mediaType, "*"))) {
+			return r.quality
+		}
+	}
+
+	return 0
+}
+
+func mediaTypeOf(contentType string) string {
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	return mediaType
+}
+
+// negotiation the codec chosen for the response and the codecs of the route
+type negotiation struct {
+	codec  Codec
+	codecs Codecs
+}
+
+type negotiationKey struct{}
+
+// negotiate choose the codec of the response by Accept and write the problems of the route with it,
+// it answers 406 when the client accepts none of the codecs
+func negotiate(codecs Codecs) router.Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+			w.Header().Add("Vary", "Accept")
+
+			codec := codecs.ForAccept(r.Header.Get("Accept"))
+			if codec == nil {
+				problem.Respond(w, r, problem.New(http.StatusNotAcceptable, "not_acceptable", "Accept must allow one of "+codecs.mediaTypes()))
+				return
+			}
+
+			ctx := context.WithValue(problem.WithEncoder(r.Context(), codec), negotiationKey{}, &negotiation{codec: codec, codecs: codecs})
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// respondWithPayload write the payload with the codec negotiated, in JSON when the route is not negotiated
+func respondWithPayload(w http.ResponseWriter, r *http.Request, code int, payload interface{}) {
+
+	var codec Codec = JSONCodec{}
+	if negotiated, ok := r.Context().Value(negotiationKey{}).(*negotiation); ok {
+		codec = negotiated.codec
+	}
+
+	response := bytes.Buffer{}
+	if err := codec.Encode(&response, payload); err != nil {
+		problem.RespondWithError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", codec.ContentType())
+	w.WriteHeader(code)
+	w.Write(response.Bytes())
+}
+
+// decodePayload read the request body with the codec of its Content-Type, JSON when it has none.
+// It answers 415 when no codec reads the media type, 413 when the body is too large and 400 when it can not be decoded,
+// ok is false in these cases
+func decodePayload(w http.ResponseWriter, r *http.Request, payload interface{}) (ok bool) {
+
+	codecs := Codecs{JSONCodec{}}
+	if negotiated, ok := r.Context().Value(negotiationKey{}).(*negotiation); ok {
+		codecs = negotiated.codecs
+	}
+
+	codec := Codec(JSONCodec{})
+	if contentType := r.Header.Get("Content-Type"); contentType != "" {
+		if codec = codecs.ForContentType(contentType); codec == nil {
+			problem.Respond(w, r, problem.New(http.StatusUnsupportedMediaType, "unsupported_media_type", "Content-Type must be one of "+codecs.mediaTypes()))
+			return false
+		}
+	}
+
+	if err := codec.Decode(r.Body, payload); err != nil {
+		respondWithBodyError(w, r, err, errInvalidPayload)
+		return false
+	}
+
+	return true
+}
@@ -0,0 +1,183 @@
+package handlers_test
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/vmihailenco/msgpack/v5"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/jcsw/go-api-learn/pkg/application/customerpb"
+	"github.com/jcsw/go-api-learn/pkg/application/handlers"
+	"github.com/jcsw/go-api-learn/pkg/application/router"
+	"github.com/jcsw/go-api-learn/pkg/domain"
+	"github.com/jcsw/go-api-learn/pkg/infra/database/repository"
+	"github.com/jcsw/go-api-learn/pkg/service"
+)
+
+func serveNegotiated(repositoryMock *repository.CustomerRepositoryMock, req *http.Request) *httptest.ResponseRecorder {
+
+	aggregate := service.CustomerAggregate{Repository: repositoryMock, CacheStore: mockCustomerCacheStoreDefault()}
+	customerHandler := handlers.CustomerHandler{CAggregate: &aggregate}
+
+	customerRouter := router.New()
+	customerHandler.RegisterRoutes(customerRouter)
+
+	response := httptest.NewRecorder()
+	customerRouter.ServeHTTP(response, req)
+	return response
+}
+
+func TestShouldChooseTheCodecTheClientPrefers(t *testing.T) {
+
+	tests := []struct {
+		accept      string
+		contentType string
+	}{
+		{"", "application/json; charset=UTF-8"},
+		{"*/*", "application/json; charset=UTF-8"},
+		{"application/xml", "application/xml; charset=UTF-8"},
+		{"text/html, application/xml;q=0.9, */*;q=0.8", "application/xml; charset=UTF-8"},
+		{"application/json;q=0.5, application/msgpack", "application/msgpack"},
+		{"application/*;q=0.2, application/x-protobuf", "application/x-protobuf"},
+		{"application/json;q=0, */*", "application/xml; charset=UTF-8"},
+	}
+
+	for _, tc := range tests {
+		codec := handlers.DefaultCodecs.ForAccept(tc.accept)
+		if assert.NotNil(t, codec, tc.accept) {
+			assert.Equal(t, tc.contentType, codec.ContentType(), tc.accept)
+		}
+	}
+
+	assert.Nil(t, handlers.DefaultCodecs.ForAccept("text/html, image/*"))
+	assert.Nil(t, handlers.DefaultCodecs.ForAccept("application/json;q=0"))
+}
+
+func TestShouldRespondWithTheCustomerInTheAcceptedMediaType(t *testing.T) {
+
+	get := func(accept string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest("GET", "/customer/"+customerAmandaID.Hex(), nil)
+		req.Header.Set("Accept", accept)
+		return serveNegotiated(mockFindCustomerByIDSuccesfull(), req)
+	}
+
+	response := get("application/xml")
+	assert.Equal(t, http.StatusOK, response.Code)
+	assert.Equal(t, "application/xml; charset=UTF-8", response.Header().Get("Content-Type"))
+	assert.Equal(t, "Accept", response.Header().Get("Vary"))
+	assert.Regexp(t, `^<\?xml version="1.0" encoding="UTF-8"\?>\n<customer><id>`+customerAmandaID.Hex()+`</id><name>Amanda</name>`+
+		`.*<addresses><address><type>home</type><street>Rua Augusta</street>.*</addresses><status>active</status>`+
+		`<createdAt>2018-10-07T12:30:00Z</createdAt>.*<version>2</version></customer>$`, response.Body.String())
+
+	response = get("application/msgpack")
+	assert.Equal(t, "application/msgpack", response.Header().Get("Content-Type"))
+	decoded := map[string]interface{}{}
+	assert.NoError(t, msgpack.Unmarshal(response.Body.Bytes(), &decoded))
+	assert.Equal(t, "Amanda", decoded["name"])
+	assert.Equal(t, "+5511987654321", decoded["phone"])
+	assert.NotContains(t, decoded, "XMLName")
+
+	response = get("application/x-protobuf")
+	assert.Equal(t, "application/x-protobuf", response.Header().Get("Content-Type"))
+	message := &customerpb.Customer{}
+	assert.NoError(t, proto.Unmarshal(response.Body.Bytes(), message))
+	assert.Equal(t, customerAmandaID.Hex(), message.GetId())
+	assert.Equal(t, "Rua Augusta", message.GetAddresses()[0].GetStreet())
+	assert.Equal(t, customerAmandaCreatedAt, message.GetCreatedAt().AsTime())
+	assert.Equal(t, int64(2), message.GetVersion())
+}
+
+func TestShouldCreateCustomerSentInTheMediaTypeOfContentType(t *testing.T) {
+
+	newCustomer := &domain.Customer{Name: "Fernanda Lima", City: "Limeira"}
+
+	msgpackPayload, _ := msgpack.Marshal(map[string]string{"name": "Fernanda Lima", "city": "Limeira"})
+	protobufPayload, _ := proto.Marshal(customerpb.FromDomain(newCustomer))
+
+	tests := []struct {
+		contentType string
+		payload     []byte
+	}{
+		{"application/json", []byte(`{"name":"Fernanda Lima","city":"Limeira"}`)},
+		{"application/xml", []byte(`<customer><name>Fernanda Lima</name><city>Limeira</city></customer>`)},
+		{"application/msgpack", msgpackPayload},
+		{"application/x-protobuf", protobufPayload},
+	}
+
+	for _, tc := range tests {
+		req, _ := http.NewRequest("POST", "/customer", bytes.NewReader(tc.payload))
+		req.Header.Set("Content-Type", tc.contentType)
+		req.Header.Set("Accept", "application/json")
+
+		response := serveNegotiated(mockCreateCustomerSuccesfull(), req)
+
+		assert.Equal(t, http.StatusOK, response.Code, tc.contentType)
+		assert.Regexp(t, `"name":"Fernanda Lima","city":"Limeira","status":"active"`, response.Body.String(), tc.contentType)
+	}
+}
+
+func TestShouldRespondWithThePageOfCustomersInXML(t *testing.T) {
+
+	req, _ := http.NewRequest("GET", "/customer", nil)
+	req.Header.Set("Accept", "application/xml")
+
+	response := serveNegotiated(mockFindCustomersSuccesfull(), req)
+	assert.Equal(t, http.StatusOK, response.Code)
+	assert.Regexp(t, `^<\?xml version="1.0" encoding="UTF-8"\?>\n<customers><customer><id>[0-9a-f]{24}</id><name>Amanda</name>`+
+		`<city>São Paulo</city>.*</customer></customers>$`, response.Body.String())
+}
+
+func TestShouldRefusePayloadLargerThanTheLimit(t *testing.T) {
+
+	req, _ := http.NewRequest("POST", "/customer", strings.NewReader(`{"name":"`+strings.Repeat("a", 1<<20)+`","city":"Limeira"}`))
+	req.Header.Set("Content-Type", "application/json")
+
+	response := serveNegotiated(mockCreateCustomerSuccesfull(), req)
+	assert.Equal(t, http.StatusRequestEntityTooLarge, response.Code)
+	assert.Regexp(t, `"status":413,.*"code":"request_too_large"`, response.Body.String())
+}
+
+func TestShouldRefuseMediaTypesWithoutCodec(t *testing.T) {
+
+	req, _ := http.NewRequest("GET", "/customer/"+customerAmandaID.Hex(), nil)
+	req.Header.Set("Accept", "text/html")
+
+	response := serveNegotiated(mockFindCustomerByIDSuccesfull(), req)
+	assert.Equal(t, http.StatusNotAcceptable, response.Code)
+	assert.Equal(t, "application/problem+json", response.Header().Get("Content-Type"))
+	assert.Regexp(t, `"code":"not_acceptable"`, response.Body.String())
+
+	req, _ = http.NewRequest("POST", "/customer", bytes.NewBufferString("name=Fernanda"))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	response = serveNegotiated(mockCreateCustomerSuccesfull(), req)
+	assert.Equal(t, http.StatusUnsupportedMediaType, response.Code)
+	assert.Regexp(t, `"code":"unsupported_media_type"`, response.Body.String())
+}
+
+func TestShouldRespondWithTheProblemInTheAcceptedMediaType(t *testing.T) {
+
+	get := func(accept string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest("GET", "/customer/5bbb50ab0c3b8a1b5c3c1d2e", nil)
+		req.Header.Set("Accept", accept)
+		return serveNegotiated(mockCustomerRepositoryDefault(), req)
+	}
+
+	response := get("application/xml")
+	assert.Equal(t, http.StatusNotFound, response.Code)
+	assert.Equal(t, "application/problem+xml", response.Header().Get("Content-Type"))
+	assert.Regexp(t, `<problem xmlns="urn:ietf:rfc:7807"><type>about:blank</type><title>Not Found</title><status>404</status>`+
+		`.*<code>customer_not_found</code><invalidParams></invalidParams></problem>$`, response.Body.String())
+
+	response = get("application/x-protobuf")
+	assert.Equal(t, http.StatusNotFound, response.Code)
+	message := &customerpb.Problem{}
+	assert.NoError(t, proto.Unmarshal(response.Body.Bytes(), message))
+	assert.Equal(t, int32(404), message.GetStatus())
+	assert.Equal(t, "customer_not_found", message.GetCode())
+}
@@ -0,0 +1,145 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/jcsw/go-api-learn/pkg/application/problem"
+	"github.com/jcsw/go-api-learn/pkg/application/router"
+	"github.com/jcsw/go-api-learn/pkg/domain"
+	"github.com/jcsw/go-api-learn/pkg/service"
+)
+
+// webhookListResponse the envelope of the webhooks
+type webhookListResponse struct {
+	Data []*domain.WebhookSubscription `json:"data"`
+}
+
+// deliveryLogResponse the envelope of the deliveries of a webhook
+type deliveryLogResponse struct {
+	Data []*domain.WebhookDelivery `json:"data"`
+	Next string                    `json:"next,omitempty"`
+}
+
+// WebhookHandler handler to "/webhooks", every route requires the admin token
+type WebhookHandler struct {
+	WAggregate *service.WebhookAggregate
+	Token      string
+}
+
+const (
+	webhookPath         = "/webhooks"
+	webhookByIDPath     = "/webhooks/{id}"
+	webhookDeliveryPath = "/webhooks/{id}/deliveries"
+	webhookReplayPath   = "/webhooks/{id}/deliveries/{deliveryId}/replay"
+
+	// maxWebhookBodySize the maximum size in bytes of a webhook payload
+	maxWebhookBodySize = 1 << 16
+)
+
+// RegisterRoutes register the routes of "/webhooks", "/webhooks/{id}" and its deliveries
+func (wh *WebhookHandler) RegisterRoutes(webhookRouter *router.Router) {
+	webhookRouter.HandleFunc("GET", webhookPath, wh.listWebhooks, requireToken(wh.Token))
+	webhookRouter.HandleFunc("POST", webhookPath, wh.addWebhook, requireToken(wh.Token), limitRequestBody(maxWebhookBodySize))
+
+	webhookRouter.HandleFunc("GET", webhookByIDPath, wh.getWebhookByID, requireToken(wh.Token))
+	webhookRouter.HandleFunc("DELETE", webhookByIDPath, wh.deleteWebhook, requireToken(wh.Token))
+
+	webhookRouter.HandleFunc("GET", webhookDeliveryPath, wh.listDeliveries, requireToken(wh.Token))
+	webhookRouter.HandleFunc("POST", webhookReplayPath, wh.replayDelivery, requireToken(wh.Token))
+}
+
+func (wh *WebhookHandler) addWebhook(w http.ResponseWriter, r *http.Request) {
+
+	reader := r.Body
+	defer reader.Close()
+
+	var newSubscription domain.WebhookSubscription
+	if err := json.NewDecoder(reader).Decode(&newSubscription); err != nil {
+		respondWithBodyError(w, r, err, errInvalidPayload)
+		return
+	}
+
+	subscription, err := wh.WAggregate.CreateSubscription(r.Context(), &newSubscription)
+	if err != nil {
+		problem.RespondWithError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Location", webhookPath+"/"+subscription.ID)
+	respondWithJSON(w, http.StatusCreated, subscription)
+}
+
+func (wh *WebhookHandler) listWebhooks(w http.ResponseWriter, r *http.Request) {
+
+	subscriptions, err := wh.WAggregate.FindSubscriptions(r.Context())
+	if err != nil {
+		problem.RespondWithError(w, r, err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, webhookListResponse{Data: subscriptions})
+}
+
+func (wh *WebhookHandler) getWebhookByID(w http.ResponseWriter, r *http.Request) {
+
+	subscription, err := wh.WAggregate.FindSubscriptionByID(r.Context(), router.Param(r, "id"))
+	if err != nil {
+		problem.RespondWithError(w, r, err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, subscription)
+}
+
+func (wh *WebhookHandler) deleteWebhook(w http.ResponseWriter, r *http.Request) {
+
+	if err := wh.WAggregate.DeleteSubscription(r.Context(), router.Param(r, "id")); err != nil {
+		problem.RespondWithError(w, r, err)
+		return
+	}
+
+	respondWithCode(w, http.StatusNoContent)
+}
+
+func (wh *WebhookHandler) listDeliveries(w http.ResponseWriter, r *http.Request) {
+
+	params := r.URL.Query()
+	query := service.DeliveryQuery{After: params.Get("after")}
+
+	if limit := params.Get("limit"); limit != "" {
+		var err error
+		if query.Limit, err = strconv.Atoi(limit); err != nil {
+			problem.RespondWithError(w, r, service.ErrInvalidLimit)
+			return
+		}
+	}
+
+	deliveryLog, err := wh.WAggregate.FindDeliveries(r.Context(), router.Param(r, "id"), query)
+	if err != nil {
+		problem.RespondWithError(w, r, err)
+		return
+	}
+
+	response := deliveryLogResponse{Data: deliveryLog.Deliveries}
+	if deliveryLog.Next != "" {
+		params.Set("after", deliveryLog.Next)
+		response.Next = (&url.URL{Path: r.URL.Path, RawQuery: params.Encode()}).String()
+	}
+
+	respondWithJSON(w, http.StatusOK, response)
+}
+
+// replayDelivery schedule the delivery to be sent again, it's sent in background
+func (wh *WebhookHandler) replayDelivery(w http.ResponseWriter, r *http.Request) {
+
+	delivery, err := wh.WAggregate.ReplayDelivery(r.Context(), router.Param(r, "id"), router.Param(r, "deliveryId"))
+	if err != nil {
+		problem.RespondWithError(w, r, err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusAccepted, delivery)
+}
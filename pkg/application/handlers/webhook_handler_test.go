@@ -0,0 +1,203 @@
+package handlers_test
+
+import (
+	"bytes"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/mongodb/mongo-go-driver/bson/objectid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+
+	"github.com/jcsw/go-api-learn/pkg/application/handlers"
+	"github.com/jcsw/go-api-learn/pkg/application/router"
+	"github.com/jcsw/go-api-learn/pkg/infra/database/repository"
+	"github.com/jcsw/go-api-learn/pkg/service"
+)
+
+var (
+	webhookID  = objectid.New()
+	deliveryID = objectid.New()
+)
+
+func webhookEntity() *repository.WebhookSubscriptionEntity {
+	return &repository.WebhookSubscriptionEntity{
+		ID:     webhookID,
+		URL:    "https://hooks.example.com/customers",
+		Events: []string{"CustomerCreated"},
+		Secret: "0123456789abcdef",
+	}
+}
+
+func TestWebhookHandler(t *testing.T) {
+	assert := assert.New(t)
+
+	tests := []struct {
+		description           string
+		webhookRepositoryMock *repository.WebhookRepositoryMock
+		method                string
+		url                   string
+		payload               []byte
+		authorization         string
+		expectedStatusCode    int
+		expectedBody          string
+	}{
+		{
+			description: "should return 201 when the webhook is created",
+			webhookRepositoryMock: func() *repository.WebhookRepositoryMock {
+				repositoryMock := &repository.WebhookRepositoryMock{}
+				repositoryMock.On("InsertSubscription", mock.Anything, mock.Anything).Return(nil)
+				return repositoryMock
+			}(),
+			method:             "POST",
+			url:                "/webhooks",
+			payload:            []byte(`{"url":"https://hooks.example.com/customers","events":["CustomerCreated"],"secret":"0123456789abcdef"}`),
+			authorization:      "Bearer admin-token",
+			expectedStatusCode: 201,
+			expectedBody:       `^{"id":"[0-9a-f]{24}","url":"https://hooks.example.com/customers","events":\["CustomerCreated"\],"createdAt":".+"}$`,
+		},
+		{
+			description:           "should return 400 when the webhook is invalid",
+			webhookRepositoryMock: &repository.WebhookRepositoryMock{},
+			method:                "POST",
+			url:                   "/webhooks",
+			payload:               []byte(`{"url":"hooks.example.com","events":["CustomerMerged"],"secret":"short"}`),
+			authorization:         "Bearer admin-token",
+			expectedStatusCode:    400,
+			expectedBody:          `"status":400,.*"code":"validation_failed".*"url".*"events".*"secret"`,
+		},
+		{
+			description:           "should return 401 when the token is missing",
+			webhookRepositoryMock: &repository.WebhookRepositoryMock{},
+			method:                "GET",
+			url:                   "/webhooks",
+			expectedStatusCode:    401,
+			expectedBody:          `"status":401,.*"code":"unauthorized"`,
+		},
+		{
+			description: "should return 200 with the webhooks without their secrets",
+			webhookRepositoryMock: func() *repository.WebhookRepositoryMock {
+				repositoryMock := &repository.WebhookRepositoryMock{}
+				repositoryMock.On("FindSubscriptions", mock.Anything).Return([]*repository.WebhookSubscriptionEntity{webhookEntity()}, nil)
+				return repositoryMock
+			}(),
+			method:             "GET",
+			url:                "/webhooks",
+			authorization:      "Bearer admin-token",
+			expectedStatusCode: 200,
+			expectedBody:       `^{"data":\[{"id":"` + webhookID.Hex() + `","url":"https://hooks.example.com/customers","events":\["CustomerCreated"\],"createdAt":"[^"]+"}\]}$`,
+		},
+		{
+			description: "should return 404 when the webhook does not exist",
+			webhookRepositoryMock: func() *repository.WebhookRepositoryMock {
+				repositoryMock := &repository.WebhookRepositoryMock{}
+				repositoryMock.On("FindSubscriptionByID", mock.Anything, webhookID).Return(nil, nil)
+				return repositoryMock
+			}(),
+			method:             "GET",
+			url:                "/webhooks/" + webhookID.Hex(),
+			authorization:      "Bearer admin-token",
+			expectedStatusCode: 404,
+			expectedBody:       `"status":404,.*"code":"webhook_not_found"`,
+		},
+		{
+			description: "should return 204 when the webhook is deleted",
+			webhookRepositoryMock: func() *repository.WebhookRepositoryMock {
+				repositoryMock := &repository.WebhookRepositoryMock{}
+				repositoryMock.On("DeleteSubscription", mock.Anything, webhookID).Return(true, nil)
+				return repositoryMock
+			}(),
+			method:             "DELETE",
+			url:                "/webhooks/" + webhookID.Hex(),
+			authorization:      "Bearer admin-token",
+			expectedStatusCode: 204,
+			expectedBody:       `^$`,
+		},
+		{
+			description: "should return 200 with the deliveries and their attempts",
+			webhookRepositoryMock: func() *repository.WebhookRepositoryMock {
+				repositoryMock := &repository.WebhookRepositoryMock{}
+				repositoryMock.On("FindSubscriptionByID", mock.Anything, webhookID).Return(webhookEntity(), nil)
+				repositoryMock.On("FindDeliveries", mock.Anything, webhookID, repository.DeliveryFilter{Limit: 2}).Return([]*repository.WebhookDeliveryEntity{
+					{ID: deliveryID, SubscriptionID: webhookID, EventType: "CustomerCreated", Status: "failed",
+						Attempts: []repository.WebhookAttemptEntity{{StatusCode: 500, Error: "webhook answered with status 500", DurationMs: 12}}},
+					{ID: objectid.New(), SubscriptionID: webhookID, EventType: "CustomerCreated", Status: "delivered"},
+				}, nil)
+				return repositoryMock
+			}(),
+			method:             "GET",
+			url:                "/webhooks/" + webhookID.Hex() + "/deliveries?limit=1",
+			authorization:      "Bearer admin-token",
+			expectedStatusCode: 200,
+			expectedBody:       `"status":"failed".*"attempts":\[{"at":"[^"]+","statusCode":500,"error":"webhook answered with status 500","durationMs":12}\].*"next":"/webhooks/` + webhookID.Hex() + `/deliveries\?after=` + deliveryID.Hex() + `\\u0026limit=1"`,
+		},
+		{
+			description: "should return 400 when the limit is invalid",
+			webhookRepositoryMock: func() *repository.WebhookRepositoryMock {
+				repositoryMock := &repository.WebhookRepositoryMock{}
+				repositoryMock.On("FindSubscriptionByID", mock.Anything, webhookID).Return(webhookEntity(), nil)
+				return repositoryMock
+			}(),
+			method:             "GET",
+			url:                "/webhooks/" + webhookID.Hex() + "/deliveries?limit=abc",
+			authorization:      "Bearer admin-token",
+			expectedStatusCode: 400,
+			expectedBody:       `"status":400,.*"limit"`,
+		},
+		{
+			description: "should return 202 when the delivery is replayed",
+			webhookRepositoryMock: func() *repository.WebhookRepositoryMock {
+				repositoryMock := &repository.WebhookRepositoryMock{}
+				repositoryMock.On("FindSubscriptionByID", mock.Anything, webhookID).Return(webhookEntity(), nil)
+				repositoryMock.On("FindDeliveryByID", mock.Anything, deliveryID).Return(&repository.WebhookDeliveryEntity{
+					ID: deliveryID, SubscriptionID: webhookID, EventType: "CustomerCreated", Status: "failed", Failures: 8}, nil)
+				repositoryMock.On("ReplayDelivery", mock.Anything, deliveryID, mock.Anything).Return(&repository.WebhookDeliveryEntity{
+					ID: deliveryID, SubscriptionID: webhookID, EventType: "CustomerCreated", Status: "pending", NextAttemptAt: time.Now()}, nil)
+				return repositoryMock
+			}(),
+			method:             "POST",
+			url:                "/webhooks/" + webhookID.Hex() + "/deliveries/" + deliveryID.Hex() + "/replay",
+			authorization:      "Bearer admin-token",
+			expectedStatusCode: 202,
+			expectedBody:       `"id":"` + deliveryID.Hex() + `".*"status":"pending","createdAt":"[^"]+","nextAttemptAt":"[^"]+"`,
+		},
+		{
+			description: "should return 500 when the delivery could not be replayed",
+			webhookRepositoryMock: func() *repository.WebhookRepositoryMock {
+				repositoryMock := &repository.WebhookRepositoryMock{}
+				repositoryMock.On("FindSubscriptionByID", mock.Anything, webhookID).Return(webhookEntity(), nil)
+				repositoryMock.On("FindDeliveryByID", mock.Anything, deliveryID).Return(nil, errors.New("connection refused"))
+				return repositoryMock
+			}(),
+			method:             "POST",
+			url:                "/webhooks/" + webhookID.Hex() + "/deliveries/" + deliveryID.Hex() + "/replay",
+			authorization:      "Bearer admin-token",
+			expectedStatusCode: 500,
+			expectedBody:       `"status":500,.*"code":"delivery_search_failed"`,
+		},
+	}
+
+	for _, tc := range tests {
+
+		req, err := http.NewRequest(tc.method, tc.url, bytes.NewBuffer(tc.payload))
+		assert.NoError(err)
+
+		if tc.authorization != "" {
+			req.Header.Set("Authorization", tc.authorization)
+		}
+
+		resp := httptest.NewRecorder()
+
+		webhookHandler := handlers.WebhookHandler{WAggregate: &service.WebhookAggregate{Repository: tc.webhookRepositoryMock}, Token: "admin-token"}
+
+		webhookRouter := router.New()
+		webhookHandler.RegisterRoutes(webhookRouter)
+		webhookRouter.ServeHTTP(resp, req)
+
+		assert.Equal(tc.expectedStatusCode, resp.Code, tc.description)
+		assert.Regexp(tc.expectedBody, resp.Body.String(), tc.description)
+	}
+}
@@ -0,0 +1,132 @@
+package problem
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"io"
+	"net/http"
+
+	"github.com/jcsw/go-api-learn/pkg/domain"
+	"github.com/jcsw/go-api-learn/pkg/infra/logger"
+)
+
+// ContentType the media type of the problem details (RFC 7807)
+const ContentType = "application/problem+json"
+
+// InvalidParam a field violation of the request
+type InvalidParam struct {
+	Name   string `json:"name" xml:"name"`
+	Code   string `json:"code" xml:"code"`
+	Reason string `json:"reason" xml:"reason"`
+}
+
+// Problem the problem details (RFC 7807) of a failed request, extended with an error code and the request id
+type Problem struct {
+	XMLName       xml.Name       `json:"-" xml:"urn:ietf:rfc:7807 problem"`
+	Type          string         `json:"type" xml:"type"`
+	Title         string         `json:"title" xml:"title"`
+	Status        int            `json:"status" xml:"status"`
+	Detail        string         `json:"detail" xml:"detail"`
+	Instance      string         `json:"instance,omitempty" xml:"instance,omitempty"`
+	Code          string         `json:"code" xml:"code"`
+	RequestID     string         `json:"requestId,omitempty" xml:"requestId,omitempty"`
+	InvalidParams []InvalidParam `json:"invalidParams,omitempty" xml:"invalidParams>i,omitempty"`
+}
+
+// Encoder write the problems in a media type other than JSON
+type Encoder interface {
+	ProblemMediaType() string
+	EncodeProblem(w io.Writer, problem *Problem) error
+}
+
+type encoderKey struct{}
+
+// WithEncoder return a copy of ctx where the problems are written by the encoder
+func WithEncoder(ctx context.Context, encoder Encoder) context.Context {
+	return context.WithValue(ctx, encoderKey{}, encoder)
+}
+
+// New create a problem with the status, the code and the detail
+func New(status int, code string, detail string) *Problem {
+	return &Problem{Type: "about:blank", Title: http.StatusText(status), Status: status, Code: code, Detail: detail}
+}
+
+// kindStatus the status code of each kind of domain error
+var kindStatus = map[error]int{
+	domain.ErrInvalid:    http.StatusBadRequest,
+	domain.ErrNotFound:   http.StatusNotFound,
+	domain.ErrConflict:   http.StatusConflict,
+	domain.ErrStale:      http.StatusPreconditionFailed,
+	domain.ErrUnexpected: http.StatusInternalServerError,
+}
+
+// FromError map the error to a problem, the errors that are not domain errors are internal errors
+func FromError(err error) *Problem {
+
+	validationErr := &domain.ValidationError{}
+	if errors.As(err, &validationErr) {
+		return invalidParams(validationErr.Fields)
+	}
+
+	fieldErr := &domain.FieldError{}
+	if errors.As(err, &fieldErr) {
+		return invalidParams([]*domain.FieldError{fieldErr})
+	}
+
+	domainErr := &domain.Error{}
+	if errors.As(err, &domainErr) {
+		if status, ok := kindStatus[domainErr.Kind]; ok {
+			return New(status, domainErr.Code, domainErr.Message)
+		}
+	}
+
+	return New(http.StatusInternalServerError, "internal_error", "Error to process request")
+}
+
+func invalidParams(fields []*domain.FieldError) *Problem {
+
+	problem := New(http.StatusBadRequest, "validation_failed", (&domain.ValidationError{Fields: fields}).Error())
+	for _, field := range fields {
+		problem.InvalidParams = append(problem.InvalidParams, InvalidParam{Name: field.Field, Code: field.Code, Reason: field.Message})
+	}
+
+	return problem
+}
+
+// RespondWithError write the problem mapped from the error, the internal errors are logged with their cause
+func RespondWithError(w http.ResponseWriter, r *http.Request, err error) {
+
+	problem := FromError(err)
+	if problem.Status >= http.StatusInternalServerError {
+		logger.FromContext(r.Context()).Error("request failed",
+			logger.String("method", r.Method), logger.String("path", r.URL.Path), logger.Err(err))
+	}
+
+	Respond(w, r, problem)
+}
+
+// Respond write the problem with the path and the request id of the request, in JSON unless the context
+// of the request carries an encoder
+func Respond(w http.ResponseWriter, r *http.Request, problem *Problem) {
+
+	problem.Instance = r.URL.Path
+	problem.RequestID = logger.RequestID(r.Context())
+
+	if encoder, ok := r.Context().Value(encoderKey{}).(Encoder); ok {
+		response := bytes.Buffer{}
+		if err := encoder.EncodeProblem(&response, problem); err == nil {
+			w.Header().Set("Content-Type", encoder.ProblemMediaType())
+			w.WriteHeader(problem.Status)
+			w.Write(response.Bytes())
+			return
+		}
+	}
+
+	response, _ := json.Marshal(problem)
+	w.Header().Set("Content-Type", ContentType)
+	w.WriteHeader(problem.Status)
+	w.Write(response)
+}
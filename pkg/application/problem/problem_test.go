@@ -0,0 +1,74 @@
+package problem_test
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/jcsw/go-api-learn/pkg/application/problem"
+	"github.com/jcsw/go-api-learn/pkg/domain"
+	"github.com/jcsw/go-api-learn/pkg/infra/logger"
+)
+
+func TestFromError(t *testing.T) {
+	assert := assert.New(t)
+
+	tests := []struct {
+		description string
+		err         error
+		expected    *problem.Problem
+	}{
+		{
+			description: "should list all the field violations",
+			err:         (&domain.Customer{}).Validate(),
+			expected: &problem.Problem{Type: "about:blank", Title: "Bad Request", Status: 400, Code: "validation_failed",
+				Detail: "Invalid value 'name'; Invalid value 'city'",
+				InvalidParams: []problem.InvalidParam{
+					{Name: "name", Code: "invalid_value", Reason: "Invalid value 'name'"},
+					{Name: "city", Code: "invalid_value", Reason: "Invalid value 'city'"},
+				}},
+		},
+		{
+			description: "should map a single field violation",
+			err:         domain.ErrInvalidCity,
+			expected: &problem.Problem{Type: "about:blank", Title: "Bad Request", Status: 400, Code: "validation_failed",
+				Detail:        "Invalid value 'city'",
+				InvalidParams: []problem.InvalidParam{{Name: "city", Code: "invalid_value", Reason: "Invalid value 'city'"}}},
+		},
+		{
+			description: "should map the kind of the domain error to the status",
+			err:         domain.NewError(domain.ErrConflict, "customer_conflict", "Customer conflict"),
+			expected:    &problem.Problem{Type: "about:blank", Title: "Conflict", Status: 409, Code: "customer_conflict", Detail: "Customer conflict"},
+		},
+		{
+			description: "should hide the cause of the domain error",
+			err:         domain.WrapError(domain.ErrUnexpected, "customer_search_failed", "could not find customer", errors.New("connection refused")),
+			expected:    &problem.Problem{Type: "about:blank", Title: "Internal Server Error", Status: 500, Code: "customer_search_failed", Detail: "could not find customer"},
+		},
+		{
+			description: "should map unknown errors to internal error",
+			err:         errors.New("connection refused"),
+			expected:    &problem.Problem{Type: "about:blank", Title: "Internal Server Error", Status: 500, Code: "internal_error", Detail: "Error to process request"},
+		},
+	}
+
+	for _, tc := range tests {
+		assert.Equal(tc.expected, problem.FromError(tc.err), tc.description)
+	}
+}
+
+func TestShouldRespondWithInstanceAndRequestID(t *testing.T) {
+
+	req := httptest.NewRequest("GET", "/customer/123", nil)
+	req = req.WithContext(logger.WithRequestID(req.Context(), "abc-123"))
+	resp := httptest.NewRecorder()
+
+	problem.Respond(resp, req, problem.New(http.StatusNotFound, "customer_not_found", "Customer not found"))
+
+	assert.Equal(t, 404, resp.Code)
+	assert.Equal(t, problem.ContentType, resp.Header().Get("Content-Type"))
+	assert.Equal(t, `{"type":"about:blank","title":"Not Found","status":404,"detail":"Customer not found","instance":"/customer/123","code":"customer_not_found","requestId":"abc-123"}`, resp.Body.String())
+}
@@ -0,0 +1,180 @@
+package router
+
+import (
+	"context"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/jcsw/go-api-learn/pkg/application/problem"
+)
+
+// Middleware wrap a handler with behaviour that runs around it
+type Middleware func(http.Handler) http.Handler
+
+type paramsKey int
+
+const routeParamsKey paramsKey = 0
+
+// route a handler registered for a method and a pattern like "/customer/{id}"
+type route struct {
+	method   string
+	pattern  string
+	segments []string
+	handler  http.Handler
+}
+
+// Router dispatch the requests by method and path, answering 404 when no pattern matches the path
+// and 405 when the pattern matches but the method was not registered
+type Router struct {
+	routes []*route
+}
+
+// New create an empty router
+func New() *Router {
+	return &Router{}
+}
+
+// Handle register the handler to the method and the pattern, the middlewares wrap only this route,
+// the first one being the outermost
+func (router *Router) Handle(method string, pattern string, handler http.Handler, middlewares ...Middleware) {
+
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		handler = middlewares[i](handler)
+	}
+
+	router.routes = append(router.routes, &route{
+		method:   method,
+		pattern:  pattern,
+		segments: splitPath(pattern),
+		handler:  handler,
+	})
+}
+
+// HandleFunc register the handler function to the method and the pattern
+func (router *Router) HandleFunc(method string, pattern string, handlerFunc http.HandlerFunc, middlewares ...Middleware) {
+	router.Handle(method, pattern, handlerFunc, middlewares...)
+}
+
+// ServeHTTP dispatch the request to the route matching its method and path, a HEAD request is served by the
+// GET route when there is no HEAD route
+func (router *Router) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+
+	segments := splitPath(r.URL.Path)
+	allowed := map[string]bool{}
+
+	var matched *route
+	var matchedParams map[string]string
+
+	for _, route := range router.routes {
+		params, ok := route.match(segments)
+		if !ok {
+			continue
+		}
+
+		if route.method == r.Method {
+			matched, matchedParams = route, params
+			break
+		}
+
+		if r.Method == http.MethodHead && route.method == http.MethodGet && matched == nil {
+			matched, matchedParams = route, params
+		}
+
+		allowed[route.method] = true
+	}
+
+	if matched != nil {
+		matched.handler.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), routeParamsKey, matchedParams)))
+		return
+	}
+
+	if len(allowed) == 0 {
+		problem.Respond(w, r, problem.New(http.StatusNotFound, "resource_not_found", "Resource not found"))
+		return
+	}
+
+	w.Header().Set("Allow", allowHeader(allowed))
+	problem.Respond(w, r, problem.New(http.StatusMethodNotAllowed, "method_not_allowed", "Method not allowed"))
+}
+
+// Pattern return the pattern of the route matching the request, or empty when none matches
+func (router *Router) Pattern(r *http.Request) string {
+
+	segments := splitPath(r.URL.Path)
+	pattern := ""
+	headPattern := ""
+
+	for _, route := range router.routes {
+		if _, ok := route.match(segments); ok {
+			if route.method == r.Method {
+				return route.pattern
+			}
+			if r.Method == http.MethodHead && route.method == http.MethodGet && headPattern == "" {
+				headPattern = route.pattern
+			}
+			pattern = route.pattern
+		}
+	}
+
+	if headPattern != "" {
+		return headPattern
+	}
+
+	return pattern
+}
+
+// allowHeader return the allowed methods sorted and without repetition, with HEAD when GET is allowed
+func allowHeader(allowed map[string]bool) string {
+
+	if allowed[http.MethodGet] {
+		allowed[http.MethodHead] = true
+	}
+
+	methods := make([]string, 0, len(allowed))
+	for method := range allowed {
+		methods = append(methods, method)
+	}
+	sort.Strings(methods)
+
+	return strings.Join(methods, ", ")
+}
+
+// Param return the value of the path parameter of the route serving the request, or empty when it's missing
+func Param(r *http.Request, name string) string {
+	params, _ := r.Context().Value(routeParamsKey).(map[string]string)
+	return params[name]
+}
+
+func (route *route) match(segments []string) (map[string]string, bool) {
+
+	if len(segments) != len(route.segments) {
+		return nil, false
+	}
+
+	params := map[string]string{}
+	for i, segment := range route.segments {
+		if strings.HasPrefix(segment, "{") && strings.HasSuffix(segment, "}") {
+			if segments[i] == "" {
+				return nil, false
+			}
+			params[segment[1:len(segment)-1]] = segments[i]
+			continue
+		}
+
+		if segment != segments[i] {
+			return nil, false
+		}
+	}
+
+	return params, true
+}
+
+// splitPath split the path in its segments, ignoring the leading and the trailing slash
+func splitPath(path string) []string {
+	path = strings.Trim(path, "/")
+	if path == "" {
+		return []string{}
+	}
+	return strings.Split(path, "/")
+}
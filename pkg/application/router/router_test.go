@@ -0,0 +1,147 @@
+package router_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/jcsw/go-api-learn/pkg/application/router"
+)
+
+func newTestRouter() *router.Router {
+	customerRouter := router.New()
+
+	customerRouter.HandleFunc("GET", "/customer", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("list"))
+	})
+	customerRouter.HandleFunc("POST", "/customer", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("create"))
+	})
+	customerRouter.HandleFunc("GET", "/customer/export", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("export"))
+	})
+	customerRouter.HandleFunc("GET", "/customer/{id}", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("get " + router.Param(r, "id")))
+	})
+	customerRouter.HandleFunc("DELETE", "/customer/{id}", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("delete " + router.Param(r, "id")))
+	}, func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte("first "))
+			next.ServeHTTP(w, r)
+		})
+	}, func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte("second "))
+			next.ServeHTTP(w, r)
+		})
+	})
+
+	return customerRouter
+}
+
+func TestRouter(t *testing.T) {
+	assert := assert.New(t)
+
+	tests := []struct {
+		description        string
+		method             string
+		url                string
+		expectedStatusCode int
+		expectedAllow      string
+		expectedBody       string
+	}{
+		{
+			description:        "should dispatch by method",
+			method:             "POST",
+			url:                "/customer",
+			expectedStatusCode: 200,
+			expectedBody:       "create",
+		},
+		{
+			description:        "should ignore the trailing slash",
+			method:             "GET",
+			url:                "/customer/",
+			expectedStatusCode: 200,
+			expectedBody:       "list",
+		},
+		{
+			description:        "should extract the path parameter",
+			method:             "GET",
+			url:                "/customer/5bb9c6b4e3a1e1f3b3c1d2e4",
+			expectedStatusCode: 200,
+			expectedBody:       "get 5bb9c6b4e3a1e1f3b3c1d2e4",
+		},
+		{
+			description:        "should run the route middlewares in order",
+			method:             "DELETE",
+			url:                "/customer/5bb9c6b4e3a1e1f3b3c1d2e4",
+			expectedStatusCode: 200,
+			expectedBody:       "first second delete 5bb9c6b4e3a1e1f3b3c1d2e4",
+		},
+		{
+			description:        "should return 405 with the allowed methods when method is not registered",
+			method:             "PUT",
+			url:                "/customer",
+			expectedStatusCode: 405,
+			expectedAllow:      "GET, HEAD, POST",
+			expectedBody:       `{"type":"about:blank","title":"Method Not Allowed","status":405,"detail":"Method not allowed","instance":"/customer","code":"method_not_allowed"}`,
+		},
+		{
+			description:        "should return each allowed method once when several routes match the path",
+			method:             "PUT",
+			url:                "/customer/export",
+			expectedStatusCode: 405,
+			expectedAllow:      "DELETE, GET, HEAD",
+			expectedBody:       `{"type":"about:blank","title":"Method Not Allowed","status":405,"detail":"Method not allowed","instance":"/customer/export","code":"method_not_allowed"}`,
+		},
+		{
+			description:        "should serve HEAD by the GET route",
+			method:             "HEAD",
+			url:                "/customer/5bb9c6b4e3a1e1f3b3c1d2e4",
+			expectedStatusCode: 200,
+			expectedBody:       "get 5bb9c6b4e3a1e1f3b3c1d2e4",
+		},
+		{
+			description:        "should return 404 when path does not match any route",
+			method:             "GET",
+			url:                "/customer/5bb9c6b4e3a1e1f3b3c1d2e4/history",
+			expectedStatusCode: 404,
+			expectedBody:       `{"type":"about:blank","title":"Not Found","status":404,"detail":"Resource not found","instance":"/customer/5bb9c6b4e3a1e1f3b3c1d2e4/history","code":"resource_not_found"}`,
+		},
+	}
+
+	customerRouter := newTestRouter()
+
+	for _, tc := range tests {
+
+		req, err := http.NewRequest(tc.method, tc.url, nil)
+		assert.NoError(err)
+
+		resp := httptest.NewRecorder()
+		customerRouter.ServeHTTP(resp, req)
+
+		assert.Equal(tc.expectedStatusCode, resp.Code, tc.description)
+		assert.Equal(tc.expectedAllow, resp.Header().Get("Allow"), tc.description)
+		assert.Equal(tc.expectedBody, resp.Body.String(), tc.description)
+	}
+}
+
+func TestShouldReturnPatternOfMatchedRoute(t *testing.T) {
+
+	customerRouter := newTestRouter()
+
+	get, _ := http.NewRequest("GET", "/customer/5bb9c6b4e3a1e1f3b3c1d2e4", nil)
+	assert.Equal(t, "/customer/{id}", customerRouter.Pattern(get))
+
+	put, _ := http.NewRequest("PUT", "/customer", nil)
+	assert.Equal(t, "/customer", customerRouter.Pattern(put))
+
+	head, _ := http.NewRequest("HEAD", "/customer", nil)
+	assert.Equal(t, "/customer", customerRouter.Pattern(head))
+
+	unknown, _ := http.NewRequest("GET", "/unknown", nil)
+	assert.Equal(t, "", customerRouter.Pattern(unknown))
+}
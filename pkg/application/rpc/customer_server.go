@@ -0,0 +1,117 @@
+package rpc
+
+import (
+	"context"
+	"encoding/json"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/jcsw/go-api-learn/pkg/application/customerpb"
+	"github.com/jcsw/go-api-learn/pkg/domain"
+	"github.com/jcsw/go-api-learn/pkg/infra/events"
+	"github.com/jcsw/go-api-learn/pkg/infra/logger"
+	"github.com/jcsw/go-api-learn/pkg/service"
+)
+
+// ErrCustomerRequired Error for a creation without the customer
+var ErrCustomerRequired = domain.NewFieldError("customer", "required", "Required field 'customer'")
+
+// CustomerServer the CustomerService of gRPC, backed by the same aggregate and stream of changes as the REST API
+type CustomerServer struct {
+	customerpb.UnimplementedCustomerServiceServer
+
+	CAggregate *service.CustomerAggregate
+	Stream     *events.Hub
+}
+
+// Create create a new customer
+func (cs *CustomerServer) Create(ctx context.Context, request *customerpb.CreateCustomerRequest) (*customerpb.Customer, error) {
+
+	if request.GetCustomer() == nil {
+		return nil, statusFromError(ctx, ErrCustomerRequired)
+	}
+
+	createdCustomer, err := cs.CAggregate.CreateNewCustomer(ctx, request.GetCustomer().ToDomain())
+	if err != nil {
+		return nil, statusFromError(ctx, err)
+	}
+
+	return customerpb.FromDomain(createdCustomer), nil
+}
+
+// Get find the customer by id
+func (cs *CustomerServer) Get(ctx context.Context, request *customerpb.GetCustomerRequest) (*customerpb.Customer, error) {
+
+	customer, err := cs.CAggregate.FindCustomerByID(ctx, request.GetId())
+	if err != nil {
+		return nil, statusFromError(ctx, err)
+	}
+
+	return customerpb.FromDomain(customer), nil
+}
+
+// List send the customers matching the request, reading a page at a time until the last one
+func (cs *CustomerServer) List(request *customerpb.ListCustomersRequest, stream customerpb.CustomerService_ListServer) error {
+
+	ctx := stream.Context()
+	query := service.CustomerQuery{City: request.GetCity(), Sort: request.GetSort(), Limit: int(request.GetPageSize())}
+
+	for {
+		page, err := cs.CAggregate.FindCustomers(ctx, query)
+		if err != nil {
+			return statusFromError(ctx, err)
+		}
+
+		for _, customer := range page.Customers {
+			if err := stream.Send(customerpb.FromDomain(customer)); err != nil {
+				return err
+			}
+		}
+
+		if page.Next == "" {
+			return nil
+		}
+		query.After = page.Next
+	}
+}
+
+// Watch send the changes of the customers until the client cancels. A client that does not keep up, or that is
+// watching when the server shuts down, is dropped with UNAVAILABLE, it watches again from the last event it received
+func (cs *CustomerServer) Watch(request *customerpb.WatchCustomersRequest, stream customerpb.CustomerService_WatchServer) error {
+
+	if cs.Stream == nil {
+		return status.Error(codes.Unimplemented, "Watching the customers is not enabled")
+	}
+
+	subscription, err := cs.Stream.Subscribe(request.GetLastEventId())
+	if err == events.ErrTooManySubscribers {
+		return status.Error(codes.ResourceExhausted, "Too many subscribers, retry later")
+	}
+	if err == events.ErrHubClosed {
+		return status.Error(codes.Unavailable, "Server is shutting down, watch again from the last event")
+	}
+	defer subscription.Close()
+
+	ctx := stream.Context()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case event, open := <-subscription.Events():
+			if !open {
+				return status.Error(codes.Unavailable, "Subscriber fell behind, watch again from the last event")
+			}
+
+			customerEvent := &domain.CustomerEvent{}
+			if err := json.Unmarshal(event.Payload, customerEvent); err != nil {
+				rpcLogger.WithContext(ctx).Warn("could not decode the event", logger.Function("Watch"), logger.String("id", event.ID), logger.Err(err))
+				continue
+			}
+
+			if err := stream.Send(customerpb.FromEvent(customerEvent)); err != nil {
+				return err
+			}
+		}
+	}
+}
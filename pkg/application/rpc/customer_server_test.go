@@ -0,0 +1,309 @@
+package rpc_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/mongodb/mongo-go-driver/bson/objectid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+
+	"github.com/jcsw/go-api-learn/pkg/application/customerpb"
+	"github.com/jcsw/go-api-learn/pkg/application/rpc"
+	"github.com/jcsw/go-api-learn/pkg/domain"
+	"github.com/jcsw/go-api-learn/pkg/infra/cache/cachestore"
+	"github.com/jcsw/go-api-learn/pkg/infra/database/repository"
+	"github.com/jcsw/go-api-learn/pkg/infra/events"
+	"github.com/jcsw/go-api-learn/pkg/service"
+)
+
+var customerAmandaID = objectid.New()
+
+// adminToken the token of the server, the calls carrying it are trusted to tell their actor
+const adminToken = "secret"
+
+// newClient serve the CustomerService in memory and return a client connected to it
+func newClient(t *testing.T, repositoryMock *repository.CustomerRepositoryMock, stream *events.Hub) customerpb.CustomerServiceClient {
+
+	aggregate := service.CustomerAggregate{Repository: repositoryMock, CacheStore: mockCustomerCacheStoreDefault()}
+	server := rpc.NewServer(&rpc.CustomerServer{CAggregate: &aggregate, Stream: stream}, adminToken)
+
+	listener := bufconn.Listen(1024 * 1024)
+	go server.Serve(listener)
+
+	conn, err := grpc.Dial("bufnet",
+		grpc.WithContextDialer(func(context.Context, string) (net.Conn, error) { return listener.Dial() }),
+		grpc.WithInsecure())
+	assert.NoError(t, err)
+
+	t.Cleanup(func() {
+		conn.Close()
+		server.Stop()
+	})
+
+	return customerpb.NewCustomerServiceClient(conn)
+}
+
+func TestShouldCreateCustomer(t *testing.T) {
+
+	client := newClient(t, mockCreateCustomerSuccesfull(), nil)
+
+	ctx := metadata.AppendToOutgoingContext(context.Background(), "x-request-id", "req-42")
+	var header metadata.MD
+	created, err := client.Create(ctx, &customerpb.CreateCustomerRequest{Customer: &customerpb.Customer{Name: "Fernanda Lima", City: "Limeira"}}, grpc.Header(&header))
+
+	assert.NoError(t, err)
+	assert.NotEmpty(t, created.GetId())
+	assert.Equal(t, "Fernanda Lima", created.GetName())
+	assert.Equal(t, "active", created.GetStatus())
+	assert.NotNil(t, created.GetCreatedAt())
+	assert.Equal(t, []string{"req-42"}, header.Get("x-request-id"))
+}
+
+func TestShouldAuditTheActorOnlyFromTheCallsCarryingTheAdminToken(t *testing.T) {
+
+	tests := []struct {
+		authorization string
+		expectedActor string
+	}{
+		{"", "anonymous"},
+		{"Bearer guess", "anonymous"},
+		{"Bearer " + adminToken, "backoffice"},
+	}
+
+	for _, tc := range tests {
+		repositoryMock := mockCreateCustomerSuccesfull()
+		client := newClient(t, repositoryMock, nil)
+
+		ctx := metadata.AppendToOutgoingContext(context.Background(), "x-actor", "backoffice", "authorization", tc.authorization)
+		_, err := client.Create(ctx, &customerpb.CreateCustomerRequest{Customer: &customerpb.Customer{Name: "Fernanda Lima", City: "Limeira"}})
+
+		if assert.NoError(t, err, tc.authorization) {
+			change := repositoryMock.Calls[0].Arguments.Get(2).(*repository.CustomerChange)
+			assert.Equal(t, tc.expectedActor, change.Audit.Actor, tc.authorization)
+		}
+	}
+}
+
+func TestShouldMapTheDomainErrorsToStatus(t *testing.T) {
+
+	tests := []struct {
+		description    string
+		repositoryMock *repository.CustomerRepositoryMock
+		request        *customerpb.CreateCustomerRequest
+		expectedCode   codes.Code
+		expectedReason string
+		expectedFields []string
+	}{
+		{
+			description:    "should return ALREADY_EXISTS when customer already exists",
+			repositoryMock: mockCreateCustomerDuplicate(),
+			request:        &customerpb.CreateCustomerRequest{Customer: &customerpb.Customer{Name: "Amanda", City: "São Paulo"}},
+			expectedCode:   codes.AlreadyExists,
+			expectedReason: "customer_already_exists",
+		},
+		{
+			description:    "should return INVALID_ARGUMENT with the field violations",
+			repositoryMock: mockCreateCustomerSuccesfull(),
+			request:        &customerpb.CreateCustomerRequest{Customer: &customerpb.Customer{Email: "amanda"}},
+			expectedCode:   codes.InvalidArgument,
+			expectedReason: "validation_failed",
+			expectedFields: []string{"name", "city", "email"},
+		},
+		{
+			description:    "should return INVALID_ARGUMENT when the customer is missing",
+			repositoryMock: mockCreateCustomerSuccesfull(),
+			request:        &customerpb.CreateCustomerRequest{},
+			expectedCode:   codes.InvalidArgument,
+			expectedReason: "validation_failed",
+			expectedFields: []string{"customer"},
+		},
+		{
+			description:    "should return INTERNAL when the repository fails",
+			repositoryMock: mockCreateCustomerError(),
+			request:        &customerpb.CreateCustomerRequest{Customer: &customerpb.Customer{Name: "Amanda", City: "São Paulo"}},
+			expectedCode:   codes.Internal,
+			expectedReason: "customer_registration_failed",
+		},
+	}
+
+	for _, tc := range tests {
+		client := newClient(t, tc.repositoryMock, nil)
+
+		_, err := client.Create(context.Background(), tc.request)
+
+		st := status.Convert(err)
+		assert.Equal(t, tc.expectedCode, st.Code(), tc.description)
+
+		fields := []string{}
+		for _, detail := range st.Details() {
+			switch detail := detail.(type) {
+			case *errdetails.ErrorInfo:
+				assert.Equal(t, tc.expectedReason, detail.GetReason(), tc.description)
+			case *errdetails.BadRequest:
+				for _, violation := range detail.GetFieldViolations() {
+					fields = append(fields, violation.GetField())
+				}
+			}
+		}
+		assert.ElementsMatch(t, tc.expectedFields, fields, tc.description)
+	}
+}
+
+func TestShouldGetCustomerByID(t *testing.T) {
+
+	client := newClient(t, mockFindCustomerByIDSuccesfull(), nil)
+
+	customer, err := client.Get(context.Background(), &customerpb.GetCustomerRequest{Id: customerAmandaID.Hex()})
+	assert.NoError(t, err)
+	assert.Equal(t, customerAmandaID.Hex(), customer.GetId())
+	assert.Equal(t, "Amanda", customer.GetName())
+	assert.Equal(t, int64(2), customer.GetVersion())
+
+	var header metadata.MD
+	_, err = client.Get(context.Background(), &customerpb.GetCustomerRequest{Id: "unknown"}, grpc.Header(&header))
+	assert.Equal(t, codes.NotFound, status.Code(err))
+	assert.Len(t, header.Get("x-request-id"), 1)
+}
+
+func TestShouldListCustomersOfEveryPage(t *testing.T) {
+
+	amanda := &repository.CustomerEntity{ID: objectid.New(), Name: "Amanda", City: "São Paulo"}
+	fernanda := &repository.CustomerEntity{ID: objectid.New(), Name: "Fernanda", City: "São Paulo"}
+	julia := &repository.CustomerEntity{ID: objectid.New(), Name: "Julia", City: "São Paulo"}
+
+	repositoryMock := &repository.CustomerRepositoryMock{}
+	repositoryMock.On("FindCustomers", mock.Anything, mock.MatchedBy(func(filter repository.CustomerFilter) bool {
+		return filter.AfterID == objectid.ObjectID{} && filter.City == "São Paulo" && filter.Limit == 3
+	})).Return([]*repository.CustomerEntity{amanda, fernanda, julia}, nil)
+	repositoryMock.On("FindCustomers", mock.Anything, mock.MatchedBy(func(filter repository.CustomerFilter) bool {
+		return filter.AfterID == fernanda.ID
+	})).Return([]*repository.CustomerEntity{julia}, nil)
+
+	client := newClient(t, repositoryMock, nil)
+
+	stream, err := client.List(context.Background(), &customerpb.ListCustomersRequest{City: "São Paulo", PageSize: 2})
+	assert.NoError(t, err)
+
+	names := []string{}
+	for {
+		customer, err := stream.Recv()
+		if err == io.EOF {
+			break
+		}
+		if !assert.NoError(t, err) {
+			return
+		}
+		names = append(names, customer.GetName())
+	}
+
+	assert.Equal(t, []string{"Amanda", "Fernanda", "Julia"}, names)
+	repositoryMock.AssertNumberOfCalls(t, "FindCustomers", 2)
+}
+
+func TestShouldRejectAnInvalidListing(t *testing.T) {
+
+	client := newClient(t, mockCustomerRepositoryDefault(), nil)
+
+	stream, err := client.List(context.Background(), &customerpb.ListCustomersRequest{PageSize: 1000})
+	assert.NoError(t, err)
+
+	_, err = stream.Recv()
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+}
+
+func TestShouldWatchTheCustomerChanges(t *testing.T) {
+
+	hub := events.NewHub(0, 0)
+	client := newClient(t, mockCustomerRepositoryDefault(), hub)
+
+	occurredAt := time.Date(2018, 10, 7, 12, 30, 0, 0, time.UTC)
+	payload, _ := json.Marshal(domain.CustomerEvent{
+		ID:         "5bbb50ab0c3b8a1b5c3c1d2e",
+		Type:       domain.CustomerCreated,
+		CustomerID: customerAmandaID.Hex(),
+		Version:    1,
+		OccurredAt: occurredAt,
+		Actor:      "backoffice",
+		Customer:   &domain.Customer{ID: customerAmandaID.Hex(), Name: "Amanda", City: "São Paulo", Version: 1},
+	})
+	hub.Publish(context.Background(), &events.Event{ID: "5bbb50ab0c3b8a1b5c3c1d2e", Type: string(domain.CustomerCreated), Payload: payload})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// an id that is not buffered resumes from the oldest buffered event
+	stream, err := client.Watch(ctx, &customerpb.WatchCustomersRequest{LastEventId: "missed"})
+	assert.NoError(t, err)
+
+	event, err := stream.Recv()
+	if assert.NoError(t, err) {
+		assert.Equal(t, "CustomerCreated", event.GetType())
+		assert.Equal(t, customerAmandaID.Hex(), event.GetCustomerId())
+		assert.Equal(t, occurredAt, event.GetOccurredAt().AsTime())
+		assert.Equal(t, "backoffice", event.GetActor())
+		assert.Equal(t, "Amanda", event.GetCustomer().GetName())
+	}
+}
+
+func TestShouldNotWatchWithoutStream(t *testing.T) {
+
+	client := newClient(t, mockCustomerRepositoryDefault(), nil)
+
+	stream, err := client.Watch(context.Background(), &customerpb.WatchCustomersRequest{})
+	assert.NoError(t, err)
+
+	_, err = stream.Recv()
+	assert.Equal(t, codes.Unimplemented, status.Code(err))
+}
+
+func mockCustomerCacheStoreDefault() *cachestore.CustomerCacheStoreMock {
+	cacheStoreMock := &cachestore.CustomerCacheStoreMock{}
+	cacheStoreMock.On("RetriveCustomerEntity", mock.Anything, mock.Anything).Return(nil)
+	cacheStoreMock.On("PersistCustomerEntity", mock.Anything, mock.Anything)
+	cacheStoreMock.On("RemoveCustomerEntity", mock.Anything, mock.Anything)
+	return cacheStoreMock
+}
+
+func mockCustomerRepositoryDefault() *repository.CustomerRepositoryMock {
+	repositoryMock := &repository.CustomerRepositoryMock{}
+	repositoryMock.On("FindCustomers", mock.Anything, mock.Anything).Return([]*repository.CustomerEntity{}, nil)
+	repositoryMock.On("FindCustomerByID", mock.Anything, mock.Anything).Return(nil, nil)
+	return repositoryMock
+}
+
+func mockCreateCustomerSuccesfull() *repository.CustomerRepositoryMock {
+	repositoryMock := &repository.CustomerRepositoryMock{}
+	repositoryMock.On("InsertCustomer", mock.Anything, mock.Anything, mock.Anything).Return(nil)
+	return repositoryMock
+}
+
+func mockCreateCustomerDuplicate() *repository.CustomerRepositoryMock {
+	repositoryMock := &repository.CustomerRepositoryMock{}
+	repositoryMock.On("InsertCustomer", mock.Anything, mock.Anything, mock.Anything).Return(repository.ErrDuplicateCustomer)
+	return repositoryMock
+}
+
+func mockCreateCustomerError() *repository.CustomerRepositoryMock {
+	repositoryMock := &repository.CustomerRepositoryMock{}
+	repositoryMock.On("InsertCustomer", mock.Anything, mock.Anything, mock.Anything).Return(errors.New("mock error"))
+	return repositoryMock
+}
+
+func mockFindCustomerByIDSuccesfull() *repository.CustomerRepositoryMock {
+	repositoryMock := &repository.CustomerRepositoryMock{}
+	customerAmanda := &repository.CustomerEntity{ID: customerAmandaID, Name: "Amanda", City: "São Paulo", Status: "active", Version: 2}
+	repositoryMock.On("FindCustomerByID", mock.Anything, customerAmandaID).Return(customerAmanda, nil)
+	return repositoryMock
+}
@@ -0,0 +1,134 @@
+package rpc
+
+import (
+	"context"
+	"crypto/subtle"
+	"fmt"
+	"strings"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+
+	"github.com/jcsw/go-api-learn/pkg/application/customerpb"
+	"github.com/jcsw/go-api-learn/pkg/infra/logger"
+)
+
+var rpcLogger = logger.With(logger.Package("rpc"))
+
+const (
+	// requestIDKey the metadata carrying the request id, like the X-Request-Id header of the REST API
+	requestIDKey = "x-request-id"
+
+	// actorKey the metadata carrying who made the request, like the X-Actor header of the REST API
+	actorKey = "x-actor"
+
+	// authorizationKey the metadata carrying the bearer token, like the Authorization header of the REST API
+	authorizationKey = "authorization"
+
+	bearerPrefix = "Bearer "
+)
+
+// NewServer create the gRPC server of the CustomerService, every call goes through the request id
+// and the logging interceptors. The actor of the metadata is trusted only from the calls carrying the adminToken
+func NewServer(customerServer *CustomerServer, adminToken string) *grpc.Server {
+
+	tracer := &tracer{adminToken: adminToken}
+	server := grpc.NewServer(
+		grpc.ChainUnaryInterceptor(tracer.unaryTracing, unaryLogging),
+		grpc.ChainStreamInterceptor(tracer.streamTracing, streamLogging))
+
+	customerpb.RegisterCustomerServiceServer(server, customerServer)
+	return server
+}
+
+// tracer the interceptors carrying the request id and the actor of the metadata in the context of the calls
+type tracer struct {
+	adminToken string
+}
+
+// tracing return a copy of the context carrying the request id and the actor of the metadata,
+// the request id is generated when the client sends none and it's returned in the header of the response.
+// The actor is asserted by the client, it's kept only when the call carries the admin token
+func (tracer *tracer) tracing(ctx context.Context) context.Context {
+
+	md, _ := metadata.FromIncomingContext(ctx)
+
+	requestID := firstValue(md, requestIDKey)
+	if requestID == "" {
+		requestID = newRequestID()
+	}
+	grpc.SetHeader(ctx, metadata.Pairs(requestIDKey, requestID))
+
+	ctx = logger.WithRequestID(ctx, requestID)
+	if actor := firstValue(md, actorKey); actor != "" && hasBearerToken(firstValue(md, authorizationKey), tracer.adminToken) {
+		ctx = logger.WithActor(ctx, actor)
+	}
+
+	return ctx
+}
+
+func (tracer *tracer) unaryTracing(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	return handler(tracer.tracing(ctx), req)
+}
+
+func (tracer *tracer) streamTracing(srv interface{}, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	return handler(srv, &tracedStream{ServerStream: stream, ctx: tracer.tracing(stream.Context())})
+}
+
+// tracedStream a stream whose context carries the request id
+type tracedStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (stream *tracedStream) Context() context.Context {
+	return stream.ctx
+}
+
+func unaryLogging(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	start := time.Now()
+	resp, err := handler(ctx, req)
+	logRequest(ctx, info.FullMethod, err, start)
+	return resp, err
+}
+
+func streamLogging(srv interface{}, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	start := time.Now()
+	err := handler(srv, stream)
+	logRequest(stream.Context(), info.FullMethod, err, start)
+	return err
+}
+
+func logRequest(ctx context.Context, method string, err error, start time.Time) {
+
+	remoteAddr := ""
+	if p, ok := peer.FromContext(ctx); ok {
+		remoteAddr = p.Addr.String()
+	}
+
+	logger.FromContext(ctx).Info("Request handled",
+		logger.String("method", method),
+		logger.String("code", status.Code(err).String()),
+		logger.String("remoteAddr", remoteAddr),
+		logger.Duration("elapsedTime", time.Since(start)))
+}
+
+func firstValue(md metadata.MD, key string) string {
+	if values := md.Get(key); len(values) > 0 {
+		return values[0]
+	}
+	return ""
+}
+
+// hasBearerToken report whether the authorization carries the bearer token, never when the token is empty
+func hasBearerToken(authorization string, token string) bool {
+	return token != "" && strings.HasPrefix(authorization, bearerPrefix) &&
+		subtle.ConstantTimeCompare([]byte(strings.TrimPrefix(authorization, bearerPrefix)), []byte(token)) == 1
+}
+
+func newRequestID() string {
+	return fmt.Sprintf("%d", time.Now().UnixNano())
+}
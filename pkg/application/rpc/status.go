@@ -0,0 +1,85 @@
+package rpc
+
+import (
+	"context"
+	"errors"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/runtime/protoiface"
+
+	"github.com/jcsw/go-api-learn/pkg/domain"
+	"github.com/jcsw/go-api-learn/pkg/infra/logger"
+	"github.com/jcsw/go-api-learn/pkg/service"
+)
+
+// errorDomain the domain of the ErrorInfo details, the reason is the code of the error, like in the problems
+const errorDomain = "go-api-learn"
+
+// kindCode the status code of each kind of domain error
+var kindCode = map[error]codes.Code{
+	domain.ErrInvalid:    codes.InvalidArgument,
+	domain.ErrNotFound:   codes.NotFound,
+	domain.ErrConflict:   codes.FailedPrecondition,
+	domain.ErrStale:      codes.Aborted,
+	domain.ErrUnexpected: codes.Internal,
+}
+
+// statusFromError map the error to a status, the errors that are not domain errors are internal errors.
+// The code of the domain error goes in an ErrorInfo and the field violations in a BadRequest, the internal
+// errors are logged with their cause
+func statusFromError(ctx context.Context, err error) error {
+
+	if ctxErr := ctx.Err(); ctxErr != nil {
+		return status.FromContextError(ctxErr).Err()
+	}
+
+	validationErr := &domain.ValidationError{}
+	if errors.As(err, &validationErr) {
+		return invalidArgument(validationErr.Fields)
+	}
+
+	fieldErr := &domain.FieldError{}
+	if errors.As(err, &fieldErr) {
+		return invalidArgument([]*domain.FieldError{fieldErr})
+	}
+
+	domainErr := &domain.Error{}
+	if errors.As(err, &domainErr) {
+		if code, ok := kindCode[domainErr.Kind]; ok {
+			if domainErr == service.ErrCustomerAlreadyExists {
+				code = codes.AlreadyExists
+			}
+			if code == codes.Internal {
+				rpcLogger.WithContext(ctx).Error("request failed", logger.Function("statusFromError"), logger.Err(err))
+			}
+			return withDetails(status.New(code, domainErr.Message), &errdetails.ErrorInfo{Reason: domainErr.Code, Domain: errorDomain})
+		}
+	}
+
+	rpcLogger.WithContext(ctx).Error("request failed", logger.Function("statusFromError"), logger.Err(err))
+	return withDetails(status.New(codes.Internal, "Error to process request"), &errdetails.ErrorInfo{Reason: "internal_error", Domain: errorDomain})
+}
+
+func invalidArgument(fields []*domain.FieldError) error {
+
+	badRequest := &errdetails.BadRequest{}
+	for _, field := range fields {
+		badRequest.FieldViolations = append(badRequest.FieldViolations, &errdetails.BadRequest_FieldViolation{Field: field.Field, Description: field.Message})
+	}
+
+	return withDetails(status.New(codes.InvalidArgument, (&domain.ValidationError{Fields: fields}).Error()),
+		&errdetails.ErrorInfo{Reason: "validation_failed", Domain: errorDomain}, badRequest)
+}
+
+// withDetails return the error of the status with the details, without them when they can not be encoded
+func withDetails(st *status.Status, details ...protoiface.MessageV1) error {
+
+	detailed, err := st.WithDetails(details...)
+	if err != nil {
+		return st.Err()
+	}
+
+	return detailed.Err()
+}
@@ -0,0 +1,56 @@
+package domain
+
+import (
+	"fmt"
+	"strings"
+)
+
+// AddressType the purpose of an address
+type AddressType string
+
+const (
+	// AddressHome the address where the customer lives
+	AddressHome AddressType = "home"
+
+	// AddressWork the address where the customer works
+	AddressWork AddressType = "work"
+
+	// AddressBilling the address used on invoices
+	AddressBilling AddressType = "billing"
+
+	// AddressShipping the address where the orders are delivered
+	AddressShipping AddressType = "shipping"
+)
+
+// addressTypes the known address types
+var addressTypes = map[AddressType]bool{
+	AddressHome:     true,
+	AddressWork:     true,
+	AddressBilling:  true,
+	AddressShipping: true,
+}
+
+// Address defines an address of the customer
+type Address struct {
+	Type       AddressType `json:"type"`
+	Street     string      `json:"street"`
+	Number     string      `json:"number,omitempty"`
+	Complement string      `json:"complement,omitempty"`
+	District   string      `json:"district,omitempty"`
+	City       string      `json:"city"`
+	State      string      `json:"state,omitempty"`
+	PostalCode string      `json:"postalCode,omitempty"`
+	Country    string      `json:"country,omitempty"`
+}
+
+// validate check the address at the index of the customer addresses, the violations are named like "addresses[0].street"
+func (address Address) validate(v *validation, index int) {
+	v.check(addressTypes[address.Type], addressFieldError(index, "type"))
+	v.check(len(strings.TrimSpace(address.Street)) > 0, addressFieldError(index, "street"))
+	v.check(len(strings.TrimSpace(address.City)) > 0, addressFieldError(index, "city"))
+}
+
+func addressFieldError(index int, field string) *FieldError {
+	name := fmt.Sprintf("addresses[%d].%s", index, field)
+	return NewFieldError(name, "invalid_value", fmt.Sprintf("Invalid value '%s'", name))
+}
@@ -0,0 +1,41 @@
+package domain
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// AuditAction what was done to a customer
+type AuditAction string
+
+const (
+	// AuditCreated the customer was created
+	AuditCreated AuditAction = "created"
+
+	// AuditUpdated the customer was replaced or patched
+	AuditUpdated AuditAction = "updated"
+
+	// AuditDeleted the customer received a tombstone
+	AuditDeleted AuditAction = "deleted"
+
+	// AuditRestored the tombstone of the customer was removed
+	AuditRestored AuditAction = "restored"
+)
+
+// CustomerAudit defines a change of a customer, who made it and when
+type CustomerAudit struct {
+	ID        string        `json:"id"`
+	Action    AuditAction   `json:"action"`
+	Actor     string        `json:"actor"`
+	RequestID string        `json:"requestId,omitempty"`
+	Timestamp time.Time     `json:"timestamp"`
+	Version   int64         `json:"version"`
+	Changes   []FieldChange `json:"changes"`
+}
+
+// FieldChange the value of a field before and after the change, absent when the field had or has no value
+type FieldChange struct {
+	Field  string          `json:"field"`
+	Before json.RawMessage `json:"before,omitempty"`
+	After  json.RawMessage `json:"after,omitempty"`
+}
@@ -1,35 +1,78 @@
 package domain
 
 import (
-	"errors"
+	"net/mail"
+	"regexp"
 	"strings"
+	"time"
 )
 
 // Customer defines a customer
 type Customer struct {
-	ID   string `json:"id"`
-	Name string `json:"name"`
-	City string `json:"city"`
+	ID        string         `json:"id"`
+	Name      string         `json:"name"`
+	City      string         `json:"city"`
+	Email     string         `json:"email,omitempty"`
+	Phone     string         `json:"phone,omitempty"`
+	Document  string         `json:"document,omitempty"`
+	Addresses []Address      `json:"addresses,omitempty"`
+	Status    CustomerStatus `json:"status"`
+	CreatedAt time.Time      `json:"createdAt"`
+	UpdatedAt time.Time      `json:"updatedAt"`
+	Version   int64          `json:"version"`
 }
 
 var (
 	// ErrInvalidName Error for invalid name
-	ErrInvalidName = errors.New("Invalid value 'name'")
+	ErrInvalidName = NewFieldError("name", "invalid_value", "Invalid value 'name'")
 
 	// ErrInvalidCity Error for invalid city
-	ErrInvalidCity = errors.New("Invalid value 'city'")
+	ErrInvalidCity = NewFieldError("city", "invalid_value", "Invalid value 'city'")
+
+	// ErrInvalidEmail Error for an email that is not a valid address
+	ErrInvalidEmail = NewFieldError("email", "invalid_format", "Invalid value 'email'")
+
+	// ErrInvalidPhone Error for a phone that is not in E.164 format
+	ErrInvalidPhone = NewFieldError("phone", "invalid_format", "Invalid value 'phone'")
+
+	// ErrInvalidDocument Error for a document that is not a valid CPF or CNPJ
+	ErrInvalidDocument = NewFieldError("document", "invalid_check_digit", "Invalid value 'document'")
+
+	// ErrInvalidStatus Error for an unknown status
+	ErrInvalidStatus = NewFieldError("status", "invalid_value", "Invalid value 'status'")
 )
 
-// Validate Return error when customer is not valid
+// e164Pattern a phone number in E.164 format, like +5511987654321
+var e164Pattern = regexp.MustCompile(`^\+[1-9][0-9]{1,14}$`)
+
+// Normalize put the email in lower case and remove the punctuation of the document,
+// it must be called before Validate
+func (customer *Customer) Normalize() {
+	customer.Email = strings.ToLower(strings.TrimSpace(customer.Email))
+	customer.Phone = strings.TrimSpace(customer.Phone)
+	customer.Document = normalizeDocument(customer.Document)
+}
+
+// Validate Return a ValidationError with all the violations when customer is not valid
 func (customer *Customer) Validate() error {
 
-	if len(strings.TrimSpace(customer.Name)) == 0 {
-		return ErrInvalidName
-	}
+	v := validation{}
+	v.check(len(strings.TrimSpace(customer.Name)) > 0, ErrInvalidName)
+	v.check(len(strings.TrimSpace(customer.City)) > 0, ErrInvalidCity)
+	v.check(customer.Email == "" || isValidEmail(customer.Email), ErrInvalidEmail)
+	v.check(customer.Phone == "" || e164Pattern.MatchString(customer.Phone), ErrInvalidPhone)
+	v.check(customer.Document == "" || IsValidCPF(customer.Document) || IsValidCNPJ(customer.Document), ErrInvalidDocument)
+	v.check(customer.Status == "" || customer.Status.IsValid(), ErrInvalidStatus)
 
-	if len(strings.TrimSpace(customer.City)) == 0 {
-		return ErrInvalidCity
+	for i, address := range customer.Addresses {
+		address.validate(&v, i)
 	}
 
-	return nil
+	return v.err()
+}
+
+// isValidEmail report whether the email is a bare address, without a display name
+func isValidEmail(email string) bool {
+	address, err := mail.ParseAddress(email)
+	return err == nil && address.Address == email
 }
@@ -1,6 +1,7 @@
 package domain
 
 import (
+	"errors"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -36,3 +37,70 @@ func TestShouldReturnErrWhenCityIsEmpty(t *testing.T) {
 		assert.Equal(t, "Invalid value 'city'", err.Error())
 	}
 }
+
+func TestShouldReturnAllViolationsWhenNameAndCityAreEmpty(t *testing.T) {
+
+	newCustomer := Customer{Name: " "}
+
+	err := newCustomer.Validate()
+
+	validationErr := &ValidationError{}
+	if assert.True(t, errors.As(err, &validationErr)) {
+		assert.Equal(t, []*FieldError{ErrInvalidName, ErrInvalidCity}, validationErr.Fields)
+	}
+
+	assert.True(t, errors.Is(err, ErrInvalid))
+	assert.True(t, errors.Is(err, ErrInvalidCity))
+	assert.Equal(t, "Invalid value 'name'; Invalid value 'city'", err.Error())
+}
+
+func TestShouldReturnNilWhenCustomerWithContactAndAddressesIsValid(t *testing.T) {
+
+	newCustomer := Customer{
+		Name:      "Marcos",
+		City:      "Santos",
+		Email:     "marcos@example.com",
+		Phone:     "+5513987654321",
+		Document:  "11222333000181",
+		Addresses: []Address{{Type: AddressBilling, Street: "Av. Ana Costa", City: "Santos"}},
+		Status:    StatusBlocked,
+	}
+
+	assert.Nil(t, newCustomer.Validate())
+}
+
+func TestShouldReturnViolationsOfContactStatusAndAddresses(t *testing.T) {
+
+	newCustomer := Customer{
+		Name:      "Marcos",
+		City:      "Santos",
+		Email:     "Marcos <marcos@example.com>",
+		Phone:     "013987654321",
+		Document:  "12345678900",
+		Addresses: []Address{{Type: AddressHome, Street: "Av. Ana Costa", City: "Santos"}, {Type: "beach"}},
+		Status:    "deleted",
+	}
+
+	err := newCustomer.Validate()
+
+	validationErr := &ValidationError{}
+	if assert.True(t, errors.As(err, &validationErr)) {
+		fields := []string{}
+		for _, field := range validationErr.Fields {
+			fields = append(fields, field.Field)
+		}
+		assert.Equal(t, []string{"email", "phone", "document", "status",
+			"addresses[1].type", "addresses[1].street", "addresses[1].city"}, fields)
+	}
+}
+
+func TestShouldNormalizeEmailAndDocument(t *testing.T) {
+
+	newCustomer := Customer{Email: " Marcos@Example.com ", Phone: " +5513987654321", Document: "529.982.247-25"}
+
+	newCustomer.Normalize()
+
+	assert.Equal(t, "marcos@example.com", newCustomer.Email)
+	assert.Equal(t, "+5513987654321", newCustomer.Phone)
+	assert.Equal(t, "52998224725", newCustomer.Document)
+}
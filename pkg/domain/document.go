@@ -0,0 +1,75 @@
+package domain
+
+import (
+	"strings"
+)
+
+var (
+	cpfFirstWeights   = []int{10, 9, 8, 7, 6, 5, 4, 3, 2}
+	cpfSecondWeights  = []int{11, 10, 9, 8, 7, 6, 5, 4, 3, 2}
+	cnpjFirstWeights  = []int{5, 4, 3, 2, 9, 8, 7, 6, 5, 4, 3, 2}
+	cnpjSecondWeights = []int{6, 5, 4, 3, 2, 9, 8, 7, 6, 5, 4, 3, 2}
+)
+
+// normalizeDocument remove the spaces and the punctuation of a formatted CPF or CNPJ, like 529.982.247-25
+func normalizeDocument(document string) string {
+	return strings.NewReplacer(" ", "", ".", "", "-", "", "/", "").Replace(document)
+}
+
+// IsValidCPF report whether the document is a CPF with 11 digits and valid check digits
+func IsValidCPF(document string) bool {
+
+	digits, ok := toDigits(document, 11)
+	if !ok {
+		return false
+	}
+
+	return checkDigit(digits, cpfFirstWeights) == digits[9] && checkDigit(digits, cpfSecondWeights) == digits[10]
+}
+
+// IsValidCNPJ report whether the document is a CNPJ with 14 digits and valid check digits
+func IsValidCNPJ(document string) bool {
+
+	digits, ok := toDigits(document, 14)
+	if !ok {
+		return false
+	}
+
+	return checkDigit(digits, cnpjFirstWeights) == digits[12] && checkDigit(digits, cnpjSecondWeights) == digits[13]
+}
+
+// toDigits convert the document to its digits, the documents with all digits equal are rejected
+// because they pass the check digit validation
+func toDigits(document string, length int) ([]int, bool) {
+
+	if len(document) != length {
+		return nil, false
+	}
+
+	digits := make([]int, length)
+	repeated := true
+	for i, char := range document {
+		if char < '0' || char > '9' {
+			return nil, false
+		}
+
+		digits[i] = int(char - '0')
+		repeated = repeated && digits[i] == digits[0]
+	}
+
+	return digits, !repeated
+}
+
+// checkDigit compute the modulo 11 check digit of the first len(weights) digits
+func checkDigit(digits []int, weights []int) int {
+
+	sum := 0
+	for i, weight := range weights {
+		sum += digits[i] * weight
+	}
+
+	if rest := sum % 11; rest >= 2 {
+		return 11 - rest
+	}
+	return 0
+}
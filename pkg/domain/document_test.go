@@ -0,0 +1,53 @@
+package domain
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIsValidCPF(t *testing.T) {
+	assert := assert.New(t)
+
+	tests := []struct {
+		description string
+		document    string
+		expected    bool
+	}{
+		{description: "should accept a valid cpf", document: "52998224725", expected: true},
+		{description: "should accept a valid cpf with zero check digit", document: "11144477735", expected: true},
+		{description: "should reject a wrong first check digit", document: "52998224715", expected: false},
+		{description: "should reject a wrong second check digit", document: "52998224726", expected: false},
+		{description: "should reject repeated digits", document: "11111111111", expected: false},
+		{description: "should reject a formatted cpf", document: "529.982.247-25", expected: false},
+		{description: "should reject a short cpf", document: "5299822472", expected: false},
+	}
+
+	for _, tc := range tests {
+		assert.Equal(tc.expected, IsValidCPF(tc.document), tc.description)
+	}
+}
+
+func TestIsValidCNPJ(t *testing.T) {
+	assert := assert.New(t)
+
+	tests := []struct {
+		description string
+		document    string
+		expected    bool
+	}{
+		{description: "should accept a valid cnpj", document: "11222333000181", expected: true},
+		{description: "should reject a wrong check digit", document: "11222333000182", expected: false},
+		{description: "should reject repeated digits", document: "00000000000000", expected: false},
+		{description: "should reject letters", document: "1122233300018A", expected: false},
+	}
+
+	for _, tc := range tests {
+		assert.Equal(tc.expected, IsValidCNPJ(tc.document), tc.description)
+	}
+}
+
+func TestShouldRemoveThePunctuationOfTheDocument(t *testing.T) {
+	assert.Equal(t, "52998224725", normalizeDocument(" 529.982.247-25"))
+	assert.Equal(t, "11222333000181", normalizeDocument("11.222.333/0001-81"))
+}
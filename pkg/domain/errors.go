@@ -0,0 +1,126 @@
+package domain
+
+import (
+	"errors"
+	"strings"
+)
+
+var (
+	// ErrInvalid kind of the errors caused by an invalid input
+	ErrInvalid = errors.New("invalid")
+
+	// ErrNotFound kind of the errors caused by a resource that does not exist
+	ErrNotFound = errors.New("not found")
+
+	// ErrConflict kind of the errors caused by a state that conflicts with the current one
+	ErrConflict = errors.New("conflict")
+
+	// ErrStale kind of the errors caused by a write based on an outdated version of the resource
+	ErrStale = errors.New("stale")
+
+	// ErrUnexpected kind of the errors caused by a failure the client can not fix, like an unavailable database
+	ErrUnexpected = errors.New("unexpected")
+)
+
+// Error an error with a kind, a stable code and a message safe to show to the client,
+// the cause is kept to be logged but never shown
+type Error struct {
+	Kind    error
+	Code    string
+	Message string
+	Cause   error
+}
+
+// NewError create an error of the kind
+func NewError(kind error, code string, message string) *Error {
+	return &Error{Kind: kind, Code: code, Message: message}
+}
+
+// WrapError create an error of the kind caused by err
+func WrapError(kind error, code string, message string, err error) *Error {
+	return &Error{Kind: kind, Code: code, Message: message, Cause: err}
+}
+
+func (err *Error) Error() string {
+	if err.Cause != nil {
+		return err.Message + ": " + err.Cause.Error()
+	}
+	return err.Message
+}
+
+// Unwrap return the cause of the error
+func (err *Error) Unwrap() error {
+	return err.Cause
+}
+
+// Is report whether the error is of the target kind
+func (err *Error) Is(target error) bool {
+	return err.Kind == target
+}
+
+// FieldError a violation of the rules of a field
+type FieldError struct {
+	Field   string
+	Code    string
+	Message string
+}
+
+// NewFieldError create a violation of the field
+func NewFieldError(field string, code string, message string) *FieldError {
+	return &FieldError{Field: field, Code: code, Message: message}
+}
+
+func (err *FieldError) Error() string {
+	return err.Message
+}
+
+// Is report whether the target is the kind ErrInvalid
+func (err *FieldError) Is(target error) bool {
+	return target == ErrInvalid
+}
+
+// ValidationError all the field violations found validating a value
+type ValidationError struct {
+	Fields []*FieldError
+}
+
+func (err *ValidationError) Error() string {
+	messages := make([]string, len(err.Fields))
+	for i, field := range err.Fields {
+		messages[i] = field.Message
+	}
+	return strings.Join(messages, "; ")
+}
+
+// Is report whether the target is the kind ErrInvalid or one of the field violations
+func (err *ValidationError) Is(target error) bool {
+	if target == ErrInvalid {
+		return true
+	}
+
+	for _, field := range err.Fields {
+		if field == target {
+			return true
+		}
+	}
+	return false
+}
+
+// validation collect the field violations of a value
+type validation struct {
+	fields []*FieldError
+}
+
+func (v *validation) check(valid bool, violation *FieldError) {
+	if !valid {
+		v.fields = append(v.fields, violation)
+	}
+}
+
+// err return a ValidationError with all the violations, or nil when there is none
+func (v *validation) err() error {
+	if len(v.fields) == 0 {
+		return nil
+	}
+	return &ValidationError{Fields: v.fields}
+}
@@ -0,0 +1,25 @@
+package domain
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestShouldMatchErrorByKindAndKeepTheCause(t *testing.T) {
+
+	cause := errors.New("connection refused")
+	err := fmt.Errorf("on insert: %w", WrapError(ErrUnexpected, "customer_registration_failed", "could not complete customer registration", cause))
+
+	assert.True(t, errors.Is(err, ErrUnexpected))
+	assert.False(t, errors.Is(err, ErrNotFound))
+	assert.True(t, errors.Is(err, cause))
+
+	domainErr := &Error{}
+	if assert.True(t, errors.As(err, &domainErr)) {
+		assert.Equal(t, "customer_registration_failed", domainErr.Code)
+		assert.Equal(t, "could not complete customer registration", domainErr.Message)
+	}
+}
@@ -0,0 +1,41 @@
+package domain
+
+import "time"
+
+// EventType what happened to a customer
+type EventType string
+
+const (
+	// CustomerCreated the customer was created
+	CustomerCreated EventType = "CustomerCreated"
+
+	// CustomerUpdated the customer was replaced or patched
+	CustomerUpdated EventType = "CustomerUpdated"
+
+	// CustomerDeleted the customer received a tombstone
+	CustomerDeleted EventType = "CustomerDeleted"
+
+	// CustomerRestored the tombstone of the customer was removed
+	CustomerRestored EventType = "CustomerRestored"
+)
+
+// IsValid report whether the event type is known
+func (eventType EventType) IsValid() bool {
+	switch eventType {
+	case CustomerCreated, CustomerUpdated, CustomerDeleted, CustomerRestored:
+		return true
+	}
+	return false
+}
+
+// CustomerEvent defines something that happened to a customer, Customer is its state right after it happened
+type CustomerEvent struct {
+	ID         string    `json:"id"`
+	Type       EventType `json:"type"`
+	CustomerID string    `json:"customerId"`
+	Version    int64     `json:"version"`
+	OccurredAt time.Time `json:"occurredAt"`
+	Actor      string    `json:"actor"`
+	RequestID  string    `json:"requestId,omitempty"`
+	Customer   *Customer `json:"customer"`
+}
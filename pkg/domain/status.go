@@ -0,0 +1,53 @@
+package domain
+
+// CustomerStatus the lifecycle status of a customer
+type CustomerStatus string
+
+const (
+	// StatusActive the customer can operate, every new customer starts active
+	StatusActive CustomerStatus = "active"
+
+	// StatusBlocked the customer is temporarily prevented from operating
+	StatusBlocked CustomerStatus = "blocked"
+
+	// StatusClosed the customer relationship ended, it's a final status
+	StatusClosed CustomerStatus = "closed"
+)
+
+// ErrInvalidStatusTransition Error for a status change that is not allowed from the current status
+var ErrInvalidStatusTransition = NewError(ErrConflict, "invalid_status_transition", "Status transition is not allowed")
+
+// statusTransitions the statuses each status can change to
+var statusTransitions = map[CustomerStatus][]CustomerStatus{
+	StatusActive:  {StatusBlocked, StatusClosed},
+	StatusBlocked: {StatusActive, StatusClosed},
+	StatusClosed:  {},
+}
+
+// IsValid report whether the status is known
+func (status CustomerStatus) IsValid() bool {
+	_, ok := statusTransitions[status]
+	return ok
+}
+
+// CanTransitionTo report whether the status can change to next, keeping the same status is always allowed
+func (status CustomerStatus) CanTransitionTo(next CustomerStatus) bool {
+	if status == next {
+		return true
+	}
+
+	for _, allowed := range statusTransitions[status] {
+		if allowed == next {
+			return true
+		}
+	}
+	return false
+}
+
+// ValidateTransition return ErrInvalidStatusTransition when the status can not change to next
+func (status CustomerStatus) ValidateTransition(next CustomerStatus) error {
+	if !status.CanTransitionTo(next) {
+		return ErrInvalidStatusTransition
+	}
+	return nil
+}
@@ -0,0 +1,37 @@
+package domain
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCustomerStatusTransitions(t *testing.T) {
+	assert := assert.New(t)
+
+	tests := []struct {
+		current  CustomerStatus
+		next     CustomerStatus
+		expected bool
+	}{
+		{current: StatusActive, next: StatusActive, expected: true},
+		{current: StatusActive, next: StatusBlocked, expected: true},
+		{current: StatusActive, next: StatusClosed, expected: true},
+		{current: StatusBlocked, next: StatusActive, expected: true},
+		{current: StatusBlocked, next: StatusClosed, expected: true},
+		{current: StatusClosed, next: StatusActive, expected: false},
+		{current: StatusClosed, next: StatusBlocked, expected: false},
+		{current: StatusActive, next: "deleted", expected: false},
+	}
+
+	for _, tc := range tests {
+		assert.Equal(tc.expected, tc.current.CanTransitionTo(tc.next), "%s -> %s", tc.current, tc.next)
+	}
+}
+
+func TestShouldReturnConflictWhenTransitionIsNotAllowed(t *testing.T) {
+
+	assert.NoError(t, StatusBlocked.ValidateTransition(StatusClosed))
+	assert.Equal(t, ErrInvalidStatusTransition, StatusClosed.ValidateTransition(StatusActive))
+	assert.True(t, StatusClosed.ValidateTransition(StatusActive).(*Error).Is(ErrConflict))
+}
@@ -0,0 +1,106 @@
+package domain
+
+import (
+	"net/url"
+	"time"
+)
+
+// AllEvents the event filter of a webhook that matches every event
+const AllEvents EventType = "*"
+
+// minWebhookSecretLength the shortest secret accepted to sign the deliveries of a webhook
+const minWebhookSecretLength = 16
+
+// WebhookSubscription defines an endpoint that receives the customer events accepted by its filter,
+// every delivery is signed with the secret, which is never returned
+type WebhookSubscription struct {
+	ID        string      `json:"id"`
+	URL       string      `json:"url"`
+	Events    []EventType `json:"events"`
+	Secret    string      `json:"secret,omitempty"`
+	CreatedAt time.Time   `json:"createdAt"`
+}
+
+// DeliveryStatus the status of the delivery of an event to a webhook
+type DeliveryStatus string
+
+const (
+	// DeliveryPending the event is waiting for its next attempt
+	DeliveryPending DeliveryStatus = "pending"
+
+	// DeliverySending the event is being sent by a dispatcher
+	DeliverySending DeliveryStatus = "sending"
+
+	// DeliveryDelivered the webhook answered with a 2xx status
+	DeliveryDelivered DeliveryStatus = "delivered"
+
+	// DeliveryFailed every attempt failed, the event is only delivered again when replayed
+	DeliveryFailed DeliveryStatus = "failed"
+)
+
+// WebhookDelivery defines the delivery of an event to a webhook and the log of its attempts
+type WebhookDelivery struct {
+	ID             string            `json:"id"`
+	SubscriptionID string            `json:"subscriptionId"`
+	EventID        string            `json:"eventId"`
+	EventType      EventType         `json:"eventType"`
+	Status         DeliveryStatus    `json:"status"`
+	CreatedAt      time.Time         `json:"createdAt"`
+	NextAttemptAt  *time.Time        `json:"nextAttemptAt,omitempty"`
+	DeliveredAt    *time.Time        `json:"deliveredAt,omitempty"`
+	Attempts       []DeliveryAttempt `json:"attempts"`
+}
+
+// DeliveryAttempt defines an attempt to deliver an event, StatusCode is absent when the webhook could not be reached
+type DeliveryAttempt struct {
+	At         time.Time `json:"at"`
+	StatusCode int       `json:"statusCode,omitempty"`
+	Error      string    `json:"error,omitempty"`
+	DurationMs int64     `json:"durationMs"`
+}
+
+var (
+	// ErrInvalidWebhookURL Error for a webhook url that is not an absolute http or https url
+	ErrInvalidWebhookURL = NewFieldError("url", "invalid_value", "Invalid value 'url'")
+
+	// ErrInvalidWebhookEvents Error for a webhook without events or with an unknown event
+	ErrInvalidWebhookEvents = NewFieldError("events", "invalid_value", "Invalid value 'events'")
+
+	// ErrInvalidWebhookSecret Error for a webhook secret that is too short
+	ErrInvalidWebhookSecret = NewFieldError("secret", "invalid_length", "Invalid value 'secret'")
+)
+
+// Validate Return a ValidationError with all the violations when the subscription is not valid
+func (subscription *WebhookSubscription) Validate() error {
+
+	v := validation{}
+	v.check(isValidWebhookURL(subscription.URL), ErrInvalidWebhookURL)
+	v.check(len(subscription.Events) > 0 && areValidEventFilters(subscription.Events), ErrInvalidWebhookEvents)
+	v.check(len(subscription.Secret) >= minWebhookSecretLength, ErrInvalidWebhookSecret)
+
+	return v.err()
+}
+
+// Accepts report whether the event filter of the subscription matches the event type
+func (subscription *WebhookSubscription) Accepts(eventType EventType) bool {
+	for _, filter := range subscription.Events {
+		if filter == AllEvents || filter == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+func isValidWebhookURL(rawURL string) bool {
+	parsed, err := url.Parse(rawURL)
+	return err == nil && (parsed.Scheme == "http" || parsed.Scheme == "https") && parsed.Host != ""
+}
+
+func areValidEventFilters(filters []EventType) bool {
+	for _, filter := range filters {
+		if filter != AllEvents && !filter.IsValid() {
+			return false
+		}
+	}
+	return true
+}
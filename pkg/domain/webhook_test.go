@@ -0,0 +1,71 @@
+package domain
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestShouldValidateWebhookSubscription(t *testing.T) {
+
+	tests := []struct {
+		description    string
+		subscription   WebhookSubscription
+		expectedFields []*FieldError
+	}{
+		{
+			description:  "should accept an https url with known events",
+			subscription: WebhookSubscription{URL: "https://hooks.example.com/customer", Events: []EventType{CustomerCreated, CustomerDeleted}, Secret: "0123456789abcdef"},
+		},
+		{
+			description:  "should accept every event",
+			subscription: WebhookSubscription{URL: "http://localhost:9000", Events: []EventType{AllEvents}, Secret: "0123456789abcdef"},
+		},
+		{
+			description:    "should reject a relative url",
+			subscription:   WebhookSubscription{URL: "/customer", Events: []EventType{AllEvents}, Secret: "0123456789abcdef"},
+			expectedFields: []*FieldError{ErrInvalidWebhookURL},
+		},
+		{
+			description:    "should reject an url that is not http",
+			subscription:   WebhookSubscription{URL: "ftp://hooks.example.com", Events: []EventType{AllEvents}, Secret: "0123456789abcdef"},
+			expectedFields: []*FieldError{ErrInvalidWebhookURL},
+		},
+		{
+			description:    "should reject all the violations",
+			subscription:   WebhookSubscription{URL: "hooks", Events: []EventType{"CustomerMoved"}, Secret: "short"},
+			expectedFields: []*FieldError{ErrInvalidWebhookURL, ErrInvalidWebhookEvents, ErrInvalidWebhookSecret},
+		},
+		{
+			description:    "should reject a subscription without events",
+			subscription:   WebhookSubscription{URL: "https://hooks.example.com", Secret: "0123456789abcdef"},
+			expectedFields: []*FieldError{ErrInvalidWebhookEvents},
+		},
+	}
+
+	for _, tc := range tests {
+
+		err := tc.subscription.Validate()
+
+		if tc.expectedFields == nil {
+			assert.Nil(t, err, tc.description)
+			continue
+		}
+
+		var validationError *ValidationError
+		if assert.True(t, errors.As(err, &validationError), tc.description) {
+			assert.Equal(t, tc.expectedFields, validationError.Fields, tc.description)
+		}
+	}
+}
+
+func TestShouldAcceptOnlyTheFilteredEvents(t *testing.T) {
+
+	subscription := WebhookSubscription{Events: []EventType{CustomerCreated}}
+	assert.True(t, subscription.Accepts(CustomerCreated))
+	assert.False(t, subscription.Accepts(CustomerDeleted))
+
+	subscription.Events = []EventType{AllEvents}
+	assert.True(t, subscription.Accepts(CustomerDeleted))
+}
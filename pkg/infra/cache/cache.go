@@ -1,18 +1,22 @@
 package cache
 
 import (
+	"context"
 	"time"
 
 	"github.com/allegro/bigcache"
 	"github.com/jcsw/go-api-learn/pkg/infra/logger"
+	"github.com/jcsw/go-api-learn/pkg/infra/metrics"
 )
 
 var bCache *bigcache.BigCache
 
+var cacheLogger = logger.With(logger.Package("cache"))
+
 func configureBigCache() *bigcache.BigCache {
 	bigcache, err := bigcache.NewBigCache(bigcache.DefaultConfig(10 * time.Minute))
 	if err != nil {
-		logger.Error("p=cache f=configureBigCache 'could not create BigCache' \n%v", err)
+		cacheLogger.Error("could not create BigCache", logger.Function("configureBigCache"), logger.Err(err))
 	}
 
 	return bigcache
@@ -27,12 +31,13 @@ func InitializeLocalCache() {
 func bigCacheMonitor() {
 	for {
 		if bCache != nil {
-			logger.Info("p=cache f=bigCacheMonitor BigCache stats: collisions=%v delHits=%v delMisses=%v hits=%v misses=%v",
-				bCache.Stats().Collisions,
-				bCache.Stats().DelHits,
-				bCache.Stats().DelMisses,
-				bCache.Stats().Hits,
-				bCache.Stats().Misses)
+			stats := bCache.Stats()
+			cacheLogger.Info("BigCache stats", logger.Function("bigCacheMonitor"),
+				logger.Int64("collisions", stats.Collisions),
+				logger.Int64("delHits", stats.DelHits),
+				logger.Int64("delMisses", stats.DelMisses),
+				logger.Int64("hits", stats.Hits),
+				logger.Int64("misses", stats.Misses))
 		} else {
 			bCache = configureBigCache()
 		}
@@ -40,23 +45,101 @@ func bigCacheMonitor() {
 	}
 }
 
-// GetValueInLocalCache - Pull value in local cache
-func GetValueInLocalCache(key string) []byte {
-	value, err := bCache.Get(key)
+// RegisterLocalCacheMetrics - Expose the local cache stats as metrics
+func RegisterLocalCacheMetrics() {
+	metrics.Register(
+		metrics.CounterFunc("bigcache_hits_total", "Number of local cache hits.", func() float64 {
+			return float64(localCacheStats().Hits)
+		}),
+		metrics.CounterFunc("bigcache_misses_total", "Number of local cache misses.", func() float64 {
+			return float64(localCacheStats().Misses)
+		}),
+		metrics.CounterFunc("bigcache_collisions_total", "Number of local cache key collisions.", func() float64 {
+			return float64(localCacheStats().Collisions)
+		}),
+		metrics.GaugeFunc("bigcache_entries", "Number of entries in local cache.", func() float64 {
+			if bCache == nil {
+				return 0
+			}
+			return float64(bCache.Len())
+		}))
+}
+
+func localCacheStats() bigcache.Stats {
+	if bCache == nil {
+		return bigcache.Stats{}
+	}
+	return bCache.Stats()
+}
+
+// LocalCache - A local cache of its own, apart from the one of InitializeLocalCache
+type LocalCache struct {
+	bigCache *bigcache.BigCache
+}
+
+// NewLocalCache - Create a local cache of its own
+func NewLocalCache() *LocalCache {
+	return &LocalCache{bigCache: configureBigCache()}
+}
+
+// DefaultLocalCache - The local cache of InitializeLocalCache
+func DefaultLocalCache() *LocalCache {
+	return &LocalCache{bigCache: bCache}
+}
+
+// PullInLocalCache - Pull value in local cache
+func PullInLocalCache(ctx context.Context, key string) []byte {
+	return DefaultLocalCache().Get(ctx, key)
+}
+
+// PutInLocalCache - Put value in local cache
+func PutInLocalCache(ctx context.Context, key string, value []byte) {
+	DefaultLocalCache().Set(ctx, key, value)
+}
+
+// DeleteValueInLocalCache - Remove value in local cache
+func DeleteValueInLocalCache(ctx context.Context, key string) {
+	DefaultLocalCache().Delete(ctx, key)
+}
+
+// Get - Pull value in the local cache
+func (localCache *LocalCache) Get(ctx context.Context, key string) []byte {
+	value, err := localCache.bigCache.Get(key)
 	if err != nil {
-		logger.Info("p=cache f=GetValueInLocalCache key=%s \n%v", key, err)
+		cacheLogger.WithContext(ctx).Info("key not found", logger.Function("PullInLocalCache"), logger.String("key", key), logger.Err(err))
 		return nil
 	}
 
-	logger.Info("p=cache f=GetValueInLocalCache key=%s value=%s", key, value)
+	cacheLogger.WithContext(ctx).Info("key found", logger.Function("PullInLocalCache"), logger.String("key", key))
 	return value
 }
 
-// SetValueInLocalCache - Put value in local cache
-func SetValueInLocalCache(key string, value []byte) {
-	logger.Info("p=cache f=SetValueInLocalCache key=%s value=%s", key, value)
+// Set - Put value in the local cache
+func (localCache *LocalCache) Set(ctx context.Context, key string, value []byte) {
+	cacheLogger.WithContext(ctx).Info("setting key", logger.Function("PutInLocalCache"), logger.String("key", key))
+
+	if err := localCache.bigCache.Set(key, value); err != nil {
+		cacheLogger.WithContext(ctx).Error("could not set key", logger.Function("PutInLocalCache"), logger.String("key", key), logger.Err(err))
+	}
+}
+
+// Delete - Remove value in the local cache
+func (localCache *LocalCache) Delete(ctx context.Context, key string) {
+	cacheLogger.WithContext(ctx).Info("deleting key", logger.Function("DeleteValueInLocalCache"), logger.String("key", key))
+
+	if err := localCache.bigCache.Delete(key); err != nil {
+		if _, notFound := err.(*bigcache.EntryNotFoundError); notFound {
+			return
+		}
+		cacheLogger.WithContext(ctx).Error("could not delete key", logger.Function("DeleteValueInLocalCache"), logger.String("key", key), logger.Err(err))
+	}
+}
+
+// Reset - Remove every value in the local cache
+func (localCache *LocalCache) Reset(ctx context.Context) {
+	cacheLogger.WithContext(ctx).Info("resetting", logger.Function("Reset"))
 
-	if err := bCache.Set(key, value); err != nil {
-		logger.Error("p=cache f=SetValueInLocalCache \n%s", err)
+	if err := localCache.bigCache.Reset(); err != nil {
+		cacheLogger.WithContext(ctx).Error("could not reset", logger.Function("Reset"), logger.Err(err))
 	}
 }
@@ -3,6 +3,7 @@
 package cache
 
 import (
+	"context"
 	"testing"
 	"time"
 
@@ -16,9 +17,21 @@ func TestPutAndPullValueInLocalCache(t *testing.T) {
 	cacheKey := "testKey-" + time.Now().String()
 	cacheValue := time.Now().String()
 
-	PutInLocalCache(cacheKey, []byte(cacheValue))
+	PutInLocalCache(context.Background(), cacheKey, []byte(cacheValue))
 
-	cachedValue := PullInLocalCache(cacheKey)
+	cachedValue := PullInLocalCache(context.Background(), cacheKey)
 
 	assert.Equal(t, cacheValue, string(cachedValue))
 }
+
+func TestDeleteValueInLocalCache(t *testing.T) {
+
+	InitializeLocalCache()
+
+	cacheKey := "testKey-" + time.Now().String()
+
+	PutInLocalCache(context.Background(), cacheKey, []byte(time.Now().String()))
+	DeleteValueInLocalCache(context.Background(), cacheKey)
+
+	assert.Nil(t, PullInLocalCache(context.Background(), cacheKey))
+}
@@ -1,8 +1,12 @@
 package cachestore
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
+	"time"
+
+	"github.com/mongodb/mongo-go-driver/bson/objectid"
 
 	"github.com/jcsw/go-api-learn/pkg/infra/cache"
 	"github.com/jcsw/go-api-learn/pkg/infra/database/repository"
@@ -11,10 +15,28 @@ import (
 
 const prefixKey = "customer"
 
+var cacheStoreLogger = logger.With(logger.Package("cachestore"))
+
 //CustomerCacheStore the customer cache store
 type CustomerCacheStore interface {
-	RetriveCustomerEntity(customerName string) *repository.CustomerEntity
-	PersistCustomerEntity(customerEntity *repository.CustomerEntity)
+	RetriveCustomerEntity(ctx context.Context, customerName string) *repository.CustomerEntity
+	PersistCustomerEntity(ctx context.Context, customerEntity *repository.CustomerEntity)
+	RemoveCustomerEntity(ctx context.Context, customerName string)
+}
+
+// cachedCustomer the customerEntity serialized in cache, the id is kept as hex
+type cachedCustomer struct {
+	ID        string                     `json:"id"`
+	Name      string                     `json:"name"`
+	City      string                     `json:"city"`
+	Email     string                     `json:"email,omitempty"`
+	Phone     string                     `json:"phone,omitempty"`
+	Document  string                     `json:"document,omitempty"`
+	Addresses []repository.AddressEntity `json:"addresses,omitempty"`
+	Status    string                     `json:"status,omitempty"`
+	CreatedAt time.Time                  `json:"createdAt"`
+	UpdatedAt time.Time                  `json:"updatedAt"`
+	Version   int64                      `json:"version"`
 }
 
 //CacheStore a cache store
@@ -22,34 +44,84 @@ type CacheStore struct {
 }
 
 // RetriveCustomerEntity retrive the customerEntity in cache
-func (CacheStore) RetriveCustomerEntity(customerName string) *repository.CustomerEntity {
+func (CacheStore) RetriveCustomerEntity(ctx context.Context, customerName string) *repository.CustomerEntity {
 
-	customerInBytes := cache.GetValueInLocalCache(makeCacheKey(customerName))
+	customerInBytes := cache.PullInLocalCache(ctx, makeCacheKey(customerName))
 	if customerInBytes == nil {
 		return nil
 	}
 
-	customerEntity := repository.CustomerEntity{}
-	if err := json.Unmarshal(customerInBytes, &customerEntity); err != nil {
-		logger.Warn("f=RetriveCustomerEntity err=%v", err)
-		return nil
-	}
-
-	return &customerEntity
+	return decodeCustomerEntity(customerInBytes)
 }
 
 // PersistCustomerEntity persist the customerEntity in cache
-func (CacheStore) PersistCustomerEntity(customerEntity *repository.CustomerEntity) {
+func (CacheStore) PersistCustomerEntity(ctx context.Context, customerEntity *repository.CustomerEntity) {
 
-	customerInBytes, err := json.Marshal(customerEntity)
-	if err != nil {
-		logger.Warn("f=PersistCustomerEntity err=%v", err)
+	customerInBytes := encodeCustomerEntity(customerEntity)
+	if customerInBytes == nil {
 		return
 	}
 
-	cache.SetValueInLocalCache(makeCacheKey(customerEntity.Name), customerInBytes)
+	cache.PutInLocalCache(ctx, makeCacheKey(customerEntity.Name), customerInBytes)
+}
+
+// RemoveCustomerEntity remove the customerEntity from cache
+func (CacheStore) RemoveCustomerEntity(ctx context.Context, customerName string) {
+	cache.DeleteValueInLocalCache(ctx, makeCacheKey(customerName))
 }
 
 func makeCacheKey(customerName string) string {
 	return fmt.Sprintf("%s-%s", prefixKey, customerName)
 }
+
+func encodeCustomerEntity(customerEntity *repository.CustomerEntity) []byte {
+
+	customerInBytes, err := json.Marshal(cachedCustomer{
+		ID:        customerEntity.ID.Hex(),
+		Name:      customerEntity.Name,
+		City:      customerEntity.City,
+		Email:     customerEntity.Email,
+		Phone:     customerEntity.Phone,
+		Document:  customerEntity.Document,
+		Addresses: customerEntity.Addresses,
+		Status:    customerEntity.Status,
+		CreatedAt: customerEntity.CreatedAt,
+		UpdatedAt: customerEntity.UpdatedAt,
+		Version:   customerEntity.Version,
+	})
+	if err != nil {
+		cacheStoreLogger.Warn("could not encode the customer", logger.Function("encodeCustomerEntity"), logger.Err(err))
+		return nil
+	}
+
+	return customerInBytes
+}
+
+func decodeCustomerEntity(customerInBytes []byte) *repository.CustomerEntity {
+
+	customer := cachedCustomer{}
+	if err := json.Unmarshal(customerInBytes, &customer); err != nil {
+		cacheStoreLogger.Warn("could not decode the customer", logger.Function("decodeCustomerEntity"), logger.Err(err))
+		return nil
+	}
+
+	id, err := objectid.FromHex(customer.ID)
+	if err != nil {
+		cacheStoreLogger.Warn("could not decode the customer", logger.Function("decodeCustomerEntity"), logger.Err(err))
+		return nil
+	}
+
+	return &repository.CustomerEntity{
+		ID:        id,
+		Name:      customer.Name,
+		City:      customer.City,
+		Email:     customer.Email,
+		Phone:     customer.Phone,
+		Document:  customer.Document,
+		Addresses: customer.Addresses,
+		Status:    customer.Status,
+		CreatedAt: customer.CreatedAt,
+		UpdatedAt: customer.UpdatedAt,
+		Version:   customer.Version,
+	}
+}
@@ -1,6 +1,8 @@
 package cachestore
 
 import (
+	"context"
+
 	"github.com/jcsw/go-api-learn/pkg/infra/database/repository"
 	"github.com/stretchr/testify/mock"
 )
@@ -11,8 +13,8 @@ type CustomerCacheStoreMock struct {
 }
 
 // RetriveCustomerEntity mock to RetriveCustomerEntity
-func (m *CustomerCacheStoreMock) RetriveCustomerEntity(customerName string) *repository.CustomerEntity {
-	args := m.Called(customerName)
+func (m *CustomerCacheStoreMock) RetriveCustomerEntity(ctx context.Context, customerName string) *repository.CustomerEntity {
+	args := m.Called(ctx, customerName)
 
 	if args.Get(0) == nil {
 		return nil
@@ -22,6 +24,11 @@ func (m *CustomerCacheStoreMock) RetriveCustomerEntity(customerName string) *rep
 }
 
 // PersistCustomerEntity mock to PersistCustomerEntity
-func (m *CustomerCacheStoreMock) PersistCustomerEntity(customerEntity *repository.CustomerEntity) {
-	m.Called(customerEntity)
+func (m *CustomerCacheStoreMock) PersistCustomerEntity(ctx context.Context, customerEntity *repository.CustomerEntity) {
+	m.Called(ctx, customerEntity)
+}
+
+// RemoveCustomerEntity mock to RemoveCustomerEntity
+func (m *CustomerCacheStoreMock) RemoveCustomerEntity(ctx context.Context, customerName string) {
+	m.Called(ctx, customerName)
 }
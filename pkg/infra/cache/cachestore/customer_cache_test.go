@@ -0,0 +1,38 @@
+package cachestore
+
+import (
+	"testing"
+	"time"
+
+	"github.com/mongodb/mongo-go-driver/bson/objectid"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/jcsw/go-api-learn/pkg/infra/database/repository"
+)
+
+func TestShouldDecodeTheEncodedCustomerEntity(t *testing.T) {
+
+	customerEntity := &repository.CustomerEntity{
+		ID:        objectid.New(),
+		Name:      "Amanda",
+		City:      "São Paulo",
+		Email:     "amanda@example.com",
+		Phone:     "+5511987654321",
+		Document:  "52998224725",
+		Addresses: []repository.AddressEntity{{Type: "home", Street: "Rua Augusta", Number: "100", City: "São Paulo", Country: "BR"}},
+		Status:    "active",
+		CreatedAt: time.Date(2018, 10, 7, 12, 30, 0, 0, time.UTC),
+		UpdatedAt: time.Date(2018, 10, 8, 9, 15, 0, 0, time.UTC),
+		Version:   3,
+	}
+
+	customerInBytes := encodeCustomerEntity(customerEntity)
+
+	assert.Equal(t, customerEntity, decodeCustomerEntity(customerInBytes))
+}
+
+func TestShouldReturnNilWhenCachedCustomerIsNotValid(t *testing.T) {
+
+	assert.Nil(t, decodeCustomerEntity([]byte(`{"id":"invalid","name":"Amanda"}`)))
+	assert.Nil(t, decodeCustomerEntity([]byte(`not json`)))
+}
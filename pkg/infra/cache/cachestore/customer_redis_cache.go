@@ -0,0 +1,39 @@
+package cachestore
+
+import (
+	"context"
+
+	"github.com/jcsw/go-api-learn/pkg/infra/cache"
+	"github.com/jcsw/go-api-learn/pkg/infra/database/repository"
+)
+
+// RedisCacheStore a cache store shared by all instances through redis
+type RedisCacheStore struct {
+}
+
+// RetriveCustomerEntity retrive the customerEntity in redis
+func (RedisCacheStore) RetriveCustomerEntity(ctx context.Context, customerName string) *repository.CustomerEntity {
+
+	customerInBytes := cache.GetValueInRedis(ctx, makeCacheKey(customerName))
+	if customerInBytes == nil {
+		return nil
+	}
+
+	return decodeCustomerEntity(customerInBytes)
+}
+
+// PersistCustomerEntity persist the customerEntity in redis
+func (RedisCacheStore) PersistCustomerEntity(ctx context.Context, customerEntity *repository.CustomerEntity) {
+
+	customerInBytes := encodeCustomerEntity(customerEntity)
+	if customerInBytes == nil {
+		return
+	}
+
+	cache.SetValueInRedis(ctx, makeCacheKey(customerEntity.Name), customerInBytes)
+}
+
+// RemoveCustomerEntity remove the customerEntity from redis
+func (RedisCacheStore) RemoveCustomerEntity(ctx context.Context, customerName string) {
+	cache.DeleteValueInRedis(ctx, makeCacheKey(customerName))
+}
@@ -0,0 +1,110 @@
+package cachestore
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/jcsw/go-api-learn/pkg/infra/cache"
+	"github.com/jcsw/go-api-learn/pkg/infra/database/repository"
+	"github.com/jcsw/go-api-learn/pkg/infra/logger"
+)
+
+const invalidationChannel = "customer-invalidation"
+
+// invalidationMessage the message broadcasted to evict a key from the local cache of the other instances
+type invalidationMessage struct {
+	Origin string `json:"origin"`
+	Key    string `json:"key"`
+}
+
+// TwoTierCacheStore a cache store with the local cache in front of redis,
+// every write is broadcasted so the other instances evict their local copy
+type TwoTierCacheStore struct {
+	instanceID string
+	localCache *cache.LocalCache
+}
+
+// NewTwoTierCacheStore create a TwoTierCacheStore and start to listen the invalidations from the other instances
+func NewTwoTierCacheStore(localCache *cache.LocalCache) *TwoTierCacheStore {
+	cacheStore := &TwoTierCacheStore{instanceID: fmt.Sprintf("%d", time.Now().UnixNano()), localCache: localCache}
+	go cache.SubscribeInRedis(invalidationChannel, cacheStore.handleSubscription, cacheStore.handleInvalidation)
+	return cacheStore
+}
+
+// RetriveCustomerEntity retrive the customerEntity in local cache and then in redis
+func (cacheStore *TwoTierCacheStore) RetriveCustomerEntity(ctx context.Context, customerName string) *repository.CustomerEntity {
+
+	cacheKey := makeCacheKey(customerName)
+
+	if customerInBytes := cacheStore.localCache.Get(ctx, cacheKey); customerInBytes != nil {
+		return decodeCustomerEntity(customerInBytes)
+	}
+
+	customerInBytes := cache.GetValueInRedis(ctx, cacheKey)
+	if customerInBytes == nil {
+		return nil
+	}
+
+	customerEntity := decodeCustomerEntity(customerInBytes)
+	if customerEntity != nil {
+		cacheStore.localCache.Set(ctx, cacheKey, customerInBytes)
+	}
+
+	return customerEntity
+}
+
+// PersistCustomerEntity persist the customerEntity in both tiers and evict it from the other instances
+func (cacheStore *TwoTierCacheStore) PersistCustomerEntity(ctx context.Context, customerEntity *repository.CustomerEntity) {
+
+	customerInBytes := encodeCustomerEntity(customerEntity)
+	if customerInBytes == nil {
+		return
+	}
+
+	cacheKey := makeCacheKey(customerEntity.Name)
+	cache.SetValueInRedis(ctx, cacheKey, customerInBytes)
+	cacheStore.localCache.Set(ctx, cacheKey, customerInBytes)
+	cacheStore.broadcastInvalidation(ctx, cacheKey)
+}
+
+// RemoveCustomerEntity remove the customerEntity from both tiers and from the other instances
+func (cacheStore *TwoTierCacheStore) RemoveCustomerEntity(ctx context.Context, customerName string) {
+
+	cacheKey := makeCacheKey(customerName)
+	cache.DeleteValueInRedis(ctx, cacheKey)
+	cacheStore.localCache.Delete(ctx, cacheKey)
+	cacheStore.broadcastInvalidation(ctx, cacheKey)
+}
+
+func (cacheStore *TwoTierCacheStore) broadcastInvalidation(ctx context.Context, cacheKey string) {
+
+	message, err := json.Marshal(invalidationMessage{Origin: cacheStore.instanceID, Key: cacheKey})
+	if err != nil {
+		cacheStoreLogger.WithContext(ctx).Warn("could not encode the invalidation", logger.Function("broadcastInvalidation"), logger.Err(err))
+		return
+	}
+
+	cache.PublishInRedis(ctx, invalidationChannel, message)
+}
+
+// handleSubscription empty the local cache, the invalidations broadcasted while the subscription was lost were missed
+func (cacheStore *TwoTierCacheStore) handleSubscription() {
+	cacheStore.localCache.Reset(context.Background())
+}
+
+func (cacheStore *TwoTierCacheStore) handleInvalidation(messageInBytes []byte) {
+
+	message := invalidationMessage{}
+	if err := json.Unmarshal(messageInBytes, &message); err != nil {
+		cacheStoreLogger.Warn("could not decode the invalidation", logger.Function("handleInvalidation"), logger.Err(err))
+		return
+	}
+
+	if message.Origin == cacheStore.instanceID {
+		return
+	}
+
+	cacheStore.localCache.Delete(context.Background(), message.Key)
+}
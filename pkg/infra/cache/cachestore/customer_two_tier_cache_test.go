@@ -0,0 +1,53 @@
+package cachestore
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/jcsw/go-api-learn/pkg/infra/cache"
+)
+
+func TestShouldEvictLocalCacheWhenInvalidationComesFromOtherInstance(t *testing.T) {
+
+	cacheStore := TwoTierCacheStore{instanceID: "instance-1", localCache: cache.NewLocalCache()}
+
+	cacheKey := makeCacheKey("Amanda")
+	cacheStore.localCache.Set(context.Background(), cacheKey, []byte("value"))
+
+	message, _ := json.Marshal(invalidationMessage{Origin: "instance-2", Key: cacheKey})
+
+	cacheStore.handleInvalidation(message)
+
+	assert.Nil(t, cacheStore.localCache.Get(context.Background(), cacheKey))
+}
+
+func TestShouldKeepLocalCacheWhenInvalidationComesFromSameInstance(t *testing.T) {
+
+	cacheStore := TwoTierCacheStore{instanceID: "instance-1", localCache: cache.NewLocalCache()}
+
+	cacheKey := makeCacheKey("Marcos")
+	cacheStore.localCache.Set(context.Background(), cacheKey, []byte("value"))
+
+	message, _ := json.Marshal(invalidationMessage{Origin: "instance-1", Key: cacheKey})
+
+	cacheStore.handleInvalidation(message)
+
+	assert.Equal(t, []byte("value"), cacheStore.localCache.Get(context.Background(), cacheKey))
+}
+
+func TestShouldEmptyLocalCacheWhenSubscribedAgain(t *testing.T) {
+
+	cacheStore := TwoTierCacheStore{instanceID: "instance-1", localCache: cache.NewLocalCache()}
+
+	amandaKey, marcosKey := makeCacheKey("Amanda"), makeCacheKey("Marcos")
+	cacheStore.localCache.Set(context.Background(), amandaKey, []byte("amanda"))
+	cacheStore.localCache.Set(context.Background(), marcosKey, []byte("marcos"))
+
+	cacheStore.handleSubscription()
+
+	assert.Nil(t, cacheStore.localCache.Get(context.Background(), amandaKey))
+	assert.Nil(t, cacheStore.localCache.Get(context.Background(), marcosKey))
+}
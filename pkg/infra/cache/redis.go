@@ -0,0 +1,226 @@
+package cache
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+
+	"github.com/jcsw/go-api-learn/pkg/infra/logger"
+	"github.com/jcsw/go-api-learn/pkg/infra/metrics"
+	"github.com/jcsw/go-api-learn/pkg/infra/properties"
+)
+
+var (
+	redisPool    *redis.Pool
+	redisHealthy int32
+)
+
+// InitializeRedisPool initialize the redis connection pool
+func InitializeRedisPool() {
+	redisPool = createRedisPool()
+	go redisPoolMonitor()
+}
+
+// IsRedisAlive return redis status
+func IsRedisAlive() bool {
+	return atomic.LoadInt32(&redisHealthy) == 1
+}
+
+// CloseRedisPool close the redis connection pool
+func CloseRedisPool() {
+	if redisPool != nil {
+		redisPool.Close()
+		cacheLogger.Info("redis pool it's closed", logger.Function("CloseRedisPool"))
+	}
+}
+
+// RegisterRedisMetrics - Expose the redis status and pool stats as metrics
+func RegisterRedisMetrics() {
+	metrics.Register(
+		metrics.GaugeFunc("redis_up", "Whether redis is reachable.", func() float64 {
+			return float64(atomic.LoadInt32(&redisHealthy))
+		}),
+		metrics.GaugeFunc("redis_pool_active_connections", "Number of connections in the redis pool.", func() float64 {
+			return float64(redisPool.Stats().ActiveCount)
+		}),
+		metrics.GaugeFunc("redis_pool_idle_connections", "Number of idle connections in the redis pool.", func() float64 {
+			return float64(redisPool.Stats().IdleCount)
+		}))
+}
+
+// GetValueInRedis - Pull value in redis
+func GetValueInRedis(ctx context.Context, key string) []byte {
+	log := cacheLogger.WithContext(ctx).With(logger.Function("GetValueInRedis"), logger.String("key", key))
+
+	ctx, cancel := properties.AppProperties.Deadlines.WithDeadline(ctx, "GetValueInRedis")
+	defer cancel()
+
+	conn, err := redisPool.GetContext(ctx)
+	if err != nil {
+		log.Error("could not get key", logger.Err(err))
+		return nil
+	}
+	defer conn.Close()
+
+	value, err := redis.Bytes(redis.DoContext(conn, ctx, "GET", key))
+	if err == redis.ErrNil {
+		log.Info("key not found")
+		return nil
+	}
+
+	if err != nil {
+		log.Error("could not get key", logger.Err(err))
+		return nil
+	}
+
+	log.Info("key found")
+	return value
+}
+
+// SetValueInRedis - Put value in redis, expiring after the configured ttl
+func SetValueInRedis(ctx context.Context, key string, value []byte) {
+	log := cacheLogger.WithContext(ctx).With(logger.Function("SetValueInRedis"), logger.String("key", key))
+	log.Info("setting key")
+
+	ctx, cancel := properties.AppProperties.Deadlines.WithDeadline(ctx, "SetValueInRedis")
+	defer cancel()
+
+	conn, err := redisPool.GetContext(ctx)
+	if err != nil {
+		log.Error("could not set key", logger.Err(err))
+		return
+	}
+	defer conn.Close()
+
+	ttl := properties.AppProperties.Redis.TTL * time.Second
+	if _, err := redis.DoContext(conn, ctx, "SET", key, value, "PX", int64(ttl/time.Millisecond)); err != nil {
+		log.Error("could not set key", logger.Err(err))
+	}
+}
+
+// DeleteValueInRedis - Remove value in redis
+func DeleteValueInRedis(ctx context.Context, key string) {
+	log := cacheLogger.WithContext(ctx).With(logger.Function("DeleteValueInRedis"), logger.String("key", key))
+	log.Info("deleting key")
+
+	ctx, cancel := properties.AppProperties.Deadlines.WithDeadline(ctx, "DeleteValueInRedis")
+	defer cancel()
+
+	conn, err := redisPool.GetContext(ctx)
+	if err != nil {
+		log.Error("could not delete key", logger.Err(err))
+		return
+	}
+	defer conn.Close()
+
+	if _, err := redis.DoContext(conn, ctx, "DEL", key); err != nil {
+		log.Error("could not delete key", logger.Err(err))
+	}
+}
+
+// PublishInRedis - Publish the message on the redis channel
+func PublishInRedis(ctx context.Context, channel string, message []byte) {
+	ctx, cancel := properties.AppProperties.Deadlines.WithDeadline(ctx, "PublishInRedis")
+	defer cancel()
+
+	conn, err := redisPool.GetContext(ctx)
+	if err != nil {
+		cacheLogger.WithContext(ctx).Error("could not publish the message",
+			logger.Function("PublishInRedis"), logger.String("channel", channel), logger.Err(err))
+		return
+	}
+	defer conn.Close()
+
+	if _, err := redis.DoContext(conn, ctx, "PUBLISH", channel, message); err != nil {
+		cacheLogger.WithContext(ctx).Error("could not publish the message",
+			logger.Function("PublishInRedis"), logger.String("channel", channel), logger.Err(err))
+	}
+}
+
+// SubscribeInRedis - Call onMessage for every message published on the redis channel,
+// it blocks forever and subscribes again when the connection is lost. onSubscribe is called
+// every time the subscription is confirmed, the messages published while it was lost are not received
+func SubscribeInRedis(channel string, onSubscribe func(), onMessage func(message []byte)) {
+	for {
+		receiveFromRedis(channel, onSubscribe, onMessage)
+		time.Sleep(1 * time.Second)
+	}
+}
+
+func receiveFromRedis(channel string, onSubscribe func(), onMessage func(message []byte)) {
+	conn := redis.PubSubConn{Conn: redisPool.Get()}
+	defer conn.Close()
+
+	if err := conn.Subscribe(channel); err != nil {
+		cacheLogger.Error("could not subscribe on channel", logger.Function("receiveFromRedis"), logger.String("channel", channel), logger.Err(err))
+		return
+	}
+
+	cacheLogger.Info("subscribed on channel", logger.Function("receiveFromRedis"), logger.String("channel", channel))
+	for {
+		switch reply := conn.ReceiveWithTimeout(0).(type) {
+		case redis.Subscription:
+			if reply.Kind == "subscribe" {
+				onSubscribe()
+			}
+		case redis.Message:
+			onMessage(reply.Data)
+		case error:
+			cacheLogger.Error("subscription lost", logger.Function("receiveFromRedis"), logger.String("channel", channel), logger.Err(reply))
+			return
+		}
+	}
+}
+
+func createRedisPool() *redis.Pool {
+	redisProperties := properties.AppProperties.Redis
+	timeout := redisProperties.Timeout * time.Millisecond
+
+	return &redis.Pool{
+		MaxIdle:     redisProperties.MaxIdle,
+		MaxActive:   redisProperties.MaxActive,
+		IdleTimeout: redisProperties.IdleTimeout * time.Second,
+		Wait:        true,
+		Dial: func() (redis.Conn, error) {
+			return redis.Dial("tcp", redisProperties.Address,
+				redis.DialPassword(redisProperties.Password),
+				redis.DialDatabase(redisProperties.Database),
+				redis.DialConnectTimeout(timeout),
+				redis.DialReadTimeout(timeout),
+				redis.DialWriteTimeout(timeout))
+		},
+		TestOnBorrow: func(conn redis.Conn, lastUsed time.Time) error {
+			if time.Since(lastUsed) < time.Minute {
+				return nil
+			}
+			_, err := conn.Do("PING")
+			return err
+		},
+	}
+}
+
+func pingRedis() error {
+	conn := redisPool.Get()
+	defer conn.Close()
+
+	_, err := conn.Do("PING")
+	return err
+}
+
+func redisPoolMonitor() {
+	for {
+
+		if err := pingRedis(); err != nil {
+			atomic.StoreInt32(&redisHealthy, 0)
+			cacheLogger.Warn("redis is not active", logger.Function("redisPoolMonitor"), logger.Err(err))
+		} else {
+			atomic.StoreInt32(&redisHealthy, 1)
+			stats := redisPool.Stats()
+			cacheLogger.Info("redis it's alive", logger.Function("redisPoolMonitor"), logger.Int("activeCount", stats.ActiveCount), logger.Int("idleCount", stats.IdleCount))
+		}
+
+		time.Sleep(30 * time.Second)
+	}
+}
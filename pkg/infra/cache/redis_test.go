@@ -0,0 +1,39 @@
+//go:build integration
+// +build integration
+
+package cache
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/jcsw/go-api-learn/pkg/infra/properties"
+)
+
+func TestSetAndGetValueInRedis(t *testing.T) {
+
+	properties.AppProperties =
+		properties.Properties{
+			Redis: properties.RedisProperties{
+				Address:     "localhost:6379",
+				Timeout:     500,
+				MaxIdle:     1,
+				MaxActive:   2,
+				IdleTimeout: 60,
+				TTL:         10,
+			}}
+
+	InitializeRedisPool()
+	defer CloseRedisPool()
+
+	cacheKey := "testKey-" + time.Now().String()
+	cacheValue := time.Now().String()
+
+	SetValueInRedis(context.Background(), cacheKey, []byte(cacheValue))
+
+	assert.Equal(t, cacheValue, string(GetValueInRedis(context.Background(), cacheKey)))
+	assert.Nil(t, GetValueInRedis(context.Background(), "missingKey-"+time.Now().String()))
+}
@@ -0,0 +1,123 @@
+package database
+
+import (
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/gocql/gocql"
+
+	"github.com/jcsw/go-api-learn/pkg/infra/logger"
+	"github.com/jcsw/go-api-learn/pkg/infra/metrics"
+	"github.com/jcsw/go-api-learn/pkg/infra/properties"
+)
+
+var (
+	cassandraSession *gocql.Session
+	cassandraHealthy int32
+)
+
+// InitializeCassandraSession initialize the cassandra session
+func InitializeCassandraSession() {
+	cassandraSession = createCassandraSession()
+	go cassandraSessionMonitor()
+}
+
+// IsCassandraSessionAlive return cassandra session status
+func IsCassandraSessionAlive() bool {
+	return atomic.LoadInt32(&cassandraHealthy) == 1
+}
+
+// RegisterCassandraSessionMetrics expose the cassandra status as metrics
+func RegisterCassandraSessionMetrics() {
+	metrics.Register(
+		metrics.GaugeFunc("cassandra_up", "Whether the cassandra session is connected.", func() float64 {
+			return float64(atomic.LoadInt32(&cassandraHealthy))
+		}))
+}
+
+// RetrieveCassandraSession Return a cassandra session
+func RetrieveCassandraSession() *gocql.Session {
+
+	if cassandraSession != nil {
+		return cassandraSession
+	}
+
+	databaseLogger.Warn("cassandra session is not active", logger.Function("RetrieveCassandraSession"))
+	return nil
+}
+
+// CloseCassandraSession close the cassandra session
+func CloseCassandraSession() {
+	if cassandraSession != nil {
+		cassandraSession.Close()
+		databaseLogger.Info("cassandra session it's closed", logger.Function("CloseCassandraSession"))
+	}
+}
+
+func createCassandraCluster(keyspace string) *gocql.ClusterConfig {
+	cluster := gocql.NewCluster(properties.AppProperties.Cassandra.Hosts...)
+	cluster.Keyspace = keyspace
+	cluster.Consistency = gocql.ParseConsistency(properties.AppProperties.Cassandra.Consistency)
+	cluster.Timeout = properties.AppProperties.Cassandra.Timeout * time.Millisecond
+	cluster.ConnectTimeout = properties.AppProperties.Cassandra.Timeout * time.Millisecond
+	cluster.NumConns = properties.AppProperties.Cassandra.NumConns
+	return cluster
+}
+
+func createCassandraKeyspace() error {
+
+	session, err := createCassandraCluster("").CreateSession()
+	if err != nil {
+		return err
+	}
+	defer session.Close()
+
+	return session.Query(fmt.Sprintf(
+		"CREATE KEYSPACE IF NOT EXISTS %s WITH replication = {'class': 'SimpleStrategy', 'replication_factor': %d}",
+		properties.AppProperties.Cassandra.Keyspace,
+		properties.AppProperties.Cassandra.ReplicationFactor)).Exec()
+}
+
+func createCassandraSession() *gocql.Session {
+
+	if err := createCassandraKeyspace(); err != nil {
+		databaseLogger.Error("could not create cassandra keyspace", logger.Function("createCassandraSession"), logger.Err(err))
+		return nil
+	}
+
+	session, err := createCassandraCluster(properties.AppProperties.Cassandra.Keyspace).CreateSession()
+	if err != nil {
+		databaseLogger.Error("could not connect at cassandra", logger.Function("createCassandraSession"), logger.Err(err))
+		return nil
+	}
+
+	databaseLogger.Info("cassandra session created", logger.Function("createCassandraSession"), logger.String("keyspace", properties.AppProperties.Cassandra.Keyspace))
+	setCassandraStatusUp()
+
+	return session
+}
+
+func cassandraSessionMonitor() {
+	for {
+
+		if cassandraSession == nil || cassandraSession.Closed() || cassandraSession.Query("SELECT now() FROM system.local").Exec() != nil {
+			setCassandraStatusDown()
+			databaseLogger.Warn("cassandra session is not active, trying to reconnect", logger.Function("cassandraSessionMonitor"))
+			cassandraSession = createCassandraSession()
+		} else {
+			setCassandraStatusUp()
+			databaseLogger.Info("cassandra session it's alive", logger.Function("cassandraSessionMonitor"))
+		}
+
+		time.Sleep(30 * time.Second)
+	}
+}
+
+func setCassandraStatusUp() {
+	atomic.StoreInt32(&cassandraHealthy, 1)
+}
+
+func setCassandraStatusDown() {
+	atomic.StoreInt32(&cassandraHealthy, 0)
+}
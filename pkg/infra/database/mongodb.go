@@ -9,6 +9,7 @@ import (
 	"github.com/mongodb/mongo-go-driver/mongo"
 
 	"github.com/jcsw/go-api-learn/pkg/infra/logger"
+	"github.com/jcsw/go-api-learn/pkg/infra/metrics"
 	"github.com/jcsw/go-api-learn/pkg/infra/properties"
 )
 
@@ -17,6 +18,8 @@ var (
 	healthy     int32
 )
 
+var databaseLogger = logger.With(logger.Package("database"))
+
 // InitializeMongoClient initiliaze the mongodb session
 func InitializeMongoClient() {
 	mongoClient = createMongoClient()
@@ -28,6 +31,15 @@ func IsMongoClientAlive() bool {
 	return atomic.LoadInt32(&healthy) == 1
 }
 
+// RegisterMongoClientMetrics expose the mongodb status as metrics, the driver does not report the
+// connections of its pool, the ones in use are the database_operations_in_flight of the mongodb backend
+func RegisterMongoClientMetrics() {
+	metrics.Register(
+		metrics.GaugeFunc("mongodb_up", "Whether the mongodb client is connected.", func() float64 {
+			return float64(atomic.LoadInt32(&healthy))
+		}))
+}
+
 // RetrieveMongoClient Return a mongodb session
 func RetrieveMongoClient() *mongo.Client {
 
@@ -35,7 +47,7 @@ func RetrieveMongoClient() *mongo.Client {
 		return mongoClient
 	}
 
-	logger.Warn("p=database f=RetrieveMongoClient 'mongodb client is not active'")
+	databaseLogger.Warn("mongodb client is not active", logger.Function("RetrieveMongoClient"))
 	return nil
 }
 
@@ -46,7 +58,7 @@ func CloseMongoClient() {
 		defer cancel()
 
 		mongoClient.Disconnect(ctx)
-		logger.Info("p=database f=CloseMongoClient 'mongodb client it's closed'")
+		databaseLogger.Info("mongodb client it's closed", logger.Function("CloseMongoClient"))
 	}
 }
 
@@ -59,21 +71,26 @@ func createMongoClient() *mongo.Client {
 		Database:        properties.AppProperties.MongoDB.Database,
 		ConnectTimeout:  properties.AppProperties.MongoDB.Timeout * time.Millisecond,
 		MaxConnsPerHost: properties.AppProperties.MongoDB.PoolLimit,
+		ReplicaSet:      properties.AppProperties.MongoDB.ReplicaSet,
 	})
 
 	if err != nil {
-		logger.Error("p=database f=createMongoClient 'could not create mongodb client' \n%v", err)
+		databaseLogger.Error("could not create mongodb client", logger.Function("createMongoClient"), logger.Err(err))
 		return nil
 	}
 
 	err = client.Connect(context.TODO())
 	if err != nil {
-		logger.Error("p=database f=createMongoClient 'could not connect at mongodb' \n%v", err)
+		databaseLogger.Error("could not connect at mongodb", logger.Function("createMongoClient"), logger.Err(err))
 		return nil
 	}
 
 	dataBases, _ := client.ListDatabases(nil, nil, nil)
-	logger.Info("p=database f=createMongoClient 'mongodb client created with databases'\n%+v", dataBases)
+	dataBaseNames := make([]string, 0, len(dataBases.Databases))
+	for _, dataBase := range dataBases.Databases {
+		dataBaseNames = append(dataBaseNames, dataBase.Name)
+	}
+	databaseLogger.Info("mongodb client created", logger.Function("createMongoClient"), logger.Any("databases", dataBaseNames))
 	setMongoDBStatusUp()
 
 	return client
@@ -84,11 +101,11 @@ func mongoClientMonitor() {
 
 		if mongoClient == nil || mongoClient.Ping(nil, nil) != nil {
 			setMongoDBStatusDown()
-			logger.Warn("p=database f=mongoClientMonitor 'mongodb client is not active, trying to reconnect'")
+			databaseLogger.Warn("mongodb client is not active, trying to reconnect", logger.Function("mongoClientMonitor"))
 			mongoClient = createMongoClient()
 		} else {
 			setMongoDBStatusUp()
-			logger.Info("p=database f=mongoClientMonitor 'mongodb client it's alive'")
+			databaseLogger.Info("mongodb client it's alive", logger.Function("mongoClientMonitor"))
 		}
 
 		time.Sleep(30 * time.Second)
@@ -0,0 +1,81 @@
+package database
+
+import (
+	"context"
+	"errors"
+
+	"github.com/mongodb/mongo-go-driver/bson"
+	"github.com/mongodb/mongo-go-driver/core/command"
+	"github.com/mongodb/mongo-go-driver/mongo"
+
+	"github.com/jcsw/go-api-learn/pkg/infra/logger"
+)
+
+// MongoIndex an index of a collection, declared by the repository that owns the collection
+type MongoIndex struct {
+	Database   string
+	Collection string
+	Name       string
+	Keys       *bson.Document
+	Unique     bool
+	Sparse     bool
+
+	// PartialFilterExpression the filter of the documents indexed, nil indexes them all
+	PartialFilterExpression *bson.Document
+}
+
+// indexConflictCodes the codes of the errors of an index that exists with other options or keys
+var indexConflictCodes = map[int32]bool{85: true, 86: true}
+
+// MongoIndexDeclarer a repository that declares the indexes its queries and constraints rely on
+type MongoIndexDeclarer interface {
+	MongoIndexes() []MongoIndex
+}
+
+// EnsureMongoIndexes create the indexes declared by the repositories, the indexes that already exist are kept.
+// An index that exists with other options, like one that became partial, is dropped and created again
+func EnsureMongoIndexes(ctx context.Context, client *mongo.Client, declarers ...MongoIndexDeclarer) error {
+	log := databaseLogger.WithContext(ctx).With(logger.Function("EnsureMongoIndexes"))
+
+	if client == nil {
+		err := errors.New("could not communicate with database")
+		log.Error("could not create the indexes", logger.Err(err))
+		return err
+	}
+
+	for _, declarer := range declarers {
+		for _, index := range declarer.MongoIndexes() {
+
+			options := mongo.NewIndexOptionsBuilder().Name(index.Name)
+			if index.Unique {
+				options.Unique(true)
+			}
+			if index.Sparse {
+				options.Sparse(true)
+			}
+			if index.PartialFilterExpression != nil {
+				options.PartialFilterExpression(index.PartialFilterExpression)
+			}
+
+			indexes := client.Database(index.Database).Collection(index.Collection).Indexes()
+			model := mongo.IndexModel{Keys: index.Keys, Options: options.Build()}
+
+			_, err := indexes.CreateOne(ctx, model)
+			if commandErr := (command.Error{}); errors.As(err, &commandErr) && indexConflictCodes[commandErr.Code] {
+				log.Warn("index exists with other options, creating it again", logger.String("collection", index.Collection), logger.String("index", index.Name))
+				if _, err = indexes.DropOne(ctx, index.Name); err == nil {
+					_, err = indexes.CreateOne(ctx, model)
+				}
+			}
+
+			if err != nil {
+				log.Error("could not create the index", logger.String("collection", index.Collection), logger.String("index", index.Name), logger.Err(err))
+				return err
+			}
+
+			log.Info("index is ready", logger.String("collection", index.Collection), logger.String("index", index.Name))
+		}
+	}
+
+	return nil
+}
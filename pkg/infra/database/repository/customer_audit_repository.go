@@ -0,0 +1,101 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/mongodb/mongo-go-driver/bson"
+	"github.com/mongodb/mongo-go-driver/bson/objectid"
+	"github.com/mongodb/mongo-go-driver/mongo"
+	"github.com/mongodb/mongo-go-driver/mongo/findopt"
+
+	"github.com/jcsw/go-api-learn/pkg/infra/logger"
+	"github.com/jcsw/go-api-learn/pkg/infra/properties"
+)
+
+const auditCollectionName = "customer_audit"
+
+// CustomerAuditEntity represents a change of a customer, who made it and when, the id and the version
+// of the customer are set by the repository when the change is written
+type CustomerAuditEntity struct {
+	ID         objectid.ObjectID   `bson:"_id"`
+	CustomerID objectid.ObjectID   `bson:"customerId"`
+	Action     string              `bson:"action"`
+	Actor      string              `bson:"actor"`
+	RequestID  string              `bson:"requestId,omitempty"`
+	Timestamp  time.Time           `bson:"timestamp"`
+	Version    int64               `bson:"version"`
+	Changes    []AuditChangeEntity `bson:"changes"`
+}
+
+// AuditChangeEntity the value of a field before and after the change, both encoded as JSON,
+// empty when the field had or has no value
+type AuditChangeEntity struct {
+	Field  string `bson:"field" cql:"field"`
+	Before string `bson:"before,omitempty" cql:"before"`
+	After  string `bson:"after,omitempty" cql:"after"`
+}
+
+// AuditFilter define the page of the audit records of a customer, from the newest to the oldest
+type AuditFilter struct {
+	AfterID objectid.ObjectID
+	Limit   int64
+}
+
+// prepare set the fields of the audit known only when the change is written
+func (audit *CustomerAuditEntity) prepare(customerEntity *CustomerEntity, version int64) {
+	audit.ID = objectid.New()
+	audit.CustomerID = customerEntity.ID
+	audit.Version = version
+}
+
+func (repository *Repository) auditCollection() *mongo.Collection {
+	return repository.MongoClient.Database(databaseName).Collection(auditCollectionName, nil)
+}
+
+// FindCustomerAudit function to find a page of the audit records of the customer, the newest first
+func (repository *Repository) FindCustomerAudit(ctx context.Context, customerID objectid.ObjectID, filter AuditFilter) ([]*CustomerAuditEntity, error) {
+	log := repositoryLogger.WithContext(ctx).With(logger.Function("FindCustomerAudit"), logger.String("id", customerID.Hex()))
+
+	ctx, cancel := properties.AppProperties.Deadlines.WithDeadline(ctx, "FindCustomerAudit")
+	defer cancel()
+
+	if _, err := repository.customerCollection(); err != nil {
+		log.Error("could not find the audit", logger.Err(err))
+		return nil, err
+	}
+
+	query := bson.NewDocument(bson.EC.ObjectID("customerId", customerID))
+	if !filter.AfterID.IsZero() {
+		query.Append(bson.EC.SubDocumentFromElements("_id", bson.EC.ObjectID("$lt", filter.AfterID)))
+	}
+
+	cur, err := repository.auditCollection().Find(ctx, query,
+		findopt.Sort(bson.NewDocument(bson.EC.Int32("_id", -1))),
+		findopt.Limit(filter.Limit))
+	if err != nil {
+		log.Error("could not find the audit", logger.Err(err))
+		return nil, err
+	}
+	defer cur.Close(ctx)
+
+	audits := []*CustomerAuditEntity{}
+	for cur.Next(ctx) {
+
+		audit := CustomerAuditEntity{}
+		if err := cur.Decode(&audit); err != nil {
+			log.Error("could not decode the audit", logger.Err(err))
+			return nil, err
+		}
+
+		audits = append(audits, &audit)
+	}
+
+	if err := cur.Err(); err != nil {
+		log.Error("could not find the audit", logger.Err(err))
+		return nil, err
+	}
+
+	log.Info("audit found", logger.Int("length", len(audits)))
+	return audits, nil
+}
@@ -0,0 +1,146 @@
+package repository
+
+import (
+	"context"
+	"errors"
+
+	"github.com/mongodb/mongo-go-driver/bson/objectid"
+	"github.com/mongodb/mongo-go-driver/mongo"
+	"github.com/mongodb/mongo-go-driver/mongo/insertopt"
+
+	"github.com/jcsw/go-api-learn/pkg/infra/logger"
+	"github.com/jcsw/go-api-learn/pkg/infra/properties"
+)
+
+// InsertCustomers function to persist the customers with the changes of their creation in one batch, the ids are
+// assigned when they have none. Return the error of each customer, nil when it was inserted and ErrDuplicateCustomer
+// when it violates an unique index, or an error when the batch could not be written at all.
+// The batch is a transaction that writes nothing when a customer fails, so the batch is written again without it
+func (repository *Repository) InsertCustomers(ctx context.Context, newCustomerEntities []*CustomerEntity, changes []*CustomerChange) ([]error, error) {
+	log := repositoryLogger.WithContext(ctx).With(logger.Function("InsertCustomers"), logger.Int("length", len(newCustomerEntities)))
+
+	ctx, cancel := properties.AppProperties.Deadlines.WithDeadline(ctx, "InsertCustomers")
+	defer cancel()
+
+	collection, err := repository.customerCollection()
+	if err != nil {
+		log.Error("could not insert the customers", logger.Err(err))
+		return nil, err
+	}
+
+	pending := make([]int, len(newCustomerEntities), len(newCustomerEntities))
+	for i, newCustomerEntity := range newCustomerEntities {
+		if newCustomerEntity.ID.IsZero() {
+			newCustomerEntity.ID = objectid.New()
+		}
+		newCustomerEntity.Version = 1
+		changes[i].prepare(newCustomerEntity, newCustomerEntity.Version)
+		pending[i] = i
+	}
+
+	rowErrors := make([]error, len(newCustomerEntities), len(newCustomerEntities))
+	failures := 0
+	for len(pending) > 0 {
+
+		failed, err := repository.insertBatch(ctx, collection, newCustomerEntities, changes, pending)
+		if err != nil {
+			log.Error("could not insert the customers", logger.Err(err))
+			return nil, err
+		}
+
+		for index, rowErr := range failed {
+			rowErrors[index] = rowErr
+			failures++
+		}
+
+		if len(failed) == 0 {
+			break
+		}
+
+		remaining := []int{}
+		for _, index := range pending {
+			if failed[index] == nil {
+				remaining = append(remaining, index)
+			}
+		}
+		pending = remaining
+	}
+
+	log.Info("customers inserted", logger.Int("inserted", len(newCustomerEntities)-failures), logger.Int("failed", failures))
+	return rowErrors, nil
+}
+
+// insertBatch insert the pending customers and record the changes of the inserted ones, return the error of each
+// customer that was not inserted by its index. It's a transaction, nothing is written when a customer fails
+func (repository *Repository) insertBatch(ctx context.Context, collection *mongo.Collection, newCustomerEntities []*CustomerEntity, changes []*CustomerChange, pending []int) (map[int]error, error) {
+	log := repositoryLogger.WithContext(ctx).With(logger.Function("insertBatch"))
+
+	session, err := repository.MongoClient.StartSession()
+	if err != nil {
+		log.Error("could not start the session", logger.Err(err))
+		return nil, err
+	}
+	defer session.EndSession(ctx)
+
+	if err := session.StartTransaction(); err != nil {
+		log.Error("could not start the transaction", logger.Err(err))
+		return nil, err
+	}
+
+	documents := make([]interface{}, len(pending), len(pending))
+	for i, index := range pending {
+		documents[i] = newCustomerEntities[index]
+	}
+
+	_, err = collection.InsertMany(ctx, documents, append(insertManySession(session), insertopt.Ordered(false))...)
+	failed, err := bulkRowErrors(err, pending)
+	if err != nil || len(failed) > 0 {
+		session.AbortTransaction(ctx)
+		return failed, err
+	}
+
+	insertedChanges := []*CustomerChange{}
+	for _, index := range pending {
+		if failed[index] == nil {
+			insertedChanges = append(insertedChanges, changes[index])
+		}
+	}
+
+	if err := repository.recordChanges(ctx, insertedChanges, session); err != nil {
+		session.AbortTransaction(ctx)
+		log.Error("could not record the changes", logger.Err(err))
+		return nil, err
+	}
+
+	if err := session.CommitTransaction(ctx); err != nil {
+		log.Error("could not commit the transaction", logger.Err(err))
+		return nil, err
+	}
+
+	return failed, nil
+}
+
+// bulkRowErrors map the write errors of an unordered insert to the index of the customers,
+// an error that is not about a single customer fails the whole batch
+func bulkRowErrors(err error, pending []int) (map[int]error, error) {
+
+	failed := map[int]error{}
+	if err == nil {
+		return failed, nil
+	}
+
+	var bulkErr mongo.BulkWriteError
+	if !errors.As(err, &bulkErr) || bulkErr.WriteConcernError != nil || len(bulkErr.WriteErrors) == 0 {
+		return nil, err
+	}
+
+	for _, writeErr := range bulkErr.WriteErrors {
+		if duplicateKeyCodes[writeErr.Code] {
+			failed[pending[writeErr.Index]] = ErrDuplicateCustomer
+			continue
+		}
+		failed[pending[writeErr.Index]] = writeErr
+	}
+
+	return failed, nil
+}
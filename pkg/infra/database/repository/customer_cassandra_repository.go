@@ -0,0 +1,942 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/gocql/gocql"
+	"github.com/mongodb/mongo-go-driver/bson/objectid"
+
+	"github.com/jcsw/go-api-learn/pkg/infra/logger"
+	"github.com/jcsw/go-api-learn/pkg/infra/properties"
+)
+
+// customerCassandraSchema the tables used by CassandraRepository, customer_by_name is a denormalized copy to find customers by name,
+// customer_name holds the name of each customer not deleted to keep it unique and customer_audit keeps the changes of each customer,
+// the newest first. The outbox is a single partition, it only holds
+// the events not published yet, each one leased to the relay that claimed it
+var customerCassandraSchema = []string{
+	`CREATE TYPE IF NOT EXISTS address (type text, street text, number text, complement text, district text,
+		city text, state text, postal_code text, country text)`,
+	`CREATE TABLE IF NOT EXISTS customer (id text PRIMARY KEY, name text, city text, email text, phone text, document text,
+		addresses list<frozen<address>>, status text, created_at timestamp, updated_at timestamp, version bigint, deleted_at timestamp)`,
+	`CREATE INDEX IF NOT EXISTS customer_city_idx ON customer (city)`,
+	`CREATE TABLE IF NOT EXISTS customer_by_name (name text, id text, city text, email text, phone text, document text,
+		addresses list<frozen<address>>, status text, created_at timestamp, updated_at timestamp, version bigint, deleted_at timestamp,
+		PRIMARY KEY (name, id))`,
+	`CREATE TABLE IF NOT EXISTS customer_name (name text PRIMARY KEY, id text)`,
+	`CREATE TYPE IF NOT EXISTS audit_change (field text, before text, after text)`,
+	`CREATE TABLE IF NOT EXISTS customer_audit (customer_id text, id text, action text, actor text, request_id text,
+		changed_at timestamp, version bigint, changes list<frozen<audit_change>>, PRIMARY KEY (customer_id, id))
+		WITH CLUSTERING ORDER BY (id DESC)`,
+	`CREATE TABLE IF NOT EXISTS customer_outbox (bucket int, id text, type text, customer_id text, version bigint,
+		occurred_at timestamp, payload text, attempts bigint, next_attempt_at timestamp, last_error text, dead_at timestamp,
+		owner_id text, lease_until timestamp, PRIMARY KEY (bucket, id))`,
+	`CREATE TABLE IF NOT EXISTS customer_outbox_dead_letter (bucket int, id text, type text, customer_id text, version bigint,
+		occurred_at timestamp, payload text, attempts bigint, next_attempt_at timestamp, last_error text, dead_at timestamp,
+		PRIMARY KEY (bucket, id))`,
+}
+
+// outboxBucket the partition of the outbox
+const outboxBucket = 0
+
+// outboxClaimCandidates the due events read by ClaimPendingEvent, it tries to claim them in turn
+const outboxClaimCandidates = 10
+
+// outboxColumns the columns of an event, in the order of outboxRow.dest
+const outboxColumns = `id, type, customer_id, version, occurred_at, payload, attempts, next_attempt_at, last_error, dead_at`
+
+// auditColumns the columns read by FindCustomerAudit, in the order of auditRow.dest
+const auditColumns = `customer_id, id, action, actor, request_id, changed_at, version, changes`
+
+// customerColumns the columns read by scanCustomer and scanCustomers, in the order of customerRow.dest
+const customerColumns = `id, name, city, email, phone, document, addresses, status, created_at, updated_at, version, deleted_at`
+
+// ErrUnsupportedSort Error for a sort the repository can not apply
+var ErrUnsupportedSort = errors.New("sort is not supported by the cassandra repository")
+
+// CassandraRepository define the data repository on cassandra
+type CassandraRepository struct {
+	Session *gocql.Session
+}
+
+func (repository *CassandraRepository) session() (*gocql.Session, error) {
+	if repository.Session == nil {
+		return nil, errors.New("could not communicate with database")
+	}
+	return repository.Session, nil
+}
+
+// CreateSchema function to create the customer tables when they not exist
+func (repository *CassandraRepository) CreateSchema(ctx context.Context) error {
+	log := repositoryLogger.WithContext(ctx).With(logger.Function("CreateSchema"))
+
+	session, err := repository.session()
+	if err != nil {
+		log.Error("could not create the schema", logger.Err(err))
+		return err
+	}
+
+	for _, statement := range customerCassandraSchema {
+		if err := session.Query(statement).WithContext(ctx).Exec(); err != nil {
+			log.Error("could not create the schema", logger.String("statement", statement), logger.Err(err))
+			return err
+		}
+	}
+
+	log.Info("cassandra customer schema is ready")
+	return nil
+}
+
+// InsertCustomer function to persist customer with the change of its creation, both in the same logged batch.
+// The name is held first by a lightweight transaction, return ErrDuplicateCustomer when another customer holds it.
+// The name is released when the batch fails, unless the batch was logged and will still be written.
+// The id is assigned when it has none
+func (repository *CassandraRepository) InsertCustomer(ctx context.Context, newCustomerEntity *CustomerEntity, change *CustomerChange) error {
+	log := repositoryLogger.WithContext(ctx).With(logger.Function("InsertCustomer"), logger.String("name", newCustomerEntity.Name))
+
+	ctx, cancel := properties.AppProperties.Deadlines.WithDeadline(ctx, "InsertCustomer")
+	defer cancel()
+
+	session, err := repository.session()
+	if err != nil {
+		log.Error("could not insert the customer", logger.Err(err))
+		return err
+	}
+
+	if newCustomerEntity.ID.IsZero() {
+		newCustomerEntity.ID = objectid.New()
+	}
+	newCustomerEntity.Version = 1
+	change.prepare(newCustomerEntity, newCustomerEntity.Version)
+
+	if err := claimCustomerName(ctx, session, newCustomerEntity.Name, newCustomerEntity.ID.Hex()); err != nil {
+		if err == ErrDuplicateCustomer {
+			log.Warn("could not insert the customer, its name is in use", logger.Err(err))
+			return err
+		}
+		log.Error("could not insert the customer", logger.Err(err))
+		return err
+	}
+
+	batch := session.NewBatch(gocql.LoggedBatch).WithContext(ctx)
+	addInsertCustomer(batch, newCustomerEntity)
+	addInsertChange(batch, change)
+	if err := session.ExecuteBatch(batch); err != nil {
+		log.Error("could not insert the customer", logger.Err(err))
+		if !isLoggedBatchTimeout(err) {
+			if err := releaseCustomerName(ctx, session, newCustomerEntity.Name, newCustomerEntity.ID.Hex()); err != nil {
+				log.Error("could not release the name of the customer not inserted", logger.Err(err))
+			}
+		}
+		return err
+	}
+
+	log.Info("customer inserted", logger.String("id", newCustomerEntity.ID.Hex()))
+	return nil
+}
+
+// InsertCustomers function to persist the customers with the changes of their creation, each customer in its own
+// logged batch because a batch spanning many partitions would overload the coordinator.
+// Return the error of each customer, nil when it was inserted and ErrDuplicateCustomer when its name is in use
+func (repository *CassandraRepository) InsertCustomers(ctx context.Context, newCustomerEntities []*CustomerEntity, changes []*CustomerChange) ([]error, error) {
+
+	if _, err := repository.session(); err != nil {
+		repositoryLogger.WithContext(ctx).Error("could not insert the customers", logger.Function("InsertCustomers"), logger.Err(err))
+		return nil, err
+	}
+
+	rowErrors := make([]error, len(newCustomerEntities), len(newCustomerEntities))
+	for i, newCustomerEntity := range newCustomerEntities {
+		rowErrors[i] = repository.InsertCustomer(ctx, newCustomerEntity, changes[i])
+	}
+
+	return rowErrors, nil
+}
+
+// FindAllCustomers function to find all customers that are not deleted
+func (repository *CassandraRepository) FindAllCustomers(ctx context.Context) ([]*CustomerEntity, error) {
+	log := repositoryLogger.WithContext(ctx).With(logger.Function("FindAllCustomers"))
+
+	ctx, cancel := properties.AppProperties.Deadlines.WithDeadline(ctx, "FindAllCustomers")
+	defer cancel()
+
+	session, err := repository.session()
+	if err != nil {
+		log.Error("could not find the customers", logger.Err(err))
+		return nil, err
+	}
+
+	customers, err := scanCustomers(session.Query(`SELECT `+customerColumns+` FROM customer`).WithContext(ctx).Iter(), 0)
+	if err != nil {
+		log.Error("could not find the customers", logger.Err(err))
+		return nil, err
+	}
+
+	log.Info("customers found", logger.Int("length", len(customers)))
+	return customers, nil
+}
+
+// FindCustomers function to find a page of customers matching the filter, only the ascending sort by id is supported
+// and the customers are returned in token order of their ids. The deleted customers are skipped while reading,
+// so the query is paged instead of limited
+func (repository *CassandraRepository) FindCustomers(ctx context.Context, filter CustomerFilter) ([]*CustomerEntity, error) {
+	log := repositoryLogger.WithContext(ctx).With(logger.Function("FindCustomers"), logger.Any("filter", filter))
+
+	ctx, cancel := properties.AppProperties.Deadlines.WithDeadline(ctx, "FindCustomers")
+	defer cancel()
+
+	session, err := repository.session()
+	if err != nil {
+		log.Error("could not find the customers", logger.Err(err))
+		return nil, err
+	}
+
+	statement, values, err := makeCustomerStatement(filter)
+	if err != nil {
+		log.Warn("could not find the customers", logger.Err(err))
+		return nil, err
+	}
+
+	customers, err := scanCustomers(session.Query(statement, values...).PageSize(int(filter.Limit)).WithContext(ctx).Iter(), int(filter.Limit))
+	if err != nil {
+		log.Error("could not find the customers", logger.Err(err))
+		return nil, err
+	}
+
+	log.Info("customers found", logger.Int("length", len(customers)))
+	return customers, nil
+}
+
+// StreamCustomers function to call each for the customers matching the filter as they're read, a page at a time,
+// with the same sort restrictions as FindCustomers. The limit is optional, it stops at the first error returned
+// by each and returns it
+func (repository *CassandraRepository) StreamCustomers(ctx context.Context, filter CustomerFilter, each func(*CustomerEntity) error) error {
+	log := repositoryLogger.WithContext(ctx).With(logger.Function("StreamCustomers"), logger.Any("filter", filter))
+
+	ctx, cancel := properties.AppProperties.Deadlines.WithDeadline(ctx, "StreamCustomers")
+	defer cancel()
+
+	session, err := repository.session()
+	if err != nil {
+		log.Error("could not stream the customers", logger.Err(err))
+		return err
+	}
+
+	statement, values, err := makeCustomerStatement(filter)
+	if err != nil {
+		log.Warn("could not stream the customers", logger.Err(err))
+		return err
+	}
+
+	iter := session.Query(statement, values...).PageSize(streamBatchSize).WithContext(ctx).Iter()
+
+	streamed := 0
+	for filter.Limit <= 0 || int64(streamed) < filter.Limit {
+		row := customerRow{}
+		if !iter.Scan(row.dest()...) {
+			break
+		}
+
+		customer, err := row.toEntity()
+		if err != nil {
+			iter.Close()
+			log.Error("could not stream the customers", logger.Err(err))
+			return err
+		}
+
+		if customer.IsDeleted() {
+			continue
+		}
+
+		if err := each(customer); err != nil {
+			iter.Close()
+			log.Warn("customers stream stopped", logger.Int("length", streamed), logger.Err(err))
+			return err
+		}
+		streamed++
+	}
+
+	if err := iter.Close(); err != nil {
+		log.Error("could not stream the customers", logger.Err(err))
+		return err
+	}
+
+	log.Info("customers streamed", logger.Int("length", streamed))
+	return nil
+}
+
+// makeCustomerStatement make the query of the customers matching the filter, it fails when the sort is not by id ascending
+func makeCustomerStatement(filter CustomerFilter) (string, []interface{}, error) {
+
+	if (filter.SortBy != "" && filter.SortBy != "_id") || filter.Descending {
+		return "", nil, ErrUnsupportedSort
+	}
+
+	statement := `SELECT ` + customerColumns + ` FROM customer`
+	values := []interface{}{}
+	where := " WHERE "
+
+	if !filter.AfterID.IsZero() {
+		statement += where + `token(id) > token(?)`
+		values = append(values, filter.AfterID.Hex())
+		where = " AND "
+	}
+
+	if filter.City != "" {
+		statement += where + `city = ?`
+		values = append(values, filter.City)
+	}
+
+	if filter.City != "" && !filter.AfterID.IsZero() {
+		statement += ` ALLOW FILTERING`
+	}
+
+	return statement, values, nil
+}
+
+// FindCustomerByName function to find customer by name, a deleted customer is not found
+func (repository *CassandraRepository) FindCustomerByName(ctx context.Context, name string) (*CustomerEntity, error) {
+	log := repositoryLogger.WithContext(ctx).With(logger.Function("FindCustomerByName"), logger.String("name", name))
+
+	ctx, cancel := properties.AppProperties.Deadlines.WithDeadline(ctx, "FindCustomerByName")
+	defer cancel()
+
+	session, err := repository.session()
+	if err != nil {
+		log.Error("could not find the customer", logger.Err(err))
+		return nil, err
+	}
+
+	customers, err := scanCustomers(session.Query(`SELECT `+customerColumns+` FROM customer_by_name WHERE name = ?`, name).WithContext(ctx).Iter(), 1)
+	if err != nil {
+		log.Error("could not find the customer", logger.Err(err))
+		return nil, err
+	}
+
+	if len(customers) == 0 {
+		log.Info("customer not found")
+		return nil, nil
+	}
+
+	log.Info("customer found", logger.String("id", customers[0].ID.Hex()))
+	return customers[0], nil
+}
+
+// FindCustomerByID function to find customer by id, even when it's deleted
+func (repository *CassandraRepository) FindCustomerByID(ctx context.Context, id objectid.ObjectID) (*CustomerEntity, error) {
+	log := repositoryLogger.WithContext(ctx).With(logger.Function("FindCustomerByID"), logger.String("id", id.Hex()))
+
+	ctx, cancel := properties.AppProperties.Deadlines.WithDeadline(ctx, "FindCustomerByID")
+	defer cancel()
+
+	session, err := repository.session()
+	if err != nil {
+		log.Error("could not find the customer", logger.Err(err))
+		return nil, err
+	}
+
+	customer, err := scanCustomer(session.Query(`SELECT `+customerColumns+` FROM customer WHERE id = ?`, id.Hex()).WithContext(ctx))
+	if err != nil {
+		log.Error("could not find the customer", logger.Err(err))
+		return nil, err
+	}
+
+	if customer == nil {
+		log.Info("customer not found")
+		return nil, nil
+	}
+
+	log.Info("customer found", logger.String("name", customer.Name))
+	return customer, nil
+}
+
+// UpdateCustomer function to replace the customer with the same id and version, return false when it does not exist or
+// its version changed. The customer row is written by a lightweight transaction conditioned on the version, then the copy
+// in customer_by_name and the change are written in a logged batch. The row of the previous name is only deleted when
+// the name changed, a delete and an insert of the same row in a batch share the timestamp and the delete would win.
+// The name is held before the customer row is written when the customer takes a name it did not hold, by a rename or
+// a restore, return ErrDuplicateCustomer when another customer holds it. The name it held is released with the batch.
+// Once the customer row is written the update is applied, so a failed batch does not fail it, the batch is retried in
+// background until it's written. The batch is written at the time of the update, so a retry does not overwrite the
+// writes of a later update nor bring back an event already published.
+// The version of customerEntity is incremented when it's replaced
+func (repository *CassandraRepository) UpdateCustomer(ctx context.Context, customerEntity *CustomerEntity, change *CustomerChange) (bool, error) {
+	log := repositoryLogger.WithContext(ctx).With(logger.Function("UpdateCustomer"), logger.String("id", customerEntity.ID.Hex()), logger.String("name", customerEntity.Name))
+
+	ctx, cancel := properties.AppProperties.Deadlines.WithDeadline(ctx, "UpdateCustomer")
+	defer cancel()
+
+	session, err := repository.session()
+	if err != nil {
+		log.Error("could not update the customer", logger.Err(err))
+		return false, err
+	}
+
+	currentCustomer, err := repository.FindCustomerByID(ctx, customerEntity.ID)
+	if err != nil || currentCustomer == nil || currentCustomer.Version != customerEntity.Version {
+		return false, err
+	}
+
+	replacement := *customerEntity
+	replacement.Version++
+	updatedAt := time.Now()
+
+	takesName := !replacement.IsDeleted() && (currentCustomer.IsDeleted() || currentCustomer.Name != replacement.Name)
+	leavesName := !currentCustomer.IsDeleted() && (replacement.IsDeleted() || currentCustomer.Name != replacement.Name)
+
+	if takesName {
+		if err := claimCustomerName(ctx, session, replacement.Name, replacement.ID.Hex()); err != nil {
+			if err == ErrDuplicateCustomer {
+				log.Warn("could not update the customer, its name is in use", logger.Err(err))
+				return false, err
+			}
+			log.Error("could not update the customer", logger.Err(err))
+			return false, err
+		}
+	}
+
+	var currentVersion int64
+	applied, err := session.Query(`UPDATE customer SET name = ?, city = ?, email = ?, phone = ?, document = ?, addresses = ?, status = ?,
+		created_at = ?, updated_at = ?, version = ?, deleted_at = ? WHERE id = ? IF version = ?`,
+		replacement.Name, replacement.City, replacement.Email, replacement.Phone, replacement.Document, replacement.Addresses, replacement.Status,
+		replacement.CreatedAt, replacement.UpdatedAt, replacement.Version, nullableTime(replacement.DeletedAt), replacement.ID.Hex(),
+		customerEntity.Version).WithContext(ctx).ScanCAS(&currentVersion)
+	if err != nil {
+		log.Error("could not update the customer", logger.Err(err))
+		return false, err
+	}
+
+	if !applied {
+		log.Info("customer not updated, its version changed", logger.Int64("version", currentVersion))
+		if takesName {
+			if err := releaseCustomerName(ctx, session, replacement.Name, replacement.ID.Hex()); err != nil {
+				log.Error("could not release the name of the customer not updated", logger.Err(err))
+			}
+		}
+		return false, nil
+	}
+
+	change.prepare(customerEntity, replacement.Version)
+	customerEntity.Version = replacement.Version
+
+	previousName := currentCustomer.Name
+	writeCopy := func(ctx context.Context) error {
+		if leavesName {
+			if err := releaseCustomerName(ctx, session, previousName, replacement.ID.Hex()); err != nil {
+				return err
+			}
+		}
+
+		batch := session.NewBatch(gocql.LoggedBatch).WithTimestamp(updatedAt.UnixNano() / int64(time.Microsecond)).WithContext(ctx)
+		if previousName != replacement.Name {
+			batch.Query(`DELETE FROM customer_by_name WHERE name = ? AND id = ?`, previousName, replacement.ID.Hex())
+		}
+		batch.Query(`INSERT INTO customer_by_name (`+customerColumns+`) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`, customerValues(&replacement)...)
+		addInsertChange(batch, change)
+		return session.ExecuteBatch(batch)
+	}
+
+	if err := writeCopy(ctx); err != nil {
+		log.Error("customer updated but could not write its copy by name and its change, retrying in background", logger.Err(err))
+		go retryCustomerCopy(log, writeCopy)
+		return true, nil
+	}
+
+	log.Info("customer updated")
+	return true, nil
+}
+
+// customerCopyRetryInterval the wait between the attempts to write the copy by name and the change of an updated customer
+const customerCopyRetryInterval = 5 * time.Second
+
+// retryCustomerCopy call writeCopy until it succeeds, each attempt with the deadline of UpdateCustomer
+func retryCustomerCopy(log *logger.Logger, writeCopy func(context.Context) error) {
+	for attempt := 2; ; attempt++ {
+		time.Sleep(customerCopyRetryInterval)
+
+		ctx, cancel := properties.AppProperties.Deadlines.WithDeadline(context.Background(), "UpdateCustomer")
+		err := writeCopy(ctx)
+		cancel()
+
+		if err == nil {
+			log.Info("copy by name and change of the updated customer written", logger.Int("attempts", attempt))
+			return
+		}
+
+		log.Warn("could not write the copy by name and the change of the updated customer", logger.Int("attempts", attempt), logger.Err(err))
+	}
+}
+
+// PurgeCustomers function to remove the customers deleted before the time, return how many were removed.
+// The tombstones are found by a full scan, it's meant to run in background
+func (repository *CassandraRepository) PurgeCustomers(ctx context.Context, deletedBefore time.Time) (int64, error) {
+	log := repositoryLogger.WithContext(ctx).With(logger.Function("PurgeCustomers"), logger.Any("deletedBefore", deletedBefore))
+
+	ctx, cancel := properties.AppProperties.Deadlines.WithDeadline(ctx, "PurgeCustomers")
+	defer cancel()
+
+	session, err := repository.session()
+	if err != nil {
+		log.Error("could not purge the customers", logger.Err(err))
+		return 0, err
+	}
+
+	iter := session.Query(`SELECT id, name FROM customer WHERE deleted_at < ? ALLOW FILTERING`, deletedBefore).WithContext(ctx).Iter()
+
+	var id, name string
+	var purged int64
+	for iter.Scan(&id, &name) {
+		batch := session.NewBatch(gocql.LoggedBatch).WithContext(ctx)
+		addDeleteCustomerRows(batch, id, name)
+		if err := session.ExecuteBatch(batch); err != nil {
+			iter.Close()
+			log.Error("could not purge the customers", logger.Int64("purged", purged), logger.Err(err))
+			return purged, err
+		}
+		purged++
+	}
+
+	if err := iter.Close(); err != nil {
+		log.Error("could not purge the customers", logger.Int64("purged", purged), logger.Err(err))
+		return purged, err
+	}
+
+	log.Info("customers purged", logger.Int64("deleted", purged))
+	return purged, nil
+}
+
+// FindCustomerAudit function to find a page of the audit records of the customer, the newest first
+func (repository *CassandraRepository) FindCustomerAudit(ctx context.Context, customerID objectid.ObjectID, filter AuditFilter) ([]*CustomerAuditEntity, error) {
+	log := repositoryLogger.WithContext(ctx).With(logger.Function("FindCustomerAudit"), logger.String("id", customerID.Hex()))
+
+	ctx, cancel := properties.AppProperties.Deadlines.WithDeadline(ctx, "FindCustomerAudit")
+	defer cancel()
+
+	session, err := repository.session()
+	if err != nil {
+		log.Error("could not find the audit", logger.Err(err))
+		return nil, err
+	}
+
+	statement := `SELECT ` + auditColumns + ` FROM customer_audit WHERE customer_id = ?`
+	values := []interface{}{customerID.Hex()}
+
+	if !filter.AfterID.IsZero() {
+		statement += ` AND id < ?`
+		values = append(values, filter.AfterID.Hex())
+	}
+
+	statement += ` LIMIT ?`
+	values = append(values, int(filter.Limit))
+
+	iter := session.Query(statement, values...).WithContext(ctx).Iter()
+
+	audits := []*CustomerAuditEntity{}
+	for {
+		row := auditRow{}
+		if !iter.Scan(row.dest()...) {
+			break
+		}
+
+		audit, err := row.toEntity()
+		if err != nil {
+			iter.Close()
+			log.Error("could not decode the audit", logger.Err(err))
+			return nil, err
+		}
+
+		audits = append(audits, audit)
+	}
+
+	if err := iter.Close(); err != nil {
+		log.Error("could not find the audit", logger.Err(err))
+		return nil, err
+	}
+
+	log.Info("audit found", logger.Int("length", len(audits)))
+	return audits, nil
+}
+
+// ClaimPendingEvent function to claim the oldest event due at the time and not leased, or whose lease expired, and return it,
+// nil when there is none. The due events are filtered in the outbox partition and the lease is set by a lightweight transaction
+// conditioned on the lease read, so an event is only published by one relay. A claimed event is due again when its lease expires
+func (repository *CassandraRepository) ClaimPendingEvent(ctx context.Context, ownerID string, dueAt time.Time, leaseUntil time.Time) (*OutboxEventEntity, error) {
+	log := repositoryLogger.WithContext(ctx).With(logger.Function("ClaimPendingEvent"), logger.String("owner", ownerID))
+
+	ctx, cancel := properties.AppProperties.Deadlines.WithDeadline(ctx, "ClaimPendingEvent")
+	defer cancel()
+
+	session, err := repository.session()
+	if err != nil {
+		log.Error("could not claim an event", logger.Err(err))
+		return nil, err
+	}
+
+	iter := session.Query(`SELECT `+outboxColumns+`, lease_until FROM customer_outbox WHERE bucket = ? AND next_attempt_at <= ? LIMIT ? ALLOW FILTERING`,
+		outboxBucket, dueAt, outboxClaimCandidates).WithContext(ctx).Iter()
+
+	candidates := []*OutboxEventEntity{}
+	for {
+		row := outboxRow{}
+		var leased time.Time
+		if !iter.Scan(append(row.dest(), &leased)...) {
+			break
+		}
+
+		event, err := row.toEntity()
+		if err != nil {
+			iter.Close()
+			log.Error("could not decode the event", logger.Err(err))
+			return nil, err
+		}
+
+		event.LeaseUntil = leased
+		candidates = append(candidates, event)
+	}
+
+	if err := iter.Close(); err != nil {
+		log.Error("could not claim an event", logger.Err(err))
+		return nil, err
+	}
+
+	for _, event := range candidates {
+		var currentLease time.Time
+		applied, err := session.Query(`UPDATE customer_outbox SET owner_id = ?, lease_until = ?, next_attempt_at = ? WHERE bucket = ? AND id = ? IF lease_until = ?`,
+			ownerID, leaseUntil, leaseUntil, outboxBucket, event.ID.Hex(), nullableTime(event.LeaseUntil)).WithContext(ctx).ScanCAS(&currentLease)
+		if err != nil {
+			log.Error("could not claim an event", logger.Err(err))
+			return nil, err
+		}
+
+		if applied {
+			event.OwnerID, event.LeaseUntil, event.NextAttemptAt = ownerID, leaseUntil, leaseUntil
+			log.Debug("event claimed", logger.String("id", event.ID.Hex()))
+			return event, nil
+		}
+	}
+
+	return nil, nil
+}
+
+// FindEarlierEvent function to find the oldest event of the customer of the event with an earlier version still in the
+// outbox, nil when there is none. The events of the customer are filtered in the outbox partition
+func (repository *CassandraRepository) FindEarlierEvent(ctx context.Context, event *OutboxEventEntity) (*OutboxEventEntity, error) {
+	log := repositoryLogger.WithContext(ctx).With(logger.Function("FindEarlierEvent"), logger.String("id", event.ID.Hex()))
+
+	ctx, cancel := properties.AppProperties.Deadlines.WithDeadline(ctx, "FindEarlierEvent")
+	defer cancel()
+
+	session, err := repository.session()
+	if err != nil {
+		log.Error("could not find the earlier event", logger.Err(err))
+		return nil, err
+	}
+
+	iter := session.Query(`SELECT `+outboxColumns+`, lease_until FROM customer_outbox WHERE bucket = ? AND customer_id = ? AND version < ? ALLOW FILTERING`,
+		outboxBucket, event.CustomerID.Hex(), event.Version).WithContext(ctx).Iter()
+
+	var earlier *OutboxEventEntity
+	for {
+		row := outboxRow{}
+		var leased time.Time
+		if !iter.Scan(append(row.dest(), &leased)...) {
+			break
+		}
+
+		if earlier != nil && row.entity.Version >= earlier.Version {
+			continue
+		}
+
+		found, err := row.toEntity()
+		if err != nil {
+			iter.Close()
+			log.Error("could not decode the event", logger.Err(err))
+			return nil, err
+		}
+
+		found.LeaseUntil = leased
+		earlier = found
+	}
+
+	if err := iter.Close(); err != nil {
+		log.Error("could not find the earlier event", logger.Err(err))
+		return nil, err
+	}
+
+	return earlier, nil
+}
+
+// AcknowledgeEvent function to remove the event that was published
+func (repository *CassandraRepository) AcknowledgeEvent(ctx context.Context, id objectid.ObjectID) error {
+	log := repositoryLogger.WithContext(ctx).With(logger.Function("AcknowledgeEvent"), logger.String("id", id.Hex()))
+
+	ctx, cancel := properties.AppProperties.Deadlines.WithDeadline(ctx, "AcknowledgeEvent")
+	defer cancel()
+
+	session, err := repository.session()
+	if err != nil {
+		log.Error("could not acknowledge the event", logger.Err(err))
+		return err
+	}
+
+	if err := session.Query(`DELETE FROM customer_outbox WHERE bucket = ? AND id = ?`, outboxBucket, id.Hex()).WithContext(ctx).Exec(); err != nil {
+		log.Error("could not acknowledge the event", logger.Err(err))
+		return err
+	}
+
+	return nil
+}
+
+// RescheduleEvent function to save the attempts, the last error and the next attempt of the event and release its lease.
+// The event is left as is when it's not leased to the owner of the event anymore
+func (repository *CassandraRepository) RescheduleEvent(ctx context.Context, event *OutboxEventEntity) error {
+	log := repositoryLogger.WithContext(ctx).With(logger.Function("RescheduleEvent"), logger.String("id", event.ID.Hex()))
+
+	ctx, cancel := properties.AppProperties.Deadlines.WithDeadline(ctx, "RescheduleEvent")
+	defer cancel()
+
+	session, err := repository.session()
+	if err != nil {
+		log.Error("could not reschedule the event", logger.Err(err))
+		return err
+	}
+
+	statement := `UPDATE customer_outbox SET attempts = ?, next_attempt_at = ?, last_error = ?, owner_id = null, lease_until = null
+		WHERE bucket = ? AND id = ? IF owner_id = ?`
+	var currentOwner string
+	if _, err := session.Query(statement, event.Attempts, event.NextAttemptAt, event.LastError, outboxBucket, event.ID.Hex(), event.OwnerID).
+		WithContext(ctx).ScanCAS(&currentOwner); err != nil {
+		log.Error("could not reschedule the event", logger.Err(err))
+		return err
+	}
+
+	return nil
+}
+
+// DeadLetterEvent function to move the event that will not be published anymore to the dead letter table, in a logged batch
+func (repository *CassandraRepository) DeadLetterEvent(ctx context.Context, event *OutboxEventEntity) error {
+	log := repositoryLogger.WithContext(ctx).With(logger.Function("DeadLetterEvent"), logger.String("id", event.ID.Hex()))
+
+	ctx, cancel := properties.AppProperties.Deadlines.WithDeadline(ctx, "DeadLetterEvent")
+	defer cancel()
+
+	session, err := repository.session()
+	if err != nil {
+		log.Error("could not dead letter the event", logger.Err(err))
+		return err
+	}
+
+	batch := session.NewBatch(gocql.LoggedBatch).WithContext(ctx)
+	addInsertEvent(batch, "customer_outbox_dead_letter", event)
+	batch.Query(`DELETE FROM customer_outbox WHERE bucket = ? AND id = ?`, outboxBucket, event.ID.Hex())
+	if err := session.ExecuteBatch(batch); err != nil {
+		log.Error("could not dead letter the event", logger.Err(err))
+		return err
+	}
+
+	log.Warn("event dead lettered", logger.String("type", event.Type), logger.Int64("attempts", event.Attempts))
+	return nil
+}
+
+func addInsertChange(batch *gocql.Batch, change *CustomerChange) {
+	audit := change.Audit
+	batch.Query(`INSERT INTO customer_audit (`+auditColumns+`) VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+		audit.CustomerID.Hex(), audit.ID.Hex(), audit.Action, audit.Actor, audit.RequestID, audit.Timestamp, audit.Version, audit.Changes)
+
+	for _, event := range change.Events {
+		addInsertEvent(batch, "customer_outbox", event)
+	}
+}
+
+func addInsertEvent(batch *gocql.Batch, table string, event *OutboxEventEntity) {
+	batch.Query(`INSERT INTO `+table+` (bucket, `+outboxColumns+`) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		outboxBucket, event.ID.Hex(), event.Type, event.CustomerID.Hex(), event.Version, event.OccurredAt, event.Payload,
+		event.Attempts, event.NextAttemptAt, event.LastError, nullableTime(event.DeadAt))
+}
+
+func addInsertCustomer(batch *gocql.Batch, customerEntity *CustomerEntity) {
+	values := customerValues(customerEntity)
+
+	batch.Query(`INSERT INTO customer (`+customerColumns+`) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`, values...)
+	batch.Query(`INSERT INTO customer_by_name (`+customerColumns+`) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`, values...)
+}
+
+// customerValues the values of the customer, in the order of customerColumns
+func customerValues(customerEntity *CustomerEntity) []interface{} {
+	return []interface{}{customerEntity.ID.Hex(), customerEntity.Name, customerEntity.City, customerEntity.Email, customerEntity.Phone,
+		customerEntity.Document, customerEntity.Addresses, customerEntity.Status, customerEntity.CreatedAt, customerEntity.UpdatedAt, customerEntity.Version,
+		nullableTime(customerEntity.DeletedAt)}
+}
+
+// nullableTime return nil for the zero time, gocql writes the zero time as an empty value that is lower than any timestamp
+func nullableTime(t time.Time) interface{} {
+	if t.IsZero() {
+		return nil
+	}
+	return t
+}
+
+// claimCustomerName hold the name for the customer by a lightweight transaction, return ErrDuplicateCustomer when
+// another customer holds it. It's applied again when the customer already holds it
+func claimCustomerName(ctx context.Context, session *gocql.Session, name string, id string) error {
+
+	holder := map[string]interface{}{}
+	applied, err := session.Query(`INSERT INTO customer_name (name, id) VALUES (?, ?) IF NOT EXISTS`, name, id).WithContext(ctx).MapScanCAS(holder)
+	if err != nil {
+		return err
+	}
+
+	if !applied && holder["id"] != id {
+		return ErrDuplicateCustomer
+	}
+
+	return nil
+}
+
+// releaseCustomerName free the name when it's held by the customer, by a lightweight transaction
+func releaseCustomerName(ctx context.Context, session *gocql.Session, name string, id string) error {
+	var holder string
+	_, err := session.Query(`DELETE FROM customer_name WHERE name = ? IF id = ?`, name, id).WithContext(ctx).ScanCAS(&holder)
+	return err
+}
+
+// isLoggedBatchTimeout report whether the error is a timeout after the batch was logged, cassandra still writes it
+func isLoggedBatchTimeout(err error) bool {
+	timeout, ok := err.(*gocql.RequestErrWriteTimeout)
+	return ok && timeout.WriteType == "BATCH"
+}
+
+func addDeleteCustomerRows(batch *gocql.Batch, id string, name string) {
+	batch.Query(`DELETE FROM customer WHERE id = ?`, id)
+	batch.Query(`DELETE FROM customer_by_name WHERE name = ? AND id = ?`, name, id)
+}
+
+// customerRow the columns of a customer as they are scanned from cassandra
+type customerRow struct {
+	id     string
+	entity CustomerEntity
+}
+
+func (row *customerRow) dest() []interface{} {
+	return []interface{}{&row.id, &row.entity.Name, &row.entity.City, &row.entity.Email, &row.entity.Phone,
+		&row.entity.Document, &row.entity.Addresses, &row.entity.Status, &row.entity.CreatedAt, &row.entity.UpdatedAt, &row.entity.Version,
+		&row.entity.DeletedAt}
+}
+
+func (row *customerRow) toEntity() (*CustomerEntity, error) {
+
+	objectID, err := objectid.FromHex(row.id)
+	if err != nil {
+		return nil, err
+	}
+
+	customer := row.entity
+	customer.ID = objectID
+	return &customer, nil
+}
+
+// auditRow the columns of an audit record as they are scanned from cassandra
+type auditRow struct {
+	customerID string
+	id         string
+	entity     CustomerAuditEntity
+}
+
+func (row *auditRow) dest() []interface{} {
+	return []interface{}{&row.customerID, &row.id, &row.entity.Action, &row.entity.Actor, &row.entity.RequestID,
+		&row.entity.Timestamp, &row.entity.Version, &row.entity.Changes}
+}
+
+func (row *auditRow) toEntity() (*CustomerAuditEntity, error) {
+
+	customerID, err := objectid.FromHex(row.customerID)
+	if err != nil {
+		return nil, err
+	}
+
+	id, err := objectid.FromHex(row.id)
+	if err != nil {
+		return nil, err
+	}
+
+	audit := row.entity
+	audit.CustomerID = customerID
+	audit.ID = id
+	return &audit, nil
+}
+
+// outboxRow the columns of an event as they are scanned from cassandra
+type outboxRow struct {
+	id         string
+	customerID string
+	entity     OutboxEventEntity
+}
+
+func (row *outboxRow) dest() []interface{} {
+	return []interface{}{&row.id, &row.entity.Type, &row.customerID, &row.entity.Version, &row.entity.OccurredAt, &row.entity.Payload,
+		&row.entity.Attempts, &row.entity.NextAttemptAt, &row.entity.LastError, &row.entity.DeadAt}
+}
+
+func (row *outboxRow) toEntity() (*OutboxEventEntity, error) {
+
+	id, err := objectid.FromHex(row.id)
+	if err != nil {
+		return nil, err
+	}
+
+	customerID, err := objectid.FromHex(row.customerID)
+	if err != nil {
+		return nil, err
+	}
+
+	event := row.entity
+	event.ID = id
+	event.CustomerID = customerID
+	return &event, nil
+}
+
+func scanCustomer(query *gocql.Query) (*CustomerEntity, error) {
+
+	row := customerRow{}
+	err := query.Scan(row.dest()...)
+	if err == gocql.ErrNotFound {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return row.toEntity()
+}
+
+// scanCustomers read the customers that are not deleted, stopping after limit customers when it's positive
+func scanCustomers(iter *gocql.Iter, limit int) ([]*CustomerEntity, error) {
+
+	customers := []*CustomerEntity{}
+
+	for limit <= 0 || len(customers) < limit {
+		row := customerRow{}
+		if !iter.Scan(row.dest()...) {
+			break
+		}
+
+		customer, err := row.toEntity()
+		if err != nil {
+			iter.Close()
+			return nil, err
+		}
+
+		if !customer.IsDeleted() {
+			customers = append(customers, customer)
+		}
+	}
+
+	if err := iter.Close(); err != nil {
+		return nil, err
+	}
+
+	return customers, nil
+}
@@ -0,0 +1,304 @@
+//go:build integration
+// +build integration
+
+package repository_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/mongodb/mongo-go-driver/bson/objectid"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/jcsw/go-api-learn/pkg/infra/database"
+	"github.com/jcsw/go-api-learn/pkg/infra/database/repository"
+	"github.com/jcsw/go-api-learn/pkg/infra/properties"
+)
+
+func initializeCassandraRepository(t *testing.T) *repository.CassandraRepository {
+
+	properties.AppProperties =
+		properties.Properties{
+			Cassandra: properties.CassandraProperties{
+				Hosts:             []string{"localhost:9042", "localhost:9043"},
+				Keyspace:          "go_api_learn_test",
+				ReplicationFactor: 2,
+				Consistency:       "quorum",
+				Timeout:           2000,
+				NumConns:          1,
+			}}
+
+	database.InitializeCassandraSession()
+
+	customerRepository := &repository.CassandraRepository{Session: database.RetrieveCassandraSession()}
+	if !assert.NoError(t, customerRepository.CreateSchema(context.Background())) {
+		t.FailNow()
+	}
+
+	return customerRepository
+}
+
+// changeOf a change with only the audit of the action
+func changeOf(action string) *repository.CustomerChange {
+	return &repository.CustomerChange{Audit: &repository.CustomerAuditEntity{Action: action}}
+}
+
+func TestShouldInsertAndFindCustomerOnCassandra(t *testing.T) {
+
+	customerRepository := initializeCassandraRepository(t)
+	defer database.CloseCassandraSession()
+
+	customerName := "Amanda-" + time.Now().String()
+	createdAt := time.Now().UTC().Truncate(time.Millisecond)
+	newCustomer := repository.CustomerEntity{
+		Name:      customerName,
+		City:      "São Paulo",
+		Email:     "amanda@example.com",
+		Phone:     "+5511987654321",
+		Document:  "52998224725",
+		Addresses: []repository.AddressEntity{{Type: "home", Street: "Rua Augusta", Number: "100", City: "São Paulo", PostalCode: "01305-000"}},
+		Status:    "active",
+		CreatedAt: createdAt,
+		UpdatedAt: createdAt,
+	}
+
+	if !assert.NoError(t, customerRepository.InsertCustomer(context.Background(), &newCustomer, changeOf("created"))) {
+		return
+	}
+	assert.False(t, newCustomer.ID.IsZero())
+
+	customerByName, err := customerRepository.FindCustomerByName(context.Background(), customerName)
+	assert.NoError(t, err)
+	assert.Equal(t, &newCustomer, customerByName)
+
+	customerByID, err := customerRepository.FindCustomerByID(context.Background(), newCustomer.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, &newCustomer, customerByID)
+
+	customers, err := customerRepository.FindAllCustomers(context.Background())
+	assert.NoError(t, err)
+	assert.Contains(t, customers, &newCustomer)
+}
+
+func TestShouldReturnNilWhenCustomerNotExistsOnCassandra(t *testing.T) {
+
+	customerRepository := initializeCassandraRepository(t)
+	defer database.CloseCassandraSession()
+
+	customerByName, err := customerRepository.FindCustomerByName(context.Background(), "Nobody-"+time.Now().String())
+	assert.NoError(t, err)
+	assert.Nil(t, customerByName)
+
+	customerByID, err := customerRepository.FindCustomerByID(context.Background(), objectid.New())
+	assert.NoError(t, err)
+	assert.Nil(t, customerByID)
+}
+
+func TestShouldUpdateDeleteAndPurgeCustomerOnCassandra(t *testing.T) {
+
+	customerRepository := initializeCassandraRepository(t)
+	defer database.CloseCassandraSession()
+
+	oldName := "Marcos-" + time.Now().String()
+	customer := repository.CustomerEntity{Name: oldName, City: "Recife"}
+	if !assert.NoError(t, customerRepository.InsertCustomer(context.Background(), &customer, changeOf("created"))) {
+		return
+	}
+
+	customer.Name = "Marcos Silva-" + time.Now().String()
+	updated, err := customerRepository.UpdateCustomer(context.Background(), &customer, changeOf("updated"))
+	assert.NoError(t, err)
+	assert.True(t, updated)
+	assert.Equal(t, int64(2), customer.Version)
+
+	outdated := customer
+	outdated.Version = 1
+	updated, err = customerRepository.UpdateCustomer(context.Background(), &outdated, changeOf("updated"))
+	assert.NoError(t, err)
+	assert.False(t, updated)
+
+	audits, err := customerRepository.FindCustomerAudit(context.Background(), customer.ID, repository.AuditFilter{Limit: 10})
+	assert.NoError(t, err)
+	if assert.Len(t, audits, 2) {
+		assert.Equal(t, "updated", audits[0].Action)
+		assert.Equal(t, int64(2), audits[0].Version)
+		assert.Equal(t, "created", audits[1].Action)
+	}
+
+	customerByOldName, err := customerRepository.FindCustomerByName(context.Background(), oldName)
+	assert.NoError(t, err)
+	assert.Nil(t, customerByOldName)
+
+	customerByNewName, err := customerRepository.FindCustomerByName(context.Background(), customer.Name)
+	assert.NoError(t, err)
+	assert.Equal(t, &customer, customerByNewName)
+
+	customer.City = "Olinda"
+	updated, err = customerRepository.UpdateCustomer(context.Background(), &customer, changeOf("updated"))
+	assert.NoError(t, err)
+	assert.True(t, updated)
+
+	customerByNewName, err = customerRepository.FindCustomerByName(context.Background(), customer.Name)
+	assert.NoError(t, err)
+	assert.Equal(t, &customer, customerByNewName)
+
+	customerByID, err := customerRepository.FindCustomerByID(context.Background(), customer.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, &customer, customerByID)
+
+	customer.DeletedAt = time.Now().UTC().Add(-time.Hour).Truncate(time.Millisecond)
+	deleted, err := customerRepository.UpdateCustomer(context.Background(), &customer, changeOf("deleted"))
+	assert.NoError(t, err)
+	assert.True(t, deleted)
+
+	customerByName, err := customerRepository.FindCustomerByName(context.Background(), customer.Name)
+	assert.NoError(t, err)
+	assert.Nil(t, customerByName)
+
+	customerByID, err = customerRepository.FindCustomerByID(context.Background(), customer.ID)
+	assert.NoError(t, err)
+	if assert.NotNil(t, customerByID) {
+		assert.True(t, customerByID.IsDeleted())
+	}
+
+	_, err = customerRepository.PurgeCustomers(context.Background(), time.Now())
+	assert.NoError(t, err)
+
+	customerByID, err = customerRepository.FindCustomerByID(context.Background(), customer.ID)
+	assert.NoError(t, err)
+	assert.Nil(t, customerByID)
+}
+
+func TestShouldKeepCustomerNameUniqueOnCassandra(t *testing.T) {
+
+	customerRepository := initializeCassandraRepository(t)
+	defer database.CloseCassandraSession()
+
+	name := "Helena-" + time.Now().String()
+	customer := repository.CustomerEntity{Name: name, City: "Natal"}
+	if !assert.NoError(t, customerRepository.InsertCustomer(context.Background(), &customer, changeOf("created"))) {
+		return
+	}
+
+	duplicate := repository.CustomerEntity{Name: name, City: "Natal"}
+	assert.Equal(t, repository.ErrDuplicateCustomer, customerRepository.InsertCustomer(context.Background(), &duplicate, changeOf("created")))
+
+	other := repository.CustomerEntity{Name: "Helena Souza-" + time.Now().String(), City: "Natal"}
+	if !assert.NoError(t, customerRepository.InsertCustomer(context.Background(), &other, changeOf("created"))) {
+		return
+	}
+
+	other.Name = name
+	updated, err := customerRepository.UpdateCustomer(context.Background(), &other, changeOf("updated"))
+	assert.Equal(t, repository.ErrDuplicateCustomer, err)
+	assert.False(t, updated)
+
+	customer.DeletedAt = time.Now().UTC().Truncate(time.Millisecond)
+	deleted, err := customerRepository.UpdateCustomer(context.Background(), &customer, changeOf("deleted"))
+	assert.NoError(t, err)
+	assert.True(t, deleted)
+
+	updated, err = customerRepository.UpdateCustomer(context.Background(), &other, changeOf("updated"))
+	assert.NoError(t, err)
+	assert.True(t, updated)
+
+	customer.DeletedAt = time.Time{}
+	restored, err := customerRepository.UpdateCustomer(context.Background(), &customer, changeOf("restored"))
+	assert.Equal(t, repository.ErrDuplicateCustomer, err)
+	assert.False(t, restored)
+}
+
+func TestShouldFindCustomersByCityOnCassandra(t *testing.T) {
+
+	customerRepository := initializeCassandraRepository(t)
+	defer database.CloseCassandraSession()
+
+	city := "Santos-" + time.Now().String()
+	for _, name := range []string{"Lucas", "Jessica", "Leandro"} {
+		if !assert.NoError(t, customerRepository.InsertCustomer(context.Background(), &repository.CustomerEntity{Name: name, City: city}, changeOf("created"))) {
+			return
+		}
+	}
+
+	firstPage, err := customerRepository.FindCustomers(context.Background(), repository.CustomerFilter{City: city, Limit: 2})
+	assert.NoError(t, err)
+	assert.Len(t, firstPage, 2)
+
+	secondPage, err := customerRepository.FindCustomers(context.Background(), repository.CustomerFilter{City: city, Limit: 2, AfterID: firstPage[1].ID})
+	assert.NoError(t, err)
+	assert.Len(t, secondPage, 1)
+
+	_, err = customerRepository.FindCustomers(context.Background(), repository.CustomerFilter{SortBy: "name", Limit: 2})
+	assert.Equal(t, repository.ErrUnsupportedSort, err)
+
+	streamed := []string{}
+	err = customerRepository.StreamCustomers(context.Background(), repository.CustomerFilter{City: city}, func(customer *repository.CustomerEntity) error {
+		streamed = append(streamed, customer.Name)
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, []string{"Lucas", "Jessica", "Leandro"}, streamed)
+}
+
+// claimOutboxEvent claim the due events until the one with the id, return nil when it's not claimed
+func claimOutboxEvent(t *testing.T, customerRepository *repository.CassandraRepository, ownerID string, id objectid.ObjectID) *repository.OutboxEventEntity {
+
+	for {
+		now := time.Now()
+		claimed, err := customerRepository.ClaimPendingEvent(context.Background(), ownerID, now, now.Add(time.Minute))
+		if !assert.NoError(t, err) || claimed == nil {
+			return nil
+		}
+
+		if claimed.ID == id {
+			return claimed
+		}
+	}
+}
+
+func TestShouldRelayOutboxEventsOnCassandra(t *testing.T) {
+
+	customerRepository := initializeCassandraRepository(t)
+	defer database.CloseCassandraSession()
+
+	occurredAt := time.Now().UTC().Add(-time.Minute).Truncate(time.Millisecond)
+	customer := repository.CustomerEntity{ID: objectid.New(), Name: "Jessica-" + time.Now().String(), City: "Santos"}
+	event := repository.OutboxEventEntity{ID: objectid.New(), Type: "CustomerCreated", CustomerID: customer.ID, Version: 1,
+		OccurredAt: occurredAt, Payload: `{"type":"CustomerCreated"}`, NextAttemptAt: occurredAt}
+	later := repository.OutboxEventEntity{ID: objectid.New(), Type: "CustomerUpdated", CustomerID: customer.ID, Version: 2,
+		OccurredAt: occurredAt, Payload: `{"type":"CustomerUpdated"}`, NextAttemptAt: time.Now().UTC().Add(time.Hour)}
+
+	change := changeOf("created")
+	change.Events = []*repository.OutboxEventEntity{&event, &later}
+	if !assert.NoError(t, customerRepository.InsertCustomer(context.Background(), &customer, change)) {
+		return
+	}
+
+	claimed := claimOutboxEvent(t, customerRepository, "relay-1", event.ID)
+	if !assert.NotNil(t, claimed) {
+		return
+	}
+	assert.Equal(t, "relay-1", claimed.OwnerID)
+	assert.Equal(t, event.Payload, claimed.Payload)
+	assert.Nil(t, claimOutboxEvent(t, customerRepository, "relay-2", event.ID))
+
+	earlier, err := customerRepository.FindEarlierEvent(context.Background(), &later)
+	assert.NoError(t, err)
+	if assert.NotNil(t, earlier) {
+		assert.Equal(t, event.ID, earlier.ID)
+	}
+
+	claimed.Attempts = 1
+	claimed.LastError = "broker unavailable"
+	claimed.NextAttemptAt = time.Now().UTC().Add(time.Hour).Truncate(time.Millisecond)
+	assert.NoError(t, customerRepository.RescheduleEvent(context.Background(), claimed))
+	assert.Nil(t, claimOutboxEvent(t, customerRepository, "relay-1", event.ID))
+
+	claimed.DeadAt = time.Now().UTC().Truncate(time.Millisecond)
+	assert.NoError(t, customerRepository.DeadLetterEvent(context.Background(), claimed))
+
+	earlier, err = customerRepository.FindEarlierEvent(context.Background(), &later)
+	assert.NoError(t, err)
+	assert.Nil(t, earlier)
+}
@@ -0,0 +1,89 @@
+package repository
+
+import (
+	"context"
+
+	"github.com/mongodb/mongo-go-driver/mongo"
+
+	"github.com/jcsw/go-api-learn/pkg/infra/logger"
+)
+
+// CustomerChange what is written along with a customer, the audit of the change and the events it emits
+type CustomerChange struct {
+	Audit  *CustomerAuditEntity
+	Events []*OutboxEventEntity
+}
+
+// prepare set the fields of the change known only when the customer is written
+func (change *CustomerChange) prepare(customerEntity *CustomerEntity, version int64) {
+	change.Audit.prepare(customerEntity, version)
+}
+
+// writeWithChange run write and record the change when it writes something, both in the same transaction,
+// so a customer is never written without its audit and its events
+func (repository *Repository) writeWithChange(ctx context.Context, change *CustomerChange, write func(session *mongo.Session) (bool, error)) (bool, error) {
+	log := repositoryLogger.WithContext(ctx).With(logger.Function("writeWithChange"), logger.String("action", change.Audit.Action))
+
+	session, err := repository.MongoClient.StartSession()
+	if err != nil {
+		log.Error("could not start the session", logger.Err(err))
+		return false, err
+	}
+	defer session.EndSession(ctx)
+
+	if err := session.StartTransaction(); err != nil {
+		log.Error("could not start the transaction", logger.Err(err))
+		return false, err
+	}
+
+	written, err := write(session)
+	if err != nil || !written {
+		session.AbortTransaction(ctx)
+		return written, err
+	}
+
+	if err := repository.recordChange(ctx, change, session); err != nil {
+		session.AbortTransaction(ctx)
+		log.Error("could not record the change", logger.Err(err))
+		return false, err
+	}
+
+	if err := session.CommitTransaction(ctx); err != nil {
+		log.Error("could not commit the transaction", logger.Err(err))
+		return false, err
+	}
+
+	return true, nil
+}
+
+// recordChange insert the audit and the events of the change, inside the session when there is one
+func (repository *Repository) recordChange(ctx context.Context, change *CustomerChange, session *mongo.Session) error {
+	return repository.recordChanges(ctx, []*CustomerChange{change}, session)
+}
+
+// recordChanges insert the audits and the events of the changes, inside the session when there is one
+func (repository *Repository) recordChanges(ctx context.Context, changes []*CustomerChange, session *mongo.Session) error {
+
+	audits := []interface{}{}
+	events := []interface{}{}
+	for _, change := range changes {
+		audits = append(audits, change.Audit)
+		for _, event := range change.Events {
+			events = append(events, event)
+		}
+	}
+
+	if len(audits) > 0 {
+		if _, err := repository.auditCollection().InsertMany(ctx, audits, insertManySession(session)...); err != nil {
+			return err
+		}
+	}
+
+	if len(events) > 0 {
+		if _, err := repository.outboxCollection().InsertMany(ctx, events, insertManySession(session)...); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
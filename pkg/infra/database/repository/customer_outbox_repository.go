@@ -0,0 +1,192 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/mongodb/mongo-go-driver/bson"
+	"github.com/mongodb/mongo-go-driver/bson/objectid"
+	"github.com/mongodb/mongo-go-driver/mongo"
+	"github.com/mongodb/mongo-go-driver/mongo/findopt"
+	"github.com/mongodb/mongo-go-driver/mongo/mongoopt"
+
+	"github.com/jcsw/go-api-learn/pkg/infra/logger"
+	"github.com/jcsw/go-api-learn/pkg/infra/properties"
+)
+
+const (
+	outboxCollectionName     = "customer_outbox"
+	deadLetterCollectionName = "customer_outbox_dead_letter"
+)
+
+// OutboxEventEntity represents an event of a customer waiting to be published, the payload is the event encoded as JSON.
+// It's due when NextAttemptAt is reached, Attempts and LastError track the failed publications. A claimed event is
+// leased to the relay of OwnerID until LeaseUntil, no other relay claims it meanwhile
+type OutboxEventEntity struct {
+	ID            objectid.ObjectID `bson:"_id"`
+	Type          string            `bson:"type"`
+	CustomerID    objectid.ObjectID `bson:"customerId"`
+	Version       int64             `bson:"version"`
+	OccurredAt    time.Time         `bson:"occurredAt"`
+	Payload       string            `bson:"payload"`
+	Attempts      int64             `bson:"attempts"`
+	NextAttemptAt time.Time         `bson:"nextAttemptAt"`
+	LastError     string            `bson:"lastError,omitempty"`
+	DeadAt        time.Time         `bson:"deadAt,omitempty"`
+	OwnerID       string            `bson:"ownerId,omitempty"`
+	LeaseUntil    time.Time         `bson:"leaseUntil,omitempty"`
+}
+
+// OutboxRepository define the data repository of the events waiting to be published
+type OutboxRepository interface {
+	ClaimPendingEvent(ctx context.Context, ownerID string, dueAt time.Time, leaseUntil time.Time) (*OutboxEventEntity, error)
+	FindEarlierEvent(ctx context.Context, event *OutboxEventEntity) (*OutboxEventEntity, error)
+	AcknowledgeEvent(ctx context.Context, id objectid.ObjectID) error
+	RescheduleEvent(ctx context.Context, event *OutboxEventEntity) error
+	DeadLetterEvent(ctx context.Context, event *OutboxEventEntity) error
+}
+
+func (repository *Repository) outboxCollection() *mongo.Collection {
+	return repository.MongoClient.Database(databaseName).Collection(outboxCollectionName, nil)
+}
+
+// ClaimPendingEvent function to claim the oldest event due at the time and return it, nil when there is none. The event is
+// leased to the owner until leaseUntil atomically, so it's only published by one relay, and it's due again when the lease expires
+func (repository *Repository) ClaimPendingEvent(ctx context.Context, ownerID string, dueAt time.Time, leaseUntil time.Time) (*OutboxEventEntity, error) {
+	log := repositoryLogger.WithContext(ctx).With(logger.Function("ClaimPendingEvent"), logger.String("owner", ownerID))
+
+	ctx, cancel := properties.AppProperties.Deadlines.WithDeadline(ctx, "ClaimPendingEvent")
+	defer cancel()
+
+	if _, err := repository.customerCollection(); err != nil {
+		log.Error("could not claim an event", logger.Err(err))
+		return nil, err
+	}
+
+	event := OutboxEventEntity{}
+	err := repository.outboxCollection().FindOneAndUpdate(ctx,
+		bson.NewDocument(bson.EC.SubDocumentFromElements("nextAttemptAt", bson.EC.Time("$lte", dueAt))),
+		bson.NewDocument(bson.EC.SubDocumentFromElements("$set",
+			bson.EC.String("ownerId", ownerID), bson.EC.Time("leaseUntil", leaseUntil), bson.EC.Time("nextAttemptAt", leaseUntil))),
+		findopt.Sort(bson.NewDocument(bson.EC.Int32("nextAttemptAt", 1), bson.EC.Int32("_id", 1))),
+		findopt.ReturnDocument(mongoopt.After)).Decode(&event)
+	if err == mongo.ErrNoDocuments {
+		return nil, nil
+	}
+
+	if err != nil {
+		log.Error("could not claim an event", logger.Err(err))
+		return nil, err
+	}
+
+	log.Debug("event claimed", logger.String("id", event.ID.Hex()))
+	return &event, nil
+}
+
+// FindEarlierEvent function to find the oldest event of the customer of the event with an earlier version still in the
+// outbox, nil when there is none
+func (repository *Repository) FindEarlierEvent(ctx context.Context, event *OutboxEventEntity) (*OutboxEventEntity, error) {
+	log := repositoryLogger.WithContext(ctx).With(logger.Function("FindEarlierEvent"), logger.String("id", event.ID.Hex()))
+
+	ctx, cancel := properties.AppProperties.Deadlines.WithDeadline(ctx, "FindEarlierEvent")
+	defer cancel()
+
+	if _, err := repository.customerCollection(); err != nil {
+		log.Error("could not find the earlier event", logger.Err(err))
+		return nil, err
+	}
+
+	earlier := OutboxEventEntity{}
+	err := repository.outboxCollection().FindOne(ctx,
+		bson.NewDocument(
+			bson.EC.ObjectID("customerId", event.CustomerID),
+			bson.EC.SubDocumentFromElements("version", bson.EC.Int64("$lt", event.Version))),
+		findopt.Sort(bson.NewDocument(bson.EC.Int32("version", 1)))).Decode(&earlier)
+	if err == mongo.ErrNoDocuments {
+		return nil, nil
+	}
+
+	if err != nil {
+		log.Error("could not find the earlier event", logger.Err(err))
+		return nil, err
+	}
+
+	return &earlier, nil
+}
+
+// AcknowledgeEvent function to remove the event that was published
+func (repository *Repository) AcknowledgeEvent(ctx context.Context, id objectid.ObjectID) error {
+	log := repositoryLogger.WithContext(ctx).With(logger.Function("AcknowledgeEvent"), logger.String("id", id.Hex()))
+
+	ctx, cancel := properties.AppProperties.Deadlines.WithDeadline(ctx, "AcknowledgeEvent")
+	defer cancel()
+
+	if _, err := repository.customerCollection(); err != nil {
+		log.Error("could not acknowledge the event", logger.Err(err))
+		return err
+	}
+
+	if _, err := repository.outboxCollection().DeleteOne(ctx, bson.NewDocument(bson.EC.ObjectID("_id", id))); err != nil {
+		log.Error("could not acknowledge the event", logger.Err(err))
+		return err
+	}
+
+	return nil
+}
+
+// RescheduleEvent function to save the attempts, the last error and the next attempt of the event and release its lease.
+// The event is left as is when it's not leased to the owner of the event anymore
+func (repository *Repository) RescheduleEvent(ctx context.Context, event *OutboxEventEntity) error {
+	log := repositoryLogger.WithContext(ctx).With(logger.Function("RescheduleEvent"), logger.String("id", event.ID.Hex()))
+
+	ctx, cancel := properties.AppProperties.Deadlines.WithDeadline(ctx, "RescheduleEvent")
+	defer cancel()
+
+	if _, err := repository.customerCollection(); err != nil {
+		log.Error("could not reschedule the event", logger.Err(err))
+		return err
+	}
+
+	update := bson.NewDocument(
+		bson.EC.SubDocumentFromElements("$set",
+			bson.EC.Int64("attempts", event.Attempts),
+			bson.EC.Time("nextAttemptAt", event.NextAttemptAt),
+			bson.EC.String("lastError", event.LastError)),
+		bson.EC.SubDocumentFromElements("$unset", bson.EC.String("ownerId", ""), bson.EC.String("leaseUntil", "")))
+
+	filter := bson.NewDocument(bson.EC.ObjectID("_id", event.ID), bson.EC.String("ownerId", event.OwnerID))
+	if _, err := repository.outboxCollection().UpdateOne(ctx, filter, update); err != nil {
+		log.Error("could not reschedule the event", logger.Err(err))
+		return err
+	}
+
+	return nil
+}
+
+// DeadLetterEvent function to move the event that will not be published anymore to the dead letter collection.
+// The event is copied before it's removed from the outbox, a copy that already exists is not an error so a failed move can be repeated
+func (repository *Repository) DeadLetterEvent(ctx context.Context, event *OutboxEventEntity) error {
+	log := repositoryLogger.WithContext(ctx).With(logger.Function("DeadLetterEvent"), logger.String("id", event.ID.Hex()))
+
+	ctx, cancel := properties.AppProperties.Deadlines.WithDeadline(ctx, "DeadLetterEvent")
+	defer cancel()
+
+	if _, err := repository.customerCollection(); err != nil {
+		log.Error("could not dead letter the event", logger.Err(err))
+		return err
+	}
+
+	deadLetters := repository.MongoClient.Database(databaseName).Collection(deadLetterCollectionName, nil)
+	if _, err := deadLetters.InsertOne(ctx, event); err != nil && !isDuplicateKey(err) {
+		log.Error("could not dead letter the event", logger.Err(err))
+		return err
+	}
+
+	if _, err := repository.outboxCollection().DeleteOne(ctx, bson.NewDocument(bson.EC.ObjectID("_id", event.ID))); err != nil {
+		log.Error("could not dead letter the event", logger.Err(err))
+		return err
+	}
+
+	log.Warn("event dead lettered", logger.String("type", event.Type), logger.Int64("attempts", event.Attempts))
+	return nil
+}
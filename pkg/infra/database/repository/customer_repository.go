@@ -3,12 +3,19 @@ package repository
 import (
 	"context"
 	"errors"
+	"fmt"
+	"time"
 
 	"github.com/mongodb/mongo-go-driver/bson"
 	"github.com/mongodb/mongo-go-driver/bson/objectid"
 	"github.com/mongodb/mongo-go-driver/mongo"
+	"github.com/mongodb/mongo-go-driver/mongo/findopt"
+	"github.com/mongodb/mongo-go-driver/mongo/insertopt"
+	"github.com/mongodb/mongo-go-driver/mongo/replaceopt"
 
+	"github.com/jcsw/go-api-learn/pkg/infra/database"
 	"github.com/jcsw/go-api-learn/pkg/infra/logger"
+	"github.com/jcsw/go-api-learn/pkg/infra/properties"
 )
 
 const (
@@ -18,21 +25,115 @@ const (
 
 // CustomerEntity represents a client on mongodb
 type CustomerEntity struct {
-	ID   objectid.ObjectID `bson:"_id"`
-	Name string            `bson:"name"`
-	City string            `bson:"city"`
+	ID        objectid.ObjectID `bson:"_id"`
+	Name      string            `bson:"name"`
+	City      string            `bson:"city"`
+	Email     string            `bson:"email,omitempty"`
+	Phone     string            `bson:"phone,omitempty"`
+	Document  string            `bson:"document,omitempty"`
+	Addresses []AddressEntity   `bson:"addresses,omitempty"`
+	Status    string            `bson:"status"`
+	CreatedAt time.Time         `bson:"createdAt"`
+	UpdatedAt time.Time         `bson:"updatedAt"`
+	Version   int64             `bson:"version"`
+	DeletedAt time.Time         `bson:"deletedAt,omitempty"`
 }
 
-// Repository define the data repository
+// IsDeleted report whether the customer has a tombstone, it's kept until purged and hidden from the lookups by name and the listings
+func (customerEntity *CustomerEntity) IsDeleted() bool {
+	return !customerEntity.DeletedAt.IsZero()
+}
+
+// AddressEntity represents an address of the client, embedded in the customer document on mongodb
+// and stored as the user defined type address on cassandra
+type AddressEntity struct {
+	Type       string `bson:"type" cql:"type"`
+	Street     string `bson:"street" cql:"street"`
+	Number     string `bson:"number,omitempty" cql:"number"`
+	Complement string `bson:"complement,omitempty" cql:"complement"`
+	District   string `bson:"district,omitempty" cql:"district"`
+	City       string `bson:"city" cql:"city"`
+	State      string `bson:"state,omitempty" cql:"state"`
+	PostalCode string `bson:"postalCode,omitempty" cql:"postal_code"`
+	Country    string `bson:"country,omitempty" cql:"country"`
+}
+
+// CustomerFilter define the filter, the sort and the page used to find customers
+type CustomerFilter struct {
+	City       string
+	SortBy     string
+	Descending bool
+	AfterID    objectid.ObjectID
+	AfterValue string
+	Limit      int64
+}
+
+// String return the filter as text to be logged
+func (filter CustomerFilter) String() string {
+	return fmt.Sprintf("city=%s sortBy=%s descending=%t after=%s limit=%d",
+		filter.City, filter.SortBy, filter.Descending, filter.AfterID.Hex(), filter.Limit)
+}
+
+var repositoryLogger = logger.With(logger.Package("repository"))
+
+// streamBatchSize the customers read from the database at once while streaming
+const streamBatchSize = 500
+
+// ErrDuplicateCustomer Error for a customer that violates an unique index, like the name already in use
+var ErrDuplicateCustomer = errors.New("customer violates an unique index")
+
+// duplicateKeyCodes the mongodb error codes of an unique index violation
+var duplicateKeyCodes = map[int]bool{11000: true, 11001: true, 12582: true}
+
+// Repository define the data repository, it writes the customer and its change in the same transaction,
+// so it requires mongodb running as a replica set
 type Repository struct {
 	MongoClient *mongo.Client
 }
 
-// CustomerRepository define the data customer repository
+// CustomerRepository define the data customer repository, the changes of the customers are written
+// along with them, so it's also the repository of the outbox
 type CustomerRepository interface {
-	InsertCustomer(newCustomerEntity *CustomerEntity) error
-	FindCustomerByName(name string) (*CustomerEntity, error)
-	FindAllCustomers() ([]*CustomerEntity, error)
+	OutboxRepository
+	InsertCustomer(ctx context.Context, newCustomerEntity *CustomerEntity, change *CustomerChange) error
+	InsertCustomers(ctx context.Context, newCustomerEntities []*CustomerEntity, changes []*CustomerChange) ([]error, error)
+	FindCustomerByName(ctx context.Context, name string) (*CustomerEntity, error)
+	FindAllCustomers(ctx context.Context) ([]*CustomerEntity, error)
+	FindCustomers(ctx context.Context, filter CustomerFilter) ([]*CustomerEntity, error)
+	StreamCustomers(ctx context.Context, filter CustomerFilter, each func(*CustomerEntity) error) error
+	FindCustomerByID(ctx context.Context, id objectid.ObjectID) (*CustomerEntity, error)
+	UpdateCustomer(ctx context.Context, customerEntity *CustomerEntity, change *CustomerChange) (bool, error)
+	PurgeCustomers(ctx context.Context, deletedBefore time.Time) (int64, error)
+	FindCustomerAudit(ctx context.Context, customerID objectid.ObjectID, filter AuditFilter) ([]*CustomerAuditEntity, error)
+}
+
+// MongoIndexes the indexes of the customer collection, the name is unique because the customers are found by it.
+// The unique indexes are partial, they only hold the customers without tombstone, so a deleted customer does not
+// block a new one with its name, email or document. The email and the document are optional so only the customers
+// with them are indexed, and the tombstone used by the purge is sparse. The audit is found by customer, the newest
+// first, and the outbox by the time the events are due
+func (repository *Repository) MongoIndexes() []database.MongoIndex {
+	return []database.MongoIndex{
+		{Database: databaseName, Collection: collectionName, Name: "customer_name_unique",
+			Keys: bson.NewDocument(bson.EC.Int32("name", 1)), Unique: true,
+			PartialFilterExpression: bson.NewDocument(notDeletedFilter())},
+		{Database: databaseName, Collection: collectionName, Name: "customer_email_unique",
+			Keys: bson.NewDocument(bson.EC.Int32("email", 1)), Unique: true,
+			PartialFilterExpression: bson.NewDocument(bson.EC.SubDocumentFromElements("email", bson.EC.Boolean("$exists", true)), notDeletedFilter())},
+		{Database: databaseName, Collection: collectionName, Name: "customer_document_unique",
+			Keys: bson.NewDocument(bson.EC.Int32("document", 1)), Unique: true,
+			PartialFilterExpression: bson.NewDocument(bson.EC.SubDocumentFromElements("document", bson.EC.Boolean("$exists", true)), notDeletedFilter())},
+		{Database: databaseName, Collection: collectionName, Name: "customer_city_id",
+			Keys: bson.NewDocument(bson.EC.Int32("city", 1), bson.EC.Int32("_id", 1))},
+		{Database: databaseName, Collection: collectionName, Name: "customer_deleted_at",
+			Keys: bson.NewDocument(bson.EC.Int32("deletedAt", 1)), Sparse: true},
+		{Database: databaseName, Collection: auditCollectionName, Name: "customer_audit_customer_id",
+			Keys: bson.NewDocument(bson.EC.Int32("customerId", 1), bson.EC.Int32("_id", -1))},
+		{Database: databaseName, Collection: outboxCollectionName, Name: "customer_outbox_next_attempt_at",
+			Keys: bson.NewDocument(bson.EC.Int32("nextAttemptAt", 1), bson.EC.Int32("_id", 1))},
+		{Database: databaseName, Collection: outboxCollectionName, Name: "customer_outbox_customer_version",
+			Keys: bson.NewDocument(bson.EC.Int32("customerId", 1), bson.EC.Int32("version", 1))},
+	}
 }
 
 func (repository *Repository) customerCollection() (*mongo.Collection, error) {
@@ -42,74 +143,390 @@ func (repository *Repository) customerCollection() (*mongo.Collection, error) {
 	return repository.MongoClient.Database(databaseName).Collection(collectionName, nil), nil
 }
 
-// InsertCustomer function to persist customer
-func (repository *Repository) InsertCustomer(newCustomerEntity *CustomerEntity) error {
+// InsertCustomer function to persist customer with the change of its creation, the id is assigned when it has none
+func (repository *Repository) InsertCustomer(ctx context.Context, newCustomerEntity *CustomerEntity, change *CustomerChange) error {
+	log := repositoryLogger.WithContext(ctx).With(logger.Function("InsertCustomer"), logger.String("name", newCustomerEntity.Name))
+
+	ctx, cancel := properties.AppProperties.Deadlines.WithDeadline(ctx, "InsertCustomer")
+	defer cancel()
 
 	collection, err := repository.customerCollection()
 	if err != nil {
-		logger.Error("p=repository f=InsertCustomer newCustomerEntity=%+v \n%v", newCustomerEntity, err)
+		log.Error("could not insert the customer", logger.Err(err))
 		return err
 	}
 
-	newCustomerEntity.ID = objectid.New()
-	if _, err := collection.InsertOne(nil, newCustomerEntity); err != nil {
-		logger.Error("p=repository f=InsertCustomer newCustomerEntity=%+v \n%v", newCustomerEntity, err)
+	if newCustomerEntity.ID.IsZero() {
+		newCustomerEntity.ID = objectid.New()
+	}
+	newCustomerEntity.Version = 1
+	change.prepare(newCustomerEntity, newCustomerEntity.Version)
+
+	_, err = repository.writeWithChange(ctx, change, func(session *mongo.Session) (bool, error) {
+		_, err := collection.InsertOne(ctx, newCustomerEntity, insertSession(session)...)
+		return err == nil, err
+	})
+	if err != nil {
+		if isDuplicateKey(err) {
+			log.Warn("could not insert the customer", logger.Err(err))
+			return ErrDuplicateCustomer
+		}
+
+		log.Error("could not insert the customer", logger.Err(err))
 		return err
 	}
 
-	logger.Info("p=repository f=InsertCustomer newCustomerEntity=%+v", newCustomerEntity)
+	log.Info("customer inserted", logger.String("id", newCustomerEntity.ID.Hex()))
 	return nil
 }
 
-// FindAllCustomers function to find all customers
-func (repository *Repository) FindAllCustomers() ([]*CustomerEntity, error) {
+// FindAllCustomers function to find all customers that are not deleted
+func (repository *Repository) FindAllCustomers(ctx context.Context) ([]*CustomerEntity, error) {
+	log := repositoryLogger.WithContext(ctx).With(logger.Function("FindAllCustomers"))
+
+	ctx, cancel := properties.AppProperties.Deadlines.WithDeadline(ctx, "FindAllCustomers")
+	defer cancel()
 
 	collection, err := repository.customerCollection()
 	if err != nil {
-		logger.Error("p=repository f=FindAllCustomers \n%v", err)
+		log.Error("could not find the customers", logger.Err(err))
 		return nil, err
 	}
 
-	cur, err := collection.Find(nil, nil)
+	cur, err := collection.Find(ctx, bson.NewDocument(notDeletedFilter()))
 	if err != nil {
-		logger.Error("p=repository f=FindAllCustomers \n%v", err)
+		log.Error("could not find the customers", logger.Err(err))
 		return nil, err
 	}
-	defer cur.Close(context.Background())
+	defer cur.Close(ctx)
 
 	customers := []*CustomerEntity{}
-	for cur.Next(context.Background()) {
+	for cur.Next(ctx) {
 
 		customer := CustomerEntity{}
 		err := cur.Decode(&customer)
 		if err != nil {
-			logger.Error("p=repository f=FindAllCustomers \n%v", err)
+			log.Error("could not decode the customer", logger.Err(err))
 		}
 
 		customers = append(customers, &customer)
 	}
 
-	logger.Info("p=repository f=FindAllCustomers length=%d", len(customers))
+	log.Info("customers found", logger.Int("length", len(customers)))
 	return customers, nil
 }
 
-// FindCustomerByName function to find customer by name
-func (repository *Repository) FindCustomerByName(name string) (*CustomerEntity, error) {
+// FindCustomers function to find a page of customers matching the filter, the deleted customers are skipped
+func (repository *Repository) FindCustomers(ctx context.Context, filter CustomerFilter) ([]*CustomerEntity, error) {
+	log := repositoryLogger.WithContext(ctx).With(logger.Function("FindCustomers"), logger.Any("filter", filter))
+
+	ctx, cancel := properties.AppProperties.Deadlines.WithDeadline(ctx, "FindCustomers")
+	defer cancel()
+
+	collection, err := repository.customerCollection()
+	if err != nil {
+		log.Error("could not find the customers", logger.Err(err))
+		return nil, err
+	}
+
+	cur, err := collection.Find(ctx, makeCustomerQuery(filter),
+		findopt.Sort(makeCustomerSort(filter)),
+		findopt.Limit(filter.Limit))
+	if err != nil {
+		log.Error("could not find the customers", logger.Err(err))
+		return nil, err
+	}
+	defer cur.Close(ctx)
+
+	customers := []*CustomerEntity{}
+	for cur.Next(ctx) {
+
+		customer := CustomerEntity{}
+		if err := cur.Decode(&customer); err != nil {
+			log.Error("could not decode the customer", logger.Err(err))
+			return nil, err
+		}
+
+		customers = append(customers, &customer)
+	}
+
+	if err := cur.Err(); err != nil {
+		log.Error("could not find the customers", logger.Err(err))
+		return nil, err
+	}
+
+	log.Info("customers found", logger.Int("length", len(customers)))
+	return customers, nil
+}
+
+// StreamCustomers function to call each for the customers matching the filter as they're read from the cursor,
+// without holding them all in memory. The limit is optional and the deleted customers are skipped,
+// it stops at the first error returned by each and returns it
+func (repository *Repository) StreamCustomers(ctx context.Context, filter CustomerFilter, each func(*CustomerEntity) error) error {
+	log := repositoryLogger.WithContext(ctx).With(logger.Function("StreamCustomers"), logger.Any("filter", filter))
+
+	ctx, cancel := properties.AppProperties.Deadlines.WithDeadline(ctx, "StreamCustomers")
+	defer cancel()
+
+	collection, err := repository.customerCollection()
+	if err != nil {
+		log.Error("could not stream the customers", logger.Err(err))
+		return err
+	}
+
+	opts := []findopt.Find{findopt.Sort(makeCustomerSort(filter)), findopt.BatchSize(streamBatchSize)}
+	if filter.Limit > 0 {
+		opts = append(opts, findopt.Limit(filter.Limit))
+	}
+
+	cur, err := collection.Find(ctx, makeCustomerQuery(filter), opts...)
+	if err != nil {
+		log.Error("could not stream the customers", logger.Err(err))
+		return err
+	}
+	defer cur.Close(ctx)
+
+	streamed := 0
+	for cur.Next(ctx) {
+
+		customer := CustomerEntity{}
+		if err := cur.Decode(&customer); err != nil {
+			log.Error("could not decode the customer", logger.Err(err))
+			return err
+		}
+
+		if err := each(&customer); err != nil {
+			log.Warn("customers stream stopped", logger.Int("length", streamed), logger.Err(err))
+			return err
+		}
+		streamed++
+	}
+
+	if err := cur.Err(); err != nil {
+		log.Error("could not stream the customers", logger.Err(err))
+		return err
+	}
+
+	log.Info("customers streamed", logger.Int("length", streamed))
+	return nil
+}
+
+func makeCustomerQuery(filter CustomerFilter) *bson.Document {
+
+	query := bson.NewDocument(notDeletedFilter())
+	if filter.City != "" {
+		query.Append(bson.EC.String("city", filter.City))
+	}
+
+	if filter.AfterID.IsZero() {
+		return query
+	}
+
+	operator := "$gt"
+	if filter.Descending {
+		operator = "$lt"
+	}
+
+	afterID := bson.EC.SubDocumentFromElements("_id", bson.EC.ObjectID(operator, filter.AfterID))
+	if filter.SortBy == "" || filter.SortBy == "_id" {
+		return query.Append(afterID)
+	}
+
+	return query.Append(bson.EC.ArrayFromElements("$or",
+		bson.VC.DocumentFromElements(bson.EC.SubDocumentFromElements(filter.SortBy, bson.EC.String(operator, filter.AfterValue))),
+		bson.VC.DocumentFromElements(bson.EC.String(filter.SortBy, filter.AfterValue), afterID),
+	))
+}
+
+func makeCustomerSort(filter CustomerFilter) *bson.Document {
+
+	direction := int32(1)
+	if filter.Descending {
+		direction = -1
+	}
+
+	sort := bson.NewDocument()
+	if filter.SortBy != "" && filter.SortBy != "_id" {
+		sort.Append(bson.EC.Int32(filter.SortBy, direction))
+	}
+
+	return sort.Append(bson.EC.Int32("_id", direction))
+}
+
+// FindCustomerByName function to find customer by name, a deleted customer is not found
+func (repository *Repository) FindCustomerByName(ctx context.Context, name string) (*CustomerEntity, error) {
+	log := repositoryLogger.WithContext(ctx).With(logger.Function("FindCustomerByName"), logger.String("name", name))
+
+	ctx, cancel := properties.AppProperties.Deadlines.WithDeadline(ctx, "FindCustomerByName")
+	defer cancel()
 
 	collection, err := repository.customerCollection()
 	if collection == nil {
-		logger.Error("p=repository f=FindCustomerByName name=%s \n%v", name, err)
+		log.Error("could not find the customer", logger.Err(err))
 		return nil, err
 	}
 
 	customer := CustomerEntity{}
-	filter := bson.NewDocument(bson.EC.String("name", name))
-	err = collection.FindOne(nil, filter, nil).Decode(&customer)
+	filter := bson.NewDocument(bson.EC.String("name", name), notDeletedFilter())
+	err = collection.FindOne(ctx, filter, nil).Decode(&customer)
+	if err == mongo.ErrNoDocuments {
+		log.Info("customer not found")
+		return nil, nil
+	}
+
 	if err != nil {
-		logger.Error("p=repository f=FindCustomerByName name=%s \n%v", name, err)
+		log.Error("could not find the customer", logger.Err(err))
 		return nil, err
 	}
 
-	logger.Info("p=repository f=FindCustomerByName customer=%+v", customer)
+	log.Info("customer found", logger.String("id", customer.ID.Hex()))
 	return &customer, err
 }
+
+// FindCustomerByID function to find customer by id, even when it's deleted
+func (repository *Repository) FindCustomerByID(ctx context.Context, id objectid.ObjectID) (*CustomerEntity, error) {
+	log := repositoryLogger.WithContext(ctx).With(logger.Function("FindCustomerByID"), logger.String("id", id.Hex()))
+
+	ctx, cancel := properties.AppProperties.Deadlines.WithDeadline(ctx, "FindCustomerByID")
+	defer cancel()
+
+	collection, err := repository.customerCollection()
+	if err != nil {
+		log.Error("could not find the customer", logger.Err(err))
+		return nil, err
+	}
+
+	customer := CustomerEntity{}
+	filter := bson.NewDocument(bson.EC.ObjectID("_id", id))
+	err = collection.FindOne(ctx, filter).Decode(&customer)
+	if err == mongo.ErrNoDocuments {
+		log.Info("customer not found")
+		return nil, nil
+	}
+
+	if err != nil {
+		log.Error("could not find the customer", logger.Err(err))
+		return nil, err
+	}
+
+	log.Info("customer found", logger.String("name", customer.Name))
+	return &customer, nil
+}
+
+// UpdateCustomer function to replace the customer with the same id and version, with the change.
+// The version of customerEntity is incremented when it's replaced, return false when it does not exist or its version changed
+func (repository *Repository) UpdateCustomer(ctx context.Context, customerEntity *CustomerEntity, change *CustomerChange) (bool, error) {
+	log := repositoryLogger.WithContext(ctx).With(logger.Function("UpdateCustomer"), logger.String("id", customerEntity.ID.Hex()), logger.String("name", customerEntity.Name))
+
+	ctx, cancel := properties.AppProperties.Deadlines.WithDeadline(ctx, "UpdateCustomer")
+	defer cancel()
+
+	collection, err := repository.customerCollection()
+	if err != nil {
+		log.Error("could not update the customer", logger.Err(err))
+		return false, err
+	}
+
+	replacement := *customerEntity
+	replacement.Version++
+	change.prepare(customerEntity, replacement.Version)
+
+	filter := bson.NewDocument(bson.EC.ObjectID("_id", customerEntity.ID), versionFilter(customerEntity.Version))
+	updated, err := repository.writeWithChange(ctx, change, func(session *mongo.Session) (bool, error) {
+		result, err := collection.ReplaceOne(ctx, filter, &replacement, replaceSession(session)...)
+		return err == nil && result.MatchedCount > 0, err
+	})
+	if err != nil {
+		if isDuplicateKey(err) {
+			log.Warn("could not update the customer", logger.Err(err))
+			return false, ErrDuplicateCustomer
+		}
+
+		log.Error("could not update the customer", logger.Err(err))
+		return false, err
+	}
+
+	if updated {
+		customerEntity.Version = replacement.Version
+	}
+
+	log.Info("customer updated", logger.Bool("updated", updated))
+	return updated, nil
+}
+
+// PurgeCustomers function to remove the customers deleted before the time, return how many were removed
+func (repository *Repository) PurgeCustomers(ctx context.Context, deletedBefore time.Time) (int64, error) {
+	log := repositoryLogger.WithContext(ctx).With(logger.Function("PurgeCustomers"), logger.Any("deletedBefore", deletedBefore))
+
+	ctx, cancel := properties.AppProperties.Deadlines.WithDeadline(ctx, "PurgeCustomers")
+	defer cancel()
+
+	collection, err := repository.customerCollection()
+	if err != nil {
+		log.Error("could not purge the customers", logger.Err(err))
+		return 0, err
+	}
+
+	filter := bson.NewDocument(bson.EC.SubDocumentFromElements("deletedAt", bson.EC.Time("$lt", deletedBefore)))
+	result, err := collection.DeleteMany(ctx, filter)
+	if err != nil {
+		log.Error("could not purge the customers", logger.Err(err))
+		return 0, err
+	}
+
+	log.Info("customers purged", logger.Int64("deleted", result.DeletedCount))
+	return result.DeletedCount, nil
+}
+
+// notDeletedFilter match the customers without tombstone, a missing field matches null
+func notDeletedFilter() *bson.Element {
+	return bson.EC.Null("deletedAt")
+}
+
+// insertSession the options to insert inside the session, none when there is no session
+func insertSession(session *mongo.Session) []insertopt.One {
+	if session == nil {
+		return nil
+	}
+	return []insertopt.One{session}
+}
+
+// insertManySession the options to insert many inside the session, none when there is no session
+func insertManySession(session *mongo.Session) []insertopt.Many {
+	if session == nil {
+		return nil
+	}
+	return []insertopt.Many{session}
+}
+
+// replaceSession the options to replace inside the session, none when there is no session
+func replaceSession(session *mongo.Session) []replaceopt.Replace {
+	if session == nil {
+		return nil
+	}
+	return []replaceopt.Replace{session}
+}
+
+// versionFilter match the version of the customer, the customers stored before the version existed have version 0
+func versionFilter(version int64) *bson.Element {
+	if version == 0 {
+		return bson.EC.SubDocumentFromElements("version", bson.EC.ArrayFromElements("$in", bson.VC.Int64(0), bson.VC.Null()))
+	}
+	return bson.EC.Int64("version", version)
+}
+
+// isDuplicateKey report whether the write failed because it violates an unique index
+func isDuplicateKey(err error) bool {
+
+	var writeErrors mongo.WriteErrors
+	if !errors.As(err, &writeErrors) {
+		return false
+	}
+
+	for _, writeError := range writeErrors {
+		if duplicateKeyCodes[writeError.Code] {
+			return true
+		}
+	}
+	return false
+}
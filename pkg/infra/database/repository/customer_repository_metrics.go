@@ -0,0 +1,136 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/mongodb/mongo-go-driver/bson/objectid"
+
+	"github.com/jcsw/go-api-learn/pkg/infra/metrics"
+)
+
+// InstrumentedRepository a CustomerRepository that records the latency and the errors of every operation
+type InstrumentedRepository struct {
+	Repository CustomerRepository
+	Backend    string
+}
+
+// InsertCustomer function to persist customer with the change of its creation
+func (instrumented *InstrumentedRepository) InsertCustomer(ctx context.Context, newCustomerEntity *CustomerEntity, change *CustomerChange) error {
+	done := metrics.StartDatabaseOperation(instrumented.Backend, "InsertCustomer")
+	err := instrumented.Repository.InsertCustomer(ctx, newCustomerEntity, change)
+	done(err)
+	return err
+}
+
+// InsertCustomers function to persist the customers with the changes of their creation in one batch
+func (instrumented *InstrumentedRepository) InsertCustomers(ctx context.Context, newCustomerEntities []*CustomerEntity, changes []*CustomerChange) ([]error, error) {
+	done := metrics.StartDatabaseOperation(instrumented.Backend, "InsertCustomers")
+	rowErrors, err := instrumented.Repository.InsertCustomers(ctx, newCustomerEntities, changes)
+	done(err)
+	return rowErrors, err
+}
+
+// FindCustomerByName function to find customer by name
+func (instrumented *InstrumentedRepository) FindCustomerByName(ctx context.Context, name string) (*CustomerEntity, error) {
+	done := metrics.StartDatabaseOperation(instrumented.Backend, "FindCustomerByName")
+	customer, err := instrumented.Repository.FindCustomerByName(ctx, name)
+	done(err)
+	return customer, err
+}
+
+// FindAllCustomers function to find all customers
+func (instrumented *InstrumentedRepository) FindAllCustomers(ctx context.Context) ([]*CustomerEntity, error) {
+	done := metrics.StartDatabaseOperation(instrumented.Backend, "FindAllCustomers")
+	customers, err := instrumented.Repository.FindAllCustomers(ctx)
+	done(err)
+	return customers, err
+}
+
+// FindCustomers function to find a page of customers matching the filter
+func (instrumented *InstrumentedRepository) FindCustomers(ctx context.Context, filter CustomerFilter) ([]*CustomerEntity, error) {
+	done := metrics.StartDatabaseOperation(instrumented.Backend, "FindCustomers")
+	customers, err := instrumented.Repository.FindCustomers(ctx, filter)
+	done(err)
+	return customers, err
+}
+
+// StreamCustomers function to call each for the customers matching the filter as they're read
+func (instrumented *InstrumentedRepository) StreamCustomers(ctx context.Context, filter CustomerFilter, each func(*CustomerEntity) error) error {
+	done := metrics.StartDatabaseOperation(instrumented.Backend, "StreamCustomers")
+	err := instrumented.Repository.StreamCustomers(ctx, filter, each)
+	done(err)
+	return err
+}
+
+// FindCustomerByID function to find customer by id
+func (instrumented *InstrumentedRepository) FindCustomerByID(ctx context.Context, id objectid.ObjectID) (*CustomerEntity, error) {
+	done := metrics.StartDatabaseOperation(instrumented.Backend, "FindCustomerByID")
+	customer, err := instrumented.Repository.FindCustomerByID(ctx, id)
+	done(err)
+	return customer, err
+}
+
+// UpdateCustomer function to replace the customer with the same id
+func (instrumented *InstrumentedRepository) UpdateCustomer(ctx context.Context, customerEntity *CustomerEntity, change *CustomerChange) (bool, error) {
+	done := metrics.StartDatabaseOperation(instrumented.Backend, "UpdateCustomer")
+	updated, err := instrumented.Repository.UpdateCustomer(ctx, customerEntity, change)
+	done(err)
+	return updated, err
+}
+
+// PurgeCustomers function to remove the customers deleted before the time
+func (instrumented *InstrumentedRepository) PurgeCustomers(ctx context.Context, deletedBefore time.Time) (int64, error) {
+	done := metrics.StartDatabaseOperation(instrumented.Backend, "PurgeCustomers")
+	purged, err := instrumented.Repository.PurgeCustomers(ctx, deletedBefore)
+	done(err)
+	return purged, err
+}
+
+// FindCustomerAudit function to find a page of the audit records of the customer
+func (instrumented *InstrumentedRepository) FindCustomerAudit(ctx context.Context, customerID objectid.ObjectID, filter AuditFilter) ([]*CustomerAuditEntity, error) {
+	done := metrics.StartDatabaseOperation(instrumented.Backend, "FindCustomerAudit")
+	audits, err := instrumented.Repository.FindCustomerAudit(ctx, customerID, filter)
+	done(err)
+	return audits, err
+}
+
+// ClaimPendingEvent function to claim the oldest event due at the time
+func (instrumented *InstrumentedRepository) ClaimPendingEvent(ctx context.Context, ownerID string, dueAt time.Time, leaseUntil time.Time) (*OutboxEventEntity, error) {
+	done := metrics.StartDatabaseOperation(instrumented.Backend, "ClaimPendingEvent")
+	event, err := instrumented.Repository.ClaimPendingEvent(ctx, ownerID, dueAt, leaseUntil)
+	done(err)
+	return event, err
+}
+
+// FindEarlierEvent function to find the oldest event of the customer of the event with an earlier version
+func (instrumented *InstrumentedRepository) FindEarlierEvent(ctx context.Context, event *OutboxEventEntity) (*OutboxEventEntity, error) {
+	done := metrics.StartDatabaseOperation(instrumented.Backend, "FindEarlierEvent")
+	earlier, err := instrumented.Repository.FindEarlierEvent(ctx, event)
+	done(err)
+	return earlier, err
+}
+
+// AcknowledgeEvent function to remove the event that was published
+func (instrumented *InstrumentedRepository) AcknowledgeEvent(ctx context.Context, id objectid.ObjectID) error {
+	done := metrics.StartDatabaseOperation(instrumented.Backend, "AcknowledgeEvent")
+	err := instrumented.Repository.AcknowledgeEvent(ctx, id)
+	done(err)
+	return err
+}
+
+// RescheduleEvent function to save the next attempt of the event
+func (instrumented *InstrumentedRepository) RescheduleEvent(ctx context.Context, event *OutboxEventEntity) error {
+	done := metrics.StartDatabaseOperation(instrumented.Backend, "RescheduleEvent")
+	err := instrumented.Repository.RescheduleEvent(ctx, event)
+	done(err)
+	return err
+}
+
+// DeadLetterEvent function to move the event to the dead letter store
+func (instrumented *InstrumentedRepository) DeadLetterEvent(ctx context.Context, event *OutboxEventEntity) error {
+	done := metrics.StartDatabaseOperation(instrumented.Backend, "DeadLetterEvent")
+	err := instrumented.Repository.DeadLetterEvent(ctx, event)
+	done(err)
+	return err
+}
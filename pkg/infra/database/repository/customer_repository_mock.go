@@ -1,6 +1,9 @@
 package repository
 
 import (
+	"context"
+	"time"
+
 	"github.com/mongodb/mongo-go-driver/bson/objectid"
 	"github.com/stretchr/testify/mock"
 )
@@ -11,19 +14,47 @@ type CustomerRepositoryMock struct {
 }
 
 // InsertCustomer mock to InsertCustomer
-func (m *CustomerRepositoryMock) InsertCustomer(newCustomerEntity *CustomerEntity) error {
-	args := m.Called(newCustomerEntity)
+func (m *CustomerRepositoryMock) InsertCustomer(ctx context.Context, newCustomerEntity *CustomerEntity, change *CustomerChange) error {
+	args := m.Called(ctx, newCustomerEntity, change)
 
 	if args.Error(0) == nil {
-		newCustomerEntity.ID = objectid.New()
+		if newCustomerEntity.ID.IsZero() {
+			newCustomerEntity.ID = objectid.New()
+		}
+		newCustomerEntity.Version = 1
 	}
 
 	return args.Error(0)
 }
 
+// InsertCustomers mock to InsertCustomers, the customers without an error are given an id
+func (m *CustomerRepositoryMock) InsertCustomers(ctx context.Context, newCustomerEntities []*CustomerEntity, changes []*CustomerChange) ([]error, error) {
+	args := m.Called(ctx, newCustomerEntities, changes)
+
+	if args.Error(1) != nil {
+		return nil, args.Error(1)
+	}
+
+	rowErrors := make([]error, len(newCustomerEntities), len(newCustomerEntities))
+	if args.Get(0) != nil {
+		rowErrors = args.Get(0).([]error)
+	}
+
+	for i, newCustomerEntity := range newCustomerEntities {
+		if rowErrors[i] == nil {
+			if newCustomerEntity.ID.IsZero() {
+				newCustomerEntity.ID = objectid.New()
+			}
+			newCustomerEntity.Version = 1
+		}
+	}
+
+	return rowErrors, nil
+}
+
 // FindCustomerByName mock to FindCustomerByName
-func (m *CustomerRepositoryMock) FindCustomerByName(name string) (*CustomerEntity, error) {
-	args := m.Called(name)
+func (m *CustomerRepositoryMock) FindCustomerByName(ctx context.Context, name string) (*CustomerEntity, error) {
+	args := m.Called(ctx, name)
 
 	if args.Error(1) != nil {
 		return nil, args.Error(1)
@@ -37,8 +68,8 @@ func (m *CustomerRepositoryMock) FindCustomerByName(name string) (*CustomerEntit
 }
 
 //FindAllCustomers mock to FindAllCustomers
-func (m *CustomerRepositoryMock) FindAllCustomers() ([]*CustomerEntity, error) {
-	args := m.Called()
+func (m *CustomerRepositoryMock) FindAllCustomers(ctx context.Context) ([]*CustomerEntity, error) {
+	args := m.Called(ctx)
 
 	if args.Error(1) != nil {
 		return nil, args.Error(1)
@@ -50,3 +81,123 @@ func (m *CustomerRepositoryMock) FindAllCustomers() ([]*CustomerEntity, error) {
 
 	return args.Get(0).([]*CustomerEntity), nil
 }
+
+// FindCustomerByID mock to FindCustomerByID
+func (m *CustomerRepositoryMock) FindCustomerByID(ctx context.Context, id objectid.ObjectID) (*CustomerEntity, error) {
+	args := m.Called(ctx, id)
+
+	if args.Error(1) != nil {
+		return nil, args.Error(1)
+	}
+
+	if args.Get(0) == nil {
+		return nil, nil
+	}
+
+	return args.Get(0).(*CustomerEntity), nil
+}
+
+// UpdateCustomer mock to UpdateCustomer
+func (m *CustomerRepositoryMock) UpdateCustomer(ctx context.Context, customerEntity *CustomerEntity, change *CustomerChange) (bool, error) {
+	args := m.Called(ctx, customerEntity, change)
+
+	if args.Bool(0) {
+		customerEntity.Version++
+	}
+
+	return args.Bool(0), args.Error(1)
+}
+
+// PurgeCustomers mock to PurgeCustomers
+func (m *CustomerRepositoryMock) PurgeCustomers(ctx context.Context, deletedBefore time.Time) (int64, error) {
+	args := m.Called(ctx, deletedBefore)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+// FindCustomers mock to FindCustomers
+func (m *CustomerRepositoryMock) FindCustomers(ctx context.Context, filter CustomerFilter) ([]*CustomerEntity, error) {
+	args := m.Called(ctx, filter)
+
+	if args.Error(1) != nil {
+		return nil, args.Error(1)
+	}
+
+	if args.Get(0) == nil {
+		return nil, nil
+	}
+
+	return args.Get(0).([]*CustomerEntity), nil
+}
+
+// StreamCustomers mock to StreamCustomers, each is called for the customers returned
+func (m *CustomerRepositoryMock) StreamCustomers(ctx context.Context, filter CustomerFilter, each func(*CustomerEntity) error) error {
+	args := m.Called(ctx, filter)
+
+	if args.Get(0) != nil {
+		for _, customerEntity := range args.Get(0).([]*CustomerEntity) {
+			if err := each(customerEntity); err != nil {
+				return err
+			}
+		}
+	}
+
+	return args.Error(1)
+}
+
+// FindCustomerAudit mock to FindCustomerAudit
+func (m *CustomerRepositoryMock) FindCustomerAudit(ctx context.Context, customerID objectid.ObjectID, filter AuditFilter) ([]*CustomerAuditEntity, error) {
+	args := m.Called(ctx, customerID, filter)
+
+	if args.Error(1) != nil {
+		return nil, args.Error(1)
+	}
+
+	if args.Get(0) == nil {
+		return nil, nil
+	}
+
+	return args.Get(0).([]*CustomerAuditEntity), nil
+}
+
+// ClaimPendingEvent mock to ClaimPendingEvent
+func (m *CustomerRepositoryMock) ClaimPendingEvent(ctx context.Context, ownerID string, dueAt time.Time, leaseUntil time.Time) (*OutboxEventEntity, error) {
+	args := m.Called(ctx, ownerID, dueAt, leaseUntil)
+	return eventOrNil(args)
+}
+
+// FindEarlierEvent mock to FindEarlierEvent
+func (m *CustomerRepositoryMock) FindEarlierEvent(ctx context.Context, event *OutboxEventEntity) (*OutboxEventEntity, error) {
+	args := m.Called(ctx, event)
+	return eventOrNil(args)
+}
+
+func eventOrNil(args mock.Arguments) (*OutboxEventEntity, error) {
+
+	if args.Error(1) != nil {
+		return nil, args.Error(1)
+	}
+
+	if args.Get(0) == nil {
+		return nil, nil
+	}
+
+	return args.Get(0).(*OutboxEventEntity), nil
+}
+
+// AcknowledgeEvent mock to AcknowledgeEvent
+func (m *CustomerRepositoryMock) AcknowledgeEvent(ctx context.Context, id objectid.ObjectID) error {
+	args := m.Called(ctx, id)
+	return args.Error(0)
+}
+
+// RescheduleEvent mock to RescheduleEvent
+func (m *CustomerRepositoryMock) RescheduleEvent(ctx context.Context, event *OutboxEventEntity) error {
+	args := m.Called(ctx, event)
+	return args.Error(0)
+}
+
+// DeadLetterEvent mock to DeadLetterEvent
+func (m *CustomerRepositoryMock) DeadLetterEvent(ctx context.Context, event *OutboxEventEntity) error {
+	args := m.Called(ctx, event)
+	return args.Error(0)
+}
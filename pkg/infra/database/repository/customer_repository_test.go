@@ -0,0 +1,103 @@
+package repository
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/mongodb/mongo-go-driver/bson"
+	"github.com/mongodb/mongo-go-driver/mongo"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIsDuplicateKey(t *testing.T) {
+	assert := assert.New(t)
+
+	tests := []struct {
+		description string
+		err         error
+		expected    bool
+	}{
+		{
+			description: "should detect the duplicate key write error",
+			err:         mongo.WriteErrors{{Code: 11000, Message: "E11000 duplicate key error collection: admin.customer index: customer_name_unique"}},
+			expected:    true,
+		},
+		{
+			description: "should detect a wrapped duplicate key write error",
+			err:         fmt.Errorf("on insert: %w", mongo.WriteErrors{{Code: 11001}}),
+			expected:    true,
+		},
+		{
+			description: "should ignore other write errors",
+			err:         mongo.WriteErrors{{Code: 121, Message: "Document failed validation"}},
+			expected:    false,
+		},
+		{
+			description: "should ignore errors that are not write errors",
+			err:         errors.New("connection refused"),
+			expected:    false,
+		},
+	}
+
+	for _, tc := range tests {
+		assert.Equal(tc.expected, isDuplicateKey(tc.err), tc.description)
+	}
+}
+
+func TestVersionFilterShouldMatchDocumentsWithoutVersion(t *testing.T) {
+
+	assert.Equal(t, `{"version":{"$in":[0,null]}}`, bson.NewDocument(versionFilter(0)).ToExtJSON(false))
+	assert.Equal(t, `{"version":3}`, bson.NewDocument(versionFilter(3)).ToExtJSON(false))
+}
+
+func TestShouldDeclareUniqueIndexForName(t *testing.T) {
+
+	indexes := (&Repository{}).MongoIndexes()
+
+	if assert.NotEmpty(t, indexes) {
+		assert.Equal(t, "customer_name_unique", indexes[0].Name)
+		assert.True(t, indexes[0].Unique)
+		assert.Equal(t, collectionName, indexes[0].Collection)
+	}
+}
+
+func TestShouldDeclareTheUniqueIndexesOnlyForTheCustomersWithoutTombstone(t *testing.T) {
+
+	partialFilters := map[string]string{}
+	for _, index := range (&Repository{}).MongoIndexes() {
+		if index.Unique {
+			assert.False(t, index.Sparse, index.Name)
+			partialFilters[index.Name] = index.PartialFilterExpression.ToExtJSON(false)
+		}
+	}
+
+	assert.Equal(t, map[string]string{
+		"customer_name_unique":     `{"deletedAt":null}`,
+		"customer_email_unique":    `{"email":{"$exists":true},"deletedAt":null}`,
+		"customer_document_unique": `{"document":{"$exists":true},"deletedAt":null}`,
+	}, partialFilters)
+}
+
+func TestBulkRowErrorsShouldMapWriteErrorsToTheCustomers(t *testing.T) {
+
+	pending := []int{0, 2, 5}
+
+	failed, err := bulkRowErrors(mongo.BulkWriteError{WriteErrors: mongo.WriteErrors{
+		{Index: 1, Code: 11000, Message: "E11000 duplicate key error"},
+		{Index: 2, Code: 121, Message: "Document failed validation"},
+	}}, pending)
+
+	assert.NoError(t, err)
+	assert.Equal(t, map[int]error{2: ErrDuplicateCustomer, 5: mongo.WriteError{Index: 2, Code: 121, Message: "Document failed validation"}}, failed)
+
+	failed, err = bulkRowErrors(nil, pending)
+	assert.NoError(t, err)
+	assert.Empty(t, failed)
+
+	_, err = bulkRowErrors(errors.New("connection refused"), pending)
+	assert.EqualError(t, err, "connection refused")
+
+	_, err = bulkRowErrors(mongo.BulkWriteError{WriteConcernError: &mongo.WriteConcernError{Code: 64}}, pending)
+	assert.Error(t, err)
+}
@@ -0,0 +1,472 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/mongodb/mongo-go-driver/bson"
+	"github.com/mongodb/mongo-go-driver/bson/objectid"
+	"github.com/mongodb/mongo-go-driver/mongo"
+	"github.com/mongodb/mongo-go-driver/mongo/findopt"
+	"github.com/mongodb/mongo-go-driver/mongo/mongoopt"
+
+	"github.com/jcsw/go-api-learn/pkg/infra/database"
+	"github.com/jcsw/go-api-learn/pkg/infra/logger"
+	"github.com/jcsw/go-api-learn/pkg/infra/properties"
+)
+
+const (
+	jobCollectionName     = "job"
+	jobPartCollectionName = "job_part"
+)
+
+// The states of a job, a job is queued until a worker claims it and running until it's finished
+const (
+	JobQueued    = "queued"
+	JobRunning   = "running"
+	JobSucceeded = "succeeded"
+	JobFailed    = "failed"
+	JobCanceled  = "canceled"
+)
+
+// ErrJobLeaseLost Error for a job that is not running under the owner anymore, its lease expired and it was queued again
+var ErrJobLeaseLost = errors.New("job is not running under this owner anymore")
+
+// JobEntity represents a job run in background by a worker, the payload and the result are encoded as JSON.
+// Attempts counts the times it was claimed and CancelRequested is set when a running job is canceled,
+// the worker running it stops as soon as it sees it. A running job is leased to the pool of OwnerID until
+// LeaseUntil, the owner renews the lease while it runs it. The input too big for a document is stored in
+// its parts, Offset counts the parts done and Counters keeps the JSON counters recorded with them, so a job
+// queued again resumes from the first part not done
+type JobEntity struct {
+	ID              objectid.ObjectID `bson:"_id"`
+	Kind            string            `bson:"kind"`
+	State           string            `bson:"state"`
+	Payload         string            `bson:"payload"`
+	Done            int64             `bson:"done"`
+	Total           int64             `bson:"total"`
+	Result          string            `bson:"result,omitempty"`
+	Error           string            `bson:"error,omitempty"`
+	Attempts        int64             `bson:"attempts"`
+	CancelRequested bool              `bson:"cancelRequested,omitempty"`
+	OwnerID         string            `bson:"ownerId,omitempty"`
+	LeaseUntil      time.Time         `bson:"leaseUntil,omitempty"`
+	Offset          int64             `bson:"offset"`
+	Counters        string            `bson:"counters,omitempty"`
+	CreatedAt       time.Time         `bson:"createdAt"`
+	StartedAt       time.Time         `bson:"startedAt,omitempty"`
+	FinishedAt      time.Time         `bson:"finishedAt,omitempty"`
+}
+
+// JobPartEntity represents a part of the input of a job, stored apart from the job so the input is not limited
+// by the size of a document. Seq is its position in the input, from 0, and Result the JSON result of the part
+// once it's done
+type JobPartEntity struct {
+	ID     objectid.ObjectID `bson:"_id"`
+	JobID  objectid.ObjectID `bson:"jobId"`
+	Seq    int64             `bson:"seq"`
+	Input  string            `bson:"input"`
+	Result string            `bson:"result,omitempty"`
+}
+
+// JobRepository define the data repository of the jobs
+type JobRepository interface {
+	InsertJob(ctx context.Context, job *JobEntity, parts []*JobPartEntity) error
+	FindJobByID(ctx context.Context, id objectid.ObjectID) (*JobEntity, error)
+	FindJobParts(ctx context.Context, jobID objectid.ObjectID, fromSeq int64, limit int64) ([]*JobPartEntity, error)
+	ClaimJob(ctx context.Context, ownerID string, startedAt time.Time, leaseUntil time.Time) (*JobEntity, error)
+	RenewJobLease(ctx context.Context, id objectid.ObjectID, ownerID string, leaseUntil time.Time) (bool, error)
+	UpdateJobProgress(ctx context.Context, job *JobEntity, part *JobPartEntity, leaseUntil time.Time) (bool, error)
+	FinishJob(ctx context.Context, job *JobEntity) error
+	CancelJob(ctx context.Context, id objectid.ObjectID, canceledAt time.Time) (*JobEntity, error)
+	RequeueExpiredJobs(ctx context.Context, maxAttempts int64, now time.Time) (int64, error)
+}
+
+// MongoJobRepository a JobRepository stored in mongodb, whatever the storage backend of the customers
+type MongoJobRepository struct {
+	MongoClient *mongo.Client
+}
+
+// MongoIndexes the indexes of the jobs, the queued ones are claimed the oldest first and the running ones
+// are requeued when their lease expires. The parts of a job are read in the order of the input
+func (repository *MongoJobRepository) MongoIndexes() []database.MongoIndex {
+	return []database.MongoIndex{
+		{Database: databaseName, Collection: jobCollectionName, Name: "job_state_id",
+			Keys: bson.NewDocument(bson.EC.Int32("state", 1), bson.EC.Int32("_id", 1))},
+		{Database: databaseName, Collection: jobCollectionName, Name: "job_state_lease",
+			Keys: bson.NewDocument(bson.EC.Int32("state", 1), bson.EC.Int32("leaseUntil", 1))},
+		{Database: databaseName, Collection: jobPartCollectionName, Name: "job_part_job_seq", Unique: true,
+			Keys: bson.NewDocument(bson.EC.Int32("jobId", 1), bson.EC.Int32("seq", 1))},
+	}
+}
+
+// runningBy the filter of the job running under the owner
+func runningBy(id objectid.ObjectID, ownerID string) *bson.Document {
+	return bson.NewDocument(bson.EC.ObjectID("_id", id), bson.EC.String("state", JobRunning), bson.EC.String("ownerId", ownerID))
+}
+
+func (repository *MongoJobRepository) collection() (*mongo.Collection, error) {
+	if repository.MongoClient == nil {
+		return nil, errors.New("could not communicate with database")
+	}
+	return repository.MongoClient.Database(databaseName).Collection(jobCollectionName, nil), nil
+}
+
+func (repository *MongoJobRepository) partCollection() *mongo.Collection {
+	return repository.MongoClient.Database(databaseName).Collection(jobPartCollectionName, nil)
+}
+
+// InsertJob function to persist the job with the parts of its input, the ids are assigned when they have none.
+// The parts are inserted first, so the job is not claimed before its whole input is stored
+func (repository *MongoJobRepository) InsertJob(ctx context.Context, job *JobEntity, parts []*JobPartEntity) error {
+	log := repositoryLogger.WithContext(ctx).With(logger.Function("InsertJob"), logger.String("kind", job.Kind))
+
+	ctx, cancel := properties.AppProperties.Deadlines.WithDeadline(ctx, "InsertJob")
+	defer cancel()
+
+	collection, err := repository.collection()
+	if err != nil {
+		log.Error("could not insert the job", logger.Err(err))
+		return err
+	}
+
+	if job.ID.IsZero() {
+		job.ID = objectid.New()
+	}
+
+	// a part is inserted at a time, each one may be close to the size limit of a document
+	for _, part := range parts {
+		if part.ID.IsZero() {
+			part.ID = objectid.New()
+		}
+		part.JobID = job.ID
+
+		if _, err := repository.partCollection().InsertOne(ctx, part); err != nil {
+			log.Error("could not insert the parts of the job", logger.Err(err))
+			return err
+		}
+	}
+
+	if _, err := collection.InsertOne(ctx, job); err != nil {
+		log.Error("could not insert the job", logger.Err(err))
+		return err
+	}
+
+	log.Info("job inserted", logger.String("id", job.ID.Hex()))
+	return nil
+}
+
+// FindJobByID function to find the job by id, return nil when it does not exist
+func (repository *MongoJobRepository) FindJobByID(ctx context.Context, id objectid.ObjectID) (*JobEntity, error) {
+	log := repositoryLogger.WithContext(ctx).With(logger.Function("FindJobByID"), logger.String("id", id.Hex()))
+
+	ctx, cancel := properties.AppProperties.Deadlines.WithDeadline(ctx, "FindJobByID")
+	defer cancel()
+
+	collection, err := repository.collection()
+	if err != nil {
+		log.Error("could not find the job", logger.Err(err))
+		return nil, err
+	}
+
+	job := JobEntity{}
+	err = collection.FindOne(ctx, bson.NewDocument(bson.EC.ObjectID("_id", id))).Decode(&job)
+	if err == mongo.ErrNoDocuments {
+		log.Info("job not found")
+		return nil, nil
+	}
+
+	if err != nil {
+		log.Error("could not find the job", logger.Err(err))
+		return nil, err
+	}
+
+	return &job, nil
+}
+
+// FindJobParts function to find the parts of the job from the seq, in the order of the input, up to limit
+func (repository *MongoJobRepository) FindJobParts(ctx context.Context, jobID objectid.ObjectID, fromSeq int64, limit int64) ([]*JobPartEntity, error) {
+	log := repositoryLogger.WithContext(ctx).With(logger.Function("FindJobParts"), logger.String("id", jobID.Hex()), logger.Int64("from", fromSeq))
+
+	ctx, cancel := properties.AppProperties.Deadlines.WithDeadline(ctx, "FindJobParts")
+	defer cancel()
+
+	if _, err := repository.collection(); err != nil {
+		log.Error("could not find the parts of the job", logger.Err(err))
+		return nil, err
+	}
+
+	cur, err := repository.partCollection().Find(ctx,
+		bson.NewDocument(bson.EC.ObjectID("jobId", jobID), bson.EC.SubDocumentFromElements("seq", bson.EC.Int64("$gte", fromSeq))),
+		findopt.Sort(bson.NewDocument(bson.EC.Int32("seq", 1))),
+		findopt.Limit(limit))
+	if err != nil {
+		log.Error("could not find the parts of the job", logger.Err(err))
+		return nil, err
+	}
+	defer cur.Close(ctx)
+
+	parts := []*JobPartEntity{}
+	for cur.Next(ctx) {
+
+		part := JobPartEntity{}
+		if err := cur.Decode(&part); err != nil {
+			log.Error("could not decode the part of the job", logger.Err(err))
+			return nil, err
+		}
+
+		parts = append(parts, &part)
+	}
+
+	if err := cur.Err(); err != nil {
+		log.Error("could not find the parts of the job", logger.Err(err))
+		return nil, err
+	}
+
+	return parts, nil
+}
+
+// ClaimJob function to move the oldest queued job to running under the owner until leaseUntil and return it,
+// nil when there is none. The job is claimed atomically, so a job is only claimed by one worker
+func (repository *MongoJobRepository) ClaimJob(ctx context.Context, ownerID string, startedAt time.Time, leaseUntil time.Time) (*JobEntity, error) {
+	log := repositoryLogger.WithContext(ctx).With(logger.Function("ClaimJob"), logger.String("owner", ownerID))
+
+	ctx, cancel := properties.AppProperties.Deadlines.WithDeadline(ctx, "ClaimJob")
+	defer cancel()
+
+	collection, err := repository.collection()
+	if err != nil {
+		log.Error("could not claim a job", logger.Err(err))
+		return nil, err
+	}
+
+	job := JobEntity{}
+	err = collection.FindOneAndUpdate(ctx,
+		bson.NewDocument(bson.EC.String("state", JobQueued)),
+		bson.NewDocument(
+			bson.EC.SubDocumentFromElements("$set", bson.EC.String("state", JobRunning), bson.EC.Time("startedAt", startedAt),
+				bson.EC.String("ownerId", ownerID), bson.EC.Time("leaseUntil", leaseUntil)),
+			bson.EC.SubDocumentFromElements("$inc", bson.EC.Int64("attempts", 1))),
+		findopt.Sort(bson.NewDocument(bson.EC.Int32("_id", 1))),
+		findopt.ReturnDocument(mongoopt.After)).Decode(&job)
+	if err == mongo.ErrNoDocuments {
+		return nil, nil
+	}
+
+	if err != nil {
+		log.Error("could not claim a job", logger.Err(err))
+		return nil, err
+	}
+
+	log.Info("job claimed", logger.String("id", job.ID.Hex()), logger.String("kind", job.Kind))
+	return &job, nil
+}
+
+// RenewJobLease function to extend the lease of the job running under the owner, return whether its cancellation
+// was requested. Return ErrJobLeaseLost when the job is not running under the owner anymore
+func (repository *MongoJobRepository) RenewJobLease(ctx context.Context, id objectid.ObjectID, ownerID string, leaseUntil time.Time) (bool, error) {
+	log := repositoryLogger.WithContext(ctx).With(logger.Function("RenewJobLease"), logger.String("id", id.Hex()), logger.String("owner", ownerID))
+
+	return repository.updateRunningJob(ctx, log, "RenewJobLease", runningBy(id, ownerID),
+		bson.NewDocument(bson.EC.SubDocumentFromElements("$set", bson.EC.Time("leaseUntil", leaseUntil))))
+}
+
+// UpdateJobProgress function to record the progress of the job running under its owner and extend its lease,
+// with its offset and its counters. The result of the part is recorded before, when there is a part done.
+// Return whether its cancellation was requested, ErrJobLeaseLost when the job is not running under its owner anymore
+func (repository *MongoJobRepository) UpdateJobProgress(ctx context.Context, job *JobEntity, part *JobPartEntity, leaseUntil time.Time) (bool, error) {
+	log := repositoryLogger.WithContext(ctx).With(logger.Function("UpdateJobProgress"), logger.String("id", job.ID.Hex()), logger.String("owner", job.OwnerID))
+
+	if part != nil {
+		if err := repository.updatePartResult(ctx, log, part); err != nil {
+			return false, err
+		}
+	}
+
+	update := bson.NewDocument(bson.EC.SubDocumentFromElements("$set",
+		bson.EC.Int64("done", job.Done), bson.EC.Int64("total", job.Total), bson.EC.Int64("offset", job.Offset),
+		bson.EC.String("counters", job.Counters), bson.EC.Time("leaseUntil", leaseUntil)))
+
+	return repository.updateRunningJob(ctx, log, "UpdateJobProgress", runningBy(job.ID, job.OwnerID), update)
+}
+
+func (repository *MongoJobRepository) updatePartResult(ctx context.Context, log *logger.Logger, part *JobPartEntity) error {
+
+	ctx, cancel := properties.AppProperties.Deadlines.WithDeadline(ctx, "UpdateJobProgress")
+	defer cancel()
+
+	if _, err := repository.collection(); err != nil {
+		log.Error("could not record the result of the part", logger.Err(err))
+		return err
+	}
+
+	if _, err := repository.partCollection().UpdateOne(ctx,
+		bson.NewDocument(bson.EC.ObjectID("_id", part.ID)),
+		bson.NewDocument(bson.EC.SubDocumentFromElements("$set", bson.EC.String("result", part.Result)))); err != nil {
+		log.Error("could not record the result of the part", logger.Err(err), logger.Int64("seq", part.Seq))
+		return err
+	}
+
+	return nil
+}
+
+// updateRunningJob apply the update to the running job matching the filter, return whether its cancellation was requested
+func (repository *MongoJobRepository) updateRunningJob(ctx context.Context, log *logger.Logger, operation string, filter *bson.Document, update *bson.Document) (bool, error) {
+
+	ctx, cancel := properties.AppProperties.Deadlines.WithDeadline(ctx, operation)
+	defer cancel()
+
+	collection, err := repository.collection()
+	if err != nil {
+		log.Error("could not update the running job", logger.Err(err))
+		return false, err
+	}
+
+	job := JobEntity{}
+	err = collection.FindOneAndUpdate(ctx, filter, update,
+		findopt.Projection(bson.NewDocument(bson.EC.Int32("cancelRequested", 1))),
+		findopt.ReturnDocument(mongoopt.After)).Decode(&job)
+	if err == mongo.ErrNoDocuments {
+		log.Warn("job is not running under this owner anymore")
+		return false, ErrJobLeaseLost
+	}
+
+	if err != nil {
+		log.Error("could not update the running job", logger.Err(err))
+		return false, err
+	}
+
+	return job.CancelRequested, nil
+}
+
+// FinishJob function to record the final state of the job running under its owner, with its result or its error.
+// Return ErrJobLeaseLost when the job is not running under its owner anymore
+func (repository *MongoJobRepository) FinishJob(ctx context.Context, job *JobEntity) error {
+	log := repositoryLogger.WithContext(ctx).With(logger.Function("FinishJob"), logger.String("id", job.ID.Hex()), logger.String("state", job.State))
+
+	ctx, cancel := properties.AppProperties.Deadlines.WithDeadline(ctx, "FinishJob")
+	defer cancel()
+
+	collection, err := repository.collection()
+	if err != nil {
+		log.Error("could not finish the job", logger.Err(err))
+		return err
+	}
+
+	result, err := collection.UpdateOne(ctx,
+		runningBy(job.ID, job.OwnerID),
+		bson.NewDocument(bson.EC.SubDocumentFromElements("$set",
+			bson.EC.String("state", job.State),
+			bson.EC.Int64("done", job.Done),
+			bson.EC.Int64("total", job.Total),
+			bson.EC.String("result", job.Result),
+			bson.EC.String("error", job.Error),
+			bson.EC.Time("finishedAt", job.FinishedAt))))
+	if err != nil {
+		log.Error("could not finish the job", logger.Err(err))
+		return err
+	}
+
+	if result.MatchedCount == 0 {
+		log.Warn("job is not running under this owner anymore")
+		return ErrJobLeaseLost
+	}
+
+	log.Info("job finished")
+	return nil
+}
+
+// CancelJob function to cancel the job, a queued job is canceled right away and a running one is flagged
+// for its worker to stop. Return the job as it's after the cancellation, nil when it does not exist
+func (repository *MongoJobRepository) CancelJob(ctx context.Context, id objectid.ObjectID, canceledAt time.Time) (*JobEntity, error) {
+	log := repositoryLogger.WithContext(ctx).With(logger.Function("CancelJob"), logger.String("id", id.Hex()))
+
+	ctx, cancel := properties.AppProperties.Deadlines.WithDeadline(ctx, "CancelJob")
+	defer cancel()
+
+	collection, err := repository.collection()
+	if err != nil {
+		log.Error("could not cancel the job", logger.Err(err))
+		return nil, err
+	}
+
+	updates := []struct {
+		state  string
+		update *bson.Document
+	}{
+		{JobQueued, bson.NewDocument(bson.EC.SubDocumentFromElements("$set", bson.EC.String("state", JobCanceled), bson.EC.Time("finishedAt", canceledAt)))},
+		{JobRunning, bson.NewDocument(bson.EC.SubDocumentFromElements("$set", bson.EC.Boolean("cancelRequested", true)))},
+	}
+
+	for _, u := range updates {
+		job := JobEntity{}
+		err := collection.FindOneAndUpdate(ctx,
+			bson.NewDocument(bson.EC.ObjectID("_id", id), bson.EC.String("state", u.state)), u.update,
+			findopt.ReturnDocument(mongoopt.After)).Decode(&job)
+		if err == nil {
+			log.Info("job canceled", logger.String("state", u.state))
+			return &job, nil
+		}
+
+		if err != mongo.ErrNoDocuments {
+			log.Error("could not cancel the job", logger.Err(err))
+			return nil, err
+		}
+	}
+
+	return repository.FindJobByID(ctx, id)
+}
+
+// RequeueExpiredJobs function to queue again the running jobs whose lease expired, their owner stopped or lost them.
+// A job that already had maxAttempts fails and a job whose cancellation was requested is canceled.
+// Return the number of jobs queued again
+func (repository *MongoJobRepository) RequeueExpiredJobs(ctx context.Context, maxAttempts int64, now time.Time) (int64, error) {
+	log := repositoryLogger.WithContext(ctx).With(logger.Function("RequeueExpiredJobs"))
+
+	ctx, cancel := properties.AppProperties.Deadlines.WithDeadline(ctx, "RequeueExpiredJobs")
+	defer cancel()
+
+	collection, err := repository.collection()
+	if err != nil {
+		log.Error("could not requeue the jobs", logger.Err(err))
+		return 0, err
+	}
+
+	// a job without a lease, left running by an older version, is expired too
+	expired := func(elems ...*bson.Element) *bson.Document {
+		return bson.NewDocument(append([]*bson.Element{bson.EC.String("state", JobRunning),
+			bson.EC.SubDocumentFromElements("leaseUntil", bson.EC.SubDocumentFromElements("$not", bson.EC.Time("$gte", now)))}, elems...)...)
+	}
+	released := func() *bson.Element {
+		return bson.EC.SubDocumentFromElements("$unset", bson.EC.String("ownerId", ""), bson.EC.String("leaseUntil", ""))
+	}
+
+	if _, err := collection.UpdateMany(ctx,
+		expired(bson.EC.Boolean("cancelRequested", true)),
+		bson.NewDocument(bson.EC.SubDocumentFromElements("$set", bson.EC.String("state", JobCanceled), bson.EC.Time("finishedAt", now)), released())); err != nil {
+		log.Error("could not requeue the jobs", logger.Err(err))
+		return 0, err
+	}
+
+	if _, err := collection.UpdateMany(ctx,
+		expired(bson.EC.SubDocumentFromElements("attempts", bson.EC.Int64("$gte", maxAttempts))),
+		bson.NewDocument(bson.EC.SubDocumentFromElements("$set", bson.EC.String("state", JobFailed),
+			bson.EC.String("error", "job was interrupted too many times"), bson.EC.Time("finishedAt", now)), released())); err != nil {
+		log.Error("could not requeue the jobs", logger.Err(err))
+		return 0, err
+	}
+
+	result, err := collection.UpdateMany(ctx,
+		expired(),
+		bson.NewDocument(bson.EC.SubDocumentFromElements("$set", bson.EC.String("state", JobQueued)), released()))
+	if err != nil {
+		log.Error("could not requeue the jobs", logger.Err(err))
+		return 0, err
+	}
+
+	if result.ModifiedCount > 0 {
+		log.Info("jobs requeued", logger.Int("length", int(result.ModifiedCount)))
+	}
+	return result.ModifiedCount, nil
+}
@@ -0,0 +1,88 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/mongodb/mongo-go-driver/bson/objectid"
+
+	"github.com/jcsw/go-api-learn/pkg/infra/metrics"
+)
+
+// InstrumentedJobRepository a JobRepository that records the latency and the errors of every operation
+type InstrumentedJobRepository struct {
+	Repository JobRepository
+	Backend    string
+}
+
+// InsertJob function to persist the job with the parts of its input
+func (instrumented *InstrumentedJobRepository) InsertJob(ctx context.Context, job *JobEntity, parts []*JobPartEntity) error {
+	done := metrics.StartDatabaseOperation(instrumented.Backend, "InsertJob")
+	err := instrumented.Repository.InsertJob(ctx, job, parts)
+	done(err)
+	return err
+}
+
+// FindJobByID function to find the job by id
+func (instrumented *InstrumentedJobRepository) FindJobByID(ctx context.Context, id objectid.ObjectID) (*JobEntity, error) {
+	done := metrics.StartDatabaseOperation(instrumented.Backend, "FindJobByID")
+	job, err := instrumented.Repository.FindJobByID(ctx, id)
+	done(err)
+	return job, err
+}
+
+// FindJobParts function to find the parts of the job from the seq
+func (instrumented *InstrumentedJobRepository) FindJobParts(ctx context.Context, jobID objectid.ObjectID, fromSeq int64, limit int64) ([]*JobPartEntity, error) {
+	done := metrics.StartDatabaseOperation(instrumented.Backend, "FindJobParts")
+	parts, err := instrumented.Repository.FindJobParts(ctx, jobID, fromSeq, limit)
+	done(err)
+	return parts, err
+}
+
+// ClaimJob function to move the oldest queued job to running under the owner
+func (instrumented *InstrumentedJobRepository) ClaimJob(ctx context.Context, ownerID string, startedAt time.Time, leaseUntil time.Time) (*JobEntity, error) {
+	done := metrics.StartDatabaseOperation(instrumented.Backend, "ClaimJob")
+	job, err := instrumented.Repository.ClaimJob(ctx, ownerID, startedAt, leaseUntil)
+	done(err)
+	return job, err
+}
+
+// RenewJobLease function to extend the lease of the job running under the owner
+func (instrumented *InstrumentedJobRepository) RenewJobLease(ctx context.Context, id objectid.ObjectID, ownerID string, leaseUntil time.Time) (bool, error) {
+	done := metrics.StartDatabaseOperation(instrumented.Backend, "RenewJobLease")
+	cancelRequested, err := instrumented.Repository.RenewJobLease(ctx, id, ownerID, leaseUntil)
+	done(err)
+	return cancelRequested, err
+}
+
+// UpdateJobProgress function to record the progress of the running job
+func (instrumented *InstrumentedJobRepository) UpdateJobProgress(ctx context.Context, job *JobEntity, part *JobPartEntity, leaseUntil time.Time) (bool, error) {
+	done := metrics.StartDatabaseOperation(instrumented.Backend, "UpdateJobProgress")
+	cancelRequested, err := instrumented.Repository.UpdateJobProgress(ctx, job, part, leaseUntil)
+	done(err)
+	return cancelRequested, err
+}
+
+// FinishJob function to record the final state of the running job
+func (instrumented *InstrumentedJobRepository) FinishJob(ctx context.Context, job *JobEntity) error {
+	done := metrics.StartDatabaseOperation(instrumented.Backend, "FinishJob")
+	err := instrumented.Repository.FinishJob(ctx, job)
+	done(err)
+	return err
+}
+
+// CancelJob function to cancel the job
+func (instrumented *InstrumentedJobRepository) CancelJob(ctx context.Context, id objectid.ObjectID, canceledAt time.Time) (*JobEntity, error) {
+	done := metrics.StartDatabaseOperation(instrumented.Backend, "CancelJob")
+	job, err := instrumented.Repository.CancelJob(ctx, id, canceledAt)
+	done(err)
+	return job, err
+}
+
+// RequeueExpiredJobs function to queue again the running jobs whose lease expired
+func (instrumented *InstrumentedJobRepository) RequeueExpiredJobs(ctx context.Context, maxAttempts int64, now time.Time) (int64, error) {
+	done := metrics.StartDatabaseOperation(instrumented.Backend, "RequeueExpiredJobs")
+	requeued, err := instrumented.Repository.RequeueExpiredJobs(ctx, maxAttempts, now)
+	done(err)
+	return requeued, err
+}
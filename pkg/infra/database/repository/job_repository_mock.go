@@ -0,0 +1,86 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/mongodb/mongo-go-driver/bson/objectid"
+	"github.com/stretchr/testify/mock"
+)
+
+// JobRepositoryMock mock to JobRepository
+type JobRepositoryMock struct {
+	mock.Mock
+}
+
+// InsertJob mock to InsertJob
+func (m *JobRepositoryMock) InsertJob(ctx context.Context, job *JobEntity, parts []*JobPartEntity) error {
+	args := m.Called(ctx, job, parts)
+	return args.Error(0)
+}
+
+// FindJobByID mock to FindJobByID
+func (m *JobRepositoryMock) FindJobByID(ctx context.Context, id objectid.ObjectID) (*JobEntity, error) {
+	args := m.Called(ctx, id)
+	return jobOrNil(args)
+}
+
+// FindJobParts mock to FindJobParts
+func (m *JobRepositoryMock) FindJobParts(ctx context.Context, jobID objectid.ObjectID, fromSeq int64, limit int64) ([]*JobPartEntity, error) {
+	args := m.Called(ctx, jobID, fromSeq, limit)
+
+	if args.Error(1) != nil {
+		return nil, args.Error(1)
+	}
+
+	return args.Get(0).([]*JobPartEntity), nil
+}
+
+// ClaimJob mock to ClaimJob
+func (m *JobRepositoryMock) ClaimJob(ctx context.Context, ownerID string, startedAt time.Time, leaseUntil time.Time) (*JobEntity, error) {
+	args := m.Called(ctx, ownerID, startedAt, leaseUntil)
+	return jobOrNil(args)
+}
+
+// RenewJobLease mock to RenewJobLease
+func (m *JobRepositoryMock) RenewJobLease(ctx context.Context, id objectid.ObjectID, ownerID string, leaseUntil time.Time) (bool, error) {
+	args := m.Called(ctx, id, ownerID, leaseUntil)
+	return args.Bool(0), args.Error(1)
+}
+
+// UpdateJobProgress mock to UpdateJobProgress
+func (m *JobRepositoryMock) UpdateJobProgress(ctx context.Context, job *JobEntity, part *JobPartEntity, leaseUntil time.Time) (bool, error) {
+	args := m.Called(ctx, job, part, leaseUntil)
+	return args.Bool(0), args.Error(1)
+}
+
+// FinishJob mock to FinishJob
+func (m *JobRepositoryMock) FinishJob(ctx context.Context, job *JobEntity) error {
+	args := m.Called(ctx, job)
+	return args.Error(0)
+}
+
+// CancelJob mock to CancelJob
+func (m *JobRepositoryMock) CancelJob(ctx context.Context, id objectid.ObjectID, canceledAt time.Time) (*JobEntity, error) {
+	args := m.Called(ctx, id, canceledAt)
+	return jobOrNil(args)
+}
+
+// RequeueExpiredJobs mock to RequeueExpiredJobs
+func (m *JobRepositoryMock) RequeueExpiredJobs(ctx context.Context, maxAttempts int64, now time.Time) (int64, error) {
+	args := m.Called(ctx, maxAttempts, now)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+func jobOrNil(args mock.Arguments) (*JobEntity, error) {
+
+	if args.Error(1) != nil {
+		return nil, args.Error(1)
+	}
+
+	if args.Get(0) == nil {
+		return nil, nil
+	}
+
+	return args.Get(0).(*JobEntity), nil
+}
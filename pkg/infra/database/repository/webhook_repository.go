@@ -0,0 +1,475 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/mongodb/mongo-go-driver/bson"
+	"github.com/mongodb/mongo-go-driver/bson/objectid"
+	"github.com/mongodb/mongo-go-driver/mongo"
+	"github.com/mongodb/mongo-go-driver/mongo/findopt"
+	"github.com/mongodb/mongo-go-driver/mongo/mongoopt"
+
+	"github.com/jcsw/go-api-learn/pkg/infra/database"
+	"github.com/jcsw/go-api-learn/pkg/infra/logger"
+	"github.com/jcsw/go-api-learn/pkg/infra/properties"
+)
+
+const (
+	webhookCollectionName  = "webhook"
+	deliveryCollectionName = "webhook_delivery"
+
+	// the statuses of the deliveries that are claimed, like the ones of the domain
+	deliveryPending = "pending"
+	deliverySending = "sending"
+)
+
+// WebhookSubscriptionEntity represents a webhook, the events are the types it receives or "*" for all of them
+type WebhookSubscriptionEntity struct {
+	ID        objectid.ObjectID `bson:"_id"`
+	URL       string            `bson:"url"`
+	Events    []string          `bson:"events"`
+	Secret    string            `bson:"secret"`
+	CreatedAt time.Time         `bson:"createdAt"`
+}
+
+// WebhookDeliveryEntity represents the delivery of an event to a webhook, the payload is the event encoded as JSON.
+// A pending delivery is due when NextAttemptAt is reached, Failures counts the failed attempts since it was created
+// or replayed and Attempts keeps the log of every attempt. A delivery being sent is claimed until NextAttemptAt,
+// it's due again when the dispatcher that claimed it did not record the attempt by then. ClaimID identifies the
+// claim, only the dispatcher holding it records the attempt
+type WebhookDeliveryEntity struct {
+	ID             objectid.ObjectID      `bson:"_id"`
+	SubscriptionID objectid.ObjectID      `bson:"subscriptionId"`
+	EventID        string                 `bson:"eventId"`
+	EventType      string                 `bson:"eventType"`
+	Payload        string                 `bson:"payload"`
+	Status         string                 `bson:"status"`
+	Failures       int64                  `bson:"failures"`
+	NextAttemptAt  time.Time              `bson:"nextAttemptAt,omitempty"`
+	CreatedAt      time.Time              `bson:"createdAt"`
+	DeliveredAt    time.Time              `bson:"deliveredAt,omitempty"`
+	Attempts       []WebhookAttemptEntity `bson:"attempts"`
+	ClaimID        string                 `bson:"claimId,omitempty"`
+}
+
+// WebhookAttemptEntity an attempt to deliver an event, StatusCode is zero when the webhook could not be reached
+type WebhookAttemptEntity struct {
+	At         time.Time `bson:"at"`
+	StatusCode int       `bson:"statusCode,omitempty"`
+	Error      string    `bson:"error,omitempty"`
+	DurationMs int64     `bson:"durationMs"`
+}
+
+// DeliveryFilter define the page of the deliveries of a webhook, from the newest to the oldest
+type DeliveryFilter struct {
+	AfterID objectid.ObjectID
+	Limit   int64
+}
+
+// ErrDeliveryClaimLost Error for an attempt recorded by a dispatcher whose claim of the delivery was revoked
+var ErrDeliveryClaimLost = errors.New("delivery is not claimed by this dispatcher anymore")
+
+// WebhookRepository define the data repository of the webhooks and their deliveries
+type WebhookRepository interface {
+	InsertSubscription(ctx context.Context, subscription *WebhookSubscriptionEntity) error
+	FindSubscriptions(ctx context.Context) ([]*WebhookSubscriptionEntity, error)
+	FindSubscriptionByID(ctx context.Context, id objectid.ObjectID) (*WebhookSubscriptionEntity, error)
+	DeleteSubscription(ctx context.Context, id objectid.ObjectID) (bool, error)
+	InsertDelivery(ctx context.Context, delivery *WebhookDeliveryEntity) error
+	ClaimDueDelivery(ctx context.Context, dueAt time.Time, leaseUntil time.Time) (*WebhookDeliveryEntity, error)
+	FindDeliveries(ctx context.Context, subscriptionID objectid.ObjectID, filter DeliveryFilter) ([]*WebhookDeliveryEntity, error)
+	FindDeliveryByID(ctx context.Context, id objectid.ObjectID) (*WebhookDeliveryEntity, error)
+	RecordDeliveryAttempt(ctx context.Context, delivery *WebhookDeliveryEntity, attempt WebhookAttemptEntity) error
+	ReplayDelivery(ctx context.Context, id objectid.ObjectID, nextAttemptAt time.Time) (*WebhookDeliveryEntity, error)
+}
+
+// MongoWebhookRepository a WebhookRepository stored in mongodb, whatever the storage backend of the customers
+type MongoWebhookRepository struct {
+	MongoClient *mongo.Client
+}
+
+// MongoIndexes the indexes of the deliveries, an event is delivered once to each webhook, the due deliveries
+// are found by status and time and the log of a webhook the newest first
+func (repository *MongoWebhookRepository) MongoIndexes() []database.MongoIndex {
+	return []database.MongoIndex{
+		{Database: databaseName, Collection: deliveryCollectionName, Name: "webhook_delivery_event_unique",
+			Keys: bson.NewDocument(bson.EC.Int32("subscriptionId", 1), bson.EC.Int32("eventId", 1)), Unique: true},
+		{Database: databaseName, Collection: deliveryCollectionName, Name: "webhook_delivery_next_attempt_at",
+			Keys: bson.NewDocument(bson.EC.Int32("status", 1), bson.EC.Int32("nextAttemptAt", 1))},
+		{Database: databaseName, Collection: deliveryCollectionName, Name: "webhook_delivery_subscription_id",
+			Keys: bson.NewDocument(bson.EC.Int32("subscriptionId", 1), bson.EC.Int32("_id", -1))},
+	}
+}
+
+func (repository *MongoWebhookRepository) collection(name string) (*mongo.Collection, error) {
+	if repository.MongoClient == nil {
+		return nil, errors.New("could not communicate with database")
+	}
+	return repository.MongoClient.Database(databaseName).Collection(name, nil), nil
+}
+
+// InsertSubscription function to persist the webhook, the id is assigned when it has none
+func (repository *MongoWebhookRepository) InsertSubscription(ctx context.Context, subscription *WebhookSubscriptionEntity) error {
+	log := repositoryLogger.WithContext(ctx).With(logger.Function("InsertSubscription"), logger.String("url", subscription.URL))
+
+	ctx, cancel := properties.AppProperties.Deadlines.WithDeadline(ctx, "InsertSubscription")
+	defer cancel()
+
+	collection, err := repository.collection(webhookCollectionName)
+	if err != nil {
+		log.Error("could not insert the webhook", logger.Err(err))
+		return err
+	}
+
+	if subscription.ID.IsZero() {
+		subscription.ID = objectid.New()
+	}
+
+	if _, err := collection.InsertOne(ctx, subscription); err != nil {
+		log.Error("could not insert the webhook", logger.Err(err))
+		return err
+	}
+
+	log.Info("webhook inserted", logger.String("id", subscription.ID.Hex()))
+	return nil
+}
+
+// FindSubscriptions function to find all webhooks, the oldest first
+func (repository *MongoWebhookRepository) FindSubscriptions(ctx context.Context) ([]*WebhookSubscriptionEntity, error) {
+	log := repositoryLogger.WithContext(ctx).With(logger.Function("FindSubscriptions"))
+
+	ctx, cancel := properties.AppProperties.Deadlines.WithDeadline(ctx, "FindSubscriptions")
+	defer cancel()
+
+	collection, err := repository.collection(webhookCollectionName)
+	if err != nil {
+		log.Error("could not find the webhooks", logger.Err(err))
+		return nil, err
+	}
+
+	cur, err := collection.Find(ctx, bson.NewDocument(), findopt.Sort(bson.NewDocument(bson.EC.Int32("_id", 1))))
+	if err != nil {
+		log.Error("could not find the webhooks", logger.Err(err))
+		return nil, err
+	}
+	defer cur.Close(ctx)
+
+	subscriptions := []*WebhookSubscriptionEntity{}
+	for cur.Next(ctx) {
+
+		subscription := WebhookSubscriptionEntity{}
+		if err := cur.Decode(&subscription); err != nil {
+			log.Error("could not decode the webhook", logger.Err(err))
+			return nil, err
+		}
+
+		subscriptions = append(subscriptions, &subscription)
+	}
+
+	if err := cur.Err(); err != nil {
+		log.Error("could not find the webhooks", logger.Err(err))
+		return nil, err
+	}
+
+	log.Debug("webhooks found", logger.Int("length", len(subscriptions)))
+	return subscriptions, nil
+}
+
+// FindSubscriptionByID function to find the webhook by id, return nil when it does not exist
+func (repository *MongoWebhookRepository) FindSubscriptionByID(ctx context.Context, id objectid.ObjectID) (*WebhookSubscriptionEntity, error) {
+	log := repositoryLogger.WithContext(ctx).With(logger.Function("FindSubscriptionByID"), logger.String("id", id.Hex()))
+
+	ctx, cancel := properties.AppProperties.Deadlines.WithDeadline(ctx, "FindSubscriptionByID")
+	defer cancel()
+
+	collection, err := repository.collection(webhookCollectionName)
+	if err != nil {
+		log.Error("could not find the webhook", logger.Err(err))
+		return nil, err
+	}
+
+	subscription := WebhookSubscriptionEntity{}
+	err = collection.FindOne(ctx, bson.NewDocument(bson.EC.ObjectID("_id", id))).Decode(&subscription)
+	if err == mongo.ErrNoDocuments {
+		log.Info("webhook not found")
+		return nil, nil
+	}
+
+	if err != nil {
+		log.Error("could not find the webhook", logger.Err(err))
+		return nil, err
+	}
+
+	return &subscription, nil
+}
+
+// DeleteSubscription function to remove the webhook and its deliveries, return whether it existed
+func (repository *MongoWebhookRepository) DeleteSubscription(ctx context.Context, id objectid.ObjectID) (bool, error) {
+	log := repositoryLogger.WithContext(ctx).With(logger.Function("DeleteSubscription"), logger.String("id", id.Hex()))
+
+	ctx, cancel := properties.AppProperties.Deadlines.WithDeadline(ctx, "DeleteSubscription")
+	defer cancel()
+
+	collection, err := repository.collection(webhookCollectionName)
+	if err != nil {
+		log.Error("could not delete the webhook", logger.Err(err))
+		return false, err
+	}
+
+	result, err := collection.DeleteOne(ctx, bson.NewDocument(bson.EC.ObjectID("_id", id)))
+	if err != nil {
+		log.Error("could not delete the webhook", logger.Err(err))
+		return false, err
+	}
+
+	deliveries, _ := repository.collection(deliveryCollectionName)
+	if _, err := deliveries.DeleteMany(ctx, bson.NewDocument(bson.EC.ObjectID("subscriptionId", id))); err != nil {
+		log.Warn("webhook deleted but not its deliveries", logger.Err(err))
+	}
+
+	log.Info("webhook deleted", logger.Bool("deleted", result.DeletedCount > 0))
+	return result.DeletedCount > 0, nil
+}
+
+// InsertDelivery function to persist the delivery, the id is assigned when it has none.
+// A delivery of the same event to the same webhook already exists when the event is published again, it's ignored
+func (repository *MongoWebhookRepository) InsertDelivery(ctx context.Context, delivery *WebhookDeliveryEntity) error {
+	log := repositoryLogger.WithContext(ctx).With(logger.Function("InsertDelivery"), logger.String("eventId", delivery.EventID))
+
+	ctx, cancel := properties.AppProperties.Deadlines.WithDeadline(ctx, "InsertDelivery")
+	defer cancel()
+
+	collection, err := repository.collection(deliveryCollectionName)
+	if err != nil {
+		log.Error("could not insert the delivery", logger.Err(err))
+		return err
+	}
+
+	if delivery.ID.IsZero() {
+		delivery.ID = objectid.New()
+	}
+
+	if _, err := collection.InsertOne(ctx, delivery); err != nil {
+		if isDuplicateKey(err) {
+			log.Info("delivery already exists")
+			return nil
+		}
+
+		log.Error("could not insert the delivery", logger.Err(err))
+		return err
+	}
+
+	return nil
+}
+
+// ClaimDueDelivery function to claim the oldest delivery due at the time, pending or whose claim expired, and return it,
+// nil when there is none. The delivery is moved to sending until leaseUntil under a new claim atomically, so it's only sent
+// by one dispatcher
+func (repository *MongoWebhookRepository) ClaimDueDelivery(ctx context.Context, dueAt time.Time, leaseUntil time.Time) (*WebhookDeliveryEntity, error) {
+	log := repositoryLogger.WithContext(ctx).With(logger.Function("ClaimDueDelivery"))
+
+	ctx, cancel := properties.AppProperties.Deadlines.WithDeadline(ctx, "ClaimDueDelivery")
+	defer cancel()
+
+	collection, err := repository.collection(deliveryCollectionName)
+	if err != nil {
+		log.Error("could not claim a delivery", logger.Err(err))
+		return nil, err
+	}
+
+	delivery := WebhookDeliveryEntity{}
+	err = collection.FindOneAndUpdate(ctx,
+		bson.NewDocument(
+			bson.EC.SubDocumentFromElements("status", bson.EC.ArrayFromElements("$in", bson.VC.String(deliveryPending), bson.VC.String(deliverySending))),
+			bson.EC.SubDocumentFromElements("nextAttemptAt", bson.EC.Time("$lte", dueAt))),
+		bson.NewDocument(bson.EC.SubDocumentFromElements("$set", bson.EC.String("status", deliverySending), bson.EC.Time("nextAttemptAt", leaseUntil),
+			bson.EC.String("claimId", objectid.New().Hex()))),
+		findopt.Sort(bson.NewDocument(bson.EC.Int32("nextAttemptAt", 1))),
+		findopt.ReturnDocument(mongoopt.After)).Decode(&delivery)
+	if err == mongo.ErrNoDocuments {
+		return nil, nil
+	}
+
+	if err != nil {
+		log.Error("could not claim a delivery", logger.Err(err))
+		return nil, err
+	}
+
+	log.Debug("delivery claimed", logger.String("id", delivery.ID.Hex()))
+	return &delivery, nil
+}
+
+// FindDeliveries function to find a page of the deliveries of the webhook, the newest first
+func (repository *MongoWebhookRepository) FindDeliveries(ctx context.Context, subscriptionID objectid.ObjectID, filter DeliveryFilter) ([]*WebhookDeliveryEntity, error) {
+	log := repositoryLogger.WithContext(ctx).With(logger.Function("FindDeliveries"), logger.String("id", subscriptionID.Hex()))
+
+	query := bson.NewDocument(bson.EC.ObjectID("subscriptionId", subscriptionID))
+	if !filter.AfterID.IsZero() {
+		query.Append(bson.EC.SubDocumentFromElements("_id", bson.EC.ObjectID("$lt", filter.AfterID)))
+	}
+
+	deliveries, err := repository.findDeliveries(ctx, "FindDeliveries", query,
+		findopt.Sort(bson.NewDocument(bson.EC.Int32("_id", -1))),
+		findopt.Limit(filter.Limit))
+	if err != nil {
+		log.Error("could not find the deliveries", logger.Err(err))
+		return nil, err
+	}
+
+	log.Info("deliveries found", logger.Int("length", len(deliveries)))
+	return deliveries, nil
+}
+
+func (repository *MongoWebhookRepository) findDeliveries(ctx context.Context, operation string, query *bson.Document, opts ...findopt.Find) ([]*WebhookDeliveryEntity, error) {
+
+	ctx, cancel := properties.AppProperties.Deadlines.WithDeadline(ctx, operation)
+	defer cancel()
+
+	collection, err := repository.collection(deliveryCollectionName)
+	if err != nil {
+		return nil, err
+	}
+
+	cur, err := collection.Find(ctx, query, opts...)
+	if err != nil {
+		return nil, err
+	}
+	defer cur.Close(ctx)
+
+	deliveries := []*WebhookDeliveryEntity{}
+	for cur.Next(ctx) {
+
+		delivery := WebhookDeliveryEntity{}
+		if err := cur.Decode(&delivery); err != nil {
+			return nil, err
+		}
+
+		deliveries = append(deliveries, &delivery)
+	}
+
+	if err := cur.Err(); err != nil {
+		return nil, err
+	}
+
+	return deliveries, nil
+}
+
+// FindDeliveryByID function to find the delivery by id, return nil when it does not exist
+func (repository *MongoWebhookRepository) FindDeliveryByID(ctx context.Context, id objectid.ObjectID) (*WebhookDeliveryEntity, error) {
+	log := repositoryLogger.WithContext(ctx).With(logger.Function("FindDeliveryByID"), logger.String("id", id.Hex()))
+
+	ctx, cancel := properties.AppProperties.Deadlines.WithDeadline(ctx, "FindDeliveryByID")
+	defer cancel()
+
+	collection, err := repository.collection(deliveryCollectionName)
+	if err != nil {
+		log.Error("could not find the delivery", logger.Err(err))
+		return nil, err
+	}
+
+	delivery := WebhookDeliveryEntity{}
+	err = collection.FindOne(ctx, bson.NewDocument(bson.EC.ObjectID("_id", id))).Decode(&delivery)
+	if err == mongo.ErrNoDocuments {
+		log.Info("delivery not found")
+		return nil, nil
+	}
+
+	if err != nil {
+		log.Error("could not find the delivery", logger.Err(err))
+		return nil, err
+	}
+
+	return &delivery, nil
+}
+
+// RecordDeliveryAttempt function to append the attempt to the delivery and save its status, failures and next attempt,
+// releasing its claim. Return ErrDeliveryClaimLost when the delivery is not under the claim of the delivery anymore,
+// because it was replayed or claimed again meanwhile
+func (repository *MongoWebhookRepository) RecordDeliveryAttempt(ctx context.Context, delivery *WebhookDeliveryEntity, attempt WebhookAttemptEntity) error {
+	log := repositoryLogger.WithContext(ctx).With(logger.Function("RecordDeliveryAttempt"), logger.String("id", delivery.ID.Hex()))
+
+	ctx, cancel := properties.AppProperties.Deadlines.WithDeadline(ctx, "RecordDeliveryAttempt")
+	defer cancel()
+
+	collection, err := repository.collection(deliveryCollectionName)
+	if err != nil {
+		log.Error("could not record the attempt of the delivery", logger.Err(err))
+		return err
+	}
+
+	set := bson.NewDocument(bson.EC.String("status", delivery.Status), bson.EC.Int64("failures", delivery.Failures))
+	unset := bson.NewDocument(bson.EC.String("claimId", ""))
+	if delivery.NextAttemptAt.IsZero() {
+		unset.Append(bson.EC.String("nextAttemptAt", ""))
+	} else {
+		set.Append(bson.EC.Time("nextAttemptAt", delivery.NextAttemptAt))
+	}
+	if !delivery.DeliveredAt.IsZero() {
+		set.Append(bson.EC.Time("deliveredAt", delivery.DeliveredAt))
+	}
+
+	result, err := collection.UpdateOne(ctx,
+		bson.NewDocument(bson.EC.ObjectID("_id", delivery.ID), bson.EC.String("status", deliverySending), bson.EC.String("claimId", delivery.ClaimID)),
+		bson.NewDocument(bson.EC.SubDocument("$set", set), bson.EC.SubDocument("$unset", unset),
+			bson.EC.SubDocumentFromElements("$push", bson.EC.SubDocument("attempts", attemptDocument(attempt)))))
+	if err != nil {
+		log.Error("could not record the attempt of the delivery", logger.Err(err))
+		return err
+	}
+
+	if result.MatchedCount == 0 {
+		return ErrDeliveryClaimLost
+	}
+
+	return nil
+}
+
+// ReplayDelivery function to schedule the delivery to be sent again at nextAttemptAt with no failures, whatever its status,
+// and return it, nil when it does not exist. The claim of a dispatcher sending it is revoked
+func (repository *MongoWebhookRepository) ReplayDelivery(ctx context.Context, id objectid.ObjectID, nextAttemptAt time.Time) (*WebhookDeliveryEntity, error) {
+	log := repositoryLogger.WithContext(ctx).With(logger.Function("ReplayDelivery"), logger.String("id", id.Hex()))
+
+	ctx, cancel := properties.AppProperties.Deadlines.WithDeadline(ctx, "ReplayDelivery")
+	defer cancel()
+
+	collection, err := repository.collection(deliveryCollectionName)
+	if err != nil {
+		log.Error("could not replay the delivery", logger.Err(err))
+		return nil, err
+	}
+
+	delivery := WebhookDeliveryEntity{}
+	err = collection.FindOneAndUpdate(ctx,
+		bson.NewDocument(bson.EC.ObjectID("_id", id)),
+		bson.NewDocument(
+			bson.EC.SubDocumentFromElements("$set",
+				bson.EC.String("status", deliveryPending), bson.EC.Int64("failures", 0), bson.EC.Time("nextAttemptAt", nextAttemptAt)),
+			bson.EC.SubDocumentFromElements("$unset", bson.EC.String("claimId", ""))),
+		findopt.ReturnDocument(mongoopt.After)).Decode(&delivery)
+	if err == mongo.ErrNoDocuments {
+		return nil, nil
+	}
+
+	if err != nil {
+		log.Error("could not replay the delivery", logger.Err(err))
+		return nil, err
+	}
+
+	return &delivery, nil
+}
+
+// attemptDocument the attempt as it's stored in the attempts of the delivery, like WebhookAttemptEntity is encoded
+func attemptDocument(attempt WebhookAttemptEntity) *bson.Document {
+
+	document := bson.NewDocument(bson.EC.Time("at", attempt.At))
+	if attempt.StatusCode != 0 {
+		document.Append(bson.EC.Int64("statusCode", int64(attempt.StatusCode)))
+	}
+	if attempt.Error != "" {
+		document.Append(bson.EC.String("error", attempt.Error))
+	}
+
+	return document.Append(bson.EC.Int64("durationMs", attempt.DurationMs))
+}
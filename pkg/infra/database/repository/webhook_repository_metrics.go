@@ -0,0 +1,96 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/mongodb/mongo-go-driver/bson/objectid"
+
+	"github.com/jcsw/go-api-learn/pkg/infra/metrics"
+)
+
+// InstrumentedWebhookRepository a WebhookRepository that records the latency and the errors of every operation
+type InstrumentedWebhookRepository struct {
+	Repository WebhookRepository
+	Backend    string
+}
+
+// InsertSubscription function to persist the webhook
+func (instrumented *InstrumentedWebhookRepository) InsertSubscription(ctx context.Context, subscription *WebhookSubscriptionEntity) error {
+	done := metrics.StartDatabaseOperation(instrumented.Backend, "InsertSubscription")
+	err := instrumented.Repository.InsertSubscription(ctx, subscription)
+	done(err)
+	return err
+}
+
+// FindSubscriptions function to find all webhooks
+func (instrumented *InstrumentedWebhookRepository) FindSubscriptions(ctx context.Context) ([]*WebhookSubscriptionEntity, error) {
+	done := metrics.StartDatabaseOperation(instrumented.Backend, "FindSubscriptions")
+	subscriptions, err := instrumented.Repository.FindSubscriptions(ctx)
+	done(err)
+	return subscriptions, err
+}
+
+// FindSubscriptionByID function to find the webhook by id
+func (instrumented *InstrumentedWebhookRepository) FindSubscriptionByID(ctx context.Context, id objectid.ObjectID) (*WebhookSubscriptionEntity, error) {
+	done := metrics.StartDatabaseOperation(instrumented.Backend, "FindSubscriptionByID")
+	subscription, err := instrumented.Repository.FindSubscriptionByID(ctx, id)
+	done(err)
+	return subscription, err
+}
+
+// DeleteSubscription function to remove the webhook and its deliveries
+func (instrumented *InstrumentedWebhookRepository) DeleteSubscription(ctx context.Context, id objectid.ObjectID) (bool, error) {
+	done := metrics.StartDatabaseOperation(instrumented.Backend, "DeleteSubscription")
+	deleted, err := instrumented.Repository.DeleteSubscription(ctx, id)
+	done(err)
+	return deleted, err
+}
+
+// InsertDelivery function to persist the delivery
+func (instrumented *InstrumentedWebhookRepository) InsertDelivery(ctx context.Context, delivery *WebhookDeliveryEntity) error {
+	done := metrics.StartDatabaseOperation(instrumented.Backend, "InsertDelivery")
+	err := instrumented.Repository.InsertDelivery(ctx, delivery)
+	done(err)
+	return err
+}
+
+// ClaimDueDelivery function to claim the oldest delivery due at the time
+func (instrumented *InstrumentedWebhookRepository) ClaimDueDelivery(ctx context.Context, dueAt time.Time, leaseUntil time.Time) (*WebhookDeliveryEntity, error) {
+	done := metrics.StartDatabaseOperation(instrumented.Backend, "ClaimDueDelivery")
+	delivery, err := instrumented.Repository.ClaimDueDelivery(ctx, dueAt, leaseUntil)
+	done(err)
+	return delivery, err
+}
+
+// FindDeliveries function to find a page of the deliveries of the webhook
+func (instrumented *InstrumentedWebhookRepository) FindDeliveries(ctx context.Context, subscriptionID objectid.ObjectID, filter DeliveryFilter) ([]*WebhookDeliveryEntity, error) {
+	done := metrics.StartDatabaseOperation(instrumented.Backend, "FindDeliveries")
+	deliveries, err := instrumented.Repository.FindDeliveries(ctx, subscriptionID, filter)
+	done(err)
+	return deliveries, err
+}
+
+// FindDeliveryByID function to find the delivery by id
+func (instrumented *InstrumentedWebhookRepository) FindDeliveryByID(ctx context.Context, id objectid.ObjectID) (*WebhookDeliveryEntity, error) {
+	done := metrics.StartDatabaseOperation(instrumented.Backend, "FindDeliveryByID")
+	delivery, err := instrumented.Repository.FindDeliveryByID(ctx, id)
+	done(err)
+	return delivery, err
+}
+
+// RecordDeliveryAttempt function to append the attempt to the claimed delivery
+func (instrumented *InstrumentedWebhookRepository) RecordDeliveryAttempt(ctx context.Context, delivery *WebhookDeliveryEntity, attempt WebhookAttemptEntity) error {
+	done := metrics.StartDatabaseOperation(instrumented.Backend, "RecordDeliveryAttempt")
+	err := instrumented.Repository.RecordDeliveryAttempt(ctx, delivery, attempt)
+	done(err)
+	return err
+}
+
+// ReplayDelivery function to schedule the delivery to be sent again
+func (instrumented *InstrumentedWebhookRepository) ReplayDelivery(ctx context.Context, id objectid.ObjectID, nextAttemptAt time.Time) (*WebhookDeliveryEntity, error) {
+	done := metrics.StartDatabaseOperation(instrumented.Backend, "ReplayDelivery")
+	delivery, err := instrumented.Repository.ReplayDelivery(ctx, id, nextAttemptAt)
+	done(err)
+	return delivery, err
+}
@@ -0,0 +1,128 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/mongodb/mongo-go-driver/bson/objectid"
+	"github.com/stretchr/testify/mock"
+)
+
+// WebhookRepositoryMock mock to WebhookRepository
+type WebhookRepositoryMock struct {
+	mock.Mock
+}
+
+// InsertSubscription mock to InsertSubscription
+func (m *WebhookRepositoryMock) InsertSubscription(ctx context.Context, subscription *WebhookSubscriptionEntity) error {
+	args := m.Called(ctx, subscription)
+	return args.Error(0)
+}
+
+// FindSubscriptions mock to FindSubscriptions
+func (m *WebhookRepositoryMock) FindSubscriptions(ctx context.Context) ([]*WebhookSubscriptionEntity, error) {
+	args := m.Called(ctx)
+
+	if args.Error(1) != nil {
+		return nil, args.Error(1)
+	}
+
+	if args.Get(0) == nil {
+		return nil, nil
+	}
+
+	return args.Get(0).([]*WebhookSubscriptionEntity), nil
+}
+
+// FindSubscriptionByID mock to FindSubscriptionByID
+func (m *WebhookRepositoryMock) FindSubscriptionByID(ctx context.Context, id objectid.ObjectID) (*WebhookSubscriptionEntity, error) {
+	args := m.Called(ctx, id)
+
+	if args.Error(1) != nil {
+		return nil, args.Error(1)
+	}
+
+	if args.Get(0) == nil {
+		return nil, nil
+	}
+
+	return args.Get(0).(*WebhookSubscriptionEntity), nil
+}
+
+// DeleteSubscription mock to DeleteSubscription
+func (m *WebhookRepositoryMock) DeleteSubscription(ctx context.Context, id objectid.ObjectID) (bool, error) {
+	args := m.Called(ctx, id)
+	return args.Bool(0), args.Error(1)
+}
+
+// InsertDelivery mock to InsertDelivery
+func (m *WebhookRepositoryMock) InsertDelivery(ctx context.Context, delivery *WebhookDeliveryEntity) error {
+	args := m.Called(ctx, delivery)
+	return args.Error(0)
+}
+
+// ClaimDueDelivery mock to ClaimDueDelivery
+func (m *WebhookRepositoryMock) ClaimDueDelivery(ctx context.Context, dueAt time.Time, leaseUntil time.Time) (*WebhookDeliveryEntity, error) {
+	args := m.Called(ctx, dueAt, leaseUntil)
+
+	if args.Error(1) != nil {
+		return nil, args.Error(1)
+	}
+
+	if args.Get(0) == nil {
+		return nil, nil
+	}
+
+	return args.Get(0).(*WebhookDeliveryEntity), nil
+}
+
+// FindDeliveries mock to FindDeliveries
+func (m *WebhookRepositoryMock) FindDeliveries(ctx context.Context, subscriptionID objectid.ObjectID, filter DeliveryFilter) ([]*WebhookDeliveryEntity, error) {
+	args := m.Called(ctx, subscriptionID, filter)
+
+	if args.Error(1) != nil {
+		return nil, args.Error(1)
+	}
+
+	if args.Get(0) == nil {
+		return nil, nil
+	}
+
+	return args.Get(0).([]*WebhookDeliveryEntity), nil
+}
+
+// FindDeliveryByID mock to FindDeliveryByID
+func (m *WebhookRepositoryMock) FindDeliveryByID(ctx context.Context, id objectid.ObjectID) (*WebhookDeliveryEntity, error) {
+	args := m.Called(ctx, id)
+
+	if args.Error(1) != nil {
+		return nil, args.Error(1)
+	}
+
+	if args.Get(0) == nil {
+		return nil, nil
+	}
+
+	return args.Get(0).(*WebhookDeliveryEntity), nil
+}
+
+// RecordDeliveryAttempt mock to RecordDeliveryAttempt
+func (m *WebhookRepositoryMock) RecordDeliveryAttempt(ctx context.Context, delivery *WebhookDeliveryEntity, attempt WebhookAttemptEntity) error {
+	args := m.Called(ctx, delivery, attempt)
+	return args.Error(0)
+}
+
+// ReplayDelivery mock to ReplayDelivery
+func (m *WebhookRepositoryMock) ReplayDelivery(ctx context.Context, id objectid.ObjectID, nextAttemptAt time.Time) (*WebhookDeliveryEntity, error) {
+	args := m.Called(ctx, id, nextAttemptAt)
+
+	if args.Error(1) != nil {
+		return nil, args.Error(1)
+	}
+
+	if args.Get(0) == nil {
+		return nil, nil
+	}
+
+	return args.Get(0).(*WebhookDeliveryEntity), nil
+}
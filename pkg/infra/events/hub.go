@@ -0,0 +1,175 @@
+package events
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+const (
+	defaultHubBufferSize     = 1000
+	defaultHubMaxSubscribers = 100
+
+	// subscriberQueueSize the events a subscriber may fall behind before it's dropped
+	subscriberQueueSize = 64
+)
+
+var (
+	// ErrTooManySubscribers Error for a subscription when the hub already has its maximum of subscribers
+	ErrTooManySubscribers = errors.New("too many subscribers")
+
+	// ErrHubClosed Error for a subscription when the hub was closed
+	ErrHubClosed = errors.New("hub closed")
+)
+
+// Hub an EventPublisher that sends the events to its live subscribers and keeps the last ones in a ring buffer,
+// so a subscriber that reconnects resumes after the last event it received. The hub is only in memory, the events
+// published before the start of the process or pushed out of the buffer are not replayed
+type Hub struct {
+	mutex          sync.Mutex
+	buffer         []*Event
+	next           int
+	length         int
+	maxSubscribers int
+	subscribers    map[*Subscription]struct{}
+	closed         bool
+}
+
+// Subscription the events sent to a subscriber of the hub, the channel is closed when the subscription is closed
+// or when the subscriber does not keep up with the events
+type Subscription struct {
+	hub    *Hub
+	events chan *Event
+}
+
+// NewHub create a Hub keeping the last bufferSize events and accepting up to maxSubscribers, zero uses the defaults
+func NewHub(bufferSize int, maxSubscribers int) *Hub {
+
+	if bufferSize <= 0 {
+		bufferSize = defaultHubBufferSize
+	}
+
+	if maxSubscribers <= 0 {
+		maxSubscribers = defaultHubMaxSubscribers
+	}
+
+	return &Hub{
+		buffer:         make([]*Event, bufferSize),
+		maxSubscribers: maxSubscribers,
+		subscribers:    map[*Subscription]struct{}{},
+	}
+}
+
+// Publish keep the event in the buffer and send it to every subscriber, a subscriber that is not keeping up is dropped
+func (hub *Hub) Publish(ctx context.Context, event *Event) error {
+
+	hub.mutex.Lock()
+	defer hub.mutex.Unlock()
+
+	hub.buffer[hub.next] = event
+	hub.next = (hub.next + 1) % len(hub.buffer)
+	if hub.length < len(hub.buffer) {
+		hub.length++
+	}
+
+	for subscription := range hub.subscribers {
+		select {
+		case subscription.events <- event:
+		default:
+			hub.remove(subscription)
+		}
+	}
+
+	return nil
+}
+
+// Subscribe add a subscriber that receives the events published from now on. With the id of the last event received,
+// it first receives the buffered events published after that one, or all of them when the id is not in the buffer anymore
+func (hub *Hub) Subscribe(lastEventID string) (*Subscription, error) {
+
+	hub.mutex.Lock()
+	defer hub.mutex.Unlock()
+
+	if hub.closed {
+		return nil, ErrHubClosed
+	}
+
+	if len(hub.subscribers) >= hub.maxSubscribers {
+		return nil, ErrTooManySubscribers
+	}
+
+	missed := []*Event{}
+	if lastEventID != "" {
+		missed = hub.eventsAfter(lastEventID)
+	}
+
+	subscription := &Subscription{hub: hub, events: make(chan *Event, len(missed)+subscriberQueueSize)}
+	for _, event := range missed {
+		subscription.events <- event
+	}
+
+	hub.subscribers[subscription] = struct{}{}
+	return subscription, nil
+}
+
+// Subscribers return the number of live subscribers
+func (hub *Hub) Subscribers() int {
+
+	hub.mutex.Lock()
+	defer hub.mutex.Unlock()
+
+	return len(hub.subscribers)
+}
+
+// Close close the channel of every subscriber and refuse the new ones, so the subscribers return on shutdown
+func (hub *Hub) Close() {
+
+	hub.mutex.Lock()
+	defer hub.mutex.Unlock()
+
+	hub.closed = true
+	for subscription := range hub.subscribers {
+		hub.remove(subscription)
+	}
+}
+
+// eventsAfter return the buffered events published after the event with the id, the oldest first
+func (hub *Hub) eventsAfter(id string) []*Event {
+
+	oldest := (hub.next - hub.length + len(hub.buffer)) % len(hub.buffer)
+
+	buffered := make([]*Event, hub.length)
+	for i := range buffered {
+		buffered[i] = hub.buffer[(oldest+i)%len(hub.buffer)]
+	}
+
+	for i := len(buffered) - 1; i >= 0; i-- {
+		if buffered[i].ID == id {
+			return buffered[i+1:]
+		}
+	}
+
+	return buffered
+}
+
+// remove drop the subscription and close its channel, it must be called with the lock held
+func (hub *Hub) remove(subscription *Subscription) {
+	if _, ok := hub.subscribers[subscription]; ok {
+		delete(hub.subscribers, subscription)
+		close(subscription.events)
+	}
+}
+
+// Events return the channel of the events sent to the subscriber
+func (subscription *Subscription) Events() <-chan *Event {
+	return subscription.events
+}
+
+// Close remove the subscriber from the hub, it can be called more than once
+func (subscription *Subscription) Close() {
+
+	subscription.hub.mutex.Lock()
+	defer subscription.hub.mutex.Unlock()
+
+	subscription.hub.remove(subscription)
+}
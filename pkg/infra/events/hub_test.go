@@ -0,0 +1,125 @@
+package events
+
+import (
+	"context"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func publishEvents(hub *Hub, ids ...int) {
+	for _, id := range ids {
+		hub.Publish(context.Background(), &Event{ID: strconv.Itoa(id), Type: "CustomerUpdated"})
+	}
+}
+
+func receivedIDs(subscription *Subscription) []string {
+	ids := []string{}
+	for {
+		select {
+		case event, ok := <-subscription.Events():
+			if !ok {
+				return ids
+			}
+			ids = append(ids, event.ID)
+		default:
+			return ids
+		}
+	}
+}
+
+func TestShouldSendPublishedEventsToEverySubscriber(t *testing.T) {
+
+	hub := NewHub(10, 10)
+	publishEvents(hub, 1)
+
+	first, err := hub.Subscribe("")
+	assert.NoError(t, err)
+	second, err := hub.Subscribe("")
+	assert.NoError(t, err)
+
+	publishEvents(hub, 2, 3)
+
+	assert.Equal(t, []string{"2", "3"}, receivedIDs(first))
+	assert.Equal(t, []string{"2", "3"}, receivedIDs(second))
+}
+
+func TestShouldResumeAfterTheLastEventReceived(t *testing.T) {
+
+	tests := []struct {
+		description string
+		lastEventID string
+		expectedIDs []string
+	}{
+		{"should replay the events after the last one", "3", []string{"4", "5"}},
+		{"should replay nothing when the last one is the newest", "5", []string{}},
+		{"should replay the whole buffer when the last one was pushed out", "1", []string{"3", "4", "5"}},
+	}
+
+	for _, tc := range tests {
+
+		hub := NewHub(3, 10)
+		publishEvents(hub, 1, 2, 3, 4, 5)
+
+		subscription, err := hub.Subscribe(tc.lastEventID)
+		assert.NoError(t, err, tc.description)
+		assert.Equal(t, tc.expectedIDs, receivedIDs(subscription), tc.description)
+	}
+}
+
+func TestShouldRefuseSubscribersAboveTheMaximum(t *testing.T) {
+
+	hub := NewHub(10, 1)
+
+	subscription, err := hub.Subscribe("")
+	assert.NoError(t, err)
+
+	_, err = hub.Subscribe("")
+	assert.Equal(t, ErrTooManySubscribers, err)
+
+	subscription.Close()
+	subscription.Close()
+	assert.Equal(t, 0, hub.Subscribers())
+
+	_, err = hub.Subscribe("")
+	assert.NoError(t, err)
+}
+
+func TestShouldDropSubscriberThatDoesNotKeepUp(t *testing.T) {
+
+	hub := NewHub(10, 10)
+
+	subscription, err := hub.Subscribe("")
+	assert.NoError(t, err)
+
+	for i := 0; i <= subscriberQueueSize; i++ {
+		publishEvents(hub, i)
+	}
+
+	assert.Equal(t, 0, hub.Subscribers())
+	assert.Len(t, receivedIDs(subscription), subscriberQueueSize)
+
+	_, open := <-subscription.Events()
+	assert.False(t, open)
+}
+
+func TestShouldCloseEverySubscriberWhenTheHubIsClosed(t *testing.T) {
+
+	hub := NewHub(10, 10)
+
+	subscription, err := hub.Subscribe("")
+	assert.NoError(t, err)
+
+	hub.Close()
+
+	_, open := <-subscription.Events()
+	assert.False(t, open)
+	assert.Equal(t, 0, hub.Subscribers())
+
+	_, err = hub.Subscribe("")
+	assert.Equal(t, ErrHubClosed, err)
+
+	subscription.Close()
+	publishEvents(hub, 1)
+}
@@ -0,0 +1,43 @@
+package events
+
+import (
+	"context"
+	"sync"
+)
+
+// MemoryPublisher an EventPublisher that keeps the events in memory, meant for tests.
+// While it fails, set by FailWith, nothing is kept
+type MemoryPublisher struct {
+	mutex     sync.Mutex
+	published []*Event
+	err       error
+}
+
+// Publish keep the event, or fail with the error set by FailWith
+func (publisher *MemoryPublisher) Publish(ctx context.Context, event *Event) error {
+	publisher.mutex.Lock()
+	defer publisher.mutex.Unlock()
+
+	if publisher.err != nil {
+		return publisher.err
+	}
+
+	publisher.published = append(publisher.published, event)
+	return nil
+}
+
+// FailWith make the next publications fail with err, nil makes them succeed again
+func (publisher *MemoryPublisher) FailWith(err error) {
+	publisher.mutex.Lock()
+	defer publisher.mutex.Unlock()
+
+	publisher.err = err
+}
+
+// Events return the events published so far, in the order they were published
+func (publisher *MemoryPublisher) Events() []*Event {
+	publisher.mutex.Lock()
+	defer publisher.mutex.Unlock()
+
+	return append([]*Event(nil), publisher.published...)
+}
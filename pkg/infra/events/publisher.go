@@ -0,0 +1,39 @@
+package events
+
+import (
+	"context"
+	"time"
+
+	"github.com/jcsw/go-api-learn/pkg/infra/logger"
+)
+
+var eventsLogger = logger.With(logger.Package("events"))
+
+// Event an event ready to be published, Key identifies what it's about and Payload is the event encoded as JSON.
+// The delivery is at least once, so the consumers must ignore an ID they already received
+type Event struct {
+	ID         string
+	Type       string
+	Key        string
+	OccurredAt time.Time
+	Payload    []byte
+}
+
+// EventPublisher publish the events to the systems that react to them
+type EventPublisher interface {
+	Publish(ctx context.Context, event *Event) error
+}
+
+// LogPublisher an EventPublisher that only logs the events
+type LogPublisher struct{}
+
+// Publish log the event
+func (publisher *LogPublisher) Publish(ctx context.Context, event *Event) error {
+	eventsLogger.WithContext(ctx).Info("event published",
+		logger.Function("LogPublisher"),
+		logger.String("id", event.ID),
+		logger.String("type", event.Type),
+		logger.String("key", event.Key),
+		logger.String("payload", string(event.Payload)))
+	return nil
+}
@@ -0,0 +1,198 @@
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sync/atomic"
+	"time"
+
+	"github.com/jcsw/go-api-learn/pkg/infra/database/repository"
+	"github.com/jcsw/go-api-learn/pkg/infra/logger"
+)
+
+var jobsLogger = logger.With(logger.Package("jobs"))
+
+// now the clock of the jobs, replaced by the tests
+var now = time.Now
+
+var (
+	// ErrJobNotFound Error for a job that does not exist
+	ErrJobNotFound = errors.New("job not found")
+
+	// ErrUnknownKind Error for a job of a kind without a registered handler
+	ErrUnknownKind = errors.New("unknown job kind")
+)
+
+// Job the status of a job, Result is the value returned by its handler encoded as JSON
+type Job struct {
+	ID         string          `json:"id"`
+	Kind       string          `json:"kind"`
+	State      string          `json:"state"`
+	Progress   Progress        `json:"progress"`
+	Result     json.RawMessage `json:"result,omitempty"`
+	Error      string          `json:"error,omitempty"`
+	Attempts   int64           `json:"attempts"`
+	CreatedAt  time.Time       `json:"createdAt"`
+	StartedAt  *time.Time      `json:"startedAt,omitempty"`
+	FinishedAt *time.Time      `json:"finishedAt,omitempty"`
+}
+
+// Progress the units of work done by a job out of the total, zero while the handler did not report it
+type Progress struct {
+	Done  int64 `json:"done"`
+	Total int64 `json:"total"`
+}
+
+// Handler run a job of a kind, the value returned is kept as its result. The handler must return when ctx is done,
+// that's how it learns the job was canceled or the pool is stopping
+type Handler func(ctx context.Context, task *Task) (interface{}, error)
+
+// Task the job given to a handler
+type Task struct {
+	ID   string
+	Kind string
+
+	entity   *repository.JobEntity
+	part     *repository.JobPartEntity
+	pool     *Pool
+	cancel   context.CancelFunc
+	canceled int32
+	lost     int32
+}
+
+// Decode decode the payload of the job into value
+func (task *Task) Decode(value interface{}) error {
+	return json.Unmarshal([]byte(task.entity.Payload), value)
+}
+
+// Progress record the progress of the job, it cancels the context of the handler when the job was canceled meanwhile
+func (task *Task) Progress(done int, total int) {
+	task.record(done, total, nil)
+}
+
+// NextPart decode the first part of the input not done into value, return false when all the parts are done.
+// A job queued again starts from the part following the last one completed by the earlier attempts
+func (task *Task) NextPart(ctx context.Context, value interface{}) (bool, error) {
+
+	parts, err := task.pool.Repository.FindJobParts(ctx, task.entity.ID, task.entity.Offset, 1)
+	if err != nil {
+		return false, err
+	}
+
+	if len(parts) == 0 {
+		task.part = nil
+		return false, nil
+	}
+
+	task.part = parts[0]
+	return true, json.Unmarshal([]byte(task.part.Input), value)
+}
+
+// CompletePart record the result of the part returned by NextPart and the counters of the job so far, encoded as
+// JSON, with its progress. The counters are returned by Counters to a job queued again. It cancels the context of
+// the handler when the job was canceled meanwhile or it's not running under this pool anymore
+func (task *Task) CompletePart(done int, total int, result interface{}, counters interface{}) {
+	log := jobsLogger.With(logger.Function("CompletePart"), logger.String("id", task.ID))
+
+	part := task.part
+	if part == nil {
+		log.Warn("no part of the job to complete")
+		task.record(done, total, nil)
+		return
+	}
+	task.part = nil
+
+	encodedResult, err := json.Marshal(result)
+	if err != nil {
+		log.Error("could not encode the result of the part", logger.Err(err))
+	}
+	part.Result = string(encodedResult)
+
+	encodedCounters, err := json.Marshal(counters)
+	if err != nil {
+		log.Error("could not encode the counters of the job", logger.Err(err))
+	}
+	task.entity.Counters = string(encodedCounters)
+	task.entity.Offset = part.Seq + 1
+
+	task.record(done, total, part)
+}
+
+// Counters decode the counters recorded by the earlier attempts of the job into value, return false when none was
+func (task *Task) Counters(value interface{}) (bool, error) {
+
+	if task.entity.Counters == "" {
+		return false, nil
+	}
+
+	return true, json.Unmarshal([]byte(task.entity.Counters), value)
+}
+
+func (task *Task) record(done int, total int, part *repository.JobPartEntity) {
+	log := jobsLogger.With(logger.Function("Progress"), logger.String("id", task.ID))
+
+	task.entity.Done, task.entity.Total = int64(done), int64(total)
+
+	cancelRequested, err := task.pool.Repository.UpdateJobProgress(context.Background(), task.entity, part, now().Add(task.pool.leaseDuration()))
+	if err == repository.ErrJobLeaseLost {
+		task.markLost()
+		return
+	}
+
+	if err != nil {
+		log.Warn("could not record the progress of the job", logger.Err(err))
+		return
+	}
+
+	if cancelRequested {
+		task.markCanceled()
+	}
+}
+
+func (task *Task) markCanceled() {
+	atomic.StoreInt32(&task.canceled, 1)
+	task.cancel()
+}
+
+func (task *Task) isCanceled() bool {
+	return atomic.LoadInt32(&task.canceled) == 1
+}
+
+func (task *Task) markLost() {
+	atomic.StoreInt32(&task.lost, 1)
+	task.cancel()
+}
+
+func (task *Task) isLost() bool {
+	return atomic.LoadInt32(&task.lost) == 1
+}
+
+func makeJobByEntity(entity *repository.JobEntity) *Job {
+
+	job := &Job{
+		ID:        entity.ID.Hex(),
+		Kind:      entity.Kind,
+		State:     entity.State,
+		Progress:  Progress{Done: entity.Done, Total: entity.Total},
+		Error:     entity.Error,
+		Attempts:  entity.Attempts,
+		CreatedAt: entity.CreatedAt,
+	}
+
+	if entity.Result != "" {
+		job.Result = json.RawMessage(entity.Result)
+	}
+
+	if !entity.StartedAt.IsZero() {
+		startedAt := entity.StartedAt
+		job.StartedAt = &startedAt
+	}
+
+	if !entity.FinishedAt.IsZero() {
+		finishedAt := entity.FinishedAt
+		job.FinishedAt = &finishedAt
+	}
+
+	return job
+}
@@ -0,0 +1,452 @@
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/mongodb/mongo-go-driver/bson/objectid"
+
+	"github.com/jcsw/go-api-learn/pkg/infra/database/repository"
+	"github.com/jcsw/go-api-learn/pkg/infra/logger"
+)
+
+const (
+	defaultWorkers       = 4
+	defaultPollInterval  = time.Second
+	defaultMaxAttempts   = 3
+	defaultLeaseDuration = 30 * time.Second
+)
+
+// Pool run the jobs stored in the repository on a bounded number of workers. A job is persisted before it's run
+// and it's leased to the pool identified by ID while it runs, the pool renews the lease until the job finishes.
+// A job whose lease expired, because its pool stopped or could not reach the repository, is queued again by
+// any pool sharing the repository, until it was tried MaxAttempts times. The fields left zero use the defaults,
+// the ID is generated on Start
+type Pool struct {
+	ID            string
+	Repository    repository.JobRepository
+	Workers       int
+	PollInterval  time.Duration
+	MaxAttempts   int64
+	LeaseDuration time.Duration
+
+	mutex    sync.Mutex
+	handlers map[string]Handler
+	running  map[string]*Task
+	wake     chan struct{}
+	stopping context.CancelFunc
+	abort    context.CancelFunc
+	workers  sync.WaitGroup
+}
+
+// Register set the handler of the jobs of the kind, it must be called before Start
+func (pool *Pool) Register(kind string, handler Handler) {
+
+	pool.mutex.Lock()
+	defer pool.mutex.Unlock()
+
+	if pool.handlers == nil {
+		pool.handlers = map[string]Handler{}
+	}
+	pool.handlers[kind] = handler
+}
+
+// Enqueue persist a job of the kind with the payload and the parts of its input encoded as JSON and wake a worker
+// to run it. The parts are stored apart from the job, the handler reads them one at a time with NextPart
+func (pool *Pool) Enqueue(ctx context.Context, kind string, payload interface{}, parts ...interface{}) (*Job, error) {
+
+	if pool.handler(kind) == nil {
+		return nil, ErrUnknownKind
+	}
+
+	encoded, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+
+	partEntities := make([]*repository.JobPartEntity, 0, len(parts))
+	for seq, part := range parts {
+		input, err := json.Marshal(part)
+		if err != nil {
+			return nil, err
+		}
+		partEntities = append(partEntities, &repository.JobPartEntity{Seq: int64(seq), Input: string(input)})
+	}
+
+	entity := &repository.JobEntity{Kind: kind, State: repository.JobQueued, Payload: string(encoded), CreatedAt: now()}
+	if err := pool.Repository.InsertJob(ctx, entity, partEntities); err != nil {
+		return nil, err
+	}
+
+	select {
+	case pool.wakeChannel() <- struct{}{}:
+	default:
+	}
+
+	return makeJobByEntity(entity), nil
+}
+
+// Find return the job by id
+func (pool *Pool) Find(ctx context.Context, id string) (*Job, error) {
+
+	jobID, err := objectid.FromHex(id)
+	if err != nil {
+		return nil, ErrJobNotFound
+	}
+
+	entity, err := pool.Repository.FindJobByID(ctx, jobID)
+	if err != nil {
+		return nil, err
+	}
+
+	if entity == nil {
+		return nil, ErrJobNotFound
+	}
+
+	return makeJobByEntity(entity), nil
+}
+
+// Results return the results of the parts of the job completed by its handler, from the part at the offset up
+// to limit, in the order of the input
+func (pool *Pool) Results(ctx context.Context, id string, offset int64, limit int64) ([]json.RawMessage, error) {
+
+	jobID, err := objectid.FromHex(id)
+	if err != nil {
+		return nil, ErrJobNotFound
+	}
+
+	entity, err := pool.Repository.FindJobByID(ctx, jobID)
+	if err != nil {
+		return nil, err
+	}
+
+	if entity == nil {
+		return nil, ErrJobNotFound
+	}
+
+	parts, err := pool.Repository.FindJobParts(ctx, jobID, offset, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]json.RawMessage, 0, len(parts))
+	for _, part := range parts {
+		if part.Result == "" {
+			break
+		}
+		results = append(results, json.RawMessage(part.Result))
+	}
+
+	return results, nil
+}
+
+// Cancel cancel the job, a queued job is canceled right away and a running one when its handler returns.
+// A finished job is returned as is
+func (pool *Pool) Cancel(ctx context.Context, id string) (*Job, error) {
+
+	jobID, err := objectid.FromHex(id)
+	if err != nil {
+		return nil, ErrJobNotFound
+	}
+
+	entity, err := pool.Repository.CancelJob(ctx, jobID, now())
+	if err != nil {
+		return nil, err
+	}
+
+	if entity == nil {
+		return nil, ErrJobNotFound
+	}
+
+	if entity.State == repository.JobRunning && entity.CancelRequested {
+		pool.mutex.Lock()
+		task := pool.running[id]
+		pool.mutex.Unlock()
+
+		if task != nil {
+			task.markCanceled()
+		}
+	}
+
+	return makeJobByEntity(entity), nil
+}
+
+// Start queue again the jobs whose lease expired and start the workers, they claim the queued jobs until Stop.
+// The expired jobs are queued again every lease duration while the pool runs
+func (pool *Pool) Start(ctx context.Context) {
+
+	pool.mutex.Lock()
+	if pool.ID == "" {
+		pool.ID = objectid.New().Hex()
+	}
+	pool.mutex.Unlock()
+
+	jobsLogger.WithContext(ctx).Info("starting the jobs pool", logger.Function("Start"), logger.String("owner", pool.ID))
+	pool.requeueExpired(ctx)
+
+	claimCtx, stopping := context.WithCancel(ctx)
+	jobsCtx, abort := context.WithCancel(ctx)
+
+	pool.mutex.Lock()
+	pool.stopping, pool.abort = stopping, abort
+	pool.mutex.Unlock()
+
+	workers := pool.Workers
+	if workers <= 0 {
+		workers = defaultWorkers
+	}
+
+	pool.workers.Add(workers + 1)
+	for i := 0; i < workers; i++ {
+		go pool.work(claimCtx, jobsCtx)
+	}
+	go pool.reap(claimCtx)
+}
+
+// Stop stop claiming jobs and wait for the running ones until ctx is done, then cancel them.
+// The jobs canceled this way are left running, they're queued again once their lease expires
+func (pool *Pool) Stop(ctx context.Context) {
+
+	pool.mutex.Lock()
+	stopping, abort := pool.stopping, pool.abort
+	pool.mutex.Unlock()
+
+	if stopping == nil {
+		return
+	}
+	stopping()
+
+	drained := make(chan struct{})
+	go func() {
+		pool.workers.Wait()
+		close(drained)
+	}()
+
+	select {
+	case <-drained:
+	case <-ctx.Done():
+		jobsLogger.WithContext(ctx).Warn("jobs still running on stop, they will be queued again when their lease expires", logger.Function("Stop"))
+		abort()
+		<-drained
+	}
+
+	abort()
+}
+
+// reap queue again the jobs whose lease expired every lease duration, until ctx is done
+func (pool *Pool) reap(ctx context.Context) {
+	defer pool.workers.Done()
+
+	ticker := time.NewTicker(pool.leaseDuration())
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			pool.requeueExpired(ctx)
+		}
+	}
+}
+
+func (pool *Pool) requeueExpired(ctx context.Context) {
+	log := jobsLogger.WithContext(ctx).With(logger.Function("requeueExpired"))
+
+	if requeued, err := pool.Repository.RequeueExpiredJobs(ctx, pool.maxAttempts(), now()); err != nil {
+		log.Error("could not requeue the expired jobs", logger.Err(err))
+	} else if requeued > 0 {
+		log.Info("jobs whose lease expired were queued again", logger.Int64("length", requeued))
+	}
+}
+
+// work claim and run the queued jobs, it waits for an Enqueue or the poll interval when there is none
+func (pool *Pool) work(claimCtx context.Context, jobsCtx context.Context) {
+	defer pool.workers.Done()
+
+	pollInterval := pool.PollInterval
+	if pollInterval <= 0 {
+		pollInterval = defaultPollInterval
+	}
+
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+
+	for claimCtx.Err() == nil {
+
+		startedAt := now()
+		entity, err := pool.Repository.ClaimJob(claimCtx, pool.ID, startedAt, startedAt.Add(pool.leaseDuration()))
+		if err != nil {
+			jobsLogger.WithContext(claimCtx).Error("could not claim a job", logger.Function("work"), logger.Err(err))
+		}
+
+		if entity != nil {
+			pool.run(jobsCtx, entity)
+			continue
+		}
+
+		select {
+		case <-claimCtx.Done():
+		case <-pool.wakeChannel():
+		case <-ticker.C:
+		}
+	}
+}
+
+// run run the job with the handler of its kind and record how it finished, a panic fails the job.
+// The lease of the job is renewed while the handler runs, the handler is canceled when the lease is lost
+func (pool *Pool) run(ctx context.Context, entity *repository.JobEntity) {
+	log := jobsLogger.WithContext(ctx).With(logger.Function("run"), logger.String("id", entity.ID.Hex()), logger.String("kind", entity.Kind))
+
+	taskCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	task := &Task{ID: entity.ID.Hex(), Kind: entity.Kind, entity: entity, pool: pool, cancel: cancel}
+
+	pool.mutex.Lock()
+	if pool.running == nil {
+		pool.running = map[string]*Task{}
+	}
+	pool.running[task.ID] = task
+	pool.mutex.Unlock()
+
+	defer func() {
+		pool.mutex.Lock()
+		delete(pool.running, task.ID)
+		pool.mutex.Unlock()
+	}()
+
+	renewCtx, stopRenewing := context.WithCancel(ctx)
+	renewed := make(chan struct{})
+	go func() {
+		defer close(renewed)
+		pool.renew(renewCtx, task)
+	}()
+
+	startedAt := now()
+	result, err := pool.call(taskCtx, task)
+
+	stopRenewing()
+	<-renewed
+
+	if task.isLost() {
+		log.Warn("job lease lost, its end is not recorded", logger.Err(err))
+		return
+	}
+
+	if err != nil && !task.isCanceled() && ctx.Err() != nil {
+		log.Warn("job interrupted by the stop, it will be queued again when its lease expires", logger.Err(err))
+		return
+	}
+
+	// a handler that finished before it saw the cancellation still succeeds or fails
+	switch {
+	case err != nil && task.isCanceled():
+		entity.State = repository.JobCanceled
+	case err != nil:
+		entity.State = repository.JobFailed
+		entity.Error = err.Error()
+	default:
+		entity.State = repository.JobSucceeded
+	}
+
+	if result != nil {
+		encoded, encodeErr := json.Marshal(result)
+		if encodeErr != nil {
+			log.Error("could not encode the result of the job", logger.Err(encodeErr))
+		}
+		entity.Result = string(encoded)
+	}
+
+	entity.FinishedAt = now()
+	if err := pool.Repository.FinishJob(context.Background(), entity); err == repository.ErrJobLeaseLost {
+		log.Warn("job lease lost before its end was recorded", logger.String("state", entity.State))
+		return
+	} else if err != nil {
+		log.Error("could not record the end of the job", logger.Err(err))
+		return
+	}
+
+	log.Info("job finished", logger.String("state", entity.State), logger.Duration("duration", entity.FinishedAt.Sub(startedAt)))
+}
+
+// renew renew the lease of the task every third of the lease duration until ctx is done, the task is canceled
+// when its cancellation was requested and marked lost when the lease was lost
+func (pool *Pool) renew(ctx context.Context, task *Task) {
+
+	ticker := time.NewTicker(pool.leaseDuration() / 3)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		cancelRequested, err := pool.Repository.RenewJobLease(ctx, task.entity.ID, task.entity.OwnerID, now().Add(pool.leaseDuration()))
+		if err == repository.ErrJobLeaseLost {
+			task.markLost()
+			return
+		}
+
+		if err != nil {
+			jobsLogger.WithContext(ctx).Warn("could not renew the lease of the job", logger.Function("renew"), logger.String("id", task.ID), logger.Err(err))
+			continue
+		}
+
+		if cancelRequested {
+			task.markCanceled()
+		}
+	}
+}
+
+// call call the handler of the task, recovering from its panic
+func (pool *Pool) call(ctx context.Context, task *Task) (result interface{}, err error) {
+
+	handler := pool.handler(task.Kind)
+	if handler == nil {
+		return nil, ErrUnknownKind
+	}
+
+	defer func() {
+		if recovered := recover(); recovered != nil {
+			result, err = nil, fmt.Errorf("job panicked: %v", recovered)
+		}
+	}()
+
+	return handler(ctx, task)
+}
+
+func (pool *Pool) handler(kind string) Handler {
+	pool.mutex.Lock()
+	defer pool.mutex.Unlock()
+	return pool.handlers[kind]
+}
+
+func (pool *Pool) wakeChannel() chan struct{} {
+	pool.mutex.Lock()
+	defer pool.mutex.Unlock()
+
+	if pool.wake == nil {
+		pool.wake = make(chan struct{}, 1)
+	}
+	return pool.wake
+}
+
+func (pool *Pool) leaseDuration() time.Duration {
+	if pool.LeaseDuration <= 0 {
+		return defaultLeaseDuration
+	}
+	return pool.LeaseDuration
+}
+
+func (pool *Pool) maxAttempts() int64 {
+	if pool.MaxAttempts <= 0 {
+		return defaultMaxAttempts
+	}
+	return pool.MaxAttempts
+}
@@ -0,0 +1,337 @@
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/mongodb/mongo-go-driver/bson/objectid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+
+	"github.com/jcsw/go-api-learn/pkg/infra/database/repository"
+)
+
+func freezeNow(t *testing.T) time.Time {
+
+	frozen := time.Date(2018, 10, 8, 12, 0, 0, 0, time.UTC)
+	previous := now
+	now = func() time.Time { return frozen }
+	t.Cleanup(func() { now = previous })
+	return frozen
+}
+
+// noPart the part recorded with a progress that completes none
+var noPart = (*repository.JobPartEntity)(nil)
+
+func newRunningJob(kind string, payload string) *repository.JobEntity {
+	return &repository.JobEntity{ID: objectid.New(), Kind: kind, State: repository.JobRunning, Payload: payload, Attempts: 1}
+}
+
+// onFinishJob send to the channel returned the jobs recorded by FinishJob
+func onFinishJob(repositoryMock *repository.JobRepositoryMock) chan *repository.JobEntity {
+
+	finished := make(chan *repository.JobEntity, 1)
+	repositoryMock.On("FinishJob", mock.Anything, mock.Anything).Return(nil).Run(func(args mock.Arguments) {
+		finished <- args.Get(1).(*repository.JobEntity)
+	})
+
+	return finished
+}
+
+// finishedJob return the next job finished, it fails the test when no job finishes in time
+func finishedJob(t *testing.T, finished chan *repository.JobEntity) *repository.JobEntity {
+
+	select {
+	case job := <-finished:
+		return job
+	case <-time.After(time.Second):
+		t.Fatal("no job finished")
+		return nil
+	}
+}
+
+func TestShouldPersistTheJobBeforeRunningIt(t *testing.T) {
+
+	createdAt := freezeNow(t)
+
+	repositoryMock := &repository.JobRepositoryMock{}
+	repositoryMock.On("InsertJob", mock.Anything, mock.Anything, mock.Anything).Return(nil)
+
+	pool := &Pool{Repository: repositoryMock}
+	pool.Register("customer.purge", func(context.Context, *Task) (interface{}, error) { return nil, nil })
+
+	job, err := pool.Enqueue(context.Background(), "customer.purge", map[string]int{"olderThanDays": 30}, []int{1, 2}, []int{3})
+
+	assert.NoError(t, err)
+	assert.Equal(t, "customer.purge", job.Kind)
+	assert.Equal(t, repository.JobQueued, job.State)
+	assert.Equal(t, createdAt, job.CreatedAt)
+
+	inserted := repositoryMock.Calls[0].Arguments.Get(1).(*repository.JobEntity)
+	assert.Equal(t, `{"olderThanDays":30}`, inserted.Payload)
+
+	parts := repositoryMock.Calls[0].Arguments.Get(2).([]*repository.JobPartEntity)
+	assert.Len(t, parts, 2)
+	assert.Equal(t, int64(0), parts[0].Seq)
+	assert.Equal(t, "[1,2]", parts[0].Input)
+	assert.Equal(t, int64(1), parts[1].Seq)
+	assert.Equal(t, "[3]", parts[1].Input)
+
+	_, err = pool.Enqueue(context.Background(), "customer.reindex", nil)
+	assert.Equal(t, ErrUnknownKind, err)
+	repositoryMock.AssertNumberOfCalls(t, "InsertJob", 1)
+}
+
+func TestShouldRequeueTheExpiredJobsAndRunTheQueuedOnes(t *testing.T) {
+
+	startedAt := freezeNow(t)
+	leaseUntil := startedAt.Add(defaultLeaseDuration)
+	claimed := newRunningJob("customer.import", `{"rows":2}`)
+
+	repositoryMock := &repository.JobRepositoryMock{}
+	repositoryMock.On("RequeueExpiredJobs", mock.Anything, int64(defaultMaxAttempts), startedAt).Return(int64(1), nil)
+	repositoryMock.On("ClaimJob", mock.Anything, "pool-1", startedAt, leaseUntil).Return(claimed, nil).Once()
+	repositoryMock.On("ClaimJob", mock.Anything, "pool-1", startedAt, leaseUntil).Return(nil, nil)
+	repositoryMock.On("UpdateJobProgress", mock.Anything, claimed, noPart, leaseUntil).Return(false, nil)
+
+	finished := onFinishJob(repositoryMock)
+
+	pool := &Pool{ID: "pool-1", Repository: repositoryMock, Workers: 1, PollInterval: time.Millisecond}
+	pool.Register("customer.import", func(ctx context.Context, task *Task) (interface{}, error) {
+		payload := struct{ Rows int }{}
+		if err := task.Decode(&payload); err != nil {
+			return nil, err
+		}
+
+		task.Progress(1, payload.Rows)
+		return map[string]int{"imported": 1}, nil
+	})
+
+	pool.Start(context.Background())
+	job := finishedJob(t, finished)
+	pool.Stop(context.Background())
+
+	assert.Equal(t, repository.JobSucceeded, job.State)
+	assert.Equal(t, `{"imported":1}`, job.Result)
+	assert.Equal(t, int64(1), job.Done)
+	assert.Equal(t, int64(2), job.Total)
+	assert.False(t, job.FinishedAt.IsZero())
+	repositoryMock.AssertCalled(t, "RequeueExpiredJobs", mock.Anything, int64(defaultMaxAttempts), startedAt)
+}
+
+func TestShouldFailTheJobWhenTheHandlerFails(t *testing.T) {
+
+	tests := []struct {
+		description   string
+		kind          string
+		expectedError string
+	}{
+		{"should fail with the error of the handler", "failing", "connection refused"},
+		{"should fail when the handler panics", "panicking", "job panicked: index out of range"},
+		{"should fail when the kind has no handler", "unknown", "unknown job kind"},
+	}
+
+	pool := &Pool{}
+	pool.Register("failing", func(context.Context, *Task) (interface{}, error) { return nil, errors.New("connection refused") })
+	pool.Register("panicking", func(context.Context, *Task) (interface{}, error) { panic("index out of range") })
+
+	for _, tc := range tests {
+		repositoryMock := &repository.JobRepositoryMock{}
+		repositoryMock.On("FinishJob", mock.Anything, mock.Anything).Return(nil)
+		pool.Repository = repositoryMock
+
+		pool.run(context.Background(), newRunningJob(tc.kind, "{}"))
+
+		job := repositoryMock.Calls[0].Arguments.Get(1).(*repository.JobEntity)
+		assert.Equal(t, repository.JobFailed, job.State, tc.description)
+		assert.Equal(t, tc.expectedError, job.Error, tc.description)
+	}
+}
+
+func TestShouldCancelTheRunningJob(t *testing.T) {
+
+	freezeNow(t)
+	running := newRunningJob("customer.import", "{}")
+	started := make(chan struct{})
+
+	repositoryMock := &repository.JobRepositoryMock{}
+	repositoryMock.On("CancelJob", mock.Anything, running.ID, mock.Anything).Return(
+		&repository.JobEntity{ID: running.ID, State: repository.JobRunning, CancelRequested: true}, nil)
+	finished := onFinishJob(repositoryMock)
+
+	pool := &Pool{Repository: repositoryMock}
+	pool.Register("customer.import", func(ctx context.Context, task *Task) (interface{}, error) {
+		close(started)
+		<-ctx.Done()
+		return nil, ctx.Err()
+	})
+
+	go pool.run(context.Background(), running)
+	<-started
+
+	job, err := pool.Cancel(context.Background(), running.ID.Hex())
+	assert.NoError(t, err)
+	assert.Equal(t, repository.JobRunning, job.State)
+
+	assert.Equal(t, repository.JobCanceled, finishedJob(t, finished).State)
+}
+
+func TestShouldCancelTheJobWhenItsProgressFindsTheCancellation(t *testing.T) {
+
+	running := newRunningJob("customer.import", "{}")
+
+	repositoryMock := &repository.JobRepositoryMock{}
+	repositoryMock.On("UpdateJobProgress", mock.Anything, running, noPart, mock.Anything).Return(true, nil)
+	repositoryMock.On("FinishJob", mock.Anything, mock.Anything).Return(nil)
+
+	pool := &Pool{Repository: repositoryMock}
+	pool.Register("customer.import", func(ctx context.Context, task *Task) (interface{}, error) {
+		task.Progress(10, 100)
+		return map[string]int{"imported": 10}, ctx.Err()
+	})
+
+	pool.run(context.Background(), running)
+
+	job := repositoryMock.Calls[1].Arguments.Get(1).(*repository.JobEntity)
+	assert.Equal(t, repository.JobCanceled, job.State)
+	assert.Equal(t, `{"imported":10}`, job.Result)
+}
+
+func TestShouldLeaveTheJobRunningWhenTheStopCanNotWaitForIt(t *testing.T) {
+
+	claimed := newRunningJob("customer.import", "{}")
+	started := make(chan struct{})
+	returned := make(chan struct{})
+
+	repositoryMock := &repository.JobRepositoryMock{}
+	repositoryMock.On("RequeueExpiredJobs", mock.Anything, mock.Anything, mock.Anything).Return(int64(0), nil)
+	repositoryMock.On("ClaimJob", mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(claimed, nil).Once()
+	repositoryMock.On("ClaimJob", mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(nil, nil)
+
+	pool := &Pool{Repository: repositoryMock, Workers: 1}
+	pool.Register("customer.import", func(ctx context.Context, task *Task) (interface{}, error) {
+		close(started)
+		<-ctx.Done()
+		close(returned)
+		return nil, ctx.Err()
+	})
+
+	pool.Start(context.Background())
+	<-started
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	pool.Stop(ctx)
+
+	<-returned
+	repositoryMock.AssertNotCalled(t, "FinishJob", mock.Anything, mock.Anything)
+}
+
+func TestShouldStopTheJobWhoseLeaseWasLost(t *testing.T) {
+
+	running := newRunningJob("customer.import", "{}")
+	running.OwnerID = "pool-1"
+
+	repositoryMock := &repository.JobRepositoryMock{}
+	repositoryMock.On("RenewJobLease", mock.Anything, running.ID, "pool-1", mock.Anything).Return(false, repository.ErrJobLeaseLost)
+
+	pool := &Pool{ID: "pool-1", Repository: repositoryMock, LeaseDuration: 3 * time.Millisecond}
+	pool.Register("customer.import", func(ctx context.Context, task *Task) (interface{}, error) {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	})
+
+	pool.run(context.Background(), running)
+
+	repositoryMock.AssertCalled(t, "RenewJobLease", mock.Anything, running.ID, "pool-1", mock.Anything)
+	repositoryMock.AssertNotCalled(t, "FinishJob", mock.Anything, mock.Anything)
+}
+
+func TestShouldCompleteThePartsOfTheJobAndResumeFromTheFirstNotDone(t *testing.T) {
+
+	running := newRunningJob("customer.import", "{}")
+	running.Offset, running.Counters = 2, `{"done":3}`
+
+	fourth := &repository.JobPartEntity{ID: objectid.New(), JobID: running.ID, Seq: 2, Input: "[4]"}
+	fifth := &repository.JobPartEntity{ID: objectid.New(), JobID: running.ID, Seq: 3, Input: "[5]"}
+
+	repositoryMock := &repository.JobRepositoryMock{}
+	repositoryMock.On("FindJobParts", mock.Anything, running.ID, int64(2), int64(1)).Return([]*repository.JobPartEntity{fourth}, nil)
+	repositoryMock.On("FindJobParts", mock.Anything, running.ID, int64(3), int64(1)).Return([]*repository.JobPartEntity{fifth}, nil)
+	repositoryMock.On("UpdateJobProgress", mock.Anything, running, fourth, mock.Anything).Return(false, nil)
+	repositoryMock.On("UpdateJobProgress", mock.Anything, running, fifth, mock.Anything).Return(false, repository.ErrJobLeaseLost)
+
+	pool := &Pool{Repository: repositoryMock}
+	pool.Register("customer.import", func(ctx context.Context, task *Task) (interface{}, error) {
+		counters := struct {
+			Done int `json:"done"`
+		}{}
+		if _, err := task.Counters(&counters); err != nil {
+			return nil, err
+		}
+
+		for ctx.Err() == nil {
+			rows := []int{}
+			if next, err := task.NextPart(ctx, &rows); err != nil || !next {
+				return nil, err
+			}
+
+			counters.Done += len(rows)
+			task.CompletePart(counters.Done, 5, len(rows), counters)
+		}
+		return nil, ctx.Err()
+	})
+
+	pool.run(context.Background(), running)
+
+	assert.Equal(t, int64(5), running.Done)
+	assert.Equal(t, int64(4), running.Offset)
+	assert.Equal(t, `{"done":5}`, running.Counters)
+	assert.Equal(t, "1", fourth.Result)
+	repositoryMock.AssertNumberOfCalls(t, "UpdateJobProgress", 2)
+	repositoryMock.AssertNotCalled(t, "FinishJob", mock.Anything, mock.Anything)
+}
+
+func TestShouldReturnTheResultsOfThePartsCompleted(t *testing.T) {
+
+	job := newRunningJob("customer.import", "{}")
+
+	repositoryMock := &repository.JobRepositoryMock{}
+	repositoryMock.On("FindJobByID", mock.Anything, job.ID).Return(job, nil)
+	repositoryMock.On("FindJobParts", mock.Anything, job.ID, int64(1), int64(10)).Return([]*repository.JobPartEntity{
+		{Seq: 1, Input: "[2]", Result: `{"imported":1}`},
+		{Seq: 2, Input: "[3]"},
+	}, nil)
+
+	pool := &Pool{Repository: repositoryMock}
+
+	results, err := pool.Results(context.Background(), job.ID.Hex(), 1, 10)
+
+	assert.NoError(t, err)
+	assert.Equal(t, []json.RawMessage{json.RawMessage(`{"imported":1}`)}, results)
+}
+
+func TestShouldNotFindJobThatDoesNotExist(t *testing.T) {
+
+	repositoryMock := &repository.JobRepositoryMock{}
+	repositoryMock.On("FindJobByID", mock.Anything, mock.Anything).Return(nil, nil)
+	repositoryMock.On("CancelJob", mock.Anything, mock.Anything, mock.Anything).Return(nil, nil)
+
+	pool := &Pool{Repository: repositoryMock}
+
+	for _, id := range []string{"5bbb50ab0c3b8a1b5c3c1d2e", "not-an-id"} {
+		_, err := pool.Find(context.Background(), id)
+		assert.Equal(t, ErrJobNotFound, err, id)
+
+		_, err = pool.Cancel(context.Background(), id)
+		assert.Equal(t, ErrJobNotFound, err, id)
+
+		_, err = pool.Results(context.Background(), id, 0, 10)
+		assert.Equal(t, ErrJobNotFound, err, id)
+	}
+
+	repositoryMock.AssertNumberOfCalls(t, "FindJobByID", 2)
+}
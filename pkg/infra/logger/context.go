@@ -0,0 +1,52 @@
+package logger
+
+import "context"
+
+type contextKey int
+
+const (
+	requestIDKey contextKey = iota
+	actorKey
+)
+
+// WithRequestID return a copy of the context carrying the requestID
+func WithRequestID(ctx context.Context, requestID string) context.Context {
+	return context.WithValue(ctx, requestIDKey, requestID)
+}
+
+// RequestID return the requestID carried by the context, or empty when there is none
+func RequestID(ctx context.Context) string {
+	if ctx == nil {
+		return ""
+	}
+	requestID, _ := ctx.Value(requestIDKey).(string)
+	return requestID
+}
+
+// WithActor return a copy of the context carrying who makes the request
+func WithActor(ctx context.Context, actor string) context.Context {
+	return context.WithValue(ctx, actorKey, actor)
+}
+
+// Actor return who makes the request carried by the context, or empty when there is none
+func Actor(ctx context.Context) string {
+	if ctx == nil {
+		return ""
+	}
+	actor, _ := ctx.Value(actorKey).(string)
+	return actor
+}
+
+// FromContext return a logger that attaches the requestID carried by the context to every entry
+func FromContext(ctx context.Context) *Logger {
+	return root.WithContext(ctx)
+}
+
+// WithContext return a logger that attaches the requestID carried by the context to every entry,
+// after the fields of this logger
+func (logger *Logger) WithContext(ctx context.Context) *Logger {
+	if requestID := RequestID(ctx); requestID != "" {
+		return logger.With(String("requestID", requestID))
+	}
+	return logger
+}
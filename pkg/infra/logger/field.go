@@ -0,0 +1,81 @@
+package logger
+
+import (
+	"fmt"
+	"time"
+)
+
+// Field a key/value attached to a log entry
+type Field struct {
+	Key   string
+	Value interface{}
+}
+
+// String create a field with a string value
+func String(key string, value string) Field {
+	return Field{Key: key, Value: value}
+}
+
+// Int create a field with an int value
+func Int(key string, value int) Field {
+	return Field{Key: key, Value: value}
+}
+
+// Int64 create a field with an int64 value
+func Int64(key string, value int64) Field {
+	return Field{Key: key, Value: value}
+}
+
+// Bool create a field with a bool value
+func Bool(key string, value bool) Field {
+	return Field{Key: key, Value: value}
+}
+
+// Duration create a field with a duration value, written as text like 1.5s
+func Duration(key string, value time.Duration) Field {
+	return Field{Key: key, Value: value}
+}
+
+// Err create the field "error" with the error message
+func Err(err error) Field {
+	return Field{Key: "error", Value: err}
+}
+
+// Any create a field with any value, written as JSON when the format is JSON
+func Any(key string, value interface{}) Field {
+	return Field{Key: key, Value: value}
+}
+
+// Package create the field "package" with the package that wrote the entry
+func Package(name string) Field {
+	return String("package", name)
+}
+
+// Function create the field "function" with the function that wrote the entry
+func Function(name string) Field {
+	return String("function", name)
+}
+
+// value return the field value to be encoded as JSON
+func (field Field) value() interface{} {
+	switch value := field.Value.(type) {
+	case error:
+		return value.Error()
+	case fmt.Stringer:
+		return value.String()
+	default:
+		return value
+	}
+}
+
+// text return the field value to be written as text
+func (field Field) text() string {
+	switch value := field.Value.(type) {
+	case string:
+		return value
+	case error:
+		return value.Error()
+	default:
+		return fmt.Sprintf("%+v", value)
+	}
+}
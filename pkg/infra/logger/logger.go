@@ -1,42 +1,233 @@
 package logger
 
 import (
-	"log"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
 	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
 )
 
-var logger = configureLogger()
+// Level define the severity of a log entry
+type Level int
 
-// GetConfiguredLogger return the configured logger
-func GetConfiguredLogger() *log.Logger {
-	return logger
+const (
+	// DebugLevel detailed information, useful only when diagnosing problems
+	DebugLevel Level = iota
+	// InfoLevel the normal operation of the app, it's the default minimum level
+	InfoLevel
+	// WarnLevel something unexpected that the app can recover from
+	WarnLevel
+	// ErrorLevel an operation that failed
+	ErrorLevel
+	// FatalLevel an error that stops the app
+	FatalLevel
+)
+
+const (
+	// FormatText one line per entry with the fields as key=value, it's the default
+	FormatText = "text"
+
+	// FormatJSON one JSON object per entry
+	FormatJSON = "json"
+)
+
+const appName = "go-api-learn"
+
+var levelNames = map[Level]string{
+	DebugLevel: "DEBUG",
+	InfoLevel:  "INFO",
+	WarnLevel:  "WARN",
+	ErrorLevel: "ERROR",
+	FatalLevel: "FATAL",
+}
+
+// String return the name of the level
+func (level Level) String() string {
+	if name, ok := levelNames[level]; ok {
+		return name
+	}
+	return "UNKNOWN"
+}
+
+// ParseLevel return the level with the name, ignoring the case
+func ParseLevel(name string) (Level, error) {
+	for level, levelName := range levelNames {
+		if strings.EqualFold(name, levelName) {
+			return level, nil
+		}
+	}
+	return InfoLevel, fmt.Errorf("unknown log level '%s'", name)
+}
+
+var (
+	mutex        sync.Mutex
+	output       io.Writer = os.Stdout
+	minimumLevel           = InfoLevel
+	outputFormat           = FormatText
+	exit                   = os.Exit
+)
+
+// Configure set the minimum level and the format of the entries
+func Configure(level string, format string) error {
+
+	minimum, err := ParseLevel(level)
+	if err != nil {
+		return err
+	}
+
+	if format != FormatText && format != FormatJSON {
+		return fmt.Errorf("unknown log format '%s'", format)
+	}
+
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	minimumLevel = minimum
+	outputFormat = format
+	return nil
+}
+
+// Logger a logger that attaches its fields to every entry
+type Logger struct {
+	fields []Field
+}
+
+var root = &Logger{}
+
+// With return a logger that attaches the fields to every entry
+func With(fields ...Field) *Logger {
+	return root.With(fields...)
 }
 
-func configureLogger() *log.Logger {
-	return log.New(os.Stdout, "go-api-learn ", log.LstdFlags)
+// With return a logger that attaches the fields to every entry, after the fields of this logger
+func (logger *Logger) With(fields ...Field) *Logger {
+	merged := make([]Field, 0, len(logger.fields)+len(fields))
+	merged = append(merged, logger.fields...)
+	merged = append(merged, fields...)
+	return &Logger{fields: merged}
 }
 
 // Debug - Logging in level DEBUG
-func Debug(log string, v ...interface{}) {
-	logger.Printf("DEBUG "+log, v...)
+func (logger *Logger) Debug(message string, fields ...Field) {
+	logger.log(DebugLevel, message, fields)
 }
 
 // Info - Logging in level INFO
-func Info(log string, v ...interface{}) {
-	logger.Printf("INFO  "+log, v...)
+func (logger *Logger) Info(message string, fields ...Field) {
+	logger.log(InfoLevel, message, fields)
 }
 
 // Warn - Logging in level WARN
-func Warn(log string, v ...interface{}) {
-	logger.Printf("WARN  "+log, v...)
+func (logger *Logger) Warn(message string, fields ...Field) {
+	logger.log(WarnLevel, message, fields)
 }
 
 // Error - Logging in level ERROR
-func Error(log string, v ...interface{}) {
-	logger.Printf("ERROR "+log, v...)
+func (logger *Logger) Error(message string, fields ...Field) {
+	logger.log(ErrorLevel, message, fields)
+}
+
+// Fatal - Logging in level FATAL and exit the app
+func (logger *Logger) Fatal(message string, fields ...Field) {
+	logger.log(FatalLevel, message, fields)
+	exit(1)
+}
+
+// Debug - Logging in level DEBUG
+func Debug(message string, fields ...Field) {
+	root.log(DebugLevel, message, fields)
+}
+
+// Info - Logging in level INFO
+func Info(message string, fields ...Field) {
+	root.log(InfoLevel, message, fields)
+}
+
+// Warn - Logging in level WARN
+func Warn(message string, fields ...Field) {
+	root.log(WarnLevel, message, fields)
+}
+
+// Error - Logging in level ERROR
+func Error(message string, fields ...Field) {
+	root.log(ErrorLevel, message, fields)
+}
+
+// Fatal - Logging in level FATAL and exit the app
+func Fatal(message string, fields ...Field) {
+	root.log(FatalLevel, message, fields)
+	exit(1)
+}
+
+func (logger *Logger) log(level Level, message string, fields []Field) {
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	if level < minimumLevel {
+		return
+	}
+
+	all := append(append(make([]Field, 0, len(logger.fields)+len(fields)), logger.fields...), fields...)
+
+	buffer := &bytes.Buffer{}
+	if outputFormat == FormatJSON {
+		encodeJSON(buffer, time.Now(), level, message, all)
+	} else {
+		encodeText(buffer, time.Now(), level, message, all)
+	}
+
+	output.Write(buffer.Bytes())
+}
+
+func encodeText(buffer *bytes.Buffer, now time.Time, level Level, message string, fields []Field) {
+	fmt.Fprintf(buffer, "%s %s %-5s %s", appName, now.Format("2006/01/02 15:04:05"), level, message)
+
+	for _, field := range fields {
+		buffer.WriteByte(' ')
+		buffer.WriteString(field.Key)
+		buffer.WriteByte('=')
+		buffer.WriteString(quoteIfNeeded(field.text()))
+	}
+
+	buffer.WriteByte('\n')
+}
+
+func encodeJSON(buffer *bytes.Buffer, now time.Time, level Level, message string, fields []Field) {
+	buffer.WriteString(`{"time":`)
+	writeJSON(buffer, now.Format(time.RFC3339Nano))
+	buffer.WriteString(`,"level":`)
+	writeJSON(buffer, strings.ToLower(level.String()))
+	buffer.WriteString(`,"app":`)
+	writeJSON(buffer, appName)
+	buffer.WriteString(`,"msg":`)
+	writeJSON(buffer, message)
+
+	for _, field := range fields {
+		buffer.WriteByte(',')
+		writeJSON(buffer, field.Key)
+		buffer.WriteByte(':')
+		writeJSON(buffer, field.value())
+	}
+
+	buffer.WriteString("}\n")
+}
+
+func writeJSON(buffer *bytes.Buffer, value interface{}) {
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		encoded, _ = json.Marshal(fmt.Sprintf("%+v", value))
+	}
+	buffer.Write(encoded)
 }
 
-// Fatal - Logging in level FATAL
-func Fatal(log string, v ...interface{}) {
-	logger.Fatalf("FATAL  "+log, v...)
+func quoteIfNeeded(value string) string {
+	if value == "" || strings.ContainsAny(value, " =\"\n\t") {
+		return strconv.Quote(value)
+	}
+	return value
 }
@@ -0,0 +1,109 @@
+package logger
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func captureOutput(t *testing.T, level string, format string) *bytes.Buffer {
+	buffer := &bytes.Buffer{}
+
+	previousOutput, previousLevel, previousFormat := output, minimumLevel, outputFormat
+	t.Cleanup(func() {
+		output, minimumLevel, outputFormat = previousOutput, previousLevel, previousFormat
+	})
+
+	output = buffer
+	assert.NoError(t, Configure(level, format))
+	return buffer
+}
+
+func TestShouldWriteEntryAsJSONWithFields(t *testing.T) {
+	buffer := captureOutput(t, "debug", FormatJSON)
+
+	With(Package("repository")).Error("could not insert the customer",
+		Function("InsertCustomer"),
+		Int("attempt", 2),
+		Duration("elapsedTime", 1500*time.Millisecond),
+		Err(errors.New("timeout")))
+
+	entry := map[string]interface{}{}
+	assert.NoError(t, json.Unmarshal(buffer.Bytes(), &entry))
+
+	assert.Equal(t, "error", entry["level"])
+	assert.Equal(t, "could not insert the customer", entry["msg"])
+	assert.Equal(t, "repository", entry["package"])
+	assert.Equal(t, "InsertCustomer", entry["function"])
+	assert.Equal(t, float64(2), entry["attempt"])
+	assert.Equal(t, "1.5s", entry["elapsedTime"])
+	assert.Equal(t, "timeout", entry["error"])
+}
+
+func TestShouldWriteEntryAsTextQuotingValuesWithSpaces(t *testing.T) {
+	buffer := captureOutput(t, "info", FormatText)
+
+	Info("customer found", String("name", "Amanda Silva"), String("city", "Recife"))
+
+	assert.Regexp(t, `^go-api-learn \S+ \S+ INFO  customer found name="Amanda Silva" city=Recife\n$`, buffer.String())
+}
+
+func TestShouldFilterEntriesBelowTheMinimumLevel(t *testing.T) {
+	buffer := captureOutput(t, "warn", FormatText)
+
+	Debug("debug entry")
+	Info("info entry")
+	Warn("warn entry")
+
+	assert.NotContains(t, buffer.String(), "debug entry")
+	assert.NotContains(t, buffer.String(), "info entry")
+	assert.Contains(t, buffer.String(), "warn entry")
+}
+
+func TestShouldAttachRequestIDFromContext(t *testing.T) {
+	buffer := captureOutput(t, "info", FormatJSON)
+
+	ctx := WithRequestID(context.Background(), "1539000000")
+	FromContext(ctx).Info("Request handled", String("method", "GET"))
+
+	entry := map[string]interface{}{}
+	assert.NoError(t, json.Unmarshal(buffer.Bytes(), &entry))
+
+	assert.Equal(t, "1539000000", entry["requestID"])
+	assert.Equal(t, "GET", entry["method"])
+}
+
+func TestShouldNotAttachRequestIDWhenContextHasNone(t *testing.T) {
+	buffer := captureOutput(t, "info", FormatText)
+
+	FromContext(context.Background()).Info("Request handled")
+
+	assert.NotContains(t, buffer.String(), "requestID")
+}
+
+func TestShouldExitWhenLoggingInLevelFatal(t *testing.T) {
+	buffer := captureOutput(t, "info", FormatText)
+
+	exitCode := 0
+	previousExit := exit
+	exit = func(code int) { exitCode = code }
+	defer func() { exit = previousExit }()
+
+	Fatal("could not load the properties")
+
+	assert.Equal(t, 1, exitCode)
+	assert.Contains(t, buffer.String(), "FATAL could not load the properties")
+}
+
+func TestShouldRejectUnknownLevelAndFormat(t *testing.T) {
+	captureOutput(t, "info", FormatText)
+
+	assert.Error(t, Configure("verbose", FormatText))
+	assert.Error(t, Configure("info", "xml"))
+	assert.Equal(t, InfoLevel, minimumLevel)
+}
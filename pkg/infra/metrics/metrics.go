@@ -0,0 +1,82 @@
+package metrics
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+var (
+	httpRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "http_requests_total",
+		Help: "Number of HTTP requests by route, method and status.",
+	}, []string{"route", "method", "status"})
+
+	httpRequestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "http_request_duration_seconds",
+		Help:    "Latency of HTTP requests by route, method and status.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"route", "method", "status"})
+
+	databaseOperationDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "database_operation_duration_seconds",
+		Help:    "Latency of database operations by backend and repository function.",
+		Buckets: []float64{.001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2},
+	}, []string{"backend", "function"})
+
+	databaseOperationErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "database_operation_errors_total",
+		Help: "Number of failed database operations by backend and repository function.",
+	}, []string{"backend", "function"})
+
+	databaseOperationsInFlight = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "database_operations_in_flight",
+		Help: "Number of database operations holding a pooled connection by backend.",
+	}, []string{"backend"})
+)
+
+// Handler return the handler to expose the metrics in Prometheus text format
+func Handler() http.Handler {
+	return promhttp.Handler()
+}
+
+// Register register the collectors in the default registry
+func Register(collectors ...prometheus.Collector) {
+	prometheus.MustRegister(collectors...)
+}
+
+// CounterFunc create a counter whose value is read from the function on every scrape
+func CounterFunc(name string, help string, value func() float64) prometheus.Collector {
+	return prometheus.NewCounterFunc(prometheus.CounterOpts{Name: name, Help: help}, value)
+}
+
+// GaugeFunc create a gauge whose value is read from the function on every scrape
+func GaugeFunc(name string, help string, value func() float64) prometheus.Collector {
+	return prometheus.NewGaugeFunc(prometheus.GaugeOpts{Name: name, Help: help}, value)
+}
+
+// ObserveHTTPRequest record a served HTTP request
+func ObserveHTTPRequest(route string, method string, status int, elapsed time.Duration) {
+	statusLabel := strconv.Itoa(status)
+	httpRequests.WithLabelValues(route, method, statusLabel).Inc()
+	httpRequestDuration.WithLabelValues(route, method, statusLabel).Observe(elapsed.Seconds())
+}
+
+// StartDatabaseOperation record the start of a database operation, the returned function must be called with the
+// operation result when it finishes
+func StartDatabaseOperation(backend string, function string) func(err error) {
+	start := time.Now()
+	databaseOperationsInFlight.WithLabelValues(backend).Inc()
+
+	return func(err error) {
+		databaseOperationsInFlight.WithLabelValues(backend).Dec()
+		databaseOperationDuration.WithLabelValues(backend, function).Observe(time.Since(start).Seconds())
+		if err != nil {
+			databaseOperationErrors.WithLabelValues(backend, function).Inc()
+		}
+	}
+}
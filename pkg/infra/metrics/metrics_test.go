@@ -0,0 +1,89 @@
+package metrics
+
+import (
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func scrape(t *testing.T) string {
+
+	recorder := httptest.NewRecorder()
+	Handler().ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	body, _ := ioutil.ReadAll(recorder.Body)
+	return string(body)
+}
+
+// register register the collectors for the test only
+func register(t *testing.T, collectors ...prometheus.Collector) {
+
+	Register(collectors...)
+	t.Cleanup(func() {
+		for _, collector := range collectors {
+			prometheus.Unregister(collector)
+		}
+	})
+}
+
+func TestShouldExposeTheRegisteredFuncsOnEveryScrape(t *testing.T) {
+
+	value := 1.0
+	register(t,
+		CounterFunc("test_func_total", "Counter read from a function.", func() float64 { return value }),
+		GaugeFunc("test_func_gauge", "Gauge read from a function.", func() float64 { return value * 2 }))
+
+	assert.Contains(t, scrape(t), "test_func_total 1\n")
+	assert.Contains(t, scrape(t), "test_func_gauge 2\n")
+
+	value = 3
+	body := scrape(t)
+	assert.Contains(t, body, "test_func_total 3\n")
+	assert.Contains(t, body, "test_func_gauge 6\n")
+}
+
+func TestShouldPanicWhenRegisteringTheSameNameTwice(t *testing.T) {
+
+	register(t, GaugeFunc("test_duplicated", "Gauge registered twice.", func() float64 { return 0 }))
+
+	assert.Panics(t, func() {
+		register(t, GaugeFunc("test_duplicated", "Gauge registered twice.", func() float64 { return 0 }))
+	})
+}
+
+func TestShouldObserveTheHTTPRequestByRouteMethodAndStatus(t *testing.T) {
+
+	httpRequests.Reset()
+	httpRequestDuration.Reset()
+
+	ObserveHTTPRequest("/test/{id}", http.MethodGet, http.StatusNotFound, 10*time.Millisecond)
+	ObserveHTTPRequest("/test/{id}", http.MethodGet, http.StatusNotFound, 20*time.Millisecond)
+
+	assert.Equal(t, 2.0, testutil.ToFloat64(httpRequests.WithLabelValues("/test/{id}", http.MethodGet, "404")))
+	assert.Contains(t, scrape(t), `http_request_duration_seconds_count{method="GET",route="/test/{id}",status="404"} 2`)
+}
+
+func TestShouldTrackTheDatabaseOperationUntilItFinishes(t *testing.T) {
+
+	databaseOperationDuration.Reset()
+	databaseOperationErrors.Reset()
+
+	finish := StartDatabaseOperation("test", "FindCustomer")
+	assert.Equal(t, 1.0, testutil.ToFloat64(databaseOperationsInFlight.WithLabelValues("test")))
+
+	finish(nil)
+	assert.Equal(t, 0.0, testutil.ToFloat64(databaseOperationsInFlight.WithLabelValues("test")))
+	assert.Equal(t, 0.0, testutil.ToFloat64(databaseOperationErrors.WithLabelValues("test", "FindCustomer")))
+
+	StartDatabaseOperation("test", "FindCustomer")(errors.New("timeout"))
+	assert.Equal(t, 1.0, testutil.ToFloat64(databaseOperationErrors.WithLabelValues("test", "FindCustomer")))
+	assert.Contains(t, scrape(t), `database_operation_duration_seconds_count{backend="test",function="FindCustomer"} 2`)
+}
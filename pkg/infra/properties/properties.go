@@ -1,6 +1,7 @@
 package properties
 
 import (
+	"context"
 	"io/ioutil"
 	"os"
 	"time"
@@ -11,18 +12,181 @@ import (
 
 // Properties define the properties values
 type Properties struct {
-	ServerPort int               `yaml:"serverPort"`
-	MongoDB    MongoDBProperties `yaml:"mongodb"`
+	ServerPort int                 `yaml:"serverPort"`
+	GRPCPort   int                 `yaml:"grpcPort"`
+	Log        LogProperties       `yaml:"log"`
+	Deadlines  DeadlineProperties  `yaml:"deadlines"`
+	Storage    StorageProperties   `yaml:"storage"`
+	Cache      CacheProperties     `yaml:"cache"`
+	MongoDB    MongoDBProperties   `yaml:"mongodb"`
+	Cassandra  CassandraProperties `yaml:"cassandra"`
+	Redis      RedisProperties     `yaml:"redis"`
+	Purge      PurgeProperties     `yaml:"purge"`
+	Admin      AdminProperties     `yaml:"admin"`
+	Outbox     OutboxProperties    `yaml:"outbox"`
+	Webhook    WebhookProperties   `yaml:"webhook"`
+	Stream     StreamProperties    `yaml:"stream"`
+	Import     ImportProperties    `yaml:"import"`
+	Jobs       JobsProperties      `yaml:"jobs"`
+}
+
+// LogProperties define the minimum level, one of debug, info, warn or error, and the format, text or json, of the logs
+type LogProperties struct {
+	Level  string `yaml:"level"`
+	Format string `yaml:"format"`
+}
+
+// DeadlineProperties define the deadline in milliseconds of each operation by its name,
+// the operations without an entry use the default and a zero deadline means none
+type DeadlineProperties struct {
+	Default    time.Duration            `yaml:"default"`
+	Operations map[string]time.Duration `yaml:"operations"`
+}
+
+// WithDeadline return a copy of the context that is canceled when the deadline of the operation expires
+func (deadlines DeadlineProperties) WithDeadline(ctx context.Context, operation string) (context.Context, context.CancelFunc) {
+
+	deadline, ok := deadlines.Operations[operation]
+	if !ok {
+		deadline = deadlines.Default
+	}
+
+	if deadline <= 0 {
+		return context.WithCancel(ctx)
+	}
+
+	return context.WithTimeout(ctx, deadline*time.Millisecond)
+}
+
+const (
+	// StorageMongoDB storage backend using mongodb, it's the default
+	StorageMongoDB = "mongodb"
+
+	// StorageCassandra storage backend using cassandra
+	StorageCassandra = "cassandra"
+)
+
+// StorageProperties define the storage backend used by the repositories
+type StorageProperties struct {
+	Backend string `yaml:"backend"`
 }
 
 // MongoDBProperties define the mongoDB properties values
 type MongoDBProperties struct {
-	Hosts     []string      `yaml:"hosts"`
-	Username  string        `yaml:"username"`
-	Password  string        `yaml:"password"`
-	Database  string        `yaml:"database"`
-	Timeout   time.Duration `yaml:"timeout"`
-	PoolLimit uint16        `yaml:"poolLimit"`
+	Hosts      []string      `yaml:"hosts"`
+	Username   string        `yaml:"username"`
+	Password   string        `yaml:"password"`
+	Database   string        `yaml:"database"`
+	Timeout    time.Duration `yaml:"timeout"`
+	PoolLimit  uint16        `yaml:"poolLimit"`
+	ReplicaSet string        `yaml:"replicaSet"`
+}
+
+const (
+	// CacheLocal cache backend using the in-process bigcache, it's the default
+	CacheLocal = "local"
+
+	// CacheRedis cache backend using redis, shared by all instances
+	CacheRedis = "redis"
+
+	// CacheTwoTier cache backend using the local cache in front of redis
+	CacheTwoTier = "twoTier"
+)
+
+// CacheProperties define the cache backend used by the cache stores
+type CacheProperties struct {
+	Backend string `yaml:"backend"`
+}
+
+// CassandraProperties define the cassandra properties values
+type CassandraProperties struct {
+	Hosts             []string      `yaml:"hosts"`
+	Keyspace          string        `yaml:"keyspace"`
+	ReplicationFactor int           `yaml:"replicationFactor"`
+	Consistency       string        `yaml:"consistency"`
+	Timeout           time.Duration `yaml:"timeout"`
+	NumConns          int           `yaml:"numConns"`
+}
+
+// RedisProperties define the redis properties values
+type RedisProperties struct {
+	Address     string        `yaml:"address"`
+	Password    string        `yaml:"password"`
+	Database    int           `yaml:"database"`
+	Timeout     time.Duration `yaml:"timeout"`
+	MaxIdle     int           `yaml:"maxIdle"`
+	MaxActive   int           `yaml:"maxActive"`
+	IdleTimeout time.Duration `yaml:"idleTimeout"`
+	TTL         time.Duration `yaml:"ttl"`
+}
+
+// PurgeProperties define how long the deleted customers are kept, in hours, and the interval between the purges,
+// in minutes, a zero interval means the purge only runs when requested by an admin
+type PurgeProperties struct {
+	Retention time.Duration `yaml:"retention"`
+	Interval  time.Duration `yaml:"interval"`
+}
+
+// AdminProperties define the bearer token required by the admin routes, they are forbidden when it's empty.
+// The actor told by a request is audited only when the request carries the token
+type AdminProperties struct {
+	Token string `yaml:"token"`
+}
+
+const (
+	// PublisherLog event publisher that only logs the events, it's the default
+	PublisherLog = "log"
+
+	// PublisherWebhook event publisher that delivers the events to the webhooks, they are stored in mongodb
+	PublisherWebhook = "webhook"
+)
+
+// OutboxProperties define how the events of the outbox are published, the interval and the backoff in milliseconds,
+// the backoff doubles on every failed attempt and after maxAttempts the event goes to the dead letter store
+type OutboxProperties struct {
+	Publisher   string        `yaml:"publisher"`
+	Interval    time.Duration `yaml:"interval"`
+	BatchSize   int64         `yaml:"batchSize"`
+	MaxAttempts int64         `yaml:"maxAttempts"`
+	Backoff     time.Duration `yaml:"backoff"`
+}
+
+// WebhookProperties define how the events are delivered to the webhooks, the interval, the backoff and the timeout
+// of a delivery in milliseconds, the backoff doubles on every failed attempt and after maxAttempts the delivery fails.
+// The deliveries are sent by up to workers at once
+type WebhookProperties struct {
+	Interval    time.Duration `yaml:"interval"`
+	BatchSize   int64         `yaml:"batchSize"`
+	MaxAttempts int64         `yaml:"maxAttempts"`
+	Backoff     time.Duration `yaml:"backoff"`
+	Timeout     time.Duration `yaml:"timeout"`
+	Workers     int           `yaml:"workers"`
+}
+
+// StreamProperties define the stream of customer changes, how many events are kept to resume a stream,
+// how many clients are streaming at most and the interval of the heartbeats in seconds
+type StreamProperties struct {
+	BufferSize     int           `yaml:"bufferSize"`
+	MaxSubscribers int           `yaml:"maxSubscribers"`
+	Heartbeat      time.Duration `yaml:"heartbeat"`
+}
+
+// ImportProperties define the import of customers, how many are inserted at once and how many rows
+// a file has at most to be imported during the request, bigger files are imported in background
+type ImportProperties struct {
+	BatchSize   int `yaml:"batchSize"`
+	MaxSyncRows int `yaml:"maxSyncRows"`
+}
+
+// JobsProperties define the jobs run in background, how many run at once, the interval in milliseconds between
+// two looks for queued jobs, how many times a job interrupted by a stop is run again, the seconds a stop waits
+// for the running jobs and the seconds a running job is leased to the instance running it
+type JobsProperties struct {
+	Workers       int           `yaml:"workers"`
+	PollInterval  time.Duration `yaml:"pollInterval"`
+	MaxAttempts   int64         `yaml:"maxAttempts"`
+	DrainTimeout  time.Duration `yaml:"drainTimeout"`
+	LeaseDuration time.Duration `yaml:"leaseDuration"`
 }
 
 // AppProperties the loaded properties values
@@ -34,13 +198,13 @@ func LoadProperties(env string) {
 	pwd, _ := os.Getwd()
 	fileProperties, err := ioutil.ReadFile(pwd + "/properties/" + env + ".yaml")
 	if err != nil {
-		logger.Fatal("p=properties f=LoadProperties \n%v", err)
+		logger.Fatal("could not load the properties", logger.Package("properties"), logger.Function("LoadProperties"), logger.String("env", env), logger.Err(err))
 	}
 
 	err = yaml.UnmarshalStrict(fileProperties, &AppProperties)
 	if err != nil {
-		logger.Fatal("p=properties f=LoadProperties \n%v", err)
+		logger.Fatal("could not load the properties", logger.Package("properties"), logger.Function("LoadProperties"), logger.String("env", env), logger.Err(err))
 	}
 
-	logger.Info("p=properties f=LoadProperties \n%+v", AppProperties)
+	logger.Info("properties loaded", logger.Package("properties"), logger.Function("LoadProperties"), logger.String("env", env))
 }
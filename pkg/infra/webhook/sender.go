@@ -0,0 +1,91 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	// SignatureHeader the header carrying the signature of the payload
+	SignatureHeader = "X-Webhook-Signature"
+
+	// TimestampHeader the header carrying the time of the delivery in unix seconds, it's part of the signature
+	TimestampHeader = "X-Webhook-Timestamp"
+
+	// EventHeader the header carrying the type of the event
+	EventHeader = "X-Webhook-Event"
+
+	// DeliveryHeader the header carrying the id of the delivery, it's the same on every attempt
+	DeliveryHeader = "X-Webhook-Delivery"
+
+	// signaturePrefix the algorithm of the signature
+	signaturePrefix = "sha256="
+
+	// maxDrainedBody the most bytes of an answer read before closing it, so the connection can be reused
+	maxDrainedBody = 4 << 10
+)
+
+// Message a payload to deliver to a webhook
+type Message struct {
+	DeliveryID string
+	EventType  string
+	Timestamp  time.Time
+	Payload    []byte
+}
+
+// Sign return the signature of the payload sent at the timestamp, the hex HMAC-SHA256 of "timestamp.payload"
+// keyed by the secret. The timestamp is signed so the receiver can reject an old delivery sent again
+func Sign(secret string, timestamp time.Time, payload []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp.Unix(), 10) + "."))
+	mac.Write(payload)
+	return signaturePrefix + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Sender deliver signed messages to webhooks
+type Sender struct {
+	Client *http.Client
+}
+
+// Send post the message to the url signed with the secret, return the status answered by the webhook.
+// It fails when the webhook can not be reached or does not answer with a 2xx status
+func (sender *Sender) Send(ctx context.Context, url string, secret string, message *Message) (int, error) {
+
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(message.Payload))
+	if err != nil {
+		return 0, err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(EventHeader, message.EventType)
+	req.Header.Set(DeliveryHeader, message.DeliveryID)
+	req.Header.Set(TimestampHeader, strconv.FormatInt(message.Timestamp.Unix(), 10))
+	req.Header.Set(SignatureHeader, Sign(secret, message.Timestamp, message.Payload))
+
+	client := sender.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	resp, err := client.Do(req.WithContext(ctx))
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	io.CopyN(ioutil.Discard, resp.Body, maxDrainedBody)
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("webhook answered with status %d", resp.StatusCode)
+	}
+
+	return resp.StatusCode, nil
+}
@@ -0,0 +1,79 @@
+package webhook
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestShouldSignThePayloadWithTheTimestamp(t *testing.T) {
+
+	timestamp := time.Unix(1539000000, 0)
+
+	signature := Sign("0123456789abcdef", timestamp, []byte(`{"type":"CustomerCreated"}`))
+
+	assert.Equal(t, "sha256=d6ebaca7286180060c37b817c2347b704a02598e8d802283fedce5d7b930ee33", signature)
+	assert.NotEqual(t, signature, Sign("0123456789abcdef", timestamp.Add(time.Second), []byte(`{"type":"CustomerCreated"}`)))
+	assert.NotEqual(t, signature, Sign("fedcba9876543210", timestamp, []byte(`{"type":"CustomerCreated"}`)))
+}
+
+func TestShouldPostSignedMessage(t *testing.T) {
+
+	message := Message{DeliveryID: "5bbb4ad8e5a8b2a1c1f6f1a1", EventType: "CustomerCreated", Timestamp: time.Unix(1539000000, 0), Payload: []byte(`{"id":"1"}`)}
+
+	var received *http.Request
+	var receivedBody []byte
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received = r
+		receivedBody, _ = ioutil.ReadAll(r.Body)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer receiver.Close()
+
+	sender := Sender{Client: receiver.Client()}
+	status, err := sender.Send(context.Background(), receiver.URL, "0123456789abcdef", &message)
+
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusNoContent, status)
+
+	if assert.NotNil(t, received) {
+		assert.Equal(t, http.MethodPost, received.Method)
+		assert.Equal(t, "application/json", received.Header.Get("Content-Type"))
+		assert.Equal(t, "CustomerCreated", received.Header.Get(EventHeader))
+		assert.Equal(t, message.DeliveryID, received.Header.Get(DeliveryHeader))
+		assert.Equal(t, "1539000000", received.Header.Get(TimestampHeader))
+		assert.Equal(t, Sign("0123456789abcdef", message.Timestamp, message.Payload), received.Header.Get(SignatureHeader))
+		assert.Equal(t, message.Payload, receivedBody)
+	}
+}
+
+func TestShouldFailWhenWebhookDoesNotAnswerSuccess(t *testing.T) {
+
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer receiver.Close()
+
+	sender := Sender{Client: receiver.Client()}
+	status, err := sender.Send(context.Background(), receiver.URL, "0123456789abcdef", &Message{Timestamp: time.Now()})
+
+	assert.Equal(t, http.StatusServiceUnavailable, status)
+	assert.EqualError(t, err, "webhook answered with status 503")
+}
+
+func TestShouldFailWhenWebhookIsUnreachable(t *testing.T) {
+
+	receiver := httptest.NewServer(http.NotFoundHandler())
+	receiver.Close()
+
+	sender := Sender{Client: &http.Client{Timeout: time.Second}}
+	status, err := sender.Send(context.Background(), receiver.URL, "0123456789abcdef", &Message{Timestamp: time.Now()})
+
+	assert.Equal(t, 0, status)
+	assert.Error(t, err)
+}
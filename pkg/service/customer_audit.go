@@ -0,0 +1,193 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"sort"
+
+	"github.com/mongodb/mongo-go-driver/bson/objectid"
+
+	"github.com/jcsw/go-api-learn/pkg/domain"
+	"github.com/jcsw/go-api-learn/pkg/infra/database/repository"
+	"github.com/jcsw/go-api-learn/pkg/infra/logger"
+)
+
+// anonymousActor the actor of the changes made by requests that do not inform one, or that are not trusted to
+const anonymousActor = "anonymous"
+
+// unauditedFields the fields that change on every write, they are already in the audit record
+var unauditedFields = []string{"id", "version", "updatedAt"}
+
+// HistoryQuery define the page of the history of a customer, from the newest change to the oldest
+type HistoryQuery struct {
+	After string
+	Limit int
+}
+
+// CustomerHistory a page of the changes of a customer, Next is empty when it is the last page
+type CustomerHistory struct {
+	Changes []*domain.CustomerAudit
+	Next    string
+}
+
+// FindCustomerHistory find a page of the changes of the customer, the deleted customers keep their history until purged
+func (aggregate *CustomerAggregate) FindCustomerHistory(ctx context.Context, customerID string, query HistoryQuery) (*CustomerHistory, error) {
+
+	id, err := objectid.FromHex(customerID)
+	if err != nil {
+		return nil, ErrCustomerNotFound
+	}
+
+	filter, err := query.toFilter()
+	if err != nil {
+		return nil, err
+	}
+
+	pageLimit := filter.Limit
+	filter.Limit++
+
+	auditsEntity, err := aggregate.Repository.FindCustomerAudit(ctx, id, filter)
+	if err != nil {
+		return nil, domain.WrapError(domain.ErrUnexpected, "customer_history_failed", "could not find customer history", err)
+	}
+
+	if len(auditsEntity) == 0 && query.After == "" {
+		if _, err := aggregate.findStoredCustomerEntityByID(ctx, customerID); err != nil {
+			return nil, err
+		}
+	}
+
+	history := CustomerHistory{}
+	if int64(len(auditsEntity)) > pageLimit {
+		auditsEntity = auditsEntity[:pageLimit]
+		history.Next = auditsEntity[pageLimit-1].ID.Hex()
+	}
+
+	history.Changes = make([]*domain.CustomerAudit, len(auditsEntity), len(auditsEntity))
+	for i, entity := range auditsEntity {
+		history.Changes[i] = makeAuditByEntity(entity)
+	}
+
+	return &history, nil
+}
+
+func (query HistoryQuery) toFilter() (repository.AuditFilter, error) {
+
+	filter := repository.AuditFilter{}
+
+	if query.Limit < 0 || query.Limit > MaxPageLimit {
+		return filter, ErrInvalidLimit
+	}
+
+	filter.Limit = int64(query.Limit)
+	if filter.Limit == 0 {
+		filter.Limit = DefaultPageLimit
+	}
+
+	if query.After != "" {
+		afterID, err := objectid.FromHex(query.After)
+		if err != nil {
+			return filter, ErrInvalidCursor
+		}
+		filter.AfterID = afterID
+	}
+
+	return filter, nil
+}
+
+// newAudit make the audit of the change from before to after, before is nil on creation.
+// The actor and the requestID are the ones carried by ctx
+func newAudit(ctx context.Context, action domain.AuditAction, before *repository.CustomerEntity, after *repository.CustomerEntity) *repository.CustomerAuditEntity {
+
+	actor := logger.Actor(ctx)
+	if actor == "" {
+		actor = anonymousActor
+	}
+
+	return &repository.CustomerAuditEntity{
+		Action:    string(action),
+		Actor:     actor,
+		RequestID: logger.RequestID(ctx),
+		Timestamp: now(),
+		Changes:   diffCustomer(before, after),
+	}
+}
+
+// diffCustomer return the fields, as seen on the API, whose values differ between both entities, sorted by field
+func diffCustomer(before *repository.CustomerEntity, after *repository.CustomerEntity) []repository.AuditChangeEntity {
+
+	beforeFields := auditedFields(before)
+	afterFields := auditedFields(after)
+
+	fields := []string{}
+	for field := range beforeFields {
+		fields = append(fields, field)
+	}
+	for field := range afterFields {
+		if _, ok := beforeFields[field]; !ok {
+			fields = append(fields, field)
+		}
+	}
+	sort.Strings(fields)
+
+	changes := []repository.AuditChangeEntity{}
+	for _, field := range fields {
+		if !bytes.Equal(beforeFields[field], afterFields[field]) {
+			changes = append(changes, repository.AuditChangeEntity{
+				Field:  field,
+				Before: string(beforeFields[field]),
+				After:  string(afterFields[field]),
+			})
+		}
+	}
+
+	return changes
+}
+
+// auditedFields return the JSON value of each field of the customer, the tombstone included
+func auditedFields(customerEntity *repository.CustomerEntity) map[string]json.RawMessage {
+
+	fields := map[string]json.RawMessage{}
+	if customerEntity == nil {
+		return fields
+	}
+
+	// a customer is always encoded, it has no value that JSON rejects
+	customerInBytes, _ := json.Marshal(makeCustomerByEntity(customerEntity))
+	json.Unmarshal(customerInBytes, &fields)
+
+	for _, field := range unauditedFields {
+		delete(fields, field)
+	}
+
+	if customerEntity.IsDeleted() {
+		fields["deletedAt"], _ = json.Marshal(customerEntity.DeletedAt)
+	}
+
+	return fields
+}
+
+func makeAuditByEntity(auditEntity *repository.CustomerAuditEntity) *domain.CustomerAudit {
+
+	changes := make([]domain.FieldChange, len(auditEntity.Changes), len(auditEntity.Changes))
+	for i, change := range auditEntity.Changes {
+		changes[i] = domain.FieldChange{Field: change.Field}
+		if change.Before != "" {
+			changes[i].Before = json.RawMessage(change.Before)
+		}
+		if change.After != "" {
+			changes[i].After = json.RawMessage(change.After)
+		}
+	}
+
+	return &domain.CustomerAudit{
+		ID:        auditEntity.ID.Hex(),
+		Action:    domain.AuditAction(auditEntity.Action),
+		Actor:     auditEntity.Actor,
+		RequestID: auditEntity.RequestID,
+		Timestamp: auditEntity.Timestamp,
+		Version:   auditEntity.Version,
+		Changes:   changes,
+	}
+}
@@ -0,0 +1,84 @@
+package service
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jcsw/go-api-learn/pkg/domain"
+)
+
+// customerColumn a column of the customers in CSV. The columns without read are only exported,
+// they are ignored on import so an exported file can be imported again
+type customerColumn struct {
+	name  string
+	write func(customer *domain.Customer) string
+	read  func(customer *domain.Customer, value string)
+}
+
+// customerColumns the columns of the customers in CSV, in the order they are exported.
+// The addresses have no column, they are only imported and exported in NDJSON
+var customerColumns = []customerColumn{
+	{
+		name:  "id",
+		write: func(customer *domain.Customer) string { return customer.ID },
+	},
+	{
+		name:  "name",
+		write: func(customer *domain.Customer) string { return customer.Name },
+		read:  func(customer *domain.Customer, value string) { customer.Name = value },
+	},
+	{
+		name:  "city",
+		write: func(customer *domain.Customer) string { return customer.City },
+		read:  func(customer *domain.Customer, value string) { customer.City = value },
+	},
+	{
+		name:  "email",
+		write: func(customer *domain.Customer) string { return customer.Email },
+		read:  func(customer *domain.Customer, value string) { customer.Email = value },
+	},
+	{
+		name:  "phone",
+		write: func(customer *domain.Customer) string { return customer.Phone },
+		read:  func(customer *domain.Customer, value string) { customer.Phone = value },
+	},
+	{
+		name:  "document",
+		write: func(customer *domain.Customer) string { return customer.Document },
+		read:  func(customer *domain.Customer, value string) { customer.Document = value },
+	},
+	{
+		name:  "status",
+		write: func(customer *domain.Customer) string { return string(customer.Status) },
+	},
+	{
+		name:  "createdAt",
+		write: func(customer *domain.Customer) string { return formatColumnTime(customer.CreatedAt) },
+	},
+	{
+		name:  "updatedAt",
+		write: func(customer *domain.Customer) string { return formatColumnTime(customer.UpdatedAt) },
+	},
+	{
+		name:  "version",
+		write: func(customer *domain.Customer) string { return strconv.FormatInt(customer.Version, 10) },
+	},
+}
+
+// findCustomerColumn return the column with the name in any case, nil when there is none
+func findCustomerColumn(name string) *customerColumn {
+	for i := range customerColumns {
+		if strings.EqualFold(customerColumns[i].name, name) {
+			return &customerColumns[i]
+		}
+	}
+	return nil
+}
+
+func formatColumnTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.UTC().Format(time.RFC3339)
+}
@@ -0,0 +1,91 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/mongodb/mongo-go-driver/bson/objectid"
+
+	"github.com/jcsw/go-api-learn/pkg/domain"
+	"github.com/jcsw/go-api-learn/pkg/infra/database/repository"
+	"github.com/jcsw/go-api-learn/pkg/infra/events"
+	"github.com/jcsw/go-api-learn/pkg/infra/logger"
+)
+
+// eventTypes the event emitted by each action on a customer
+var eventTypes = map[domain.AuditAction]domain.EventType{
+	domain.AuditCreated:  domain.CustomerCreated,
+	domain.AuditUpdated:  domain.CustomerUpdated,
+	domain.AuditDeleted:  domain.CustomerDeleted,
+	domain.AuditRestored: domain.CustomerRestored,
+}
+
+// newChange make the change written along with the customer, its audit and the event it emits.
+// before is nil on creation, after has the id of the customer and the version it's replacing
+func newChange(ctx context.Context, action domain.AuditAction, before *repository.CustomerEntity, after *repository.CustomerEntity) *repository.CustomerChange {
+
+	audit := newAudit(ctx, action, before, after)
+
+	return &repository.CustomerChange{
+		Audit:  audit,
+		Events: []*repository.OutboxEventEntity{newEvent(eventTypes[action], audit, after)},
+	}
+}
+
+// newEvent make the event of the change, it carries the customer as it's written, with the next version
+func newEvent(eventType domain.EventType, audit *repository.CustomerAuditEntity, after *repository.CustomerEntity) *repository.OutboxEventEntity {
+
+	written := *after
+	written.Version++
+
+	id := objectid.New()
+	event := domain.CustomerEvent{
+		ID:         id.Hex(),
+		Type:       eventType,
+		CustomerID: written.ID.Hex(),
+		Version:    written.Version,
+		OccurredAt: audit.Timestamp,
+		Actor:      audit.Actor,
+		RequestID:  audit.RequestID,
+		Customer:   makeCustomerByEntity(&written),
+	}
+
+	// an event is always encoded, it has no value that JSON rejects
+	payload, _ := json.Marshal(event)
+
+	return &repository.OutboxEventEntity{
+		ID:            id,
+		Type:          string(eventType),
+		CustomerID:    written.ID,
+		Version:       written.Version,
+		OccurredAt:    audit.Timestamp,
+		Payload:       string(payload),
+		NextAttemptAt: audit.Timestamp,
+	}
+}
+
+// notify send the events of the written change to the Notifier, a failure is only logged because
+// the events are also published from the outbox
+func (aggregate *CustomerAggregate) notify(ctx context.Context, change *repository.CustomerChange) {
+
+	if aggregate.Notifier == nil {
+		return
+	}
+
+	for _, event := range change.Events {
+		if err := aggregate.Notifier.Publish(ctx, makeEventByEntity(event)); err != nil {
+			serviceLogger.WithContext(ctx).Warn("could not notify the event", logger.Function("notify"), logger.String("id", event.ID.Hex()), logger.Err(err))
+		}
+	}
+}
+
+// makeEventByEntity make the event to publish from the event stored in the outbox, the key is the customer id
+func makeEventByEntity(event *repository.OutboxEventEntity) *events.Event {
+	return &events.Event{
+		ID:         event.ID.Hex(),
+		Type:       event.Type,
+		Key:        event.CustomerID.Hex(),
+		OccurredAt: event.OccurredAt,
+		Payload:    []byte(event.Payload),
+	}
+}
@@ -0,0 +1,160 @@
+package service
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"io"
+
+	"github.com/jcsw/go-api-learn/pkg/domain"
+	"github.com/jcsw/go-api-learn/pkg/infra/database/repository"
+)
+
+const (
+	// ExportCSV the format of an export in CSV, with a header naming the columns
+	ExportCSV = "csv"
+
+	// ExportNDJSON the format of an export in NDJSON, a customer in JSON by line with its addresses
+	ExportNDJSON = "ndjson"
+
+	// ExportExcel the format of an export in CSV that spreadsheets open as is, it starts with a byte order mark,
+	// the lines end with CRLF and the values that would be taken as formulas are escaped
+	ExportExcel = "excel"
+)
+
+// ErrUnsupportedExportFormat Error for an export in an unknown format
+var ErrUnsupportedExportFormat = domain.NewFieldError("format", "invalid_value", "Invalid value 'format'")
+
+// CustomerEncoder write the customers in an export format, they're buffered until Flush
+type CustomerEncoder interface {
+	Encode(customer *domain.Customer) error
+	Flush() error
+}
+
+// NewCustomerEncoder create the encoder of the format, the header of the CSV formats is buffered right away
+// so an empty export still names its columns
+func NewCustomerEncoder(format string, writer io.Writer) (CustomerEncoder, error) {
+	switch format {
+	case ExportCSV:
+		return newCSVEncoder(bufio.NewWriter(writer), false), nil
+	case ExportExcel:
+		buffered := bufio.NewWriter(writer)
+		buffered.WriteString("\ufeff")
+		return newCSVEncoder(buffered, true), nil
+	case ExportNDJSON:
+		buffered := bufio.NewWriter(writer)
+		return &ndjsonEncoder{buffered: buffered, encoder: json.NewEncoder(buffered)}, nil
+	default:
+		return nil, ErrUnsupportedExportFormat
+	}
+}
+
+// ExportCustomers call each for the customers matching the query, in the order of the listing, as they're read
+// from the database. The export is not paged, it starts after the cursor of the query, when there is one,
+// and goes until the last customer. It stops at the first error returned by each and returns it
+func (aggregate *CustomerAggregate) ExportCustomers(ctx context.Context, query CustomerQuery, each func(*domain.Customer) error) error {
+
+	query.Limit = 0
+	filter, err := query.toFilter()
+	if err != nil {
+		return err
+	}
+	filter.Limit = 0
+
+	var eachErr error
+	err = aggregate.Repository.StreamCustomers(ctx, filter, func(customerEntity *repository.CustomerEntity) error {
+		eachErr = each(makeCustomerByEntity(customerEntity))
+		return eachErr
+	})
+
+	if eachErr != nil {
+		return eachErr
+	}
+
+	if err == repository.ErrUnsupportedSort {
+		return ErrInvalidSort
+	}
+
+	if err != nil {
+		return domain.WrapError(domain.ErrUnexpected, "customer_export_failed", "could not export customers", err)
+	}
+
+	return nil
+}
+
+// csvEncoder write the customers by the columns shared with the import
+type csvEncoder struct {
+	writer      *csv.Writer
+	escapeCells bool
+	record      []string
+}
+
+func newCSVEncoder(buffered *bufio.Writer, excel bool) *csvEncoder {
+
+	encoder := &csvEncoder{writer: csv.NewWriter(buffered), escapeCells: excel, record: make([]string, len(customerColumns))}
+	encoder.writer.UseCRLF = excel
+
+	for i, column := range customerColumns {
+		encoder.record[i] = column.name
+	}
+	encoder.writer.Write(encoder.record)
+
+	return encoder
+}
+
+func (encoder *csvEncoder) Encode(customer *domain.Customer) error {
+
+	for i, column := range customerColumns {
+		encoder.record[i] = column.write(customer)
+		if encoder.escapeCells {
+			encoder.record[i] = escapeFormula(encoder.record[i])
+		}
+	}
+
+	return encoder.writer.Write(encoder.record)
+}
+
+func (encoder *csvEncoder) Flush() error {
+	encoder.writer.Flush()
+	return encoder.writer.Error()
+}
+
+// escapeFormula prefix with a quote the value a spreadsheet would run as a formula, like a phone starting with +
+func escapeFormula(value string) string {
+	if value != "" && isFormulaStart(value[0]) {
+		return "'" + value
+	}
+	return value
+}
+
+// unescapeFormula remove the quote escapeFormula prefixed, so a file exported for spreadsheets imports the values as they were
+func unescapeFormula(value string) string {
+	if len(value) > 1 && value[0] == '\'' && isFormulaStart(value[1]) {
+		return value[1:]
+	}
+	return value
+}
+
+// isFormulaStart whether a spreadsheet runs as a formula the value starting with the character
+func isFormulaStart(first byte) bool {
+	switch first {
+	case '=', '+', '-', '@', '\t', '\r':
+		return true
+	}
+	return false
+}
+
+// ndjsonEncoder write each customer as a line of JSON
+type ndjsonEncoder struct {
+	buffered *bufio.Writer
+	encoder  *json.Encoder
+}
+
+func (encoder *ndjsonEncoder) Encode(customer *domain.Customer) error {
+	return encoder.encoder.Encode(customer)
+}
+
+func (encoder *ndjsonEncoder) Flush() error {
+	return encoder.buffered.Flush()
+}
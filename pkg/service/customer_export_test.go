@@ -0,0 +1,187 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mongodb/mongo-go-driver/bson/objectid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+
+	"github.com/jcsw/go-api-learn/pkg/domain"
+	"github.com/jcsw/go-api-learn/pkg/infra/database/repository"
+)
+
+var exportedCustomer = &domain.Customer{
+	ID:        "5bbb50ab0c3b8a1b5c3c1d2e",
+	Name:      "Marcos, Jr",
+	City:      "Santos",
+	Phone:     "+5513987654321",
+	Status:    domain.StatusActive,
+	CreatedAt: time.Date(2018, 10, 8, 12, 0, 0, 0, time.UTC),
+	UpdatedAt: time.Date(2018, 10, 9, 8, 30, 0, 0, time.UTC),
+	Version:   2,
+	Addresses: []domain.Address{{Type: "home", Street: "Rua XV", City: "Santos"}},
+}
+
+func encodeCustomers(t *testing.T, format string, customers ...*domain.Customer) string {
+
+	out := bytes.Buffer{}
+	encoder, err := NewCustomerEncoder(format, &out)
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+
+	for _, customer := range customers {
+		assert.NoError(t, encoder.Encode(customer))
+	}
+	assert.NoError(t, encoder.Flush())
+
+	return out.String()
+}
+
+func TestShouldEncodeCustomersInCSV(t *testing.T) {
+
+	assert.Equal(t, "id,name,city,email,phone,document,status,createdAt,updatedAt,version\n"+
+		`5bbb50ab0c3b8a1b5c3c1d2e,"Marcos, Jr",Santos,,+5513987654321,,active,2018-10-08T12:00:00Z,2018-10-09T08:30:00Z,2`+"\n",
+		encodeCustomers(t, ExportCSV, exportedCustomer))
+
+	assert.Equal(t, "id,name,city,email,phone,document,status,createdAt,updatedAt,version\n", encodeCustomers(t, ExportCSV))
+}
+
+func TestShouldEncodeCustomersInCSVForSpreadsheets(t *testing.T) {
+
+	assert.Equal(t, "\ufeffid,name,city,email,phone,document,status,createdAt,updatedAt,version\r\n"+
+		`5bbb50ab0c3b8a1b5c3c1d2e,"Marcos, Jr",Santos,,'+5513987654321,,active,2018-10-08T12:00:00Z,2018-10-09T08:30:00Z,2`+"\r\n",
+		encodeCustomers(t, ExportExcel, exportedCustomer))
+}
+
+func TestShouldEscapeTheValuesSpreadsheetsRunAsFormulas(t *testing.T) {
+
+	tests := []struct {
+		value   string
+		escaped string
+	}{
+		{"=SUM(A1:A2)", "'=SUM(A1:A2)"},
+		{"+5513987654321", "'+5513987654321"},
+		{"-1", "'-1"},
+		{"@cmd", "'@cmd"},
+		{"\t=1", "'\t=1"},
+		{"\r=1", "'\r=1"},
+		{"Santos", "Santos"},
+		{"'quoted", "'quoted"},
+		{"", ""},
+	}
+
+	for _, tc := range tests {
+		assert.Equal(t, tc.escaped, escapeFormula(tc.value), tc.value)
+		assert.Equal(t, tc.value, unescapeFormula(tc.escaped), tc.value)
+	}
+}
+
+func TestShouldEncodeCustomersInNDJSONWithTheAddresses(t *testing.T) {
+
+	encoded := encodeCustomers(t, ExportNDJSON, exportedCustomer, &domain.Customer{ID: "5bbb50ab0c3b8a1b5c3c1d2f", Name: "Maria"})
+
+	lines := strings.Split(strings.TrimSuffix(encoded, "\n"), "\n")
+	if assert.Len(t, lines, 2) {
+		assert.Regexp(t, `^{"id":"5bbb50ab0c3b8a1b5c3c1d2e","name":"Marcos, Jr",.*"addresses":\[{"type":"home","street":"Rua XV".*\],"status":"active"`, lines[0])
+		assert.Regexp(t, `^{"id":"5bbb50ab0c3b8a1b5c3c1d2f","name":"Maria"`, lines[1])
+	}
+}
+
+func TestShouldImportTheCustomersExported(t *testing.T) {
+
+	for _, format := range []string{ExportCSV, ExportExcel, ExportNDJSON} {
+		importFormat := ImportCSV
+		if format == ExportNDJSON {
+			importFormat = ImportNDJSON
+		}
+
+		rows, err := ReadImportRows(importFormat, strings.NewReader(encodeCustomers(t, format, &domain.Customer{ID: "5bbb50ab0c3b8a1b5c3c1d2e",
+			Name: "Marcos, Jr", City: "Santos", Email: "marcos@example.com", Phone: "+5513987654321", Status: domain.StatusBlocked, Version: 3})))
+
+		assert.NoError(t, err, format)
+		if assert.Len(t, rows, 1, format) {
+			assert.Equal(t, &domain.Customer{Name: "Marcos, Jr", City: "Santos", Email: "marcos@example.com", Phone: "+5513987654321"}, rows[0].Customer, format)
+		}
+	}
+}
+
+func TestShouldRejectUnsupportedExportFormat(t *testing.T) {
+
+	_, err := NewCustomerEncoder("xlsx", &bytes.Buffer{})
+
+	assert.Equal(t, ErrUnsupportedExportFormat, err)
+}
+
+func TestShouldExportCustomersMatchingTheQueryWithoutPaging(t *testing.T) {
+
+	customersEntity := []*repository.CustomerEntity{
+		{ID: objectid.New(), Name: "Marcos", City: "Santos", Status: "active", Version: 1},
+		{ID: objectid.New(), Name: "Maria", City: "Santos", Status: "active", Version: 1},
+	}
+
+	repositoryMock := &repository.CustomerRepositoryMock{}
+	repositoryMock.On("StreamCustomers", mock.Anything, repository.CustomerFilter{City: "Santos", SortBy: "name", Descending: true}).Return(customersEntity, nil)
+
+	customerAggregate := CustomerAggregate{Repository: repositoryMock}
+
+	exported := []string{}
+	err := customerAggregate.ExportCustomers(context.Background(), CustomerQuery{City: "Santos", Sort: "-name", Limit: 500}, func(customer *domain.Customer) error {
+		exported = append(exported, customer.Name)
+		return nil
+	})
+
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"Marcos", "Maria"}, exported)
+}
+
+func TestShouldStopExportAtTheFirstErrorOfTheCaller(t *testing.T) {
+
+	customersEntity := []*repository.CustomerEntity{{ID: objectid.New(), Name: "Marcos"}, {ID: objectid.New(), Name: "Maria"}}
+
+	repositoryMock := &repository.CustomerRepositoryMock{}
+	repositoryMock.On("StreamCustomers", mock.Anything, mock.Anything).Return(customersEntity, nil)
+
+	customerAggregate := CustomerAggregate{Repository: repositoryMock}
+
+	brokenPipe := errors.New("broken pipe")
+	calls := 0
+	err := customerAggregate.ExportCustomers(context.Background(), CustomerQuery{}, func(customer *domain.Customer) error {
+		calls++
+		return brokenPipe
+	})
+
+	assert.Equal(t, brokenPipe, err)
+	assert.Equal(t, 1, calls)
+}
+
+func TestShouldReturnErrorWhenExportFails(t *testing.T) {
+
+	tests := []struct {
+		repositoryErr error
+		expectedErr   error
+	}{
+		{repository.ErrUnsupportedSort, ErrInvalidSort},
+		{errors.New("connection refused"), domain.ErrUnexpected},
+	}
+
+	for _, tc := range tests {
+		repositoryMock := &repository.CustomerRepositoryMock{}
+		repositoryMock.On("StreamCustomers", mock.Anything, mock.Anything).Return(nil, tc.repositoryErr)
+
+		customerAggregate := CustomerAggregate{Repository: repositoryMock}
+		err := customerAggregate.ExportCustomers(context.Background(), CustomerQuery{}, func(*domain.Customer) error { return nil })
+
+		assert.True(t, errors.Is(err, tc.expectedErr), "%v", tc.repositoryErr)
+	}
+
+	customerAggregate := CustomerAggregate{Repository: &repository.CustomerRepositoryMock{}}
+	err := customerAggregate.ExportCustomers(context.Background(), CustomerQuery{Sort: "email"}, func(*domain.Customer) error { return nil })
+	assert.Equal(t, ErrInvalidSort, err)
+}
@@ -0,0 +1,308 @@
+package service
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"io"
+	"strings"
+
+	"github.com/mongodb/mongo-go-driver/bson/objectid"
+
+	"github.com/jcsw/go-api-learn/pkg/domain"
+	"github.com/jcsw/go-api-learn/pkg/infra/database/repository"
+	"github.com/jcsw/go-api-learn/pkg/infra/logger"
+)
+
+const (
+	// ImportCSV the format of a file of customers in CSV, with a header naming the columns
+	ImportCSV = "csv"
+
+	// ImportNDJSON the format of a file of customers in NDJSON, a customer in JSON by line
+	ImportNDJSON = "ndjson"
+
+	// DefaultImportBatchSize the customers inserted at once when no batch size is informed
+	DefaultImportBatchSize = 500
+
+	// maxImportLineSize the biggest line of a NDJSON file
+	maxImportLineSize = 1 << 20
+)
+
+var (
+	// ErrUnsupportedImportFormat Error for an import in a format other than CSV or NDJSON
+	ErrUnsupportedImportFormat = domain.NewError(domain.ErrInvalid, "unsupported_import_format", "Unsupported import format")
+
+	// ErrInvalidImportHeader Error for a CSV file without a header or with an unknown or repeated column
+	ErrInvalidImportHeader = domain.NewError(domain.ErrInvalid, "invalid_import_header", "Invalid import header")
+
+	// ErrInvalidImportRow Error for a row that can not be read as a customer
+	ErrInvalidImportRow = domain.NewError(domain.ErrInvalid, "invalid_row", "Invalid row")
+)
+
+// ImportRow a customer read from an import file, the line where it starts and the result of its import,
+// the id of the customer created or the error that rejected it
+type ImportRow struct {
+	Line     int
+	Customer *domain.Customer
+	ID       string
+	Err      error
+}
+
+// ImportReport the result of an import, the rows are in the order of the file
+type ImportReport struct {
+	Total    int
+	Imported int
+	Failed   int
+	Rows     []*ImportRow
+}
+
+// ImportRowReader read the rows of an import file one at a time, a row that can not be read is returned with its error
+type ImportRowReader struct {
+	next func() (*ImportRow, error)
+}
+
+// NewImportRowReader create the reader of the rows of the file, the header of a CSV file is read right away.
+// It fails when the format is unknown or the header is invalid
+func NewImportRowReader(format string, reader io.Reader) (*ImportRowReader, error) {
+	switch format {
+	case ImportCSV:
+		return newCSVRowReader(reader)
+	case ImportNDJSON:
+		return newNDJSONRowReader(reader), nil
+	default:
+		return nil, ErrUnsupportedImportFormat
+	}
+}
+
+// Read return the next row, io.EOF after the last one. It fails when the rest of the file can not be read at all
+func (rows *ImportRowReader) Read() (*ImportRow, error) {
+	return rows.next()
+}
+
+// ReadN return the next rows up to n, less than n only when the file ends, all of them when n is negative
+func (rows *ImportRowReader) ReadN(n int) ([]*ImportRow, error) {
+
+	read := []*ImportRow{}
+	for n < 0 || len(read) < n {
+		row, err := rows.Read()
+		if err == io.EOF {
+			return read, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		read = append(read, row)
+	}
+
+	return read, nil
+}
+
+// ReadImportRows read the customers of the file, a row that can not be read is kept with its error.
+// It fails when the format is unknown or the file can not be read at all
+func ReadImportRows(format string, reader io.Reader) ([]*ImportRow, error) {
+
+	rows, err := NewImportRowReader(format, reader)
+	if err != nil {
+		return nil, err
+	}
+
+	return rows.ReadN(-1)
+}
+
+func newCSVRowReader(reader io.Reader) (*ImportRowReader, error) {
+
+	csvReader := csv.NewReader(reader)
+
+	header, err := csvReader.Read()
+	if err == io.EOF {
+		return nil, ErrInvalidImportHeader
+	}
+	if err != nil {
+		return nil, invalidImportFile(err)
+	}
+
+	columns, err := readCSVHeader(header)
+	if err != nil {
+		return nil, err
+	}
+
+	return &ImportRowReader{next: func() (*ImportRow, error) {
+
+		record, err := csvReader.Read()
+		if err == io.EOF {
+			return nil, io.EOF
+		}
+
+		var parseErr *csv.ParseError
+		if errors.As(err, &parseErr) && parseErr.Err == csv.ErrFieldCount {
+			return &ImportRow{Line: parseErr.StartLine, Err: ErrInvalidImportRow}, nil
+		}
+		if err != nil {
+			return nil, invalidImportFile(err)
+		}
+
+		line, _ := csvReader.FieldPos(0)
+		customer := &domain.Customer{}
+		for i, column := range columns {
+			if column.read != nil {
+				column.read(customer, unescapeFormula(record[i]))
+			}
+		}
+
+		return &ImportRow{Line: line, Customer: customer}, nil
+	}}, nil
+}
+
+// readCSVHeader return the column of each field of the header, the first one may carry the byte order mark
+// that spreadsheets write
+func readCSVHeader(header []string) ([]*customerColumn, error) {
+
+	columns := make([]*customerColumn, len(header), len(header))
+	seen := map[string]bool{}
+
+	for i, name := range header {
+		name = strings.TrimSpace(strings.TrimPrefix(name, "\ufeff"))
+
+		column := findCustomerColumn(name)
+		if column == nil || seen[column.name] {
+			return nil, ErrInvalidImportHeader
+		}
+
+		seen[column.name] = true
+		columns[i] = column
+	}
+
+	return columns, nil
+}
+
+func newNDJSONRowReader(reader io.Reader) *ImportRowReader {
+
+	scanner := bufio.NewScanner(reader)
+	scanner.Buffer(make([]byte, 64*1024), maxImportLineSize)
+
+	line := 0
+	return &ImportRowReader{next: func() (*ImportRow, error) {
+
+		for scanner.Scan() {
+			line++
+			if len(strings.TrimSpace(scanner.Text())) == 0 {
+				continue
+			}
+
+			customer := &domain.Customer{}
+			if err := json.Unmarshal(scanner.Bytes(), customer); err != nil {
+				return &ImportRow{Line: line, Err: ErrInvalidImportRow}, nil
+			}
+
+			// as on the creation, the id, the status and the version come from the service
+			return &ImportRow{Line: line, Customer: &domain.Customer{
+				Name:      customer.Name,
+				City:      customer.City,
+				Email:     customer.Email,
+				Phone:     customer.Phone,
+				Document:  customer.Document,
+				Addresses: customer.Addresses,
+			}}, nil
+		}
+
+		if err := scanner.Err(); err != nil {
+			return nil, invalidImportFile(err)
+		}
+
+		return nil, io.EOF
+	}}
+}
+
+func invalidImportFile(err error) error {
+	return domain.WrapError(domain.ErrInvalid, "invalid_import_file", "could not read the import file", err)
+}
+
+// ImportCustomers create the customers of the rows, validated like on CreateNewCustomer and inserted batchSize
+// at a time. It sets the id or the error of each row, a row that fails does not stop the others
+func (aggregate *CustomerAggregate) ImportCustomers(ctx context.Context, rows []*ImportRow, batchSize int) *ImportReport {
+
+	if batchSize <= 0 {
+		batchSize = DefaultImportBatchSize
+	}
+
+	batch := make([]*ImportRow, 0, batchSize)
+	for _, row := range rows {
+		if row.Err != nil {
+			continue
+		}
+
+		row.Customer.Normalize()
+		if err := row.Customer.Validate(); err != nil {
+			row.Err = err
+			continue
+		}
+
+		batch = append(batch, row)
+		if len(batch) == batchSize {
+			aggregate.importBatch(ctx, batch)
+			batch = batch[:0]
+		}
+	}
+
+	if len(batch) > 0 {
+		aggregate.importBatch(ctx, batch)
+	}
+
+	return newImportReport(rows)
+}
+
+func (aggregate *CustomerAggregate) importBatch(ctx context.Context, batch []*ImportRow) {
+
+	newCustomerEntities := make([]*repository.CustomerEntity, len(batch), len(batch))
+	changes := make([]*repository.CustomerChange, len(batch), len(batch))
+
+	for i, row := range batch {
+		newCustomerEntity := toEntity(row.Customer)
+		newCustomerEntity.ID = objectid.New()
+		newCustomerEntity.Status = string(domain.StatusActive)
+		newCustomerEntity.CreatedAt = now()
+		newCustomerEntity.UpdatedAt = newCustomerEntity.CreatedAt
+
+		newCustomerEntities[i] = newCustomerEntity
+		changes[i] = newChange(ctx, domain.AuditCreated, nil, newCustomerEntity)
+	}
+
+	rowErrors, err := aggregate.Repository.InsertCustomers(ctx, newCustomerEntities, changes)
+	if err != nil {
+		serviceLogger.WithContext(ctx).Error("could not import the batch", logger.Function("ImportCustomers"), logger.Int("rows", len(batch)), logger.Err(err))
+		err = domain.WrapError(domain.ErrUnexpected, "customer_import_failed", "could not import customers", err)
+		for _, row := range batch {
+			row.Err = err
+		}
+		return
+	}
+
+	for i, row := range batch {
+		switch {
+		case rowErrors[i] == repository.ErrDuplicateCustomer:
+			row.Err = ErrCustomerAlreadyExists
+		case rowErrors[i] != nil:
+			row.Err = domain.WrapError(domain.ErrUnexpected, "customer_registration_failed", "could not complete customer registration", rowErrors[i])
+		default:
+			row.ID = newCustomerEntities[i].ID.Hex()
+			aggregate.lookup.forget(newCustomerEntities[i].Name)
+			aggregate.notify(ctx, changes[i])
+		}
+	}
+}
+
+func newImportReport(rows []*ImportRow) *ImportReport {
+
+	report := &ImportReport{Total: len(rows), Rows: rows}
+	for _, row := range rows {
+		if row.Err != nil {
+			report.Failed++
+		} else {
+			report.Imported++
+		}
+	}
+
+	return report
+}
@@ -0,0 +1,72 @@
+package service
+
+import (
+	"context"
+)
+
+// DefaultMaxSyncImportRows the rows imported during the request when no limit is informed
+const DefaultMaxSyncImportRows = 1000
+
+// CustomerImporter import the customers during the request up to MaxSyncRows rows, bigger files are imported
+// in background by a job
+type CustomerImporter struct {
+	Aggregate   *CustomerAggregate
+	BatchSize   int
+	MaxSyncRows int
+}
+
+// SyncLimit the rows imported during the request, MaxSyncRows or DefaultMaxSyncImportRows when it's not informed
+func (importer *CustomerImporter) SyncLimit() int {
+
+	if importer.MaxSyncRows <= 0 {
+		return DefaultMaxSyncImportRows
+	}
+
+	return importer.MaxSyncRows
+}
+
+// BatchLimit the rows imported at a time, BatchSize or DefaultImportBatchSize when it's not informed
+func (importer *CustomerImporter) BatchLimit() int {
+
+	if importer.BatchSize <= 0 {
+		return DefaultImportBatchSize
+	}
+
+	return importer.BatchSize
+}
+
+// IsAsync report whether the rows are too many to import during the request
+func (importer *CustomerImporter) IsAsync(rows []*ImportRow) bool {
+	return len(rows) > importer.SyncLimit()
+}
+
+// Import import the rows and return the report
+func (importer *CustomerImporter) Import(ctx context.Context, rows []*ImportRow) *ImportReport {
+	return importer.Aggregate.ImportCustomers(ctx, rows, importer.BatchSize)
+}
+
+// ImportFrom import the rows of the file a batch at a time, the next batch is read only after the one before
+// is imported and the customers of the rows imported are released, the report keeps only their line, id and error.
+// It stops at the first error reading the file, the batches imported before it stay imported
+func (importer *CustomerImporter) ImportFrom(ctx context.Context, rows *ImportRowReader) (*ImportReport, error) {
+
+	batchSize := importer.BatchLimit()
+
+	imported := []*ImportRow{}
+	for {
+		batch, err := rows.ReadN(batchSize)
+		if err != nil {
+			return nil, err
+		}
+
+		importer.Aggregate.ImportCustomers(ctx, batch, batchSize)
+		for _, row := range batch {
+			row.Customer = nil
+		}
+		imported = append(imported, batch...)
+
+		if len(batch) < batchSize {
+			return newImportReport(imported), nil
+		}
+	}
+}
@@ -0,0 +1,176 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+
+	"github.com/jcsw/go-api-learn/pkg/domain"
+	"github.com/jcsw/go-api-learn/pkg/infra/database/repository"
+	"github.com/jcsw/go-api-learn/pkg/infra/events"
+)
+
+func TestShouldReadCSVRowsByTheColumnsOfTheHeader(t *testing.T) {
+
+	file := "\ufeffCity,name,status,email\n" +
+		"Santos,Marcos,blocked,MARCOS@EXAMPLE.COM\n" +
+		"Campinas\n" +
+		"\"São\nPaulo\",Maria,,\n"
+
+	rows, err := ReadImportRows(ImportCSV, strings.NewReader(file))
+
+	assert.Nil(t, err)
+	if assert.Len(t, rows, 3) {
+		assert.Equal(t, &ImportRow{Line: 2, Customer: &domain.Customer{Name: "Marcos", City: "Santos", Email: "MARCOS@EXAMPLE.COM"}}, rows[0])
+		assert.Equal(t, &ImportRow{Line: 3, Err: ErrInvalidImportRow}, rows[1])
+		assert.Equal(t, &ImportRow{Line: 4, Customer: &domain.Customer{Name: "Maria", City: "São\nPaulo"}}, rows[2])
+	}
+}
+
+func TestShouldRejectCSVWithInvalidHeader(t *testing.T) {
+
+	tests := []string{"", "name,age\n", "name,city,Name\n"}
+
+	for _, file := range tests {
+		_, err := ReadImportRows(ImportCSV, strings.NewReader(file))
+		assert.Equal(t, ErrInvalidImportHeader, err, "file %q", file)
+	}
+}
+
+func TestShouldRejectCSVThatCanNotBeParsed(t *testing.T) {
+
+	_, err := ReadImportRows(ImportCSV, strings.NewReader("name,city\n\"Marcos,Santos\n"))
+
+	assert.True(t, errors.Is(err, domain.ErrInvalid))
+}
+
+func TestShouldReadNDJSONRowsSkippingBlankLines(t *testing.T) {
+
+	file := `{"id":"5bbb50ab0c3b8a1b5c3c1d2e","name":"Marcos","city":"Santos","status":"closed","addresses":[{"type":"home","city":"Santos"}]}` + "\n" +
+		"\n" +
+		`{"name":` + "\n" +
+		`{"name":"Maria","city":"Campinas"}`
+
+	rows, err := ReadImportRows(ImportNDJSON, strings.NewReader(file))
+
+	assert.Nil(t, err)
+	if assert.Len(t, rows, 3) {
+		assert.Equal(t, &ImportRow{Line: 1, Customer: &domain.Customer{Name: "Marcos", City: "Santos",
+			Addresses: []domain.Address{{Type: "home", City: "Santos"}}}}, rows[0])
+		assert.Equal(t, &ImportRow{Line: 3, Err: ErrInvalidImportRow}, rows[1])
+		assert.Equal(t, &ImportRow{Line: 4, Customer: &domain.Customer{Name: "Maria", City: "Campinas"}}, rows[2])
+	}
+}
+
+func TestShouldRejectUnsupportedImportFormat(t *testing.T) {
+
+	_, err := ReadImportRows("xml", strings.NewReader("<customers/>"))
+
+	assert.Equal(t, ErrUnsupportedImportFormat, err)
+}
+
+func TestShouldImportValidRowsInBatchesAndReportEachRow(t *testing.T) {
+
+	createdAt := freezeNow(t)
+	rows := []*ImportRow{
+		{Line: 2, Customer: &domain.Customer{Name: "Marcos", City: "Santos", Email: " MARCOS@EXAMPLE.COM "}},
+		{Line: 3, Customer: &domain.Customer{Name: "Maria"}},
+		{Line: 4, Err: ErrInvalidImportRow},
+		{Line: 5, Customer: &domain.Customer{Name: "Joana", City: "Campinas"}},
+		{Line: 6, Customer: &domain.Customer{Name: "Pedro", City: "Recife"}},
+	}
+
+	repositoryMock := &repository.CustomerRepositoryMock{}
+	repositoryMock.On("InsertCustomers", mock.Anything, mock.MatchedBy(func(entities []*repository.CustomerEntity) bool {
+		return len(entities) == 2 && entities[0].Name == "Marcos" && entities[0].Email == "marcos@example.com" &&
+			entities[0].Status == "active" && entities[0].CreatedAt == createdAt && entities[1].Name == "Joana"
+	}), mock.Anything).Return([]error{nil, repository.ErrDuplicateCustomer}, nil).Once()
+	repositoryMock.On("InsertCustomers", mock.Anything, mock.MatchedBy(func(entities []*repository.CustomerEntity) bool {
+		return len(entities) == 1 && entities[0].Name == "Pedro"
+	}), mock.Anything).Return(nil, errors.New("connection refused")).Once()
+
+	notifier := &events.MemoryPublisher{}
+	customerAggregate := CustomerAggregate{Repository: repositoryMock, Notifier: notifier}
+
+	report := customerAggregate.ImportCustomers(context.Background(), rows, 2)
+
+	assert.Equal(t, 5, report.Total)
+	assert.Equal(t, 1, report.Imported)
+	assert.Equal(t, 4, report.Failed)
+
+	assert.Len(t, rows[0].ID, 24)
+	assert.Nil(t, rows[0].Err)
+	assert.True(t, errors.Is(rows[1].Err, domain.ErrInvalidCity))
+	assert.Equal(t, ErrInvalidImportRow, rows[2].Err)
+	assert.Equal(t, ErrCustomerAlreadyExists, rows[3].Err)
+	assert.True(t, errors.Is(rows[4].Err, domain.ErrUnexpected))
+
+	if notified := notifier.Events(); assert.Len(t, notified, 1) {
+		assert.Equal(t, rows[0].ID, notified[0].Key)
+	}
+
+	repositoryMock.AssertNumberOfCalls(t, "InsertCustomers", 2)
+}
+
+func TestShouldLimitTheRowsImportedDuringTheRequestAndAtATime(t *testing.T) {
+
+	rows := []*ImportRow{{Line: 1}, {Line: 2}, {Line: 3}}
+
+	importer := &CustomerImporter{BatchSize: 2, MaxSyncRows: 2}
+	assert.True(t, importer.IsAsync(rows))
+	assert.False(t, importer.IsAsync(rows[:2]))
+	assert.Equal(t, 2, importer.BatchLimit())
+
+	importer = &CustomerImporter{}
+	assert.Equal(t, DefaultMaxSyncImportRows, importer.SyncLimit())
+	assert.Equal(t, DefaultImportBatchSize, importer.BatchLimit())
+}
+
+func TestShouldImportFromTheFileABatchAtATime(t *testing.T) {
+
+	freezeNow(t)
+	repositoryMock := &repository.CustomerRepositoryMock{}
+	repositoryMock.On("InsertCustomers", mock.Anything, mock.Anything, mock.Anything).Return(nil, nil)
+
+	importer := &CustomerImporter{Aggregate: &CustomerAggregate{Repository: repositoryMock}, BatchSize: 2}
+
+	rows, err := NewImportRowReader(ImportCSV, strings.NewReader("name,city\nMarcos,Santos\nMaria,Campinas\nAmanda,Limeira\n"))
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	report, err := importer.ImportFrom(context.Background(), rows)
+
+	assert.NoError(t, err)
+	assert.Equal(t, 3, report.Total)
+	assert.Equal(t, 3, report.Imported)
+	for _, row := range report.Rows {
+		assert.Nil(t, row.Customer)
+		assert.NotEmpty(t, row.ID)
+	}
+	repositoryMock.AssertNumberOfCalls(t, "InsertCustomers", 2)
+}
+
+func TestShouldStopImportFromTheFileWhenItCanNotBeRead(t *testing.T) {
+
+	freezeNow(t)
+	repositoryMock := &repository.CustomerRepositoryMock{}
+	repositoryMock.On("InsertCustomers", mock.Anything, mock.Anything, mock.Anything).Return(nil, nil)
+
+	importer := &CustomerImporter{Aggregate: &CustomerAggregate{Repository: repositoryMock}, BatchSize: 2}
+
+	rows, err := NewImportRowReader(ImportCSV, strings.NewReader("name,city\nMarcos,Santos\nMaria,Campinas\n\"Amanda,Limeira\n"))
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	report, err := importer.ImportFrom(context.Background(), rows)
+
+	assert.Nil(t, report)
+	assert.True(t, errors.Is(err, domain.ErrInvalid))
+	repositoryMock.AssertNumberOfCalls(t, "InsertCustomers", 1)
+}
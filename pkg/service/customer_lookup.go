@@ -0,0 +1,142 @@
+package service
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/sync/singleflight"
+
+	"github.com/jcsw/go-api-learn/pkg/infra/database/repository"
+)
+
+const (
+	// notFoundTTL how long a name that was not found in database is answered without querying it again
+	notFoundTTL = 5 * time.Second
+
+	// maxNotFoundNames the names not found remembered at most, the new ones are not remembered while it's full
+	maxNotFoundNames = 10000
+)
+
+// LookupStats the counters of the lookups by name that reached the database or were saved
+type LookupStats struct {
+	Lookups           int64 `json:"lookups"`
+	DatabaseCalls     int64 `json:"databaseCalls"`
+	CoalescedLookups  int64 `json:"coalescedLookups"`
+	NegativeCacheHits int64 `json:"negativeCacheHits"`
+	SavedCalls        int64 `json:"savedCalls"`
+}
+
+// customerLookup coalesce the concurrent lookups by the same name and remember the names not found for notFoundTTL.
+// The names not found are remembered by this process only, a customer created with the name by another instance
+// is not found here until the name expires
+type customerLookup struct {
+	group         singleflight.Group
+	mutex         sync.Mutex
+	notFoundNames map[string]time.Time
+
+	lookups           int64
+	databaseCalls     int64
+	negativeCacheHits int64
+}
+
+// findByName call find once for all the concurrent lookups by the same name, find receives a context detached from
+// the caller so a canceled request does not fail the lookups coalesced with it, the caller stops waiting when its
+// context is done
+func (lookup *customerLookup) findByName(ctx context.Context, customerName string,
+	find func(ctx context.Context) (*repository.CustomerEntity, error)) (*repository.CustomerEntity, error) {
+
+	if lookup.isKnownAsNotFound(customerName) {
+		atomic.AddInt64(&lookup.negativeCacheHits, 1)
+		return nil, nil
+	}
+
+	atomic.AddInt64(&lookup.lookups, 1)
+	findCtx := detach(ctx)
+	result := lookup.group.DoChan(customerName, func() (interface{}, error) {
+		atomic.AddInt64(&lookup.databaseCalls, 1)
+
+		customerEntity, err := find(findCtx)
+		if err == nil && customerEntity == nil {
+			lookup.rememberNotFound(customerName)
+		}
+
+		return customerEntity, err
+	})
+
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case found := <-result:
+		if found.Err != nil {
+			return nil, found.Err
+		}
+		customerEntity, _ := found.Val.(*repository.CustomerEntity)
+		return customerEntity, nil
+	}
+}
+
+func (lookup *customerLookup) isKnownAsNotFound(customerName string) bool {
+
+	lookup.mutex.Lock()
+	defer lookup.mutex.Unlock()
+
+	expiresAt, ok := lookup.notFoundNames[customerName]
+	if !ok {
+		return false
+	}
+
+	if time.Now().After(expiresAt) {
+		delete(lookup.notFoundNames, customerName)
+		return false
+	}
+
+	return true
+}
+
+// rememberNotFound remember the name as not found, the expired names are swept when the names are full
+func (lookup *customerLookup) rememberNotFound(customerName string) {
+
+	lookup.mutex.Lock()
+	defer lookup.mutex.Unlock()
+
+	if lookup.notFoundNames == nil {
+		lookup.notFoundNames = map[string]time.Time{}
+	}
+
+	if len(lookup.notFoundNames) >= maxNotFoundNames {
+		now := time.Now()
+		for name, expiresAt := range lookup.notFoundNames {
+			if now.After(expiresAt) {
+				delete(lookup.notFoundNames, name)
+			}
+		}
+	}
+
+	if len(lookup.notFoundNames) < maxNotFoundNames {
+		lookup.notFoundNames[customerName] = time.Now().Add(notFoundTTL)
+	}
+}
+
+// forget remove the name from the names not found, it must be called when a customer starts to use the name
+func (lookup *customerLookup) forget(customerName string) {
+
+	lookup.mutex.Lock()
+	defer lookup.mutex.Unlock()
+
+	delete(lookup.notFoundNames, customerName)
+}
+
+func (lookup *customerLookup) stats() LookupStats {
+
+	stats := LookupStats{
+		Lookups:           atomic.LoadInt64(&lookup.lookups),
+		DatabaseCalls:     atomic.LoadInt64(&lookup.databaseCalls),
+		NegativeCacheHits: atomic.LoadInt64(&lookup.negativeCacheHits),
+	}
+
+	stats.CoalescedLookups = stats.Lookups - stats.DatabaseCalls
+	stats.SavedCalls = stats.CoalescedLookups + stats.NegativeCacheHits
+	return stats
+}
@@ -0,0 +1,126 @@
+package service
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"strings"
+
+	"github.com/mongodb/mongo-go-driver/bson/objectid"
+
+	"github.com/jcsw/go-api-learn/pkg/domain"
+	"github.com/jcsw/go-api-learn/pkg/infra/database/repository"
+)
+
+const (
+	// DefaultPageLimit the page size used when no limit is informed
+	DefaultPageLimit = 20
+
+	// MaxPageLimit the biggest page size allowed
+	MaxPageLimit = 100
+)
+
+var (
+	// ErrInvalidLimit Error for invalid page limit
+	ErrInvalidLimit = domain.NewFieldError("limit", "invalid_value", "Invalid value 'limit'")
+
+	// ErrInvalidSort Error for invalid sort
+	ErrInvalidSort = domain.NewFieldError("sort", "invalid_value", "Invalid value 'sort'")
+
+	// ErrInvalidCursor Error for invalid page cursor
+	ErrInvalidCursor = domain.NewFieldError("after", "invalid_value", "Invalid value 'after'")
+)
+
+// sortableFields maps the sort values accepted on the API to the document fields
+var sortableFields = map[string]string{
+	"id":   "_id",
+	"name": "name",
+	"city": "city",
+}
+
+// CustomerQuery define the filter, the sort and the page to list customers
+type CustomerQuery struct {
+	City  string
+	Sort  string
+	After string
+	Limit int
+}
+
+// CustomerPage a page of customers, Next is empty when it is the last page
+type CustomerPage struct {
+	Customers []*domain.Customer
+	Next      string
+}
+
+// pageCursor the position of the last customer returned in a page
+type pageCursor struct {
+	Sort  string `json:"s"`
+	ID    string `json:"i"`
+	Value string `json:"v,omitempty"`
+}
+
+func (query CustomerQuery) toFilter() (repository.CustomerFilter, error) {
+
+	filter := repository.CustomerFilter{City: query.City, SortBy: "_id"}
+
+	if query.Limit < 0 || query.Limit > MaxPageLimit {
+		return filter, ErrInvalidLimit
+	}
+
+	filter.Limit = int64(query.Limit)
+	if filter.Limit == 0 {
+		filter.Limit = DefaultPageLimit
+	}
+
+	if query.Sort != "" {
+		field, ok := sortableFields[strings.TrimPrefix(query.Sort, "-")]
+		if !ok {
+			return filter, ErrInvalidSort
+		}
+		filter.SortBy = field
+		filter.Descending = strings.HasPrefix(query.Sort, "-")
+	}
+
+	if query.After != "" {
+		cursor, err := decodePageCursor(query.After)
+		if err != nil || cursor.Sort != query.Sort {
+			return filter, ErrInvalidCursor
+		}
+
+		filter.AfterID, err = objectid.FromHex(cursor.ID)
+		if err != nil {
+			return filter, ErrInvalidCursor
+		}
+		filter.AfterValue = cursor.Value
+	}
+
+	return filter, nil
+}
+
+func makePageCursor(query CustomerQuery, filter repository.CustomerFilter, last *repository.CustomerEntity) string {
+
+	cursor := pageCursor{Sort: query.Sort, ID: last.ID.Hex()}
+	switch filter.SortBy {
+	case "name":
+		cursor.Value = last.Name
+	case "city":
+		cursor.Value = last.City
+	}
+
+	cursorInBytes, _ := json.Marshal(cursor)
+	return base64.RawURLEncoding.EncodeToString(cursorInBytes)
+}
+
+func decodePageCursor(encoded string) (*pageCursor, error) {
+
+	cursorInBytes, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, err
+	}
+
+	cursor := pageCursor{}
+	if err := json.Unmarshal(cursorInBytes, &cursor); err != nil {
+		return nil, err
+	}
+
+	return &cursor, nil
+}
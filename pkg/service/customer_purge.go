@@ -0,0 +1,71 @@
+package service
+
+import (
+	"context"
+	"time"
+
+	"github.com/jcsw/go-api-learn/pkg/infra/logger"
+)
+
+var serviceLogger = logger.With(logger.Package("service"))
+
+// CustomerPurgeJob remove in background the customers deleted for longer than the retention,
+// it runs on every interval and whenever it's triggered
+type CustomerPurgeJob struct {
+	aggregate *CustomerAggregate
+	retention time.Duration
+	interval  time.Duration
+	trigger   chan struct{}
+}
+
+// NewCustomerPurgeJob create a CustomerPurgeJob, a zero interval means it only runs when triggered
+func NewCustomerPurgeJob(aggregate *CustomerAggregate, retention time.Duration, interval time.Duration) *CustomerPurgeJob {
+	return &CustomerPurgeJob{
+		aggregate: aggregate,
+		retention: retention,
+		interval:  interval,
+		trigger:   make(chan struct{}, 1),
+	}
+}
+
+// Trigger ask the job to run as soon as possible, a trigger is dropped when another one is already pending
+func (job *CustomerPurgeJob) Trigger() {
+	select {
+	case job.trigger <- struct{}{}:
+	default:
+	}
+}
+
+// Run purge the customers until ctx is done
+func (job *CustomerPurgeJob) Run(ctx context.Context) {
+
+	var tick <-chan time.Time
+	if job.interval > 0 {
+		ticker := time.NewTicker(job.interval)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-tick:
+		case <-job.trigger:
+		}
+
+		job.purge(ctx)
+	}
+}
+
+func (job *CustomerPurgeJob) purge(ctx context.Context) {
+	log := serviceLogger.WithContext(ctx).With(logger.Function("CustomerPurgeJob"), logger.Duration("retention", job.retention))
+
+	purged, err := job.aggregate.PurgeDeletedCustomers(ctx, job.retention)
+	if err != nil {
+		log.Error("could not purge the deleted customers", logger.Int64("purged", purged), logger.Err(err))
+		return
+	}
+
+	log.Info("deleted customers purged", logger.Int64("purged", purged))
+}
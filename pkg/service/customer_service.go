@@ -1,62 +1,118 @@
 package service
 
 import (
-	"errors"
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/mongodb/mongo-go-driver/bson/objectid"
 
 	"github.com/jcsw/go-api-learn/pkg/domain"
 	"github.com/jcsw/go-api-learn/pkg/infra/cache/cachestore"
 	"github.com/jcsw/go-api-learn/pkg/infra/database/repository"
+	"github.com/jcsw/go-api-learn/pkg/infra/events"
+	"github.com/jcsw/go-api-learn/pkg/infra/logger"
+)
+
+var (
+	// ErrCustomerNotFound Error for a customer that does not exist
+	ErrCustomerNotFound = domain.NewError(domain.ErrNotFound, "customer_not_found", "Customer not found")
+
+	// ErrCustomerAlreadyExists Error for a customer with the name, the email or the document of another customer
+	ErrCustomerAlreadyExists = domain.NewError(domain.ErrConflict, "customer_already_exists", "Customer already exists")
+
+	// ErrCustomerVersionMismatch Error for a write based on a version of the customer that is not the current one
+	ErrCustomerVersionMismatch = domain.NewError(domain.ErrStale, "customer_version_mismatch", "Customer was modified by another request")
+
+	// ErrCustomerNotDeleted Error for a restore of a customer that is not deleted
+	ErrCustomerNotDeleted = domain.NewError(domain.ErrConflict, "customer_not_deleted", "Customer is not deleted")
 )
 
-// CustomerAggregate aggregate to customer service
+// AnyVersion the expected version that matches the current version of the customer, whatever it is
+const AnyVersion int64 = -1
+
+// CustomerAggregate aggregate to customer service, the events of the changes are also sent to the Notifier,
+// when there is one, as soon as they are written
 type CustomerAggregate struct {
 	Repository repository.CustomerRepository
 	CacheStore cachestore.CustomerCacheStore
+	Notifier   events.EventPublisher
+
+	lookup customerLookup
 }
 
-// CreateNewCustomer create a new customer
-func (aggregate *CustomerAggregate) CreateNewCustomer(newCustomer *domain.Customer) (*domain.Customer, error) {
+// CreateNewCustomer create a new customer, every write of a customer is recorded in its history
+// and emits an event, both written along with the customer
+func (aggregate *CustomerAggregate) CreateNewCustomer(ctx context.Context, newCustomer *domain.Customer) (*domain.Customer, error) {
 
+	newCustomer.Normalize()
 	if err := newCustomer.Validate(); err != nil {
 		return nil, err
 	}
 
 	newCustomerEntity := toEntity(newCustomer)
-	if err := aggregate.Repository.InsertCustomer(newCustomerEntity); err != nil {
-		return nil, errors.New("could not complete customer registration")
+	newCustomerEntity.ID = objectid.New()
+	newCustomerEntity.Status = string(domain.StatusActive)
+	newCustomerEntity.CreatedAt = now()
+	newCustomerEntity.UpdatedAt = newCustomerEntity.CreatedAt
+
+	change := newChange(ctx, domain.AuditCreated, nil, newCustomerEntity)
+	err := aggregate.Repository.InsertCustomer(ctx, newCustomerEntity, change)
+	if err == repository.ErrDuplicateCustomer {
+		return nil, ErrCustomerAlreadyExists
+	}
+
+	if err != nil {
+		return nil, domain.WrapError(domain.ErrUnexpected, "customer_registration_failed", "could not complete customer registration", err)
 	}
 
+	aggregate.CacheStore.PersistCustomerEntity(ctx, newCustomerEntity)
+	aggregate.lookup.forget(newCustomerEntity.Name)
+	aggregate.notify(ctx, change)
+
 	return makeCustomerByEntity(newCustomerEntity), nil
 }
 
 // FindCustomerByName find customer by name
-func (aggregate *CustomerAggregate) FindCustomerByName(customerName string) (*domain.Customer, error) {
+func (aggregate *CustomerAggregate) FindCustomerByName(ctx context.Context, customerName string) (*domain.Customer, error) {
 
-	customerEntity := aggregate.CacheStore.RetriveCustomerEntity(customerName)
+	customerEntity := aggregate.CacheStore.RetriveCustomerEntity(ctx, customerName)
 	if customerEntity != nil {
 		return makeCustomerByEntity(customerEntity), nil
 	}
 
-	customerEntity, err := aggregate.Repository.FindCustomerByName(customerName)
+	customerEntity, err := aggregate.lookup.findByName(ctx, customerName, func(ctx context.Context) (*repository.CustomerEntity, error) {
+
+		customerEntity, err := aggregate.Repository.FindCustomerByName(ctx, customerName)
+		if customerEntity != nil {
+			aggregate.CacheStore.PersistCustomerEntity(ctx, customerEntity)
+		}
+
+		return customerEntity, err
+	})
+
 	if err != nil {
-		return nil, errors.New("could not find customer\n" + err.Error())
+		return nil, domain.WrapError(domain.ErrUnexpected, "customer_search_failed", "could not find customer", err)
 	}
 
 	if customerEntity == nil {
-		return nil, nil
+		return nil, ErrCustomerNotFound
 	}
 
-	aggregate.CacheStore.PersistCustomerEntity(customerEntity)
-
 	return makeCustomerByEntity(customerEntity), nil
 }
 
+// LookupStats return the counters of the lookups by name
+func (aggregate *CustomerAggregate) LookupStats() LookupStats {
+	return aggregate.lookup.stats()
+}
+
 // FindAllCustomers find all customers
-func (aggregate *CustomerAggregate) FindAllCustomers() ([]*domain.Customer, error) {
+func (aggregate *CustomerAggregate) FindAllCustomers(ctx context.Context) ([]*domain.Customer, error) {
 
-	customersEntity, err := aggregate.Repository.FindAllCustomers()
+	customersEntity, err := aggregate.Repository.FindAllCustomers(ctx)
 	if err != nil {
-		return nil, errors.New("could not find customers\n" + err.Error())
+		return nil, domain.WrapError(domain.ErrUnexpected, "customer_search_failed", "could not find customers", err)
 	}
 
 	customers := make([]*domain.Customer, len(customersEntity), len(customersEntity))
@@ -67,14 +123,358 @@ func (aggregate *CustomerAggregate) FindAllCustomers() ([]*domain.Customer, erro
 	return customers, nil
 }
 
+// FindCustomers find a page of customers matching the query
+func (aggregate *CustomerAggregate) FindCustomers(ctx context.Context, query CustomerQuery) (*CustomerPage, error) {
+
+	filter, err := query.toFilter()
+	if err != nil {
+		return nil, err
+	}
+
+	pageLimit := filter.Limit
+	filter.Limit++
+
+	customersEntity, err := aggregate.Repository.FindCustomers(ctx, filter)
+	if err == repository.ErrUnsupportedSort {
+		return nil, ErrInvalidSort
+	}
+
+	if err != nil {
+		return nil, domain.WrapError(domain.ErrUnexpected, "customer_search_failed", "could not find customers", err)
+	}
+
+	page := CustomerPage{}
+	if int64(len(customersEntity)) > pageLimit {
+		customersEntity = customersEntity[:pageLimit]
+		page.Next = makePageCursor(query, filter, customersEntity[pageLimit-1])
+	}
+
+	page.Customers = make([]*domain.Customer, len(customersEntity), len(customersEntity))
+	for i, entity := range customersEntity {
+		page.Customers[i] = makeCustomerByEntity(entity)
+	}
+
+	return &page, nil
+}
+
+// FindCustomerByID find customer by id
+func (aggregate *CustomerAggregate) FindCustomerByID(ctx context.Context, customerID string) (*domain.Customer, error) {
+
+	customerEntity, err := aggregate.findCustomerEntityByID(ctx, customerID)
+	if err != nil {
+		return nil, err
+	}
+
+	return makeCustomerByEntity(customerEntity), nil
+}
+
+// UpdateCustomer replace all values of the customer when its current version is the expected one
+func (aggregate *CustomerAggregate) UpdateCustomer(ctx context.Context, customerID string, expectedVersion int64, customer *domain.Customer) (*domain.Customer, error) {
+
+	customer.Normalize()
+	if err := customer.Validate(); err != nil {
+		return nil, err
+	}
+
+	currentEntity, err := aggregate.findCustomerEntityByID(ctx, customerID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := checkVersion(currentEntity, expectedVersion); err != nil {
+		return nil, err
+	}
+
+	return aggregate.replaceCustomer(ctx, currentEntity, customer)
+}
+
+// PatchCustomer apply a JSON Merge Patch (RFC 7396) on the customer when its current version is the expected one
+func (aggregate *CustomerAggregate) PatchCustomer(ctx context.Context, customerID string, expectedVersion int64, patch []byte) (*domain.Customer, error) {
+
+	currentEntity, err := aggregate.findCustomerEntityByID(ctx, customerID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := checkVersion(currentEntity, expectedVersion); err != nil {
+		return nil, err
+	}
+
+	currentCustomer, err := json.Marshal(makeCustomerByEntity(currentEntity))
+	if err != nil {
+		return nil, domain.WrapError(domain.ErrUnexpected, "customer_patch_failed", "could not patch customer", err)
+	}
+
+	patchedCustomer, err := applyMergePatch(currentCustomer, patch)
+	if err != nil {
+		return nil, err
+	}
+
+	customer := domain.Customer{}
+	if err := json.Unmarshal(patchedCustomer, &customer); err != nil {
+		return nil, ErrInvalidMergePatch
+	}
+
+	customer.Normalize()
+	if err := customer.Validate(); err != nil {
+		return nil, err
+	}
+
+	return aggregate.replaceCustomer(ctx, currentEntity, &customer)
+}
+
+// DeleteCustomer put a tombstone on the customer when its current version is the expected one,
+// it's not found anymore until restored and it's removed by the purge after the retention.
+// Return the version of the deleted customer, expected by the restore
+func (aggregate *CustomerAggregate) DeleteCustomer(ctx context.Context, customerID string, expectedVersion int64) (int64, error) {
+
+	currentEntity, err := aggregate.findCustomerEntityByID(ctx, customerID)
+	if err != nil {
+		return 0, err
+	}
+
+	if err := checkVersion(currentEntity, expectedVersion); err != nil {
+		return 0, err
+	}
+
+	deletedEntity := *currentEntity
+	deletedEntity.DeletedAt = now()
+	deletedEntity.UpdatedAt = deletedEntity.DeletedAt
+
+	change := newChange(ctx, domain.AuditDeleted, currentEntity, &deletedEntity)
+	deleted, err := aggregate.Repository.UpdateCustomer(ctx, &deletedEntity, change)
+	aggregate.CacheStore.RemoveCustomerEntity(detach(ctx), currentEntity.Name)
+
+	if err != nil {
+		return 0, domain.WrapError(domain.ErrUnexpected, "customer_delete_failed", "could not delete customer", err)
+	}
+
+	if !deleted {
+		return 0, ErrCustomerVersionMismatch
+	}
+
+	aggregate.notify(ctx, change)
+
+	return deletedEntity.Version, nil
+}
+
+// RestoreCustomer remove the tombstone of the customer when its current version is the expected one
+func (aggregate *CustomerAggregate) RestoreCustomer(ctx context.Context, customerID string, expectedVersion int64) (*domain.Customer, error) {
+
+	currentEntity, err := aggregate.findStoredCustomerEntityByID(ctx, customerID)
+	if err != nil {
+		return nil, err
+	}
+
+	if !currentEntity.IsDeleted() {
+		return nil, ErrCustomerNotDeleted
+	}
+
+	if err := checkVersion(currentEntity, expectedVersion); err != nil {
+		return nil, err
+	}
+
+	restoredEntity := *currentEntity
+	restoredEntity.DeletedAt = time.Time{}
+	restoredEntity.UpdatedAt = now()
+
+	change := newChange(ctx, domain.AuditRestored, currentEntity, &restoredEntity)
+	restored, err := aggregate.Repository.UpdateCustomer(ctx, &restoredEntity, change)
+	aggregate.CacheStore.RemoveCustomerEntity(detach(ctx), currentEntity.Name)
+	aggregate.lookup.forget(currentEntity.Name)
+
+	if err == repository.ErrDuplicateCustomer {
+		return nil, ErrCustomerAlreadyExists
+	}
+
+	if err != nil {
+		return nil, domain.WrapError(domain.ErrUnexpected, "customer_restore_failed", "could not restore customer", err)
+	}
+
+	if !restored {
+		return nil, ErrCustomerVersionMismatch
+	}
+
+	aggregate.notify(ctx, change)
+
+	return makeCustomerByEntity(&restoredEntity), nil
+}
+
+// PurgeDeletedCustomers remove for good the customers deleted for longer than the retention, return how many were removed
+func (aggregate *CustomerAggregate) PurgeDeletedCustomers(ctx context.Context, retention time.Duration) (int64, error) {
+
+	purged, err := aggregate.Repository.PurgeCustomers(ctx, now().Add(-retention))
+	if err != nil {
+		return purged, domain.WrapError(domain.ErrUnexpected, "customer_purge_failed", "could not purge customers", err)
+	}
+
+	return purged, nil
+}
+
+// findCustomerEntityByID find the customer that is not deleted
+func (aggregate *CustomerAggregate) findCustomerEntityByID(ctx context.Context, customerID string) (*repository.CustomerEntity, error) {
+
+	customerEntity, err := aggregate.findStoredCustomerEntityByID(ctx, customerID)
+	if err != nil {
+		return nil, err
+	}
+
+	if customerEntity.IsDeleted() {
+		return nil, ErrCustomerNotFound
+	}
+
+	return customerEntity, nil
+}
+
+// findStoredCustomerEntityByID find the customer even when it's deleted
+func (aggregate *CustomerAggregate) findStoredCustomerEntityByID(ctx context.Context, customerID string) (*repository.CustomerEntity, error) {
+
+	id, err := objectid.FromHex(customerID)
+	if err != nil {
+		return nil, ErrCustomerNotFound
+	}
+
+	customerEntity, err := aggregate.Repository.FindCustomerByID(ctx, id)
+	if err != nil {
+		return nil, domain.WrapError(domain.ErrUnexpected, "customer_search_failed", "could not find customer", err)
+	}
+
+	if customerEntity == nil {
+		return nil, ErrCustomerNotFound
+	}
+
+	return customerEntity, nil
+}
+
+// replaceCustomer write the customer over the current entity and evict both names from cache,
+// they are evicted even when the write fails or the request is canceled because the stored state is unknown.
+// The customer keeps the current status when none is informed and the creation time is never replaced
+func (aggregate *CustomerAggregate) replaceCustomer(ctx context.Context, currentEntity *repository.CustomerEntity, customer *domain.Customer) (*domain.Customer, error) {
+
+	currentStatus := statusOf(currentEntity)
+	if customer.Status == "" {
+		customer.Status = currentStatus
+	}
+
+	if err := currentStatus.ValidateTransition(customer.Status); err != nil {
+		return nil, err
+	}
+
+	customerEntity := toEntity(customer)
+	customerEntity.ID = currentEntity.ID
+	customerEntity.CreatedAt = currentEntity.CreatedAt
+	customerEntity.UpdatedAt = now()
+	customerEntity.Version = currentEntity.Version
+
+	change := newChange(ctx, domain.AuditUpdated, currentEntity, customerEntity)
+	updated, err := aggregate.Repository.UpdateCustomer(ctx, customerEntity, change)
+
+	evictionCtx := detach(ctx)
+	aggregate.CacheStore.RemoveCustomerEntity(evictionCtx, currentEntity.Name)
+	if customerEntity.Name != currentEntity.Name {
+		aggregate.CacheStore.RemoveCustomerEntity(evictionCtx, customerEntity.Name)
+		aggregate.lookup.forget(customerEntity.Name)
+	}
+
+	if err == repository.ErrDuplicateCustomer {
+		return nil, ErrCustomerAlreadyExists
+	}
+
+	if err != nil {
+		return nil, domain.WrapError(domain.ErrUnexpected, "customer_update_failed", "could not update customer", err)
+	}
+
+	if !updated {
+		return nil, ErrCustomerVersionMismatch
+	}
+
+	aggregate.notify(ctx, change)
+	return makeCustomerByEntity(customerEntity), nil
+}
+
+// detach return a context carrying the requestID of ctx that is not canceled with it
+func detach(ctx context.Context) context.Context {
+	return logger.WithRequestID(context.Background(), logger.RequestID(ctx))
+}
+
+// checkVersion return ErrCustomerVersionMismatch when the version of the entity is not the expected one
+func checkVersion(customerEntity *repository.CustomerEntity, expectedVersion int64) error {
+	if expectedVersion != AnyVersion && customerEntity.Version != expectedVersion {
+		return ErrCustomerVersionMismatch
+	}
+	return nil
+}
+
+// now return the current time truncated to milliseconds, the precision kept by mongodb and cassandra
+var now = func() time.Time {
+	return time.Now().UTC().Truncate(time.Millisecond)
+}
+
+// statusOf return the status of the entity, the customers stored before the status existed are active
+func statusOf(customerEntity *repository.CustomerEntity) domain.CustomerStatus {
+	if customerEntity.Status == "" {
+		return domain.StatusActive
+	}
+	return domain.CustomerStatus(customerEntity.Status)
+}
+
 func makeCustomerByEntity(customerEntity *repository.CustomerEntity) *domain.Customer {
-	return &domain.Customer{ID: customerEntity.ID.Hex(), Name: customerEntity.Name, City: customerEntity.City}
+
+	var addresses []domain.Address
+	for _, address := range customerEntity.Addresses {
+		addresses = append(addresses, domain.Address{
+			Type:       domain.AddressType(address.Type),
+			Street:     address.Street,
+			Number:     address.Number,
+			Complement: address.Complement,
+			District:   address.District,
+			City:       address.City,
+			State:      address.State,
+			PostalCode: address.PostalCode,
+			Country:    address.Country,
+		})
+	}
+
+	return &domain.Customer{
+		ID:        customerEntity.ID.Hex(),
+		Name:      customerEntity.Name,
+		City:      customerEntity.City,
+		Email:     customerEntity.Email,
+		Phone:     customerEntity.Phone,
+		Document:  customerEntity.Document,
+		Addresses: addresses,
+		Status:    statusOf(customerEntity),
+		CreatedAt: customerEntity.CreatedAt,
+		UpdatedAt: customerEntity.UpdatedAt,
+		Version:   customerEntity.Version,
+	}
 }
 
 func toEntity(customer *domain.Customer) *repository.CustomerEntity {
+
+	var addresses []repository.AddressEntity
+	for _, address := range customer.Addresses {
+		addresses = append(addresses, repository.AddressEntity{
+			Type:       string(address.Type),
+			Street:     address.Street,
+			Number:     address.Number,
+			Complement: address.Complement,
+			District:   address.District,
+			City:       address.City,
+			State:      address.State,
+			PostalCode: address.PostalCode,
+			Country:    address.Country,
+		})
+	}
+
 	customerEntity := repository.CustomerEntity{
-		Name: customer.Name,
-		City: customer.City,
+		Name:      customer.Name,
+		City:      customer.City,
+		Email:     customer.Email,
+		Phone:     customer.Phone,
+		Document:  customer.Document,
+		Addresses: addresses,
+		Status:    string(customer.Status),
 	}
 	return &customerEntity
 }
@@ -1,8 +1,13 @@
 package service
 
 import (
+	"context"
+	"encoding/json"
 	"errors"
+	"fmt"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/mongodb/mongo-go-driver/bson/objectid"
 	"github.com/stretchr/testify/assert"
@@ -11,17 +16,37 @@ import (
 	"github.com/jcsw/go-api-learn/pkg/domain"
 	"github.com/jcsw/go-api-learn/pkg/infra/cache/cachestore"
 	"github.com/jcsw/go-api-learn/pkg/infra/database/repository"
+	"github.com/jcsw/go-api-learn/pkg/infra/events"
+	"github.com/jcsw/go-api-learn/pkg/infra/logger"
 )
 
+// freezeNow make the service use a fixed current time until the end of the test
+func freezeNow(t *testing.T) time.Time {
+
+	frozen := time.Date(2018, 10, 8, 12, 0, 0, 0, time.UTC)
+	previous := now
+	now = func() time.Time { return frozen }
+	t.Cleanup(func() { now = previous })
+
+	return frozen
+}
+
 func TestShouldCreateNewCustomer(t *testing.T) {
 
+	createdAt := freezeNow(t)
 	newCustomer := domain.Customer{Name: "Marcos", City: "Santos"}
 
 	repositoryMock := &repository.CustomerRepositoryMock{}
-	repositoryMock.On("InsertCustomer", toEntity(&newCustomer)).Return(nil)
+	repositoryMock.On("InsertCustomer", mock.Anything, mock.MatchedBy(func(customerEntity *repository.CustomerEntity) bool {
+		expected := repository.CustomerEntity{ID: customerEntity.ID, Name: "Marcos", City: "Santos", Status: "active", CreatedAt: createdAt, UpdatedAt: createdAt}
+		return !customerEntity.ID.IsZero() && assert.ObjectsAreEqual(&expected, customerEntity)
+	}), mock.Anything).Return(nil)
 
-	aggregate := CustomerAggregate{Repository: repositoryMock}
-	createdCustomer, err := aggregate.CreateNewCustomer(&newCustomer)
+	cacheStoreMock := &cachestore.CustomerCacheStoreMock{}
+	cacheStoreMock.On("PersistCustomerEntity", mock.Anything, mock.Anything)
+
+	aggregate := CustomerAggregate{Repository: repositoryMock, CacheStore: cacheStoreMock}
+	createdCustomer, err := aggregate.CreateNewCustomer(context.Background(), &newCustomer)
 
 	assert.Nil(t, err)
 
@@ -29,9 +54,52 @@ func TestShouldCreateNewCustomer(t *testing.T) {
 		assert.Equal(t, newCustomer.Name, createdCustomer.Name)
 		assert.Equal(t, newCustomer.City, createdCustomer.City)
 		assert.NotEmpty(t, createdCustomer.ID)
+		assert.Equal(t, domain.StatusActive, createdCustomer.Status)
+		assert.Equal(t, createdAt, createdCustomer.CreatedAt)
 	}
 
-	repositoryMock.AssertCalled(t, "InsertCustomer", mock.Anything)
+	repositoryMock.AssertCalled(t, "InsertCustomer", mock.Anything, mock.Anything, mock.Anything)
+
+	cacheStoreMock.AssertCalled(t, "PersistCustomerEntity", mock.Anything, mock.MatchedBy(func(customerEntity *repository.CustomerEntity) bool {
+		return customerEntity.ID.Hex() == createdCustomer.ID && customerEntity.Name == newCustomer.Name
+	}))
+}
+
+func TestShouldReturnConflictWhenCustomerAlreadyExists(t *testing.T) {
+
+	newCustomer := domain.Customer{Name: "Marcos", City: "Santos"}
+
+	repositoryMock := &repository.CustomerRepositoryMock{}
+	repositoryMock.On("InsertCustomer", mock.Anything, mock.Anything, mock.Anything).Return(repository.ErrDuplicateCustomer)
+
+	cacheStoreMock := &cachestore.CustomerCacheStoreMock{}
+
+	aggregate := CustomerAggregate{Repository: repositoryMock, CacheStore: cacheStoreMock}
+	createdCustomer, err := aggregate.CreateNewCustomer(context.Background(), &newCustomer)
+
+	assert.Nil(t, createdCustomer)
+	assert.Equal(t, ErrCustomerAlreadyExists, err)
+	assert.True(t, errors.Is(err, domain.ErrConflict))
+
+	cacheStoreMock.AssertNotCalled(t, "PersistCustomerEntity", mock.Anything, mock.Anything)
+}
+
+func TestShouldReturnConflictWhenUpdatedNameIsInUse(t *testing.T) {
+
+	customerInDataBase := repository.CustomerEntity{ID: objectid.New(), Name: "Marcos", City: "Santos"}
+
+	repositoryMock := &repository.CustomerRepositoryMock{}
+	repositoryMock.On("FindCustomerByID", mock.Anything, customerInDataBase.ID).Return(&customerInDataBase, nil)
+	repositoryMock.On("UpdateCustomer", mock.Anything, mock.Anything, mock.Anything).Return(false, repository.ErrDuplicateCustomer)
+
+	cacheStoreMock := &cachestore.CustomerCacheStoreMock{}
+	cacheStoreMock.On("RemoveCustomerEntity", mock.Anything, mock.Anything)
+
+	aggregate := CustomerAggregate{Repository: repositoryMock, CacheStore: cacheStoreMock}
+	updatedCustomer, err := aggregate.UpdateCustomer(context.Background(), customerInDataBase.ID.Hex(), AnyVersion, &domain.Customer{Name: "Lucas", City: "Santos"})
+
+	assert.Nil(t, updatedCustomer)
+	assert.Equal(t, ErrCustomerAlreadyExists, err)
 }
 
 func TestShouldNotCreateCustomerWhenRepositoryIsUnavaliable(t *testing.T) {
@@ -39,10 +107,12 @@ func TestShouldNotCreateCustomerWhenRepositoryIsUnavaliable(t *testing.T) {
 	newCustomer := domain.Customer{Name: "Leandro", City: "Santos"}
 
 	repositoryMock := &repository.CustomerRepositoryMock{}
-	repositoryMock.On("InsertCustomer", toEntity(&newCustomer)).Return(errors.New("Error"))
+	repositoryMock.On("InsertCustomer", mock.Anything, mock.Anything, mock.Anything).Return(errors.New("Error"))
 
-	aggregate := CustomerAggregate{Repository: repositoryMock}
-	createdCustomer, err := aggregate.CreateNewCustomer(&newCustomer)
+	cacheStoreMock := &cachestore.CustomerCacheStoreMock{}
+
+	aggregate := CustomerAggregate{Repository: repositoryMock, CacheStore: cacheStoreMock}
+	createdCustomer, err := aggregate.CreateNewCustomer(context.Background(), &newCustomer)
 
 	assert.Nil(t, createdCustomer)
 
@@ -50,7 +120,9 @@ func TestShouldNotCreateCustomerWhenRepositoryIsUnavaliable(t *testing.T) {
 		assert.Contains(t, err.Error(), "could not complete customer registration")
 	}
 
-	repositoryMock.AssertCalled(t, "InsertCustomer", mock.Anything)
+	repositoryMock.AssertCalled(t, "InsertCustomer", mock.Anything, mock.Anything, mock.Anything)
+
+	cacheStoreMock.AssertNotCalled(t, "PersistCustomerEntity", mock.Anything, mock.Anything)
 }
 
 func TestShouldReturnCustomerWhenNameExistsInDatabase(t *testing.T) {
@@ -59,14 +131,14 @@ func TestShouldReturnCustomerWhenNameExistsInDatabase(t *testing.T) {
 	customerInDataBase := repository.CustomerEntity{ID: objectid.New(), Name: customerName, City: "São Paulo"}
 
 	repositoryMock := &repository.CustomerRepositoryMock{}
-	repositoryMock.On("FindCustomerByName", customerName).Return(&customerInDataBase, nil)
+	repositoryMock.On("FindCustomerByName", mock.Anything, customerName).Return(&customerInDataBase, nil)
 
 	cacheStoreMock := &cachestore.CustomerCacheStoreMock{}
-	cacheStoreMock.On("RetriveCustomerEntity", customerName).Return(nil)
-	cacheStoreMock.On("PersistCustomerEntity", &customerInDataBase)
+	cacheStoreMock.On("RetriveCustomerEntity", mock.Anything, customerName).Return(nil)
+	cacheStoreMock.On("PersistCustomerEntity", mock.Anything, &customerInDataBase)
 
 	aggregate := CustomerAggregate{Repository: repositoryMock, CacheStore: cacheStoreMock}
-	customer, err := aggregate.FindCustomerByName(customerName)
+	customer, err := aggregate.FindCustomerByName(context.Background(), customerName)
 
 	assert.Nil(t, err)
 
@@ -76,10 +148,10 @@ func TestShouldReturnCustomerWhenNameExistsInDatabase(t *testing.T) {
 		assert.NotEmpty(t, customer.ID)
 	}
 
-	repositoryMock.AssertCalled(t, "FindCustomerByName", customerName)
+	repositoryMock.AssertCalled(t, "FindCustomerByName", mock.Anything, customerName)
 
-	cacheStoreMock.AssertCalled(t, "RetriveCustomerEntity", customerName)
-	cacheStoreMock.AssertCalled(t, "PersistCustomerEntity", &customerInDataBase)
+	cacheStoreMock.AssertCalled(t, "RetriveCustomerEntity", mock.Anything, customerName)
+	cacheStoreMock.AssertCalled(t, "PersistCustomerEntity", mock.Anything, &customerInDataBase)
 }
 
 func TestShouldReturnCustomerWhenNameExistsInCache(t *testing.T) {
@@ -88,13 +160,13 @@ func TestShouldReturnCustomerWhenNameExistsInCache(t *testing.T) {
 	customerInCache := repository.CustomerEntity{ID: objectid.New(), Name: customerName, City: "São Paulo"}
 
 	repositoryMock := &repository.CustomerRepositoryMock{}
-	repositoryMock.On("FindCustomerByName", customerName).Return(nil, nil)
+	repositoryMock.On("FindCustomerByName", mock.Anything, customerName).Return(nil, nil)
 
 	cacheStoreMock := &cachestore.CustomerCacheStoreMock{}
-	cacheStoreMock.On("RetriveCustomerEntity", customerName).Return(&customerInCache)
+	cacheStoreMock.On("RetriveCustomerEntity", mock.Anything, customerName).Return(&customerInCache)
 
 	aggregate := CustomerAggregate{Repository: repositoryMock, CacheStore: cacheStoreMock}
-	customer, err := aggregate.FindCustomerByName(customerName)
+	customer, err := aggregate.FindCustomerByName(context.Background(), customerName)
 
 	assert.Nil(t, err)
 
@@ -104,32 +176,32 @@ func TestShouldReturnCustomerWhenNameExistsInCache(t *testing.T) {
 		assert.NotEmpty(t, customer.ID)
 	}
 
-	repositoryMock.AssertNotCalled(t, "FindCustomerByName", customerName)
+	repositoryMock.AssertNotCalled(t, "FindCustomerByName", mock.Anything, customerName)
 
-	cacheStoreMock.AssertCalled(t, "RetriveCustomerEntity", customerName)
-	cacheStoreMock.AssertNotCalled(t, "PersistCustomerEntity", mock.Anything)
+	cacheStoreMock.AssertCalled(t, "RetriveCustomerEntity", mock.Anything, customerName)
+	cacheStoreMock.AssertNotCalled(t, "PersistCustomerEntity", mock.Anything, mock.Anything)
 }
 
-func TestShouldReturnNilWhenNameNotExistsInCacheAndDatabase(t *testing.T) {
+func TestShouldReturnNotFoundWhenNameNotExistsInCacheAndDatabase(t *testing.T) {
 
 	customerName := "Marcos"
 
 	repositoryMock := &repository.CustomerRepositoryMock{}
-	repositoryMock.On("FindCustomerByName", customerName).Return(nil, nil)
+	repositoryMock.On("FindCustomerByName", mock.Anything, customerName).Return(nil, nil)
 
 	cacheStoreMock := &cachestore.CustomerCacheStoreMock{}
-	cacheStoreMock.On("RetriveCustomerEntity", customerName).Return(nil)
+	cacheStoreMock.On("RetriveCustomerEntity", mock.Anything, customerName).Return(nil)
 
 	aggregate := CustomerAggregate{Repository: repositoryMock, CacheStore: cacheStoreMock}
-	customer, err := aggregate.FindCustomerByName(customerName)
+	customer, err := aggregate.FindCustomerByName(context.Background(), customerName)
 
-	assert.Nil(t, err)
+	assert.Equal(t, ErrCustomerNotFound, err)
 	assert.Nil(t, customer)
 
-	repositoryMock.AssertCalled(t, "FindCustomerByName", customerName)
+	repositoryMock.AssertCalled(t, "FindCustomerByName", mock.Anything, customerName)
 
-	cacheStoreMock.AssertCalled(t, "RetriveCustomerEntity", customerName)
-	cacheStoreMock.AssertNotCalled(t, "PersistCustomerEntity", mock.Anything)
+	cacheStoreMock.AssertCalled(t, "RetriveCustomerEntity", mock.Anything, customerName)
+	cacheStoreMock.AssertNotCalled(t, "PersistCustomerEntity", mock.Anything, mock.Anything)
 }
 
 func TestShouldReturnErrorWhenNotHasInCacheAndRepositoryIsUnavaliable(t *testing.T) {
@@ -137,13 +209,13 @@ func TestShouldReturnErrorWhenNotHasInCacheAndRepositoryIsUnavaliable(t *testing
 	customerName := "Leandro"
 
 	repositoryMock := &repository.CustomerRepositoryMock{}
-	repositoryMock.On("FindCustomerByName", customerName).Return(nil, errors.New("Error"))
+	repositoryMock.On("FindCustomerByName", mock.Anything, customerName).Return(nil, errors.New("Error"))
 
 	cacheStoreMock := &cachestore.CustomerCacheStoreMock{}
-	cacheStoreMock.On("RetriveCustomerEntity", customerName).Return(nil)
+	cacheStoreMock.On("RetriveCustomerEntity", mock.Anything, customerName).Return(nil)
 
 	aggregate := CustomerAggregate{Repository: repositoryMock, CacheStore: cacheStoreMock}
-	customer, err := aggregate.FindCustomerByName(customerName)
+	customer, err := aggregate.FindCustomerByName(context.Background(), customerName)
 
 	assert.Nil(t, customer)
 
@@ -151,10 +223,10 @@ func TestShouldReturnErrorWhenNotHasInCacheAndRepositoryIsUnavaliable(t *testing
 		assert.Contains(t, err.Error(), "could not find customer")
 	}
 
-	repositoryMock.AssertCalled(t, "FindCustomerByName", customerName)
+	repositoryMock.AssertCalled(t, "FindCustomerByName", mock.Anything, customerName)
 
-	cacheStoreMock.AssertCalled(t, "RetriveCustomerEntity", customerName)
-	cacheStoreMock.AssertNotCalled(t, "PersistCustomerEntity", mock.Anything)
+	cacheStoreMock.AssertCalled(t, "RetriveCustomerEntity", mock.Anything, customerName)
+	cacheStoreMock.AssertNotCalled(t, "PersistCustomerEntity", mock.Anything, mock.Anything)
 }
 
 func TestShouldReturnCustomersWhenExistsOneCustomer(t *testing.T) {
@@ -162,10 +234,10 @@ func TestShouldReturnCustomersWhenExistsOneCustomer(t *testing.T) {
 	customerAmanda := &repository.CustomerEntity{ID: objectid.New(), Name: "Amanda", City: "São Paulo"}
 
 	repositoryMock := &repository.CustomerRepositoryMock{}
-	repositoryMock.On("FindAllCustomers").Return([]*repository.CustomerEntity{customerAmanda}, nil)
+	repositoryMock.On("FindAllCustomers", mock.Anything, mock.Anything).Return([]*repository.CustomerEntity{customerAmanda}, nil)
 
 	aggregate := CustomerAggregate{Repository: repositoryMock}
-	customers, err := aggregate.FindAllCustomers()
+	customers, err := aggregate.FindAllCustomers(context.Background())
 
 	assert.Nil(t, err)
 
@@ -177,7 +249,7 @@ func TestShouldReturnCustomersWhenExistsOneCustomer(t *testing.T) {
 		assert.NotEmpty(t, customers[0].ID)
 	}
 
-	repositoryMock.AssertCalled(t, "FindAllCustomers")
+	repositoryMock.AssertCalled(t, "FindAllCustomers", mock.Anything, mock.Anything)
 }
 
 func TestShouldReturnCustomersWhenExistsTwoCustomer(t *testing.T) {
@@ -186,10 +258,10 @@ func TestShouldReturnCustomersWhenExistsTwoCustomer(t *testing.T) {
 	customerMarcos := &repository.CustomerEntity{ID: objectid.New(), Name: "Marcos", City: "Recife"}
 
 	repositoryMock := &repository.CustomerRepositoryMock{}
-	repositoryMock.On("FindAllCustomers").Return([]*repository.CustomerEntity{customerAmanda, customerMarcos}, nil)
+	repositoryMock.On("FindAllCustomers", mock.Anything, mock.Anything).Return([]*repository.CustomerEntity{customerAmanda, customerMarcos}, nil)
 
 	aggregate := CustomerAggregate{Repository: repositoryMock}
-	customers, err := aggregate.FindAllCustomers()
+	customers, err := aggregate.FindAllCustomers(context.Background())
 
 	assert.Nil(t, err)
 
@@ -205,30 +277,30 @@ func TestShouldReturnCustomersWhenExistsTwoCustomer(t *testing.T) {
 		assert.NotEmpty(t, customers[1].ID)
 	}
 
-	repositoryMock.AssertCalled(t, "FindAllCustomers")
+	repositoryMock.AssertCalled(t, "FindAllCustomers", mock.Anything, mock.Anything)
 }
 
 func TestShouldReturnEmptyCustomersWhenNotExists(t *testing.T) {
 
 	repositoryMock := &repository.CustomerRepositoryMock{}
-	repositoryMock.On("FindAllCustomers").Return([]*repository.CustomerEntity{}, nil)
+	repositoryMock.On("FindAllCustomers", mock.Anything, mock.Anything).Return([]*repository.CustomerEntity{}, nil)
 
 	aggregate := CustomerAggregate{Repository: repositoryMock}
-	customers, err := aggregate.FindAllCustomers()
+	customers, err := aggregate.FindAllCustomers(context.Background())
 
 	assert.Nil(t, err)
 	assert.Empty(t, customers)
 
-	repositoryMock.AssertCalled(t, "FindAllCustomers")
+	repositoryMock.AssertCalled(t, "FindAllCustomers", mock.Anything, mock.Anything)
 }
 
 func TestShouldReturnErrorWhenReturnError(t *testing.T) {
 
 	repositoryMock := &repository.CustomerRepositoryMock{}
-	repositoryMock.On("FindAllCustomers").Return(nil, errors.New("Error"))
+	repositoryMock.On("FindAllCustomers", mock.Anything, mock.Anything).Return(nil, errors.New("Error"))
 
 	aggregate := CustomerAggregate{Repository: repositoryMock}
-	customers, err := aggregate.FindAllCustomers()
+	customers, err := aggregate.FindAllCustomers(context.Background())
 
 	assert.Empty(t, customers)
 
@@ -236,3 +308,825 @@ func TestShouldReturnErrorWhenReturnError(t *testing.T) {
 		assert.Contains(t, err.Error(), "could not find customers")
 	}
 }
+
+func TestShouldReturnCustomerWhenIDExistsInDatabase(t *testing.T) {
+
+	customerInDataBase := repository.CustomerEntity{ID: objectid.New(), Name: "Lucas", City: "São Paulo"}
+
+	repositoryMock := &repository.CustomerRepositoryMock{}
+	repositoryMock.On("FindCustomerByID", mock.Anything, customerInDataBase.ID).Return(&customerInDataBase, nil)
+
+	aggregate := CustomerAggregate{Repository: repositoryMock}
+	customer, err := aggregate.FindCustomerByID(context.Background(), customerInDataBase.ID.Hex())
+
+	assert.Nil(t, err)
+
+	if assert.NotNil(t, customer) {
+		assert.Equal(t, customerInDataBase.ID.Hex(), customer.ID)
+		assert.Equal(t, customerInDataBase.Name, customer.Name)
+		assert.Equal(t, customerInDataBase.City, customer.City)
+	}
+
+	repositoryMock.AssertCalled(t, "FindCustomerByID", mock.Anything, customerInDataBase.ID)
+}
+
+func TestShouldReturnNotFoundWhenIDIsNotValid(t *testing.T) {
+
+	repositoryMock := &repository.CustomerRepositoryMock{}
+
+	aggregate := CustomerAggregate{Repository: repositoryMock}
+	customer, err := aggregate.FindCustomerByID(context.Background(), "invalid")
+
+	assert.Equal(t, ErrCustomerNotFound, err)
+	assert.Nil(t, customer)
+
+	repositoryMock.AssertNotCalled(t, "FindCustomerByID", mock.Anything, mock.Anything)
+}
+
+func TestShouldUpdateCustomerAndEvictBothNamesFromCache(t *testing.T) {
+
+	updatedAt := freezeNow(t)
+	createdAt := updatedAt.Add(-time.Hour)
+	customerInDataBase := repository.CustomerEntity{ID: objectid.New(), Name: "Marcos", City: "Santos", Status: "active", CreatedAt: createdAt, Version: 2}
+	customer := domain.Customer{Name: "Marcos Silva", City: "Recife"}
+
+	repositoryMock := &repository.CustomerRepositoryMock{}
+	repositoryMock.On("FindCustomerByID", mock.Anything, customerInDataBase.ID).Return(&customerInDataBase, nil)
+	repositoryMock.On("UpdateCustomer", mock.Anything, &repository.CustomerEntity{ID: customerInDataBase.ID, Name: "Marcos Silva", City: "Recife",
+		Status: "active", CreatedAt: createdAt, UpdatedAt: updatedAt, Version: 2}, mock.Anything).Return(true, nil)
+
+	cacheStoreMock := &cachestore.CustomerCacheStoreMock{}
+	cacheStoreMock.On("RemoveCustomerEntity", mock.Anything, mock.Anything)
+
+	aggregate := CustomerAggregate{Repository: repositoryMock, CacheStore: cacheStoreMock}
+	updatedCustomer, err := aggregate.UpdateCustomer(context.Background(), customerInDataBase.ID.Hex(), 2, &customer)
+
+	assert.Nil(t, err)
+
+	if assert.NotNil(t, updatedCustomer) {
+		assert.Equal(t, customerInDataBase.ID.Hex(), updatedCustomer.ID)
+		assert.Equal(t, "Recife", updatedCustomer.City)
+		assert.Equal(t, int64(3), updatedCustomer.Version)
+	}
+
+	cacheStoreMock.AssertCalled(t, "RemoveCustomerEntity", mock.Anything, "Marcos")
+	cacheStoreMock.AssertCalled(t, "RemoveCustomerEntity", mock.Anything, "Marcos Silva")
+	cacheStoreMock.AssertNotCalled(t, "PersistCustomerEntity", mock.Anything, mock.Anything)
+}
+
+func TestShouldEvictCacheWhenUpdateFails(t *testing.T) {
+
+	customerInDataBase := repository.CustomerEntity{ID: objectid.New(), Name: "Marcos", City: "Santos"}
+
+	repositoryMock := &repository.CustomerRepositoryMock{}
+	repositoryMock.On("FindCustomerByID", mock.Anything, customerInDataBase.ID).Return(&customerInDataBase, nil)
+	repositoryMock.On("UpdateCustomer", mock.Anything, mock.Anything, mock.Anything).Return(false, errors.New("Error"))
+
+	cacheStoreMock := &cachestore.CustomerCacheStoreMock{}
+	cacheStoreMock.On("RemoveCustomerEntity", mock.Anything, mock.Anything)
+
+	aggregate := CustomerAggregate{Repository: repositoryMock, CacheStore: cacheStoreMock}
+	updatedCustomer, err := aggregate.UpdateCustomer(context.Background(), customerInDataBase.ID.Hex(), AnyVersion, &domain.Customer{Name: "Marcos", City: "Recife"})
+
+	assert.Nil(t, updatedCustomer)
+
+	if assert.NotNil(t, err) {
+		assert.Contains(t, err.Error(), "could not update customer")
+	}
+
+	cacheStoreMock.AssertCalled(t, "RemoveCustomerEntity", mock.Anything, "Marcos")
+	cacheStoreMock.AssertNumberOfCalls(t, "RemoveCustomerEntity", 1)
+}
+
+func TestShouldNotUpdateCustomerWhenIsNotValid(t *testing.T) {
+
+	repositoryMock := &repository.CustomerRepositoryMock{}
+	cacheStoreMock := &cachestore.CustomerCacheStoreMock{}
+
+	aggregate := CustomerAggregate{Repository: repositoryMock, CacheStore: cacheStoreMock}
+	updatedCustomer, err := aggregate.UpdateCustomer(context.Background(), objectid.New().Hex(), AnyVersion, &domain.Customer{Name: "Marcos"})
+
+	assert.Nil(t, updatedCustomer)
+	assert.True(t, errors.Is(err, domain.ErrInvalidCity))
+
+	repositoryMock.AssertNotCalled(t, "UpdateCustomer", mock.Anything, mock.Anything, mock.Anything)
+	cacheStoreMock.AssertNotCalled(t, "RemoveCustomerEntity", mock.Anything, mock.Anything)
+}
+
+func TestShouldReturnNotFoundWhenUpdateCustomerNotExists(t *testing.T) {
+
+	repositoryMock := &repository.CustomerRepositoryMock{}
+	repositoryMock.On("FindCustomerByID", mock.Anything, mock.Anything).Return(nil, nil)
+
+	cacheStoreMock := &cachestore.CustomerCacheStoreMock{}
+
+	aggregate := CustomerAggregate{Repository: repositoryMock, CacheStore: cacheStoreMock}
+	updatedCustomer, err := aggregate.UpdateCustomer(context.Background(), objectid.New().Hex(), AnyVersion, &domain.Customer{Name: "Marcos", City: "Recife"})
+
+	assert.Equal(t, ErrCustomerNotFound, err)
+	assert.Nil(t, updatedCustomer)
+
+	repositoryMock.AssertNotCalled(t, "UpdateCustomer", mock.Anything, mock.Anything, mock.Anything)
+	cacheStoreMock.AssertNotCalled(t, "RemoveCustomerEntity", mock.Anything, mock.Anything)
+}
+
+func TestShouldNotUpdateCustomerWhenVersionIsNotTheCurrent(t *testing.T) {
+
+	customerInDataBase := repository.CustomerEntity{ID: objectid.New(), Name: "Marcos", City: "Santos", Version: 3}
+
+	repositoryMock := &repository.CustomerRepositoryMock{}
+	repositoryMock.On("FindCustomerByID", mock.Anything, customerInDataBase.ID).Return(&customerInDataBase, nil)
+
+	cacheStoreMock := &cachestore.CustomerCacheStoreMock{}
+
+	aggregate := CustomerAggregate{Repository: repositoryMock, CacheStore: cacheStoreMock}
+	updatedCustomer, err := aggregate.UpdateCustomer(context.Background(), customerInDataBase.ID.Hex(), 2, &domain.Customer{Name: "Marcos", City: "Recife"})
+
+	assert.Nil(t, updatedCustomer)
+	assert.Equal(t, ErrCustomerVersionMismatch, err)
+
+	repositoryMock.AssertNotCalled(t, "UpdateCustomer", mock.Anything, mock.Anything, mock.Anything)
+	cacheStoreMock.AssertNotCalled(t, "RemoveCustomerEntity", mock.Anything, mock.Anything)
+}
+
+func TestShouldReturnVersionMismatchWhenCustomerIsReplacedConcurrently(t *testing.T) {
+
+	customerInDataBase := repository.CustomerEntity{ID: objectid.New(), Name: "Marcos", City: "Santos", Version: 2}
+
+	repositoryMock := &repository.CustomerRepositoryMock{}
+	repositoryMock.On("FindCustomerByID", mock.Anything, customerInDataBase.ID).Return(&customerInDataBase, nil)
+	repositoryMock.On("UpdateCustomer", mock.Anything, mock.Anything, mock.Anything).Return(false, nil)
+
+	cacheStoreMock := &cachestore.CustomerCacheStoreMock{}
+	cacheStoreMock.On("RemoveCustomerEntity", mock.Anything, mock.Anything)
+
+	aggregate := CustomerAggregate{Repository: repositoryMock, CacheStore: cacheStoreMock}
+	updatedCustomer, err := aggregate.UpdateCustomer(context.Background(), customerInDataBase.ID.Hex(), 2, &domain.Customer{Name: "Marcos", City: "Recife"})
+
+	assert.Nil(t, updatedCustomer)
+	assert.Equal(t, ErrCustomerVersionMismatch, err)
+
+	cacheStoreMock.AssertCalled(t, "RemoveCustomerEntity", mock.Anything, "Marcos")
+}
+
+func TestShouldPatchCustomer(t *testing.T) {
+
+	updatedAt := freezeNow(t)
+	customerInDataBase := repository.CustomerEntity{ID: objectid.New(), Name: "Lucas", City: "São Paulo"}
+
+	repositoryMock := &repository.CustomerRepositoryMock{}
+	repositoryMock.On("FindCustomerByID", mock.Anything, customerInDataBase.ID).Return(&customerInDataBase, nil)
+	repositoryMock.On("UpdateCustomer", mock.Anything, &repository.CustomerEntity{ID: customerInDataBase.ID, Name: "Lucas", City: "Santos",
+		Status: "active", UpdatedAt: updatedAt}, mock.Anything).Return(true, nil)
+
+	cacheStoreMock := &cachestore.CustomerCacheStoreMock{}
+	cacheStoreMock.On("RemoveCustomerEntity", mock.Anything, mock.Anything)
+
+	aggregate := CustomerAggregate{Repository: repositoryMock, CacheStore: cacheStoreMock}
+	patchedCustomer, err := aggregate.PatchCustomer(context.Background(), customerInDataBase.ID.Hex(), AnyVersion, []byte(`{"city":"Santos","id":"ignored"}`))
+
+	assert.Nil(t, err)
+
+	if assert.NotNil(t, patchedCustomer) {
+		assert.Equal(t, customerInDataBase.ID.Hex(), patchedCustomer.ID)
+		assert.Equal(t, "Lucas", patchedCustomer.Name)
+		assert.Equal(t, "Santos", patchedCustomer.City)
+	}
+
+	cacheStoreMock.AssertCalled(t, "RemoveCustomerEntity", mock.Anything, "Lucas")
+	cacheStoreMock.AssertNumberOfCalls(t, "RemoveCustomerEntity", 1)
+}
+
+func TestShouldNotPatchCustomerWhenPatchIsNotValid(t *testing.T) {
+
+	customerInDataBase := repository.CustomerEntity{ID: objectid.New(), Name: "Lucas", City: "São Paulo"}
+
+	repositoryMock := &repository.CustomerRepositoryMock{}
+	repositoryMock.On("FindCustomerByID", mock.Anything, customerInDataBase.ID).Return(&customerInDataBase, nil)
+
+	aggregate := CustomerAggregate{Repository: repositoryMock}
+	patchedCustomer, err := aggregate.PatchCustomer(context.Background(), customerInDataBase.ID.Hex(), AnyVersion, []byte(`{"city":`))
+
+	assert.Nil(t, patchedCustomer)
+	assert.Equal(t, ErrInvalidMergePatch, err)
+
+	repositoryMock.AssertNotCalled(t, "UpdateCustomer", mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestShouldBlockCustomerAndNormalizeDocument(t *testing.T) {
+
+	freezeNow(t)
+	customerInDataBase := repository.CustomerEntity{ID: objectid.New(), Name: "Lucas", City: "São Paulo", Status: "active"}
+
+	repositoryMock := &repository.CustomerRepositoryMock{}
+	repositoryMock.On("FindCustomerByID", mock.Anything, customerInDataBase.ID).Return(&customerInDataBase, nil)
+	repositoryMock.On("UpdateCustomer", mock.Anything, mock.Anything, mock.Anything).Return(true, nil)
+
+	cacheStoreMock := &cachestore.CustomerCacheStoreMock{}
+	cacheStoreMock.On("RemoveCustomerEntity", mock.Anything, mock.Anything)
+
+	aggregate := CustomerAggregate{Repository: repositoryMock, CacheStore: cacheStoreMock}
+	patchedCustomer, err := aggregate.PatchCustomer(context.Background(), customerInDataBase.ID.Hex(), AnyVersion,
+		[]byte(`{"status":"blocked","document":"529.982.247-25"}`))
+
+	assert.Nil(t, err)
+
+	if assert.NotNil(t, patchedCustomer) {
+		assert.Equal(t, domain.StatusBlocked, patchedCustomer.Status)
+		assert.Equal(t, "52998224725", patchedCustomer.Document)
+	}
+}
+
+func TestShouldNotReopenClosedCustomer(t *testing.T) {
+
+	customerInDataBase := repository.CustomerEntity{ID: objectid.New(), Name: "Lucas", City: "São Paulo", Status: "closed"}
+
+	repositoryMock := &repository.CustomerRepositoryMock{}
+	repositoryMock.On("FindCustomerByID", mock.Anything, customerInDataBase.ID).Return(&customerInDataBase, nil)
+
+	aggregate := CustomerAggregate{Repository: repositoryMock}
+	patchedCustomer, err := aggregate.PatchCustomer(context.Background(), customerInDataBase.ID.Hex(), AnyVersion, []byte(`{"status":"active"}`))
+
+	assert.Nil(t, patchedCustomer)
+	assert.Equal(t, domain.ErrInvalidStatusTransition, err)
+
+	repositoryMock.AssertNotCalled(t, "UpdateCustomer", mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestShouldDeleteCustomerWithTombstoneAndEvictFromCache(t *testing.T) {
+
+	deletedAt := freezeNow(t)
+	customerInDataBase := repository.CustomerEntity{ID: objectid.New(), Name: "Lucas", City: "São Paulo", Version: 2}
+
+	repositoryMock := &repository.CustomerRepositoryMock{}
+	repositoryMock.On("FindCustomerByID", mock.Anything, customerInDataBase.ID).Return(&customerInDataBase, nil)
+	repositoryMock.On("UpdateCustomer", mock.Anything, &repository.CustomerEntity{ID: customerInDataBase.ID, Name: "Lucas", City: "São Paulo",
+		UpdatedAt: deletedAt, DeletedAt: deletedAt, Version: 2}, mock.Anything).Return(true, nil)
+
+	cacheStoreMock := &cachestore.CustomerCacheStoreMock{}
+	cacheStoreMock.On("RemoveCustomerEntity", mock.Anything, mock.Anything)
+
+	aggregate := CustomerAggregate{Repository: repositoryMock, CacheStore: cacheStoreMock}
+	version, err := aggregate.DeleteCustomer(context.Background(), customerInDataBase.ID.Hex(), 2)
+
+	assert.Nil(t, err)
+	assert.Equal(t, int64(3), version)
+	assert.False(t, customerInDataBase.IsDeleted())
+
+	cacheStoreMock.AssertCalled(t, "RemoveCustomerEntity", mock.Anything, "Lucas")
+}
+
+func TestShouldReturnNotFoundWhenDeleteCustomerNotExists(t *testing.T) {
+
+	repositoryMock := &repository.CustomerRepositoryMock{}
+	repositoryMock.On("FindCustomerByID", mock.Anything, mock.Anything).Return(nil, nil)
+
+	cacheStoreMock := &cachestore.CustomerCacheStoreMock{}
+
+	aggregate := CustomerAggregate{Repository: repositoryMock, CacheStore: cacheStoreMock}
+	_, err := aggregate.DeleteCustomer(context.Background(), objectid.New().Hex(), AnyVersion)
+
+	assert.Equal(t, ErrCustomerNotFound, err)
+
+	repositoryMock.AssertNotCalled(t, "UpdateCustomer", mock.Anything, mock.Anything, mock.Anything)
+	cacheStoreMock.AssertNotCalled(t, "RemoveCustomerEntity", mock.Anything, mock.Anything)
+}
+
+func TestShouldReturnNotFoundWhenCustomerIsDeleted(t *testing.T) {
+
+	customerInDataBase := repository.CustomerEntity{ID: objectid.New(), Name: "Lucas", City: "São Paulo", DeletedAt: time.Now()}
+
+	repositoryMock := &repository.CustomerRepositoryMock{}
+	repositoryMock.On("FindCustomerByID", mock.Anything, customerInDataBase.ID).Return(&customerInDataBase, nil)
+
+	aggregate := CustomerAggregate{Repository: repositoryMock}
+
+	customer, err := aggregate.FindCustomerByID(context.Background(), customerInDataBase.ID.Hex())
+	assert.Nil(t, customer)
+	assert.Equal(t, ErrCustomerNotFound, err)
+
+	_, err = aggregate.DeleteCustomer(context.Background(), customerInDataBase.ID.Hex(), AnyVersion)
+	assert.Equal(t, ErrCustomerNotFound, err)
+
+	repositoryMock.AssertNotCalled(t, "UpdateCustomer", mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestShouldNotDeleteCustomerWhenVersionIsNotTheCurrent(t *testing.T) {
+
+	customerInDataBase := repository.CustomerEntity{ID: objectid.New(), Name: "Lucas", City: "São Paulo", Version: 4}
+
+	repositoryMock := &repository.CustomerRepositoryMock{}
+	repositoryMock.On("FindCustomerByID", mock.Anything, customerInDataBase.ID).Return(&customerInDataBase, nil)
+
+	aggregate := CustomerAggregate{Repository: repositoryMock}
+	_, err := aggregate.DeleteCustomer(context.Background(), customerInDataBase.ID.Hex(), 3)
+
+	assert.Equal(t, ErrCustomerVersionMismatch, err)
+
+	repositoryMock.AssertNotCalled(t, "UpdateCustomer", mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestShouldReturnErrorWhenDeleteAndRepositoryIsUnavaliable(t *testing.T) {
+
+	customerInDataBase := repository.CustomerEntity{ID: objectid.New(), Name: "Lucas", City: "São Paulo"}
+
+	repositoryMock := &repository.CustomerRepositoryMock{}
+	repositoryMock.On("FindCustomerByID", mock.Anything, customerInDataBase.ID).Return(&customerInDataBase, nil)
+	repositoryMock.On("UpdateCustomer", mock.Anything, mock.Anything, mock.Anything).Return(false, errors.New("Error"))
+
+	cacheStoreMock := &cachestore.CustomerCacheStoreMock{}
+	cacheStoreMock.On("RemoveCustomerEntity", mock.Anything, mock.Anything)
+
+	aggregate := CustomerAggregate{Repository: repositoryMock, CacheStore: cacheStoreMock}
+	_, err := aggregate.DeleteCustomer(context.Background(), customerInDataBase.ID.Hex(), AnyVersion)
+
+	if assert.NotNil(t, err) {
+		assert.Contains(t, err.Error(), "could not delete customer")
+	}
+
+	cacheStoreMock.AssertCalled(t, "RemoveCustomerEntity", mock.Anything, "Lucas")
+}
+
+func TestShouldRestoreDeletedCustomer(t *testing.T) {
+
+	restoredAt := freezeNow(t)
+	deletedAt := restoredAt.Add(-time.Hour)
+	customerInDataBase := repository.CustomerEntity{ID: objectid.New(), Name: "Lucas", City: "São Paulo", Status: "active",
+		UpdatedAt: deletedAt, DeletedAt: deletedAt, Version: 3}
+
+	repositoryMock := &repository.CustomerRepositoryMock{}
+	repositoryMock.On("FindCustomerByID", mock.Anything, customerInDataBase.ID).Return(&customerInDataBase, nil)
+	repositoryMock.On("UpdateCustomer", mock.Anything, &repository.CustomerEntity{ID: customerInDataBase.ID, Name: "Lucas", City: "São Paulo",
+		Status: "active", UpdatedAt: restoredAt, Version: 3}, mock.Anything).Return(true, nil)
+
+	cacheStoreMock := &cachestore.CustomerCacheStoreMock{}
+	cacheStoreMock.On("RemoveCustomerEntity", mock.Anything, mock.Anything)
+
+	aggregate := CustomerAggregate{Repository: repositoryMock, CacheStore: cacheStoreMock}
+	restoredCustomer, err := aggregate.RestoreCustomer(context.Background(), customerInDataBase.ID.Hex(), 3)
+
+	assert.Nil(t, err)
+
+	if assert.NotNil(t, restoredCustomer) {
+		assert.Equal(t, "Lucas", restoredCustomer.Name)
+		assert.Equal(t, int64(4), restoredCustomer.Version)
+	}
+
+	cacheStoreMock.AssertCalled(t, "RemoveCustomerEntity", mock.Anything, "Lucas")
+}
+
+func TestShouldNotRestoreCustomerWhoseNameIsInUseAgain(t *testing.T) {
+
+	customerInDataBase := repository.CustomerEntity{ID: objectid.New(), Name: "Lucas", City: "São Paulo", DeletedAt: time.Now(), Version: 3}
+
+	repositoryMock := &repository.CustomerRepositoryMock{}
+	repositoryMock.On("FindCustomerByID", mock.Anything, customerInDataBase.ID).Return(&customerInDataBase, nil)
+	repositoryMock.On("UpdateCustomer", mock.Anything, mock.Anything, mock.Anything).Return(false, repository.ErrDuplicateCustomer)
+
+	cacheStoreMock := &cachestore.CustomerCacheStoreMock{}
+	cacheStoreMock.On("RemoveCustomerEntity", mock.Anything, mock.Anything)
+
+	aggregate := CustomerAggregate{Repository: repositoryMock, CacheStore: cacheStoreMock}
+	restoredCustomer, err := aggregate.RestoreCustomer(context.Background(), customerInDataBase.ID.Hex(), AnyVersion)
+
+	assert.Nil(t, restoredCustomer)
+	assert.Equal(t, ErrCustomerAlreadyExists, err)
+}
+
+func TestShouldNotRestoreCustomerThatIsNotDeleted(t *testing.T) {
+
+	customerInDataBase := repository.CustomerEntity{ID: objectid.New(), Name: "Lucas", City: "São Paulo", Version: 3}
+
+	repositoryMock := &repository.CustomerRepositoryMock{}
+	repositoryMock.On("FindCustomerByID", mock.Anything, customerInDataBase.ID).Return(&customerInDataBase, nil)
+
+	aggregate := CustomerAggregate{Repository: repositoryMock}
+	restoredCustomer, err := aggregate.RestoreCustomer(context.Background(), customerInDataBase.ID.Hex(), AnyVersion)
+
+	assert.Nil(t, restoredCustomer)
+	assert.Equal(t, ErrCustomerNotDeleted, err)
+
+	repositoryMock.AssertNotCalled(t, "UpdateCustomer", mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestShouldPurgeCustomersDeletedBeforeTheRetention(t *testing.T) {
+
+	purgedAt := freezeNow(t)
+
+	repositoryMock := &repository.CustomerRepositoryMock{}
+	repositoryMock.On("PurgeCustomers", mock.Anything, purgedAt.Add(-720*time.Hour)).Return(int64(2), nil)
+
+	aggregate := CustomerAggregate{Repository: repositoryMock}
+	purged, err := aggregate.PurgeDeletedCustomers(context.Background(), 720*time.Hour)
+
+	assert.Nil(t, err)
+	assert.Equal(t, int64(2), purged)
+}
+
+func TestShouldPurgeWhenJobIsTriggered(t *testing.T) {
+
+	purged := make(chan struct{})
+
+	repositoryMock := &repository.CustomerRepositoryMock{}
+	repositoryMock.On("PurgeCustomers", mock.Anything, mock.Anything).Return(int64(1), nil).Run(func(mock.Arguments) {
+		purged <- struct{}{}
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	job := NewCustomerPurgeJob(&CustomerAggregate{Repository: repositoryMock}, time.Hour, 0)
+	go job.Run(ctx)
+	job.Trigger()
+
+	select {
+	case <-purged:
+	case <-time.After(time.Second):
+		t.Fatal("the purge did not run after the trigger")
+	}
+}
+
+func TestShouldAuditChangedFieldsWithActorAndRequestID(t *testing.T) {
+
+	changedAt := freezeNow(t)
+	customerInDataBase := &repository.CustomerEntity{ID: objectid.New(), Name: "Lucas", City: "Santos", Email: "lucas@mail.com",
+		Status: "active", CreatedAt: changedAt.Add(-time.Hour), UpdatedAt: changedAt.Add(-time.Hour), Version: 4}
+
+	repositoryMock := &repository.CustomerRepositoryMock{}
+	repositoryMock.On("FindCustomerByID", mock.Anything, customerInDataBase.ID).Return(customerInDataBase, nil)
+	repositoryMock.On("UpdateCustomer", mock.Anything, mock.Anything, mock.Anything).Return(true, nil)
+
+	cacheStoreMock := &cachestore.CustomerCacheStoreMock{}
+	cacheStoreMock.On("RemoveCustomerEntity", mock.Anything, mock.Anything)
+
+	ctx := logger.WithActor(logger.WithRequestID(context.Background(), "1539000000"), "backoffice")
+
+	aggregate := CustomerAggregate{Repository: repositoryMock, CacheStore: cacheStoreMock}
+	_, err := aggregate.UpdateCustomer(ctx, customerInDataBase.ID.Hex(), 4, &domain.Customer{Name: "Lucas", City: "São Paulo", Status: "blocked"})
+
+	assert.Nil(t, err)
+
+	repositoryMock.AssertCalled(t, "UpdateCustomer", mock.Anything, mock.Anything, changeWithAudit(&repository.CustomerAuditEntity{
+		Action:    "updated",
+		Actor:     "backoffice",
+		RequestID: "1539000000",
+		Timestamp: changedAt,
+		Changes: []repository.AuditChangeEntity{
+			{Field: "city", Before: `"Santos"`, After: `"São Paulo"`},
+			{Field: "email", Before: `"lucas@mail.com"`},
+			{Field: "status", Before: `"active"`, After: `"blocked"`},
+		},
+	}))
+}
+
+func TestShouldAuditDeleteAsAnonymousWhenRequestHasNoActor(t *testing.T) {
+
+	deletedAt := freezeNow(t)
+	customerInDataBase := &repository.CustomerEntity{ID: objectid.New(), Name: "Lucas", City: "Santos", Version: 1}
+
+	repositoryMock := &repository.CustomerRepositoryMock{}
+	repositoryMock.On("FindCustomerByID", mock.Anything, customerInDataBase.ID).Return(customerInDataBase, nil)
+	repositoryMock.On("UpdateCustomer", mock.Anything, mock.Anything, mock.Anything).Return(true, nil)
+
+	cacheStoreMock := &cachestore.CustomerCacheStoreMock{}
+	cacheStoreMock.On("RemoveCustomerEntity", mock.Anything, mock.Anything)
+
+	aggregate := CustomerAggregate{Repository: repositoryMock, CacheStore: cacheStoreMock}
+	_, err := aggregate.DeleteCustomer(context.Background(), customerInDataBase.ID.Hex(), 1)
+
+	assert.Nil(t, err)
+
+	repositoryMock.AssertCalled(t, "UpdateCustomer", mock.Anything, mock.Anything, changeWithAudit(&repository.CustomerAuditEntity{
+		Action:    "deleted",
+		Actor:     "anonymous",
+		Timestamp: deletedAt,
+		Changes:   []repository.AuditChangeEntity{{Field: "deletedAt", After: `"2018-10-08T12:00:00Z"`}},
+	}))
+}
+
+func TestShouldEmitEventWithTheCustomerAsWritten(t *testing.T) {
+
+	occurredAt := freezeNow(t)
+	customerInDataBase := &repository.CustomerEntity{ID: objectid.New(), Name: "Lucas", City: "Santos", Status: "active", Version: 4}
+
+	repositoryMock := &repository.CustomerRepositoryMock{}
+	repositoryMock.On("FindCustomerByID", mock.Anything, customerInDataBase.ID).Return(customerInDataBase, nil)
+	repositoryMock.On("UpdateCustomer", mock.Anything, mock.Anything, mock.Anything).Return(true, nil)
+
+	cacheStoreMock := &cachestore.CustomerCacheStoreMock{}
+	cacheStoreMock.On("RemoveCustomerEntity", mock.Anything, mock.Anything)
+
+	ctx := logger.WithActor(context.Background(), "backoffice")
+
+	aggregate := CustomerAggregate{Repository: repositoryMock, CacheStore: cacheStoreMock}
+	_, err := aggregate.UpdateCustomer(ctx, customerInDataBase.ID.Hex(), 4, &domain.Customer{Name: "Lucas", City: "Recife"})
+
+	assert.Nil(t, err)
+
+	repositoryMock.AssertCalled(t, "UpdateCustomer", mock.Anything, mock.Anything, mock.MatchedBy(func(change *repository.CustomerChange) bool {
+		if len(change.Events) != 1 {
+			return false
+		}
+
+		event := change.Events[0]
+		customerEvent := domain.CustomerEvent{}
+		json.Unmarshal([]byte(event.Payload), &customerEvent)
+
+		return event.Type == "CustomerUpdated" && event.CustomerID == customerInDataBase.ID && event.Version == 5 &&
+			event.NextAttemptAt == occurredAt && customerEvent.ID == event.ID.Hex() && customerEvent.Actor == "backoffice" &&
+			customerEvent.Customer.City == "Recife" && customerEvent.Customer.Version == 5
+	}))
+}
+
+func TestShouldNotifyTheEventOnlyWhenTheChangeIsWritten(t *testing.T) {
+
+	freezeNow(t)
+	customerInDataBase := &repository.CustomerEntity{ID: objectid.New(), Name: "Lucas", City: "Santos", Status: "active", Version: 4}
+
+	repositoryMock := &repository.CustomerRepositoryMock{}
+	repositoryMock.On("FindCustomerByID", mock.Anything, customerInDataBase.ID).Return(customerInDataBase, nil)
+	repositoryMock.On("UpdateCustomer", mock.Anything, mock.Anything, mock.Anything).Return(true, nil).Once()
+	repositoryMock.On("UpdateCustomer", mock.Anything, mock.Anything, mock.Anything).Return(false, nil).Once()
+
+	cacheStoreMock := &cachestore.CustomerCacheStoreMock{}
+	cacheStoreMock.On("RemoveCustomerEntity", mock.Anything, mock.Anything)
+
+	notifier := &events.MemoryPublisher{}
+
+	aggregate := CustomerAggregate{Repository: repositoryMock, CacheStore: cacheStoreMock, Notifier: notifier}
+	_, err := aggregate.DeleteCustomer(context.Background(), customerInDataBase.ID.Hex(), 4)
+	assert.Nil(t, err)
+
+	_, err = aggregate.DeleteCustomer(context.Background(), customerInDataBase.ID.Hex(), 4)
+	assert.Equal(t, ErrCustomerVersionMismatch, err)
+
+	if notified := notifier.Events(); assert.Len(t, notified, 1) {
+		assert.Equal(t, "CustomerDeleted", notified[0].Type)
+		assert.Equal(t, customerInDataBase.ID.Hex(), notified[0].Key)
+		assert.Contains(t, string(notified[0].Payload), `"type":"CustomerDeleted"`)
+	}
+}
+
+// changeWithAudit match the change with the audit
+func changeWithAudit(audit *repository.CustomerAuditEntity) interface{} {
+	return mock.MatchedBy(func(change *repository.CustomerChange) bool {
+		return assert.ObjectsAreEqual(audit, change.Audit)
+	})
+}
+
+func TestShouldReturnHistoryPageWithNextCursorWhenHasMoreChanges(t *testing.T) {
+
+	customerID := objectid.New()
+	afterID := objectid.New()
+	audits := []*repository.CustomerAuditEntity{
+		{ID: objectid.New(), CustomerID: customerID, Action: "updated", Version: 3,
+			Changes: []repository.AuditChangeEntity{{Field: "city", Before: `"Santos"`, After: `"Recife"`}}},
+		{ID: objectid.New(), CustomerID: customerID, Action: "updated", Version: 2},
+	}
+
+	repositoryMock := &repository.CustomerRepositoryMock{}
+	repositoryMock.On("FindCustomerAudit", mock.Anything, customerID, repository.AuditFilter{AfterID: afterID, Limit: 2}).Return(audits, nil)
+
+	aggregate := CustomerAggregate{Repository: repositoryMock, CacheStore: &cachestore.CustomerCacheStoreMock{}}
+	history, err := aggregate.FindCustomerHistory(context.Background(), customerID.Hex(), HistoryQuery{After: afterID.Hex(), Limit: 1})
+
+	assert.Nil(t, err)
+
+	if assert.NotNil(t, history) && assert.Len(t, history.Changes, 1) {
+		assert.Equal(t, audits[0].ID.Hex(), history.Next)
+		assert.Equal(t, domain.AuditUpdated, history.Changes[0].Action)
+		assert.Equal(t, []domain.FieldChange{{Field: "city", Before: []byte(`"Santos"`), After: []byte(`"Recife"`)}}, history.Changes[0].Changes)
+	}
+}
+
+func TestShouldReturnNotFoundWhenHistoryOfCustomerNotExists(t *testing.T) {
+
+	customerID := objectid.New()
+
+	repositoryMock := &repository.CustomerRepositoryMock{}
+	repositoryMock.On("FindCustomerAudit", mock.Anything, customerID, mock.Anything).Return([]*repository.CustomerAuditEntity{}, nil)
+	repositoryMock.On("FindCustomerByID", mock.Anything, customerID).Return(nil, nil)
+
+	aggregate := CustomerAggregate{Repository: repositoryMock, CacheStore: &cachestore.CustomerCacheStoreMock{}}
+	history, err := aggregate.FindCustomerHistory(context.Background(), customerID.Hex(), HistoryQuery{})
+
+	assert.Nil(t, history)
+	assert.Equal(t, ErrCustomerNotFound, err)
+}
+
+func TestShouldReturnPageWithNextCursorWhenHasMoreCustomers(t *testing.T) {
+
+	customerAmanda := &repository.CustomerEntity{ID: objectid.New(), Name: "Amanda", City: "Recife"}
+	customerMarcos := &repository.CustomerEntity{ID: objectid.New(), Name: "Marcos", City: "Recife"}
+
+	repositoryMock := &repository.CustomerRepositoryMock{}
+	repositoryMock.On("FindCustomers", mock.Anything, repository.CustomerFilter{City: "Recife", SortBy: "name", Limit: 2}).
+		Return([]*repository.CustomerEntity{customerAmanda, customerMarcos}, nil)
+	repositoryMock.On("FindCustomers", mock.Anything, repository.CustomerFilter{City: "Recife", SortBy: "name", Limit: 2, AfterID: customerAmanda.ID, AfterValue: "Amanda"}).
+		Return([]*repository.CustomerEntity{customerMarcos}, nil)
+
+	aggregate := CustomerAggregate{Repository: repositoryMock}
+	page, err := aggregate.FindCustomers(context.Background(), CustomerQuery{City: "Recife", Sort: "name", Limit: 1})
+
+	assert.Nil(t, err)
+
+	if assert.NotNil(t, page) && assert.Equal(t, 1, len(page.Customers)) {
+		assert.Equal(t, "Amanda", page.Customers[0].Name)
+		assert.NotEmpty(t, page.Next)
+	}
+
+	page, err = aggregate.FindCustomers(context.Background(), CustomerQuery{City: "Recife", Sort: "name", Limit: 1, After: page.Next})
+
+	assert.Nil(t, err)
+
+	if assert.NotNil(t, page) && assert.Equal(t, 1, len(page.Customers)) {
+		assert.Equal(t, "Marcos", page.Customers[0].Name)
+		assert.Empty(t, page.Next)
+	}
+}
+
+func TestShouldReturnErrorWhenQueryIsNotValid(t *testing.T) {
+
+	tests := []struct {
+		description string
+		query       CustomerQuery
+		expected    error
+	}{
+		{"should reject negative limit", CustomerQuery{Limit: -1}, ErrInvalidLimit},
+		{"should reject limit bigger than max", CustomerQuery{Limit: MaxPageLimit + 1}, ErrInvalidLimit},
+		{"should reject unknown sort", CustomerQuery{Sort: "age"}, ErrInvalidSort},
+		{"should reject malformed cursor", CustomerQuery{After: "!"}, ErrInvalidCursor},
+		{"should reject cursor from another sort", CustomerQuery{Sort: "-city", After: makePageCursor(CustomerQuery{Sort: "name"},
+			repository.CustomerFilter{SortBy: "name"}, &repository.CustomerEntity{ID: objectid.New(), Name: "Amanda"})}, ErrInvalidCursor},
+	}
+
+	for _, tc := range tests {
+		repositoryMock := &repository.CustomerRepositoryMock{}
+
+		aggregate := CustomerAggregate{Repository: repositoryMock}
+		page, err := aggregate.FindCustomers(context.Background(), tc.query)
+
+		assert.Nil(t, page, tc.description)
+		assert.Equal(t, tc.expected, err, tc.description)
+
+		repositoryMock.AssertNotCalled(t, "FindCustomers", mock.Anything, mock.Anything)
+	}
+}
+
+func TestShouldNotQueryDatabaseAgainWhenNameWasNotFoundRecently(t *testing.T) {
+
+	customerName := "Thiago"
+
+	repositoryMock := &repository.CustomerRepositoryMock{}
+	repositoryMock.On("FindCustomerByName", mock.Anything, customerName).Return(nil, nil)
+
+	cacheStoreMock := &cachestore.CustomerCacheStoreMock{}
+	cacheStoreMock.On("RetriveCustomerEntity", mock.Anything, customerName).Return(nil)
+
+	aggregate := CustomerAggregate{Repository: repositoryMock, CacheStore: cacheStoreMock}
+
+	for i := 0; i < 3; i++ {
+		customer, err := aggregate.FindCustomerByName(context.Background(), customerName)
+		assert.Equal(t, ErrCustomerNotFound, err)
+		assert.Nil(t, customer)
+	}
+
+	repositoryMock.AssertNumberOfCalls(t, "FindCustomerByName", 1)
+
+	stats := aggregate.LookupStats()
+	assert.Equal(t, int64(1), stats.DatabaseCalls)
+	assert.Equal(t, int64(2), stats.NegativeCacheHits)
+	assert.Equal(t, int64(2), stats.SavedCalls)
+}
+
+func TestShouldQueryDatabaseAgainWhenNotFoundEntryExpires(t *testing.T) {
+
+	customerName := "Thiago"
+
+	repositoryMock := &repository.CustomerRepositoryMock{}
+	repositoryMock.On("FindCustomerByName", mock.Anything, customerName).Return(nil, nil)
+
+	cacheStoreMock := &cachestore.CustomerCacheStoreMock{}
+	cacheStoreMock.On("RetriveCustomerEntity", mock.Anything, customerName).Return(nil)
+
+	aggregate := CustomerAggregate{Repository: repositoryMock, CacheStore: cacheStoreMock}
+	aggregate.FindCustomerByName(context.Background(), customerName)
+
+	aggregate.lookup.notFoundNames[customerName] = time.Now().Add(-time.Second)
+	aggregate.FindCustomerByName(context.Background(), customerName)
+
+	repositoryMock.AssertNumberOfCalls(t, "FindCustomerByName", 2)
+}
+
+func TestShouldRememberTheNotFoundNamesUpToTheMaximum(t *testing.T) {
+
+	lookup := &customerLookup{}
+	for i := 0; i < maxNotFoundNames; i++ {
+		lookup.rememberNotFound(fmt.Sprintf("Thiago-%d", i))
+	}
+
+	lookup.rememberNotFound("Amanda")
+	assert.False(t, lookup.isKnownAsNotFound("Amanda"))
+	assert.Len(t, lookup.notFoundNames, maxNotFoundNames)
+
+	lookup.notFoundNames["Thiago-0"] = time.Now().Add(-time.Second)
+	lookup.rememberNotFound("Amanda")
+	assert.True(t, lookup.isKnownAsNotFound("Amanda"))
+	assert.Len(t, lookup.notFoundNames, maxNotFoundNames)
+}
+
+func TestShouldQueryDatabaseAgainWhenNotFoundNameIsCreated(t *testing.T) {
+
+	customerName := "Thiago"
+
+	repositoryMock := &repository.CustomerRepositoryMock{}
+	repositoryMock.On("FindCustomerByName", mock.Anything, customerName).Return(nil, nil).Once()
+	repositoryMock.On("InsertCustomer", mock.Anything, mock.Anything, mock.Anything).Return(nil)
+
+	cacheStoreMock := &cachestore.CustomerCacheStoreMock{}
+	cacheStoreMock.On("RetriveCustomerEntity", mock.Anything, customerName).Return(nil)
+	cacheStoreMock.On("PersistCustomerEntity", mock.Anything, mock.Anything)
+
+	aggregate := CustomerAggregate{Repository: repositoryMock, CacheStore: cacheStoreMock}
+	aggregate.FindCustomerByName(context.Background(), customerName)
+
+	createdCustomer, _ := aggregate.CreateNewCustomer(context.Background(), &domain.Customer{Name: customerName, City: "Recife"})
+	customerInDataBase := toEntity(createdCustomer)
+	customerInDataBase.ID, _ = objectid.FromHex(createdCustomer.ID)
+	repositoryMock.On("FindCustomerByName", mock.Anything, customerName).Return(customerInDataBase, nil)
+
+	customer, err := aggregate.FindCustomerByName(context.Background(), customerName)
+
+	assert.Nil(t, err)
+	assert.NotNil(t, customer)
+
+	repositoryMock.AssertNumberOfCalls(t, "FindCustomerByName", 2)
+}
+
+func TestShouldCoalesceConcurrentLookupsByTheSameName(t *testing.T) {
+
+	customerName := "Jessica"
+	customerInDataBase := repository.CustomerEntity{ID: objectid.New(), Name: customerName, City: "São Paulo"}
+
+	repositoryMock := &repository.CustomerRepositoryMock{}
+	repositoryMock.On("FindCustomerByName", mock.Anything, customerName).Return(&customerInDataBase, nil).After(100 * time.Millisecond)
+
+	cacheStoreMock := &cachestore.CustomerCacheStoreMock{}
+	cacheStoreMock.On("RetriveCustomerEntity", mock.Anything, customerName).Return(nil)
+	cacheStoreMock.On("PersistCustomerEntity", mock.Anything, &customerInDataBase)
+
+	aggregate := CustomerAggregate{Repository: repositoryMock, CacheStore: cacheStoreMock}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			customer, err := aggregate.FindCustomerByName(context.Background(), customerName)
+			assert.Nil(t, err)
+			assert.NotNil(t, customer)
+		}()
+	}
+	wg.Wait()
+
+	repositoryMock.AssertNumberOfCalls(t, "FindCustomerByName", 1)
+	cacheStoreMock.AssertNumberOfCalls(t, "PersistCustomerEntity", 1)
+
+	stats := aggregate.LookupStats()
+	assert.Equal(t, int64(5), stats.Lookups)
+	assert.Equal(t, int64(4), stats.CoalescedLookups)
+}
+
+func TestShouldStopWaitingLookupWhenRequestIsCanceled(t *testing.T) {
+
+	customerName := "Bruna"
+	customerInDataBase := repository.CustomerEntity{ID: objectid.New(), Name: customerName, City: "Recife"}
+
+	findContexts := make(chan context.Context, 1)
+
+	repositoryMock := &repository.CustomerRepositoryMock{}
+	repositoryMock.On("FindCustomerByName", mock.Anything, customerName).Return(&customerInDataBase, nil).
+		After(100 * time.Millisecond).
+		Run(func(args mock.Arguments) { findContexts <- args.Get(0).(context.Context) })
+
+	cacheStoreMock := &cachestore.CustomerCacheStoreMock{}
+	cacheStoreMock.On("RetriveCustomerEntity", mock.Anything, customerName).Return(nil)
+	cacheStoreMock.On("PersistCustomerEntity", mock.Anything, &customerInDataBase)
+
+	aggregate := CustomerAggregate{Repository: repositoryMock, CacheStore: cacheStoreMock}
+
+	ctx, cancel := context.WithCancel(logger.WithRequestID(context.Background(), "1539000000"))
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		cancel()
+	}()
+
+	customer, err := aggregate.FindCustomerByName(ctx, customerName)
+
+	assert.Nil(t, customer)
+	assert.EqualError(t, err, "could not find customer: context canceled")
+
+	findCtx := <-findContexts
+	assert.NoError(t, findCtx.Err())
+	assert.Equal(t, "1539000000", logger.RequestID(findCtx))
+}
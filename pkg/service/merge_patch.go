@@ -0,0 +1,53 @@
+package service
+
+import (
+	"encoding/json"
+
+	"github.com/jcsw/go-api-learn/pkg/domain"
+)
+
+// ErrInvalidMergePatch Error for a patch document that is not a valid JSON Merge Patch
+var ErrInvalidMergePatch = domain.NewError(domain.ErrInvalid, "invalid_merge_patch", "Invalid merge patch document")
+
+// applyMergePatch apply the patch document on the target document following RFC 7396
+func applyMergePatch(target []byte, patch []byte) ([]byte, error) {
+
+	var targetValue interface{}
+	if err := json.Unmarshal(target, &targetValue); err != nil {
+		return nil, ErrInvalidMergePatch
+	}
+
+	var patchValue interface{}
+	if err := json.Unmarshal(patch, &patchValue); err != nil {
+		return nil, ErrInvalidMergePatch
+	}
+
+	if _, ok := patchValue.(map[string]interface{}); !ok {
+		return nil, ErrInvalidMergePatch
+	}
+
+	return json.Marshal(mergePatch(targetValue, patchValue))
+}
+
+func mergePatch(target interface{}, patch interface{}) interface{} {
+
+	patchObject, ok := patch.(map[string]interface{})
+	if !ok {
+		return patch
+	}
+
+	targetObject, ok := target.(map[string]interface{})
+	if !ok {
+		targetObject = map[string]interface{}{}
+	}
+
+	for name, value := range patchObject {
+		if value == nil {
+			delete(targetObject, name)
+			continue
+		}
+		targetObject[name] = mergePatch(targetObject[name], value)
+	}
+
+	return targetObject
+}
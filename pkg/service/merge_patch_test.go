@@ -0,0 +1,38 @@
+package service
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestShouldApplyMergePatch(t *testing.T) {
+
+	tests := []struct {
+		description string
+		target      string
+		patch       string
+		expected    string
+	}{
+		{"should replace a member", `{"a":"b"}`, `{"a":"c"}`, `{"a":"c"}`},
+		{"should add a member", `{"a":"b"}`, `{"b":"c"}`, `{"a":"b","b":"c"}`},
+		{"should remove a member", `{"a":"b","b":"c"}`, `{"a":null}`, `{"b":"c"}`},
+		{"should replace an array", `{"a":["b"]}`, `{"a":["c","d"]}`, `{"a":["c","d"]}`},
+		{"should merge nested objects", `{"a":{"b":"c","d":"e"}}`, `{"a":{"d":null,"f":"g"}}`, `{"a":{"b":"c","f":"g"}}`},
+		{"should replace a scalar with an object", `{"a":"b"}`, `{"a":{"c":null,"d":"e"}}`, `{"a":{"d":"e"}}`},
+	}
+
+	for _, tc := range tests {
+		result, err := applyMergePatch([]byte(tc.target), []byte(tc.patch))
+
+		assert.Nil(t, err, tc.description)
+		assert.JSONEq(t, tc.expected, string(result), tc.description)
+	}
+}
+
+func TestShouldReturnErrWhenMergePatchIsNotAnObject(t *testing.T) {
+
+	_, err := applyMergePatch([]byte(`{"a":"b"}`), []byte(`["a"]`))
+
+	assert.Equal(t, ErrInvalidMergePatch, err)
+}
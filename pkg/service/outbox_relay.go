@@ -0,0 +1,234 @@
+package service
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/mongodb/mongo-go-driver/bson/objectid"
+
+	"github.com/jcsw/go-api-learn/pkg/infra/database/repository"
+	"github.com/jcsw/go-api-learn/pkg/infra/events"
+	"github.com/jcsw/go-api-learn/pkg/infra/logger"
+)
+
+const (
+	defaultRelayInterval    = time.Second
+	defaultRelayBatchSize   = 100
+	defaultRelayMaxAttempts = 10
+	defaultRelayBackoff     = time.Second
+	defaultRelayLease       = 30 * time.Second
+
+	// maxBackoff the longest wait between two attempts to deliver an event
+	maxBackoff = time.Hour
+)
+
+// OutboxRelay publish in background the events stored in the outbox. An event is removed only after it's published,
+// so it's delivered at least once. Each event is claimed by the relay identified by ID for Lease before it's published,
+// so the relays sharing the outbox don't publish it at once, and the events of a customer are published in the order
+// of their versions. A failed event is retried with a backoff that doubles on every attempt and after MaxAttempts
+// it's moved to the dead letter store. The fields left zero use the defaults, the ID is generated on first use
+type OutboxRelay struct {
+	ID          string
+	Outbox      repository.OutboxRepository
+	Publisher   events.EventPublisher
+	Interval    time.Duration
+	BatchSize   int64
+	MaxAttempts int64
+	Backoff     time.Duration
+	Lease       time.Duration
+
+	ownerOnce    sync.Once
+	published    int64
+	retried      int64
+	deadLettered int64
+}
+
+// RelayStats the counters of the events handled by the relay
+type RelayStats struct {
+	Published    int64 `json:"published"`
+	Retried      int64 `json:"retried"`
+	DeadLettered int64 `json:"deadLettered"`
+}
+
+// Run publish the pending events on every interval until ctx is done
+func (relay *OutboxRelay) Run(ctx context.Context) {
+
+	ticker := time.NewTicker(durationOrDefault(relay.Interval, defaultRelayInterval))
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		relay.RelayPending(ctx)
+	}
+}
+
+// RelayPending publish the events that are due, batch after batch while they are published, return how many were published
+func (relay *OutboxRelay) RelayPending(ctx context.Context) int {
+
+	batchSize := relay.BatchSize
+	if batchSize <= 0 {
+		batchSize = defaultRelayBatchSize
+	}
+
+	published := 0
+	for ctx.Err() == nil {
+
+		claimed, batchPublished := relay.relayBatch(ctx, batchSize)
+		published += batchPublished
+
+		if claimed < batchSize || batchPublished == 0 {
+			break
+		}
+	}
+
+	return published
+}
+
+// relayBatch claim and publish up to batchSize due events, return how many were claimed and published.
+// An event claimed while an earlier event of its customer is still in the outbox is held until that one is due
+func (relay *OutboxRelay) relayBatch(ctx context.Context, batchSize int64) (int64, int) {
+	log := serviceLogger.WithContext(ctx).With(logger.Function("OutboxRelay"))
+
+	var claimed int64
+	published := 0
+	for ctx.Err() == nil && claimed < batchSize {
+
+		claimedAt := now()
+		event, err := relay.Outbox.ClaimPendingEvent(ctx, relay.ownerID(), claimedAt, claimedAt.Add(durationOrDefault(relay.Lease, defaultRelayLease)))
+		if err != nil {
+			log.Error("could not claim a pending event", logger.Err(err))
+			break
+		}
+
+		if event == nil {
+			break
+		}
+		claimed++
+
+		earlier, err := relay.Outbox.FindEarlierEvent(ctx, event)
+		if err != nil {
+			log.Error("could not find the earlier events of the customer, the event is due again when its lease expires", logger.String("id", event.ID.Hex()), logger.Err(err))
+			continue
+		}
+
+		if earlier != nil {
+			relay.hold(ctx, event, earlier)
+			continue
+		}
+
+		if relay.deliver(ctx, event) {
+			published++
+		}
+	}
+
+	return claimed, published
+}
+
+// Stats return the counters of the events handled by the relay
+func (relay *OutboxRelay) Stats() RelayStats {
+	return RelayStats{
+		Published:    atomic.LoadInt64(&relay.published),
+		Retried:      atomic.LoadInt64(&relay.retried),
+		DeadLettered: atomic.LoadInt64(&relay.deadLettered),
+	}
+}
+
+// deliver publish the event and remove it from the outbox, or schedule its next attempt when it fails.
+// Return whether it was published
+func (relay *OutboxRelay) deliver(ctx context.Context, event *repository.OutboxEventEntity) bool {
+	log := serviceLogger.WithContext(ctx).With(logger.Function("OutboxRelay"), logger.String("id", event.ID.Hex()), logger.String("type", event.Type))
+
+	err := relay.Publisher.Publish(ctx, makeEventByEntity(event))
+
+	if err == nil {
+		atomic.AddInt64(&relay.published, 1)
+		if err := relay.Outbox.AcknowledgeEvent(ctx, event.ID); err != nil {
+			log.Warn("event published but not acknowledged, it will be published again", logger.Err(err))
+		}
+		return true
+	}
+
+	event.Attempts++
+	event.LastError = err.Error()
+
+	maxAttempts := relay.MaxAttempts
+	if maxAttempts <= 0 {
+		maxAttempts = defaultRelayMaxAttempts
+	}
+
+	if event.Attempts >= maxAttempts {
+		atomic.AddInt64(&relay.deadLettered, 1)
+		event.DeadAt = now()
+		if err := relay.Outbox.DeadLetterEvent(ctx, event); err != nil {
+			log.Error("could not dead letter the event", logger.Err(err))
+		}
+		return false
+	}
+
+	atomic.AddInt64(&relay.retried, 1)
+	event.NextAttemptAt = now().Add(relay.backoff(event.Attempts))
+	log.Warn("could not publish the event, it will be retried", logger.Int64("attempts", event.Attempts), logger.Err(err))
+
+	if err := relay.Outbox.RescheduleEvent(ctx, event); err != nil {
+		log.Error("could not reschedule the event", logger.Err(err))
+	}
+	return false
+}
+
+// hold schedule the event to the next attempt of the earlier event of its customer, and not before the next interval,
+// so it's not published before it
+func (relay *OutboxRelay) hold(ctx context.Context, event *repository.OutboxEventEntity, earlier *repository.OutboxEventEntity) {
+	log := serviceLogger.WithContext(ctx).With(logger.Function("OutboxRelay"), logger.String("id", event.ID.Hex()), logger.String("earlier", earlier.ID.Hex()))
+
+	event.NextAttemptAt = now().Add(durationOrDefault(relay.Interval, defaultRelayInterval))
+	if earlier.NextAttemptAt.After(event.NextAttemptAt) {
+		event.NextAttemptAt = earlier.NextAttemptAt
+	}
+
+	log.Debug("event held until the earlier event of its customer is published")
+	if err := relay.Outbox.RescheduleEvent(ctx, event); err != nil {
+		log.Error("could not hold the event, it's due again when its lease expires", logger.Err(err))
+	}
+}
+
+func (relay *OutboxRelay) ownerID() string {
+	relay.ownerOnce.Do(func() {
+		if relay.ID == "" {
+			relay.ID = objectid.New().Hex()
+		}
+	})
+	return relay.ID
+}
+
+// backoff return the wait before the next attempt to publish an event
+func (relay *OutboxRelay) backoff(attempts int64) time.Duration {
+	return exponentialBackoff(durationOrDefault(relay.Backoff, defaultRelayBackoff), attempts)
+}
+
+// exponentialBackoff return the wait after the failed attempts, it starts at base and doubles on every attempt up to maxBackoff
+func exponentialBackoff(base time.Duration, attempts int64) time.Duration {
+
+	backoff := base
+	for i := int64(1); i < attempts && backoff < maxBackoff; i++ {
+		backoff *= 2
+	}
+
+	if backoff > maxBackoff {
+		return maxBackoff
+	}
+	return backoff
+}
+
+func durationOrDefault(duration time.Duration, defaultDuration time.Duration) time.Duration {
+	if duration <= 0 {
+		return defaultDuration
+	}
+	return duration
+}
@@ -0,0 +1,181 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/mongodb/mongo-go-driver/bson/objectid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+
+	"github.com/jcsw/go-api-learn/pkg/infra/database/repository"
+	"github.com/jcsw/go-api-learn/pkg/infra/events"
+)
+
+func newPendingEvent(attempts int64) *repository.OutboxEventEntity {
+	return &repository.OutboxEventEntity{
+		ID:         objectid.New(),
+		Type:       "CustomerCreated",
+		CustomerID: objectid.New(),
+		Version:    1,
+		Payload:    `{"type":"CustomerCreated"}`,
+		Attempts:   attempts,
+	}
+}
+
+// onClaimPendingEvent make the events claimable in turn, the claims after them find none
+func onClaimPendingEvent(repositoryMock *repository.CustomerRepositoryMock, pending ...*repository.OutboxEventEntity) {
+
+	for _, event := range pending {
+		repositoryMock.On("ClaimPendingEvent", mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(event, nil).Once()
+	}
+	repositoryMock.On("ClaimPendingEvent", mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(nil, nil)
+	repositoryMock.On("FindEarlierEvent", mock.Anything, mock.Anything).Return(nil, nil)
+}
+
+func TestShouldPublishAndAcknowledgePendingEvents(t *testing.T) {
+
+	dueAt := freezeNow(t)
+	pending := newPendingEvent(0)
+
+	repositoryMock := &repository.CustomerRepositoryMock{}
+	repositoryMock.On("ClaimPendingEvent", mock.Anything, "relay-1", dueAt, dueAt.Add(defaultRelayLease)).Return(pending, nil).Once()
+	onClaimPendingEvent(repositoryMock)
+	repositoryMock.On("AcknowledgeEvent", mock.Anything, pending.ID).Return(nil)
+
+	publisher := &events.MemoryPublisher{}
+
+	relay := OutboxRelay{ID: "relay-1", Outbox: repositoryMock, Publisher: publisher, BatchSize: 10}
+	published := relay.RelayPending(context.Background())
+
+	assert.Equal(t, 1, published)
+	assert.Equal(t, RelayStats{Published: 1}, relay.Stats())
+
+	if publishedEvents := publisher.Events(); assert.Len(t, publishedEvents, 1) {
+		assert.Equal(t, pending.ID.Hex(), publishedEvents[0].ID)
+		assert.Equal(t, pending.CustomerID.Hex(), publishedEvents[0].Key)
+		assert.Equal(t, "CustomerCreated", publishedEvents[0].Type)
+		assert.Equal(t, []byte(pending.Payload), publishedEvents[0].Payload)
+	}
+
+	repositoryMock.AssertCalled(t, "AcknowledgeEvent", mock.Anything, pending.ID)
+}
+
+func TestShouldRescheduleEventWithBackoffWhenPublishFails(t *testing.T) {
+
+	failedAt := freezeNow(t)
+	pending := newPendingEvent(2)
+
+	repositoryMock := &repository.CustomerRepositoryMock{}
+	onClaimPendingEvent(repositoryMock, pending)
+	repositoryMock.On("RescheduleEvent", mock.Anything, pending).Return(nil)
+
+	publisher := &events.MemoryPublisher{}
+	publisher.FailWith(errors.New("broker unavailable"))
+
+	relay := OutboxRelay{Outbox: repositoryMock, Publisher: publisher, Backoff: time.Second, MaxAttempts: 5}
+	published := relay.RelayPending(context.Background())
+
+	assert.Equal(t, 0, published)
+	assert.Equal(t, RelayStats{Retried: 1}, relay.Stats())
+	assert.Equal(t, int64(3), pending.Attempts)
+	assert.Equal(t, "broker unavailable", pending.LastError)
+	assert.Equal(t, failedAt.Add(4*time.Second), pending.NextAttemptAt)
+
+	repositoryMock.AssertNotCalled(t, "AcknowledgeEvent", mock.Anything, mock.Anything)
+	repositoryMock.AssertNotCalled(t, "DeadLetterEvent", mock.Anything, mock.Anything)
+}
+
+func TestShouldDeadLetterEventWhenAttemptsAreExhausted(t *testing.T) {
+
+	failedAt := freezeNow(t)
+	pending := newPendingEvent(4)
+
+	repositoryMock := &repository.CustomerRepositoryMock{}
+	onClaimPendingEvent(repositoryMock, pending)
+	repositoryMock.On("DeadLetterEvent", mock.Anything, pending).Return(nil)
+
+	publisher := &events.MemoryPublisher{}
+	publisher.FailWith(errors.New("broker unavailable"))
+
+	relay := OutboxRelay{Outbox: repositoryMock, Publisher: publisher, MaxAttempts: 5}
+	relay.RelayPending(context.Background())
+
+	assert.Equal(t, RelayStats{DeadLettered: 1}, relay.Stats())
+	assert.Equal(t, int64(5), pending.Attempts)
+	assert.Equal(t, failedAt, pending.DeadAt)
+
+	repositoryMock.AssertNotCalled(t, "RescheduleEvent", mock.Anything, mock.Anything)
+}
+
+func TestShouldKeepRelayingWhileBatchesAreFull(t *testing.T) {
+
+	freezeNow(t)
+
+	repositoryMock := &repository.CustomerRepositoryMock{}
+	onClaimPendingEvent(repositoryMock, newPendingEvent(0), newPendingEvent(0), newPendingEvent(0))
+	repositoryMock.On("AcknowledgeEvent", mock.Anything, mock.Anything).Return(nil)
+
+	relay := OutboxRelay{Outbox: repositoryMock, Publisher: &events.MemoryPublisher{}, BatchSize: 2}
+	published := relay.RelayPending(context.Background())
+
+	assert.Equal(t, 3, published)
+	assert.NotEmpty(t, relay.ID)
+	repositoryMock.AssertNumberOfCalls(t, "ClaimPendingEvent", 4)
+}
+
+func TestShouldHoldTheEventWhileAnEarlierEventOfTheCustomerIsPending(t *testing.T) {
+
+	heldAt := freezeNow(t)
+	earlier := newPendingEvent(1)
+	earlier.NextAttemptAt = heldAt.Add(time.Minute)
+	later := newPendingEvent(0)
+	later.CustomerID, later.Version = earlier.CustomerID, 2
+
+	repositoryMock := &repository.CustomerRepositoryMock{}
+	repositoryMock.On("ClaimPendingEvent", mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(later, nil).Once()
+	repositoryMock.On("ClaimPendingEvent", mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(nil, nil).Once()
+	repositoryMock.On("ClaimPendingEvent", mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(later, nil).Once()
+	repositoryMock.On("ClaimPendingEvent", mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(nil, nil)
+	repositoryMock.On("FindEarlierEvent", mock.Anything, later).Return(earlier, nil)
+	repositoryMock.On("RescheduleEvent", mock.Anything, later).Return(nil)
+
+	publisher := &events.MemoryPublisher{}
+
+	relay := OutboxRelay{Outbox: repositoryMock, Publisher: publisher}
+	published := relay.RelayPending(context.Background())
+
+	assert.Equal(t, 0, published)
+	assert.Empty(t, publisher.Events())
+	assert.Equal(t, RelayStats{}, relay.Stats())
+	assert.Equal(t, int64(0), later.Attempts)
+	assert.Equal(t, earlier.NextAttemptAt, later.NextAttemptAt)
+
+	earlier.NextAttemptAt = heldAt
+	relay.RelayPending(context.Background())
+	assert.Equal(t, heldAt.Add(defaultRelayInterval), later.NextAttemptAt)
+
+	repositoryMock.AssertNotCalled(t, "AcknowledgeEvent", mock.Anything, mock.Anything)
+}
+
+func TestShouldDoubleBackoffUpToTheMaximum(t *testing.T) {
+
+	relay := OutboxRelay{Backoff: time.Minute}
+
+	tests := []struct {
+		attempts        int64
+		expectedBackoff time.Duration
+	}{
+		{1, time.Minute},
+		{2, 2 * time.Minute},
+		{5, 16 * time.Minute},
+		{7, time.Hour},
+		{60, time.Hour},
+	}
+
+	for _, tc := range tests {
+		assert.Equal(t, tc.expectedBackoff, relay.backoff(tc.attempts), "attempts %d", tc.attempts)
+	}
+}
@@ -0,0 +1,234 @@
+package service
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/jcsw/go-api-learn/pkg/domain"
+	"github.com/jcsw/go-api-learn/pkg/infra/database/repository"
+	"github.com/jcsw/go-api-learn/pkg/infra/logger"
+	"github.com/jcsw/go-api-learn/pkg/infra/webhook"
+)
+
+const (
+	defaultDispatchInterval    = time.Second
+	defaultDispatchBatchSize   = 100
+	defaultDispatchMaxAttempts = 8
+	defaultDispatchBackoff     = 10 * time.Second
+	defaultDispatchWorkers     = 4
+	defaultDispatchLease       = time.Minute
+)
+
+// errWebhookGone the error logged in the attempt of a delivery whose webhook was deleted
+const errWebhookGone = "webhook not found"
+
+// WebhookDispatcher deliver in background the pending deliveries to the webhooks on Workers workers, every attempt
+// is logged in the delivery. Each delivery is claimed for Lease before it's sent, so the dispatchers of every instance
+// share the deliveries, and one left sending by a dispatcher that stopped is due again when the lease expires.
+// A failed delivery is retried with a backoff that doubles on every attempt and after MaxAttempts it's marked
+// as failed until replayed. The fields left zero use the defaults
+type WebhookDispatcher struct {
+	Repository  repository.WebhookRepository
+	Sender      *webhook.Sender
+	Interval    time.Duration
+	BatchSize   int64
+	MaxAttempts int64
+	Backoff     time.Duration
+	Workers     int
+	Lease       time.Duration
+
+	delivered int64
+	retried   int64
+	failed    int64
+}
+
+// DispatchStats the counters of the deliveries handled by the dispatcher
+type DispatchStats struct {
+	Delivered int64 `json:"delivered"`
+	Retried   int64 `json:"retried"`
+	Failed    int64 `json:"failed"`
+}
+
+// Run deliver the due deliveries on every interval until ctx is done
+func (dispatcher *WebhookDispatcher) Run(ctx context.Context) {
+
+	ticker := time.NewTicker(durationOrDefault(dispatcher.Interval, defaultDispatchInterval))
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		dispatcher.DispatchDue(ctx)
+	}
+}
+
+// DispatchDue deliver the deliveries that are due, batch after batch while they are delivered, return how many were delivered
+func (dispatcher *WebhookDispatcher) DispatchDue(ctx context.Context) int {
+
+	batchSize := dispatcher.BatchSize
+	if batchSize <= 0 {
+		batchSize = defaultDispatchBatchSize
+	}
+
+	delivered := 0
+	for ctx.Err() == nil {
+
+		claimed, batchDelivered := dispatcher.dispatchBatch(ctx, batchSize)
+		delivered += batchDelivered
+
+		if claimed < batchSize || batchDelivered == 0 {
+			break
+		}
+	}
+
+	return delivered
+}
+
+// dispatchBatch claim and deliver up to batchSize due deliveries on the workers, return how many were claimed and delivered
+func (dispatcher *WebhookDispatcher) dispatchBatch(ctx context.Context, batchSize int64) (int64, int) {
+	log := serviceLogger.WithContext(ctx).With(logger.Function("WebhookDispatcher"))
+
+	workers := dispatcher.Workers
+	if workers <= 0 {
+		workers = defaultDispatchWorkers
+	}
+
+	var reserved, claimed, delivered int64
+	var wg sync.WaitGroup
+
+	wg.Add(workers)
+	for i := 0; i < workers; i++ {
+		go func() {
+			defer wg.Done()
+
+			for ctx.Err() == nil && atomic.AddInt64(&reserved, 1) <= batchSize {
+				claimedAt := now()
+				delivery, err := dispatcher.Repository.ClaimDueDelivery(ctx, claimedAt, claimedAt.Add(durationOrDefault(dispatcher.Lease, defaultDispatchLease)))
+				if err != nil {
+					log.Error("could not claim a due delivery", logger.Err(err))
+					return
+				}
+
+				if delivery == nil {
+					return
+				}
+
+				atomic.AddInt64(&claimed, 1)
+				if dispatcher.deliver(ctx, delivery) {
+					atomic.AddInt64(&delivered, 1)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	return claimed, int(delivered)
+}
+
+// Stats return the counters of the deliveries handled by the dispatcher
+func (dispatcher *WebhookDispatcher) Stats() DispatchStats {
+	return DispatchStats{
+		Delivered: atomic.LoadInt64(&dispatcher.delivered),
+		Retried:   atomic.LoadInt64(&dispatcher.retried),
+		Failed:    atomic.LoadInt64(&dispatcher.failed),
+	}
+}
+
+// deliver send the event of the claimed delivery to the webhook and log the attempt, the delivery is retried later
+// when it fails. Return whether it was delivered
+func (dispatcher *WebhookDispatcher) deliver(ctx context.Context, delivery *repository.WebhookDeliveryEntity) bool {
+	log := serviceLogger.WithContext(ctx).With(logger.Function("WebhookDispatcher"), logger.String("id", delivery.ID.Hex()), logger.String("type", delivery.EventType))
+
+	subscriptionEntity, err := dispatcher.Repository.FindSubscriptionByID(ctx, delivery.SubscriptionID)
+	if err != nil {
+		log.Error("could not find the webhook of the delivery, it's due again when its claim expires", logger.Err(err))
+		return false
+	}
+
+	attempt := repository.WebhookAttemptEntity{At: now()}
+	if subscriptionEntity == nil {
+		attempt.Error = errWebhookGone
+		dispatcher.fail(ctx, delivery, attempt)
+		return false
+	}
+
+	started := time.Now()
+	attempt.StatusCode, err = dispatcher.Sender.Send(ctx, subscriptionEntity.URL, subscriptionEntity.Secret, &webhook.Message{
+		DeliveryID: delivery.ID.Hex(),
+		EventType:  delivery.EventType,
+		Timestamp:  attempt.At,
+		Payload:    []byte(delivery.Payload),
+	})
+	attempt.DurationMs = int64(time.Since(started) / time.Millisecond)
+
+	if err != nil {
+		attempt.Error = err.Error()
+		dispatcher.retry(ctx, delivery, attempt)
+		return false
+	}
+
+	atomic.AddInt64(&dispatcher.delivered, 1)
+	delivery.Attempts = append(delivery.Attempts, attempt)
+	delivery.Status = string(domain.DeliveryDelivered)
+	delivery.DeliveredAt = attempt.At
+	delivery.NextAttemptAt = time.Time{}
+
+	if err := dispatcher.Repository.RecordDeliveryAttempt(ctx, delivery, attempt); err == repository.ErrDeliveryClaimLost {
+		log.Warn("event delivered but the delivery was replayed or claimed again meanwhile, the attempt is not recorded")
+	} else if err != nil {
+		log.Warn("event delivered but not recorded, it will be delivered again", logger.Err(err))
+	}
+	return true
+}
+
+// retry schedule the next attempt of the delivery, or mark it as failed when the attempts are exhausted
+func (dispatcher *WebhookDispatcher) retry(ctx context.Context, delivery *repository.WebhookDeliveryEntity, attempt repository.WebhookAttemptEntity) {
+	log := serviceLogger.WithContext(ctx).With(logger.Function("WebhookDispatcher"), logger.String("id", delivery.ID.Hex()))
+
+	maxAttempts := dispatcher.MaxAttempts
+	if maxAttempts <= 0 {
+		maxAttempts = defaultDispatchMaxAttempts
+	}
+
+	if delivery.Failures+1 >= maxAttempts {
+		dispatcher.fail(ctx, delivery, attempt)
+		return
+	}
+
+	atomic.AddInt64(&dispatcher.retried, 1)
+	delivery.Attempts = append(delivery.Attempts, attempt)
+	delivery.Status = string(domain.DeliveryPending)
+	delivery.Failures++
+	delivery.NextAttemptAt = attempt.At.Add(exponentialBackoff(durationOrDefault(dispatcher.Backoff, defaultDispatchBackoff), delivery.Failures))
+	log.Warn("could not deliver the event, it will be retried", logger.Int64("failures", delivery.Failures), logger.String("error", attempt.Error))
+
+	if err := dispatcher.Repository.RecordDeliveryAttempt(ctx, delivery, attempt); err == repository.ErrDeliveryClaimLost {
+		log.Warn("the delivery was replayed or claimed again meanwhile, the attempt is not recorded")
+	} else if err != nil {
+		log.Error("could not reschedule the delivery", logger.Err(err))
+	}
+}
+
+// fail mark the delivery as failed, it's only delivered again when replayed
+func (dispatcher *WebhookDispatcher) fail(ctx context.Context, delivery *repository.WebhookDeliveryEntity, attempt repository.WebhookAttemptEntity) {
+	log := serviceLogger.WithContext(ctx).With(logger.Function("WebhookDispatcher"), logger.String("id", delivery.ID.Hex()))
+
+	atomic.AddInt64(&dispatcher.failed, 1)
+	delivery.Attempts = append(delivery.Attempts, attempt)
+	delivery.Failures++
+	delivery.Status = string(domain.DeliveryFailed)
+	delivery.NextAttemptAt = time.Time{}
+	log.Warn("could not deliver the event, it will not be retried", logger.Int64("failures", delivery.Failures), logger.String("error", attempt.Error))
+
+	if err := dispatcher.Repository.RecordDeliveryAttempt(ctx, delivery, attempt); err == repository.ErrDeliveryClaimLost {
+		log.Warn("the delivery was replayed or claimed again meanwhile, the attempt is not recorded")
+	} else if err != nil {
+		log.Error("could not mark the delivery as failed", logger.Err(err))
+	}
+}
@@ -0,0 +1,173 @@
+package service
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/mongodb/mongo-go-driver/bson/objectid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+
+	"github.com/jcsw/go-api-learn/pkg/infra/database/repository"
+	"github.com/jcsw/go-api-learn/pkg/infra/webhook"
+)
+
+func newReceiver(t *testing.T, status int, received chan<- *http.Request) *httptest.Server {
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ioutil.ReadAll(r.Body)
+		if received != nil {
+			received <- r
+		}
+		w.WriteHeader(status)
+	}))
+	t.Cleanup(receiver.Close)
+	return receiver
+}
+
+func newDueDelivery(subscriptionID objectid.ObjectID, failures int64) *repository.WebhookDeliveryEntity {
+	return &repository.WebhookDeliveryEntity{
+		ID:             objectid.New(),
+		SubscriptionID: subscriptionID,
+		EventID:        objectid.New().Hex(),
+		EventType:      "CustomerCreated",
+		Payload:        `{"type":"CustomerCreated"}`,
+		Status:         "sending",
+		Failures:       failures,
+	}
+}
+
+func TestShouldDeliverSignedEventAndLogTheAttempt(t *testing.T) {
+
+	deliveredAt := freezeNow(t)
+	received := make(chan *http.Request, 1)
+	receiver := newReceiver(t, http.StatusOK, received)
+
+	subscription := newSubscriptionEntity("*")
+	subscription.URL = receiver.URL
+	delivery := newDueDelivery(subscription.ID, 0)
+
+	repositoryMock := &repository.WebhookRepositoryMock{}
+	repositoryMock.On("ClaimDueDelivery", mock.Anything, deliveredAt, deliveredAt.Add(defaultDispatchLease)).Return(delivery, nil).Once()
+	repositoryMock.On("ClaimDueDelivery", mock.Anything, mock.Anything, mock.Anything).Return(nil, nil)
+	repositoryMock.On("FindSubscriptionByID", mock.Anything, subscription.ID).Return(subscription, nil)
+	repositoryMock.On("RecordDeliveryAttempt", mock.Anything, delivery, mock.Anything).Return(nil)
+
+	dispatcher := WebhookDispatcher{Repository: repositoryMock, Sender: &webhook.Sender{Client: receiver.Client()}, BatchSize: 10}
+	delivered := dispatcher.DispatchDue(context.Background())
+
+	assert.Equal(t, 1, delivered)
+	assert.Equal(t, DispatchStats{Delivered: 1}, dispatcher.Stats())
+	assert.Equal(t, "delivered", delivery.Status)
+	assert.Equal(t, deliveredAt, delivery.DeliveredAt)
+	if assert.Len(t, delivery.Attempts, 1) {
+		assert.Equal(t, http.StatusOK, delivery.Attempts[0].StatusCode)
+		assert.Empty(t, delivery.Attempts[0].Error)
+		repositoryMock.AssertCalled(t, "RecordDeliveryAttempt", mock.Anything, delivery, delivery.Attempts[0])
+	}
+
+	request := <-received
+	assert.Equal(t, delivery.ID.Hex(), request.Header.Get(webhook.DeliveryHeader))
+	assert.Equal(t, webhook.Sign(subscription.Secret, deliveredAt, []byte(delivery.Payload)), request.Header.Get(webhook.SignatureHeader))
+}
+
+func TestShouldRetryDeliveryWithBackoffWhenWebhookFails(t *testing.T) {
+
+	failedAt := freezeNow(t)
+	receiver := newReceiver(t, http.StatusInternalServerError, nil)
+
+	subscription := newSubscriptionEntity("*")
+	subscription.URL = receiver.URL
+	delivery := newDueDelivery(subscription.ID, 2)
+
+	repositoryMock := &repository.WebhookRepositoryMock{}
+	repositoryMock.On("ClaimDueDelivery", mock.Anything, failedAt, mock.Anything).Return(delivery, nil).Once()
+	repositoryMock.On("ClaimDueDelivery", mock.Anything, mock.Anything, mock.Anything).Return(nil, nil)
+	repositoryMock.On("FindSubscriptionByID", mock.Anything, subscription.ID).Return(subscription, nil)
+	repositoryMock.On("RecordDeliveryAttempt", mock.Anything, delivery, mock.Anything).Return(nil)
+
+	dispatcher := WebhookDispatcher{Repository: repositoryMock, Sender: &webhook.Sender{Client: receiver.Client()}, Backoff: time.Second, MaxAttempts: 5}
+	delivered := dispatcher.DispatchDue(context.Background())
+
+	assert.Equal(t, 0, delivered)
+	assert.Equal(t, DispatchStats{Retried: 1}, dispatcher.Stats())
+	assert.Equal(t, "pending", delivery.Status)
+	assert.Equal(t, int64(3), delivery.Failures)
+	assert.Equal(t, failedAt.Add(4*time.Second), delivery.NextAttemptAt)
+	if assert.Len(t, delivery.Attempts, 1) {
+		assert.Equal(t, http.StatusInternalServerError, delivery.Attempts[0].StatusCode)
+		assert.Equal(t, "webhook answered with status 500", delivery.Attempts[0].Error)
+	}
+}
+
+func TestShouldFailDeliveryWhenAttemptsAreExhausted(t *testing.T) {
+
+	freezeNow(t)
+	receiver := newReceiver(t, http.StatusBadGateway, nil)
+
+	subscription := newSubscriptionEntity("*")
+	subscription.URL = receiver.URL
+	delivery := newDueDelivery(subscription.ID, 4)
+
+	repositoryMock := &repository.WebhookRepositoryMock{}
+	repositoryMock.On("ClaimDueDelivery", mock.Anything, mock.Anything, mock.Anything).Return(delivery, nil).Once()
+	repositoryMock.On("ClaimDueDelivery", mock.Anything, mock.Anything, mock.Anything).Return(nil, nil)
+	repositoryMock.On("FindSubscriptionByID", mock.Anything, subscription.ID).Return(subscription, nil)
+	repositoryMock.On("RecordDeliveryAttempt", mock.Anything, delivery, mock.Anything).Return(nil)
+
+	dispatcher := WebhookDispatcher{Repository: repositoryMock, Sender: &webhook.Sender{Client: receiver.Client()}, MaxAttempts: 5}
+	dispatcher.DispatchDue(context.Background())
+
+	assert.Equal(t, DispatchStats{Failed: 1}, dispatcher.Stats())
+	assert.Equal(t, "failed", delivery.Status)
+	assert.Equal(t, int64(5), delivery.Failures)
+	assert.True(t, delivery.NextAttemptAt.IsZero())
+}
+
+func TestShouldFailDeliveryOfDeletedSubscription(t *testing.T) {
+
+	freezeNow(t)
+	delivery := newDueDelivery(objectid.New(), 0)
+
+	repositoryMock := &repository.WebhookRepositoryMock{}
+	repositoryMock.On("ClaimDueDelivery", mock.Anything, mock.Anything, mock.Anything).Return(delivery, nil).Once()
+	repositoryMock.On("ClaimDueDelivery", mock.Anything, mock.Anything, mock.Anything).Return(nil, nil)
+	repositoryMock.On("FindSubscriptionByID", mock.Anything, delivery.SubscriptionID).Return(nil, nil)
+	repositoryMock.On("RecordDeliveryAttempt", mock.Anything, delivery, mock.Anything).Return(nil)
+
+	dispatcher := WebhookDispatcher{Repository: repositoryMock, Sender: &webhook.Sender{}}
+	dispatcher.DispatchDue(context.Background())
+
+	assert.Equal(t, "failed", delivery.Status)
+	if assert.Len(t, delivery.Attempts, 1) {
+		assert.Equal(t, errWebhookGone, delivery.Attempts[0].Error)
+	}
+}
+
+func TestShouldSendTheClaimedDeliveriesOnTheWorkersUpToTheBatchSize(t *testing.T) {
+
+	freezeNow(t)
+	received := make(chan *http.Request, 10)
+	receiver := newReceiver(t, http.StatusOK, received)
+
+	subscription := newSubscriptionEntity("*")
+	subscription.URL = receiver.URL
+
+	repositoryMock := &repository.WebhookRepositoryMock{}
+	for i := 0; i < 3; i++ {
+		repositoryMock.On("ClaimDueDelivery", mock.Anything, mock.Anything, mock.Anything).Return(newDueDelivery(subscription.ID, 0), nil).Once()
+	}
+	repositoryMock.On("FindSubscriptionByID", mock.Anything, subscription.ID).Return(subscription, nil)
+	repositoryMock.On("RecordDeliveryAttempt", mock.Anything, mock.Anything, mock.Anything).Return(nil)
+
+	dispatcher := WebhookDispatcher{Repository: repositoryMock, Sender: &webhook.Sender{Client: receiver.Client()}, BatchSize: 2, Workers: 3}
+	claimed, delivered := dispatcher.dispatchBatch(context.Background(), 2)
+
+	assert.Equal(t, int64(2), claimed)
+	assert.Equal(t, 2, delivered)
+	assert.Len(t, received, 2)
+	repositoryMock.AssertNumberOfCalls(t, "ClaimDueDelivery", 2)
+}
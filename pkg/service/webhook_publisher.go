@@ -0,0 +1,56 @@
+package service
+
+import (
+	"context"
+
+	"github.com/mongodb/mongo-go-driver/bson/objectid"
+
+	"github.com/jcsw/go-api-learn/pkg/domain"
+	"github.com/jcsw/go-api-learn/pkg/infra/database/repository"
+	"github.com/jcsw/go-api-learn/pkg/infra/events"
+	"github.com/jcsw/go-api-learn/pkg/infra/logger"
+)
+
+// WebhookPublisher an EventPublisher that schedules the delivery of every event to the webhooks that accept it,
+// the deliveries are made by the WebhookDispatcher. An event published again is not delivered twice to a webhook
+type WebhookPublisher struct {
+	Repository repository.WebhookRepository
+}
+
+// Publish create a pending delivery of the event for each webhook whose filter matches its type
+func (publisher *WebhookPublisher) Publish(ctx context.Context, event *events.Event) error {
+	log := serviceLogger.WithContext(ctx).With(logger.Function("WebhookPublisher"), logger.String("id", event.ID), logger.String("type", event.Type))
+
+	subscriptionsEntity, err := publisher.Repository.FindSubscriptions(ctx)
+	if err != nil {
+		return err
+	}
+
+	scheduled := 0
+	for _, subscriptionEntity := range subscriptionsEntity {
+
+		if !makeSubscriptionByEntity(subscriptionEntity).Accepts(domain.EventType(event.Type)) {
+			continue
+		}
+
+		delivery := &repository.WebhookDeliveryEntity{
+			ID:             objectid.New(),
+			SubscriptionID: subscriptionEntity.ID,
+			EventID:        event.ID,
+			EventType:      event.Type,
+			Payload:        string(event.Payload),
+			Status:         string(domain.DeliveryPending),
+			NextAttemptAt:  now(),
+			CreatedAt:      now(),
+			Attempts:       []repository.WebhookAttemptEntity{},
+		}
+
+		if err := publisher.Repository.InsertDelivery(ctx, delivery); err != nil {
+			return err
+		}
+		scheduled++
+	}
+
+	log.Debug("event deliveries scheduled", logger.Int("webhooks", scheduled))
+	return nil
+}
@@ -0,0 +1,270 @@
+package service
+
+import (
+	"context"
+
+	"github.com/mongodb/mongo-go-driver/bson/objectid"
+
+	"github.com/jcsw/go-api-learn/pkg/domain"
+	"github.com/jcsw/go-api-learn/pkg/infra/database/repository"
+)
+
+var (
+	// ErrWebhookNotFound Error for a webhook that does not exist
+	ErrWebhookNotFound = domain.NewError(domain.ErrNotFound, "webhook_not_found", "Webhook not found")
+
+	// ErrDeliveryNotFound Error for a delivery that does not exist or belongs to another webhook
+	ErrDeliveryNotFound = domain.NewError(domain.ErrNotFound, "delivery_not_found", "Delivery not found")
+)
+
+// WebhookAggregate aggregate to webhook service
+type WebhookAggregate struct {
+	Repository repository.WebhookRepository
+}
+
+// DeliveryQuery define the page of the deliveries of a webhook, from the newest to the oldest
+type DeliveryQuery struct {
+	After string
+	Limit int
+}
+
+// DeliveryLog a page of the deliveries of a webhook, Next is empty when it is the last page
+type DeliveryLog struct {
+	Deliveries []*domain.WebhookDelivery
+	Next       string
+}
+
+// CreateSubscription create a webhook, it receives the events published after its creation
+func (aggregate *WebhookAggregate) CreateSubscription(ctx context.Context, subscription *domain.WebhookSubscription) (*domain.WebhookSubscription, error) {
+
+	if err := subscription.Validate(); err != nil {
+		return nil, err
+	}
+
+	subscriptionEntity := &repository.WebhookSubscriptionEntity{
+		ID:        objectid.New(),
+		URL:       subscription.URL,
+		Events:    make([]string, len(subscription.Events), len(subscription.Events)),
+		Secret:    subscription.Secret,
+		CreatedAt: now(),
+	}
+	for i, eventType := range subscription.Events {
+		subscriptionEntity.Events[i] = string(eventType)
+	}
+
+	if err := aggregate.Repository.InsertSubscription(ctx, subscriptionEntity); err != nil {
+		return nil, domain.WrapError(domain.ErrUnexpected, "webhook_registration_failed", "could not complete webhook registration", err)
+	}
+
+	return makeSubscriptionByEntity(subscriptionEntity), nil
+}
+
+// FindSubscriptions find all webhooks
+func (aggregate *WebhookAggregate) FindSubscriptions(ctx context.Context) ([]*domain.WebhookSubscription, error) {
+
+	subscriptionsEntity, err := aggregate.Repository.FindSubscriptions(ctx)
+	if err != nil {
+		return nil, domain.WrapError(domain.ErrUnexpected, "webhook_search_failed", "could not find webhooks", err)
+	}
+
+	subscriptions := make([]*domain.WebhookSubscription, len(subscriptionsEntity), len(subscriptionsEntity))
+	for i, entity := range subscriptionsEntity {
+		subscriptions[i] = makeSubscriptionByEntity(entity)
+	}
+
+	return subscriptions, nil
+}
+
+// FindSubscriptionByID find the webhook by id
+func (aggregate *WebhookAggregate) FindSubscriptionByID(ctx context.Context, subscriptionID string) (*domain.WebhookSubscription, error) {
+
+	subscriptionEntity, err := aggregate.findSubscriptionEntity(ctx, subscriptionID)
+	if err != nil {
+		return nil, err
+	}
+
+	return makeSubscriptionByEntity(subscriptionEntity), nil
+}
+
+// DeleteSubscription delete the webhook and its deliveries, the pending ones are not delivered anymore
+func (aggregate *WebhookAggregate) DeleteSubscription(ctx context.Context, subscriptionID string) error {
+
+	id, err := objectid.FromHex(subscriptionID)
+	if err != nil {
+		return ErrWebhookNotFound
+	}
+
+	deleted, err := aggregate.Repository.DeleteSubscription(ctx, id)
+	if err != nil {
+		return domain.WrapError(domain.ErrUnexpected, "webhook_delete_failed", "could not delete webhook", err)
+	}
+
+	if !deleted {
+		return ErrWebhookNotFound
+	}
+
+	return nil
+}
+
+// FindDeliveries find a page of the deliveries of the webhook with the log of their attempts
+func (aggregate *WebhookAggregate) FindDeliveries(ctx context.Context, subscriptionID string, query DeliveryQuery) (*DeliveryLog, error) {
+
+	subscriptionEntity, err := aggregate.findSubscriptionEntity(ctx, subscriptionID)
+	if err != nil {
+		return nil, err
+	}
+
+	filter, err := query.toFilter()
+	if err != nil {
+		return nil, err
+	}
+
+	pageLimit := filter.Limit
+	filter.Limit++
+
+	deliveriesEntity, err := aggregate.Repository.FindDeliveries(ctx, subscriptionEntity.ID, filter)
+	if err != nil {
+		return nil, domain.WrapError(domain.ErrUnexpected, "delivery_search_failed", "could not find deliveries", err)
+	}
+
+	deliveryLog := DeliveryLog{}
+	if int64(len(deliveriesEntity)) > pageLimit {
+		deliveriesEntity = deliveriesEntity[:pageLimit]
+		deliveryLog.Next = deliveriesEntity[pageLimit-1].ID.Hex()
+	}
+
+	deliveryLog.Deliveries = make([]*domain.WebhookDelivery, len(deliveriesEntity), len(deliveriesEntity))
+	for i, entity := range deliveriesEntity {
+		deliveryLog.Deliveries[i] = makeDeliveryByEntity(entity)
+	}
+
+	return &deliveryLog, nil
+}
+
+// ReplayDelivery deliver the event again as soon as possible, whatever the status of the delivery.
+// The attempts made so far are kept in the log and the delivery gets all its attempts again
+func (aggregate *WebhookAggregate) ReplayDelivery(ctx context.Context, subscriptionID string, deliveryID string) (*domain.WebhookDelivery, error) {
+
+	subscriptionEntity, err := aggregate.findSubscriptionEntity(ctx, subscriptionID)
+	if err != nil {
+		return nil, err
+	}
+
+	id, err := objectid.FromHex(deliveryID)
+	if err != nil {
+		return nil, ErrDeliveryNotFound
+	}
+
+	deliveryEntity, err := aggregate.Repository.FindDeliveryByID(ctx, id)
+	if err != nil {
+		return nil, domain.WrapError(domain.ErrUnexpected, "delivery_search_failed", "could not find delivery", err)
+	}
+
+	if deliveryEntity == nil || deliveryEntity.SubscriptionID != subscriptionEntity.ID {
+		return nil, ErrDeliveryNotFound
+	}
+
+	replayed, err := aggregate.Repository.ReplayDelivery(ctx, id, now())
+	if err != nil {
+		return nil, domain.WrapError(domain.ErrUnexpected, "delivery_replay_failed", "could not replay delivery", err)
+	}
+
+	if replayed == nil {
+		return nil, ErrDeliveryNotFound
+	}
+
+	return makeDeliveryByEntity(replayed), nil
+}
+
+func (aggregate *WebhookAggregate) findSubscriptionEntity(ctx context.Context, subscriptionID string) (*repository.WebhookSubscriptionEntity, error) {
+
+	id, err := objectid.FromHex(subscriptionID)
+	if err != nil {
+		return nil, ErrWebhookNotFound
+	}
+
+	subscriptionEntity, err := aggregate.Repository.FindSubscriptionByID(ctx, id)
+	if err != nil {
+		return nil, domain.WrapError(domain.ErrUnexpected, "webhook_search_failed", "could not find webhook", err)
+	}
+
+	if subscriptionEntity == nil {
+		return nil, ErrWebhookNotFound
+	}
+
+	return subscriptionEntity, nil
+}
+
+func (query DeliveryQuery) toFilter() (repository.DeliveryFilter, error) {
+
+	filter := repository.DeliveryFilter{}
+
+	if query.Limit < 0 || query.Limit > MaxPageLimit {
+		return filter, ErrInvalidLimit
+	}
+
+	filter.Limit = int64(query.Limit)
+	if filter.Limit == 0 {
+		filter.Limit = DefaultPageLimit
+	}
+
+	if query.After != "" {
+		afterID, err := objectid.FromHex(query.After)
+		if err != nil {
+			return filter, ErrInvalidCursor
+		}
+		filter.AfterID = afterID
+	}
+
+	return filter, nil
+}
+
+// makeSubscriptionByEntity make the webhook without its secret
+func makeSubscriptionByEntity(subscriptionEntity *repository.WebhookSubscriptionEntity) *domain.WebhookSubscription {
+
+	events := make([]domain.EventType, len(subscriptionEntity.Events), len(subscriptionEntity.Events))
+	for i, eventType := range subscriptionEntity.Events {
+		events[i] = domain.EventType(eventType)
+	}
+
+	return &domain.WebhookSubscription{
+		ID:        subscriptionEntity.ID.Hex(),
+		URL:       subscriptionEntity.URL,
+		Events:    events,
+		CreatedAt: subscriptionEntity.CreatedAt,
+	}
+}
+
+func makeDeliveryByEntity(deliveryEntity *repository.WebhookDeliveryEntity) *domain.WebhookDelivery {
+
+	delivery := &domain.WebhookDelivery{
+		ID:             deliveryEntity.ID.Hex(),
+		SubscriptionID: deliveryEntity.SubscriptionID.Hex(),
+		EventID:        deliveryEntity.EventID,
+		EventType:      domain.EventType(deliveryEntity.EventType),
+		Status:         domain.DeliveryStatus(deliveryEntity.Status),
+		CreatedAt:      deliveryEntity.CreatedAt,
+		Attempts:       make([]domain.DeliveryAttempt, len(deliveryEntity.Attempts), len(deliveryEntity.Attempts)),
+	}
+
+	if delivery.Status == domain.DeliveryPending {
+		nextAttemptAt := deliveryEntity.NextAttemptAt
+		delivery.NextAttemptAt = &nextAttemptAt
+	}
+
+	if !deliveryEntity.DeliveredAt.IsZero() {
+		deliveredAt := deliveryEntity.DeliveredAt
+		delivery.DeliveredAt = &deliveredAt
+	}
+
+	for i, attempt := range deliveryEntity.Attempts {
+		delivery.Attempts[i] = domain.DeliveryAttempt{
+			At:         attempt.At,
+			StatusCode: attempt.StatusCode,
+			Error:      attempt.Error,
+			DurationMs: attempt.DurationMs,
+		}
+	}
+
+	return delivery
+}
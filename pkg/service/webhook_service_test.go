@@ -0,0 +1,174 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/mongodb/mongo-go-driver/bson/objectid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+
+	"github.com/jcsw/go-api-learn/pkg/domain"
+	"github.com/jcsw/go-api-learn/pkg/infra/database/repository"
+	"github.com/jcsw/go-api-learn/pkg/infra/events"
+)
+
+func newSubscriptionEntity(events ...string) *repository.WebhookSubscriptionEntity {
+	return &repository.WebhookSubscriptionEntity{
+		ID:     objectid.New(),
+		URL:    "https://hooks.example.com/customers",
+		Events: events,
+		Secret: "0123456789abcdef",
+	}
+}
+
+func TestShouldCreateSubscriptionWithoutReturningTheSecret(t *testing.T) {
+
+	createdAt := freezeNow(t)
+
+	repositoryMock := &repository.WebhookRepositoryMock{}
+	repositoryMock.On("InsertSubscription", mock.Anything, mock.Anything).Return(nil)
+
+	aggregate := WebhookAggregate{Repository: repositoryMock}
+	subscription, err := aggregate.CreateSubscription(context.Background(), &domain.WebhookSubscription{
+		URL:    "https://hooks.example.com/customers",
+		Events: []domain.EventType{domain.CustomerCreated},
+		Secret: "0123456789abcdef",
+	})
+
+	assert.NoError(t, err)
+	assert.Equal(t, "https://hooks.example.com/customers", subscription.URL)
+	assert.Equal(t, []domain.EventType{domain.CustomerCreated}, subscription.Events)
+	assert.Equal(t, createdAt, subscription.CreatedAt)
+	assert.Empty(t, subscription.Secret)
+
+	repositoryMock.AssertCalled(t, "InsertSubscription", mock.Anything, mock.MatchedBy(func(entity *repository.WebhookSubscriptionEntity) bool {
+		return entity.ID.Hex() == subscription.ID && assert.ObjectsAreEqual(&repository.WebhookSubscriptionEntity{
+			ID:        entity.ID,
+			URL:       "https://hooks.example.com/customers",
+			Events:    []string{"CustomerCreated"},
+			Secret:    "0123456789abcdef",
+			CreatedAt: createdAt,
+		}, entity)
+	}))
+}
+
+func TestShouldNotCreateInvalidSubscription(t *testing.T) {
+
+	repositoryMock := &repository.WebhookRepositoryMock{}
+
+	aggregate := WebhookAggregate{Repository: repositoryMock}
+	_, err := aggregate.CreateSubscription(context.Background(), &domain.WebhookSubscription{URL: "ftp://hooks.example.com"})
+
+	assert.True(t, errors.Is(err, domain.ErrInvalidWebhookURL))
+	repositoryMock.AssertNotCalled(t, "InsertSubscription", mock.Anything, mock.Anything)
+}
+
+func TestShouldReturnWebhookNotFoundWhenDeletingUnknownSubscription(t *testing.T) {
+
+	id := objectid.New()
+
+	repositoryMock := &repository.WebhookRepositoryMock{}
+	repositoryMock.On("DeleteSubscription", mock.Anything, id).Return(false, nil)
+
+	aggregate := WebhookAggregate{Repository: repositoryMock}
+
+	assert.Equal(t, ErrWebhookNotFound, aggregate.DeleteSubscription(context.Background(), id.Hex()))
+	assert.Equal(t, ErrWebhookNotFound, aggregate.DeleteSubscription(context.Background(), "invalid"))
+}
+
+func TestShouldFindDeliveriesPageWithNextCursor(t *testing.T) {
+
+	subscription := newSubscriptionEntity("*")
+	deliveries := []*repository.WebhookDeliveryEntity{
+		{ID: objectid.New(), SubscriptionID: subscription.ID, Status: "delivered"},
+		{ID: objectid.New(), SubscriptionID: subscription.ID, Status: "failed"},
+		{ID: objectid.New(), SubscriptionID: subscription.ID, Status: "pending"},
+	}
+
+	repositoryMock := &repository.WebhookRepositoryMock{}
+	repositoryMock.On("FindSubscriptionByID", mock.Anything, subscription.ID).Return(subscription, nil)
+	repositoryMock.On("FindDeliveries", mock.Anything, subscription.ID, repository.DeliveryFilter{Limit: 3}).Return(deliveries, nil)
+
+	aggregate := WebhookAggregate{Repository: repositoryMock}
+	deliveryLog, err := aggregate.FindDeliveries(context.Background(), subscription.ID.Hex(), DeliveryQuery{Limit: 2})
+
+	assert.NoError(t, err)
+	assert.Len(t, deliveryLog.Deliveries, 2)
+	assert.Equal(t, deliveries[1].ID.Hex(), deliveryLog.Next)
+	assert.Equal(t, domain.DeliveryFailed, deliveryLog.Deliveries[1].Status)
+}
+
+func TestShouldReplayFailedDelivery(t *testing.T) {
+
+	replayedAt := freezeNow(t)
+	subscription := newSubscriptionEntity("*")
+	delivery := &repository.WebhookDeliveryEntity{
+		ID:             objectid.New(),
+		SubscriptionID: subscription.ID,
+		Status:         "failed",
+		Failures:       8,
+		Attempts:       []repository.WebhookAttemptEntity{{StatusCode: 500}},
+	}
+
+	repositoryMock := &repository.WebhookRepositoryMock{}
+	repositoryMock.On("FindSubscriptionByID", mock.Anything, subscription.ID).Return(subscription, nil)
+	repositoryMock.On("FindDeliveryByID", mock.Anything, delivery.ID).Return(delivery, nil)
+	repositoryMock.On("ReplayDelivery", mock.Anything, delivery.ID, replayedAt).Return(&repository.WebhookDeliveryEntity{
+		ID:             delivery.ID,
+		SubscriptionID: subscription.ID,
+		Status:         "pending",
+		NextAttemptAt:  replayedAt,
+		Attempts:       delivery.Attempts,
+	}, nil)
+
+	aggregate := WebhookAggregate{Repository: repositoryMock}
+	replayed, err := aggregate.ReplayDelivery(context.Background(), subscription.ID.Hex(), delivery.ID.Hex())
+
+	assert.NoError(t, err)
+	assert.Equal(t, domain.DeliveryPending, replayed.Status)
+	assert.Equal(t, &replayedAt, replayed.NextAttemptAt)
+	assert.Len(t, replayed.Attempts, 1)
+}
+
+func TestShouldNotReplayDeliveryOfAnotherSubscription(t *testing.T) {
+
+	subscription := newSubscriptionEntity("*")
+	delivery := &repository.WebhookDeliveryEntity{ID: objectid.New(), SubscriptionID: objectid.New(), Status: "failed"}
+
+	repositoryMock := &repository.WebhookRepositoryMock{}
+	repositoryMock.On("FindSubscriptionByID", mock.Anything, subscription.ID).Return(subscription, nil)
+	repositoryMock.On("FindDeliveryByID", mock.Anything, delivery.ID).Return(delivery, nil)
+
+	aggregate := WebhookAggregate{Repository: repositoryMock}
+	_, err := aggregate.ReplayDelivery(context.Background(), subscription.ID.Hex(), delivery.ID.Hex())
+
+	assert.Equal(t, ErrDeliveryNotFound, err)
+	repositoryMock.AssertNotCalled(t, "ReplayDelivery", mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestShouldScheduleDeliveriesOnlyForAcceptingSubscriptions(t *testing.T) {
+
+	dueAt := freezeNow(t)
+	all := newSubscriptionEntity("*")
+	created := newSubscriptionEntity("CustomerCreated")
+	deleted := newSubscriptionEntity("CustomerDeleted")
+
+	repositoryMock := &repository.WebhookRepositoryMock{}
+	repositoryMock.On("FindSubscriptions", mock.Anything).Return([]*repository.WebhookSubscriptionEntity{all, created, deleted}, nil)
+	repositoryMock.On("InsertDelivery", mock.Anything, mock.Anything).Return(nil)
+
+	publisher := WebhookPublisher{Repository: repositoryMock}
+	err := publisher.Publish(context.Background(), &events.Event{ID: "5bbb4ad8e5a8b2a1c1f6f1a1", Type: "CustomerCreated", Payload: []byte(`{}`)})
+
+	assert.NoError(t, err)
+	repositoryMock.AssertNumberOfCalls(t, "InsertDelivery", 2)
+	for _, subscription := range []*repository.WebhookSubscriptionEntity{all, created} {
+		subscriptionID := subscription.ID
+		repositoryMock.AssertCalled(t, "InsertDelivery", mock.Anything, mock.MatchedBy(func(delivery *repository.WebhookDeliveryEntity) bool {
+			return delivery.SubscriptionID == subscriptionID && delivery.EventID == "5bbb4ad8e5a8b2a1c1f6f1a1" &&
+				delivery.Status == "pending" && delivery.NextAttemptAt.Equal(dueAt) && delivery.Payload == `{}`
+		}))
+	}
+}